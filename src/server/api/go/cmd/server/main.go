@@ -20,6 +20,7 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // GetMessages validates ?tz= against the embedded tz database, independent of the image
 
 	"github.com/gin-gonic/gin"
 	"github.com/memodb-io/Acontext/internal/bootstrap"
@@ -27,6 +28,7 @@ import (
 	"github.com/memodb-io/Acontext/internal/infra/cache"
 	dbpkg "github.com/memodb-io/Acontext/internal/infra/db"
 	"github.com/memodb-io/Acontext/internal/modules/handler"
+	"github.com/memodb-io/Acontext/internal/modules/service"
 	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
 	"github.com/memodb-io/Acontext/internal/router"
 	"github.com/memodb-io/Acontext/internal/telemetry"
@@ -90,10 +92,16 @@ func main() {
 	artifactHandler := do.MustInvoke[*handler.ArtifactHandler](inj)
 	taskHandler := do.MustInvoke[*handler.TaskHandler](inj)
 	toolHandler := do.MustInvoke[*handler.ToolHandler](inj)
+	convertHandler := do.MustInvoke[*handler.ConvertHandler](inj)
+	assetHandler := do.MustInvoke[*handler.AssetHandler](inj)
+	apiKeyHandler := do.MustInvoke[*handler.APIKeyHandler](inj)
+	apiKeyService := do.MustInvoke[service.APIKeyService](inj)
+	localAssetHandler := do.MustInvoke[*handler.LocalAssetHandler](inj)
 
 	engine := router.NewRouter(router.RouterDeps{
 		Config:          cfg,
 		DB:              db,
+		Redis:           rdb,
 		Log:             log,
 		SpaceHandler:    spaceHandler,
 		BlockHandler:    blockHandler,
@@ -102,8 +110,39 @@ func main() {
 		ArtifactHandler: artifactHandler,
 		TaskHandler:     taskHandler,
 		ToolHandler:     toolHandler,
+		ConvertHandler:  convertHandler,
+		AssetHandler:    assetHandler,
+		APIKeyHandler:   apiKeyHandler,
+		APIKeyUsage:     apiKeyService,
+
+		LocalAssetHandler: localAssetHandler,
 	})
 
+	// periodically refresh the local learning status of sessions
+	syncCtx, stopSync := context.WithCancel(context.Background())
+	defer stopSync()
+	if cfg.LearningStatus.SyncIntervalSec > 0 {
+		go runLearningStatusSync(syncCtx, do.MustInvoke[service.SessionService](inj), time.Duration(cfg.LearningStatus.SyncIntervalSec)*time.Second, log)
+	}
+
+	// give the messages stored before search text was indexed their search text, so that search matches them
+	go backfillSearchText(syncCtx, do.MustInvoke[service.SessionService](inj), log)
+
+	// periodically purge orphaned assets
+	if cfg.Asset.GCIntervalSec > 0 {
+		go runAssetGC(syncCtx, do.MustInvoke[service.AssetService](inj), time.Duration(cfg.Asset.GCIntervalSec)*time.Second, log)
+	}
+
+	// periodically write the last use of API keys
+	if cfg.APIKey.LastUsedFlushSec > 0 {
+		go runAPIKeyUsageFlush(syncCtx, apiKeyService, time.Duration(cfg.APIKey.LastUsedFlushSec)*time.Second, log)
+	}
+
+	// periodically publish the outbox RabbitMQ messages that are not published yet
+	if cfg.RabbitMQ.RetryIntervalSec > 0 {
+		go runMQRetry(syncCtx, do.MustInvoke[service.MQOutboxService](inj), time.Duration(cfg.RabbitMQ.RetryIntervalSec)*time.Second, log)
+	}
+
 	addr := fmt.Sprintf("%s:%d", cfg.App.Host, cfg.App.Port)
 	srv := &http.Server{Addr: addr, Handler: engine}
 
@@ -126,5 +165,99 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Sugar().Errorw("server shutdown", "err", err)
 	}
+	if _, err := apiKeyService.FlushLastUsed(ctx); err != nil {
+		log.Sugar().Warnw("failed to write the last use of API keys", "err", err)
+	}
 	log.Sugar().Info("server exited")
 }
+
+// runLearningStatusSync syncs the session learning status on every tick until ctx is cancelled
+func runLearningStatusSync(ctx context.Context, svc service.SessionService, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := svc.SyncLearningStatus(ctx)
+			if err != nil {
+				log.Sugar().Warnw("failed to sync learning status", "err", err)
+				continue
+			}
+			if n > 0 {
+				log.Sugar().Debugw("synced learning status", "sessions", n)
+			}
+		}
+	}
+}
+
+// backfillSearchText computes the search text of the messages stored without one, once at startup
+func backfillSearchText(ctx context.Context, svc service.SessionService, log *zap.Logger) {
+	n, err := svc.BackfillSearchText(ctx)
+	if err != nil {
+		log.Sugar().Warnw("failed to backfill message search text", "messages", n, "err", err)
+		return
+	}
+	if n > 0 {
+		log.Sugar().Infow("backfilled message search text", "messages", n)
+	}
+}
+
+// runAssetGC purges orphaned assets on every tick until ctx is cancelled
+func runAssetGC(ctx context.Context, svc service.AssetService, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			out, err := svc.GC(ctx)
+			if err != nil {
+				log.Sugar().Warnw("failed to purge orphaned assets", "err", err)
+				continue
+			}
+			if out.PurgedAssets > 0 || out.FailedAssets > 0 || out.UntrackedObjects > 0 {
+				log.Sugar().Infow("purged orphaned assets", "purged", out.PurgedAssets, "failed", out.FailedAssets, "untracked", out.UntrackedObjects)
+			}
+		}
+	}
+}
+
+// runAPIKeyUsageFlush writes the last use of API keys on every tick until ctx is cancelled
+func runAPIKeyUsageFlush(ctx context.Context, svc service.APIKeyService, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := svc.FlushLastUsed(ctx); err != nil {
+				log.Sugar().Warnw("failed to write the last use of API keys", "err", err)
+			}
+		}
+	}
+}
+
+// runMQRetry publishes the outbox RabbitMQ messages that are not published yet on every tick until ctx is cancelled
+func runMQRetry(ctx context.Context, svc service.MQOutboxService, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			out, err := svc.RetryPending(ctx)
+			if err != nil {
+				log.Sugar().Warnw("failed to retry pending mq events", "err", err)
+				continue
+			}
+			if out.Published > 0 || out.Failed > 0 || out.Dead > 0 {
+				log.Sugar().Infow("retried pending mq events", "published", out.Published, "failed", out.Failed, "dead", out.Dead)
+			}
+		}
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"github.com/memodb-io/Acontext/internal/infra/httpclient"
 	"github.com/memodb-io/Acontext/internal/infra/logger"
 	mq "github.com/memodb-io/Acontext/internal/infra/queue"
+	"github.com/memodb-io/Acontext/internal/infra/scanner"
+	"github.com/memodb-io/Acontext/internal/infra/webhook"
 	"github.com/memodb-io/Acontext/internal/modules/handler"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/repo"
@@ -42,7 +44,9 @@ func BuildContainer() *do.Injector {
 	do.Provide(inj, func(i *do.Injector) (*gorm.DB, error) {
 		cfg := do.MustInvoke[*config.Config](i)
 		log := do.MustInvoke[*zap.Logger](i)
-		d, err := db.New(cfg)
+		d, err := connectWithRetry(cfg.Startup, log, "database", func() (*gorm.DB, error) {
+			return db.New(cfg)
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -62,7 +66,10 @@ func BuildContainer() *do.Injector {
 				&model.ToolSOP{},
 				&model.ExperienceConfirmation{},
 				&model.Metric{},
+				&model.APIKey{},
+				&model.PendingMQEvent{},
 			)
+			EnsureMessageSearchIndex(context.Background(), d, log)
 		}
 
 		// ensure default project exists
@@ -76,30 +83,36 @@ func BuildContainer() *do.Injector {
 	// Redis
 	do.Provide(inj, func(i *do.Injector) (*redis.Client, error) {
 		cfg := do.MustInvoke[*config.Config](i)
-		return cache.New(cfg)
+		log := do.MustInvoke[*zap.Logger](i)
+		return connectWithRetry(cfg.Startup, log, "redis", func() (*redis.Client, error) {
+			return cache.New(cfg, log)
+		})
 	})
 
 	// RabbitMQ Connection
 	do.Provide(inj, func(i *do.Injector) (*amqp.Connection, error) {
 		cfg := do.MustInvoke[*config.Config](i)
+		log := do.MustInvoke[*zap.Logger](i)
 
 		// Check if TLS is enabled via config or URL protocol
 		useTLS := cfg.RabbitMQ.EnableTLS || strings.HasPrefix(cfg.RabbitMQ.URL, "amqps://")
 
-		if useTLS {
-			// Use TLS configuration with minimum TLS 1.2
-			tlsConfig := &tls.Config{
-				MinVersion: tls.VersionTLS12,
-			}
-			// Convert amqp:// to amqps:// if needed
-			url := cfg.RabbitMQ.URL
-			if strings.HasPrefix(url, "amqp://") {
-				url = strings.Replace(url, "amqp://", "amqps://", 1)
+		return connectWithRetry(cfg.Startup, log, "rabbitmq", func() (*amqp.Connection, error) {
+			if useTLS {
+				// Use TLS configuration with minimum TLS 1.2
+				tlsConfig := &tls.Config{
+					MinVersion: tls.VersionTLS12,
+				}
+				// Convert amqp:// to amqps:// if needed
+				url := cfg.RabbitMQ.URL
+				if strings.HasPrefix(url, "amqp://") {
+					url = strings.Replace(url, "amqp://", "amqps://", 1)
+				}
+				return amqp.DialTLS(url, tlsConfig)
 			}
-			return amqp.DialTLS(url, tlsConfig)
-		}
 
-		return amqp.Dial(cfg.RabbitMQ.URL)
+			return amqp.Dial(cfg.RabbitMQ.URL)
+		})
 	})
 
 	// RabbitMQ Publisher
@@ -110,10 +123,13 @@ func BuildContainer() *do.Injector {
 		return mq.NewPublisher(conn, log, cfg)
 	})
 
-	// S3
-	do.Provide(inj, func(i *do.Injector) (*blob.S3Deps, error) {
+	// Object storage, S3, GCS or local files
+	do.Provide(inj, func(i *do.Injector) (blob.Store, error) {
 		cfg := do.MustInvoke[*config.Config](i)
-		return blob.NewS3(context.Background(), cfg)
+		log := do.MustInvoke[*zap.Logger](i)
+		return connectWithRetry(cfg.Startup, log, "object storage", func() (blob.Store, error) {
+			return blob.NewStore(context.Background(), cfg)
+		})
 	})
 	// get presign expire duration
 	do.Provide(inj, func(i *do.Injector) (func() time.Duration, error) {
@@ -133,11 +149,25 @@ func BuildContainer() *do.Injector {
 		return httpclient.NewCoreClient(cfg, log), nil
 	})
 
+	// Webhook Sender (nil if not configured)
+	do.Provide(inj, func(i *do.Injector) (*webhook.Sender, error) {
+		cfg := do.MustInvoke[*config.Config](i)
+		log := do.MustInvoke[*zap.Logger](i)
+		return webhook.NewSender(cfg, log), nil
+	})
+
+	// Malware scanner (nil if not configured)
+	do.Provide(inj, func(i *do.Injector) (*scanner.Scanner, error) {
+		cfg := do.MustInvoke[*config.Config](i)
+		log := do.MustInvoke[*zap.Logger](i)
+		return scanner.NewScanner(cfg, log), nil
+	})
+
 	// Repo
 	do.Provide(inj, func(i *do.Injector) (repo.AssetReferenceRepo, error) {
 		return repo.NewAssetReferenceRepo(
 			do.MustInvoke[*gorm.DB](i),
-			do.MustInvoke[*blob.S3Deps](i),
+			do.MustInvoke[blob.Store](i),
 		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (repo.SpaceRepo, error) {
@@ -147,7 +177,7 @@ func BuildContainer() *do.Injector {
 		return repo.NewSessionRepo(
 			do.MustInvoke[*gorm.DB](i),
 			do.MustInvoke[repo.AssetReferenceRepo](i),
-			do.MustInvoke[*blob.S3Deps](i),
+			do.MustInvoke[blob.Store](i),
 			do.MustInvoke[*zap.Logger](i),
 		), nil
 	})
@@ -169,6 +199,12 @@ func BuildContainer() *do.Injector {
 	do.Provide(inj, func(i *do.Injector) (repo.TaskRepo, error) {
 		return repo.NewTaskRepo(do.MustInvoke[*gorm.DB](i)), nil
 	})
+	do.Provide(inj, func(i *do.Injector) (repo.PendingMQEventRepo, error) {
+		return repo.NewPendingMQEventRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (repo.APIKeyRepo, error) {
+		return repo.NewAPIKeyRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
 
 	// Service
 	do.Provide(inj, func(i *do.Injector) (service.SpaceService, error) {
@@ -179,15 +215,25 @@ func BuildContainer() *do.Injector {
 			do.MustInvoke[*zap.Logger](i),
 		), nil
 	})
+	do.Provide(inj, func(i *do.Injector) (service.MQOutboxService, error) {
+		return service.NewMQOutboxService(
+			do.MustInvoke[*mq.Publisher](i),
+			do.MustInvoke[repo.PendingMQEventRepo](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
+		), nil
+	})
 	do.Provide(inj, func(i *do.Injector) (service.SessionService, error) {
 		return service.NewSessionService(
 			do.MustInvoke[repo.SessionRepo](i),
 			do.MustInvoke[repo.AssetReferenceRepo](i),
 			do.MustInvoke[*zap.Logger](i),
-			do.MustInvoke[*blob.S3Deps](i),
-			do.MustInvoke[*mq.Publisher](i),
+			do.MustInvoke[blob.Store](i),
+			do.MustInvoke[service.MQOutboxService](i),
 			do.MustInvoke[*config.Config](i),
 			do.MustInvoke[*redis.Client](i),
+			do.MustInvoke[*webhook.Sender](i),
+			do.MustInvoke[*scanner.Scanner](i),
 		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (service.BlockService, error) {
@@ -199,7 +245,15 @@ func BuildContainer() *do.Injector {
 	do.Provide(inj, func(i *do.Injector) (service.ArtifactService, error) {
 		return service.NewArtifactService(
 			do.MustInvoke[repo.ArtifactRepo](i),
-			do.MustInvoke[*blob.S3Deps](i),
+			do.MustInvoke[blob.Store](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.AssetService, error) {
+		return service.NewAssetService(
+			do.MustInvoke[repo.AssetReferenceRepo](i),
+			do.MustInvoke[blob.Store](i),
+			do.MustInvoke[*config.Config](i),
+			do.MustInvoke[*zap.Logger](i),
 		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (service.TaskService, error) {
@@ -208,6 +262,12 @@ func BuildContainer() *do.Injector {
 			do.MustInvoke[*zap.Logger](i),
 		), nil
 	})
+	do.Provide(inj, func(i *do.Injector) (service.APIKeyService, error) {
+		return service.NewAPIKeyService(
+			do.MustInvoke[repo.APIKeyRepo](i),
+			do.MustInvoke[*config.Config](i),
+		), nil
+	})
 
 	// Handler
 	do.Provide(inj, func(i *do.Injector) (*handler.SpaceHandler, error) {
@@ -220,6 +280,7 @@ func BuildContainer() *do.Injector {
 		return handler.NewSessionHandler(
 			do.MustInvoke[service.SessionService](i),
 			do.MustInvoke[*httpclient.CoreClient](i),
+			do.MustInvoke[*config.Config](i),
 		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (*handler.BlockHandler, error) {
@@ -243,5 +304,20 @@ func BuildContainer() *do.Injector {
 	do.Provide(inj, func(i *do.Injector) (*handler.ToolHandler, error) {
 		return handler.NewToolHandler(do.MustInvoke[*httpclient.CoreClient](i)), nil
 	})
+	do.Provide(inj, func(i *do.Injector) (*handler.AssetHandler, error) {
+		return handler.NewAssetHandler(
+			do.MustInvoke[service.AssetService](i),
+			do.MustInvoke[*config.Config](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.LocalAssetHandler, error) {
+		return handler.NewLocalAssetHandler(do.MustInvoke[blob.Store](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.APIKeyHandler, error) {
+		return handler.NewAPIKeyHandler(do.MustInvoke[service.APIKeyService](i)), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (*handler.ConvertHandler, error) {
+		return handler.NewConvertHandler(do.MustInvoke[*config.Config](i)), nil
+	})
 	return inj
 }
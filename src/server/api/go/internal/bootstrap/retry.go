@@ -0,0 +1,38 @@
+package bootstrap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"go.uber.org/zap"
+)
+
+// connectWithRetry calls connect until it succeeds, so the server waits for a dependency that is still
+// starting (e.g. brought up at the same time by compose or k8s) instead of exiting. The wait before
+// each retry starts at ConnectBackoffMs and doubles up to ConnectMaxBackoffMs, for up to ConnectAttempts.
+func connectWithRetry[T any](cfg config.StartupCfg, log *zap.Logger, name string, connect func() (T, error)) (T, error) {
+	backoff := time.Duration(cfg.ConnectBackoffMs) * time.Millisecond
+	maxBackoff := time.Duration(cfg.ConnectMaxBackoffMs) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		v, err := connect()
+		if err == nil {
+			return v, nil
+		}
+		if attempt >= cfg.ConnectAttempts {
+			return v, fmt.Errorf("connect to %s after %d attempts: %w", name, attempt, err)
+		}
+
+		log.Warn("dependency not ready, retrying",
+			zap.String("dependency", name),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if maxBackoff > 0 && backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
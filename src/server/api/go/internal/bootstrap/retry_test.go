@@ -0,0 +1,50 @@
+package bootstrap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestConnectWithRetry(t *testing.T) {
+	errDown := errors.New("connection refused")
+	cfg := config.StartupCfg{ConnectAttempts: 3, ConnectBackoffMs: 1, ConnectMaxBackoffMs: 2}
+
+	t.Run("succeeds once the dependency is up", func(t *testing.T) {
+		calls := 0
+		v, err := connectWithRetry(cfg, zap.NewNop(), "db", func() (string, error) {
+			calls++
+			if calls < 3 {
+				return "", errDown
+			}
+			return "conn", nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "conn", v)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("gives up after the configured attempts", func(t *testing.T) {
+		calls := 0
+		_, err := connectWithRetry(cfg, zap.NewNop(), "db", func() (string, error) {
+			calls++
+			return "", errDown
+		})
+		assert.ErrorIs(t, err, errDown)
+		assert.ErrorContains(t, err, "connect to db after 3 attempts")
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("retries are disabled below 2 attempts", func(t *testing.T) {
+		calls := 0
+		_, err := connectWithRetry(config.StartupCfg{}, zap.NewNop(), "db", func() (string, error) {
+			calls++
+			return "", errDown
+		})
+		assert.ErrorIs(t, err, errDown)
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,24 @@
+package bootstrap
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// EnsureMessageSearchIndex creates the trigram index message search matches messages.search_text with.
+// Search still works without it, so a failure, e.g. when pg_trgm cannot be installed, is only logged.
+// Trigrams need 3 characters, so queries shorter than that scan the messages of the project either way.
+func EnsureMessageSearchIndex(ctx context.Context, db *gorm.DB, log *zap.Logger) {
+	stmts := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_messages_search_text ON messages USING gin (search_text gin_trgm_ops)",
+	}
+	for _, stmt := range stmts {
+		if err := db.WithContext(ctx).Exec(stmt).Error; err != nil {
+			log.Warn("failed to create the message search index", zap.Error(err))
+			return
+		}
+	}
+}
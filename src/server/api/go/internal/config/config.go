@@ -15,6 +15,8 @@ type AppCfg struct {
 	Env  string
 	Host string
 	Port int
+
+	StrictQueryParams bool // Reject requests with query parameters the endpoint doesn't recognize
 }
 
 type RootCfg struct {
@@ -23,6 +25,21 @@ type RootCfg struct {
 	SecretPepper             string
 }
 
+type InternalCfg struct {
+	Token string // Bearer token of the /internal routes, empty leaves them unavailable
+}
+
+type APIKeyCfg struct {
+	RotationOverlapSec int // The previous secret of a rotated API key stays valid for this long
+	LastUsedFlushSec   int // Interval of the last_used_at writes, usage is buffered in memory in between
+}
+
+type StartupCfg struct {
+	ConnectAttempts     int // Attempts to connect to each dependency on startup, values below 2 disable retries
+	ConnectBackoffMs    int // Wait before the first retry, doubled on every retry
+	ConnectMaxBackoffMs int // Cap of the wait between retries, <= 0 disables the cap
+}
+
 type LogCfg struct {
 	Level string
 }
@@ -41,6 +58,11 @@ type RedisCfg struct {
 	DB        int
 	PoolSize  int
 	EnableTLS bool
+
+	PartsCacheTTLSec int // TTL of cached message parts, <= 0 falls back to 1 hour
+
+	BreakerFailures    int // Consecutive connection failures after which Redis calls are skipped, 0 disables the breaker
+	BreakerCooldownSec int // How long Redis calls are skipped before one probes Redis again
 }
 
 type MQExchangeName struct {
@@ -57,6 +79,13 @@ type MQCfg struct {
 	EnableTLS    bool
 	ExchangeName MQExchangeName
 	RoutingKey   MQRoutingKey
+
+	// Messages are published through the pending_mq_events outbox, the ones not published yet are retried every RetryIntervalSec, <= 0 disables retries
+	RetryIntervalSec   int
+	RetryBatchSize     int
+	RetryBackoffSec    int // Wait before the first retry, doubled on every retry up to RetryMaxBackoffSec
+	RetryMaxBackoffSec int
+	RetryMaxAttempts   int // Messages are marked dead and no longer retried after this many attempts, 0 retries forever
 }
 
 type S3Cfg struct {
@@ -68,11 +97,35 @@ type S3Cfg struct {
 	Bucket           string
 	UsePathStyle     bool
 	PresignExpireSec int
-	SSE              string
+	// Hard ceiling of the lifetime of presigned urls, capping the expiry a request asks for, 0 disables it
+	PresignMaxExpireSec int
+	SSE                 string
+}
+
+type StorageCfg struct {
+	Backend string // Object storage backend: s3 (default), gcs or local
+}
+
+type GCSCfg struct {
+	Bucket          string
+	CredentialsFile string // Service account key file, application default credentials are used when empty
+}
+
+type LocalStorageCfg struct {
+	DevMode bool   // Must be set to use the local backend, which is meant for development only
+	Dir     string // Directory objects are written under
+	BaseURL string // Base URL of this server in presigned URLs, http://127.0.0.1:<app.port> when empty
+	Secret  string // HMAC-SHA256 signing secret of presigned URLs, random per process when empty
 }
 
 type CoreCfg struct {
-	BaseURL string
+	BaseURL        string
+	TimeoutSec     int  // Timeout of a single request attempt
+	MaxAttempts    int  // Max attempts of idempotent GET calls, 1 disables retries
+	RetryBackoffMs int  // Initial retry backoff, doubled on every retry
+	DebugResponses bool // Allow search endpoints to return Core's raw response for debugging
+	// Concurrent Core calls of batch endpoints, also read from core.flushConcurrency
+	BatchConcurrency int
 }
 
 type TelemetryCfg struct {
@@ -85,24 +138,149 @@ type ArtifactCfg struct {
 	MaxUploadSizeBytes int64 // Maximum file upload size in bytes
 }
 
+type AssetCfg struct {
+	SanitizeFilenames bool // Strip directories and control characters from the filenames of uploaded message files
+	MaxFilenameBytes  int  // Longer filenames are truncated, keeping the extension, when sanitizing
+	GCIntervalSec     int  // Interval of the orphaned asset purge, 0 disables the periodic run
+	GCMinAgeHours     int  // Only purge or report assets untouched for this long, leaving in-flight uploads alone
+	UploadConcurrency int  // Files of a multipart message uploaded at once, values below 2 upload them one by one
+}
+
+type SpaceCfg struct {
+	MaxPerProject int // Creating a space beyond this count in a project is rejected with 409, 0 means unlimited
+}
+
+type MultipartCfg struct {
+	MaxMemoryBytes int64 // Multipart parts beyond this are buffered to temp files
+	MaxBodyBytes   int64 // Larger multipart requests are rejected with 413 while streaming, 0 disables the limit. Store message requests are also capped by Message.MaxBodyBytes, the smaller applies
+}
+
+type MessageCfg struct {
+	MaxBodyBytes       int64 // Larger store message requests are rejected with 413, 0 disables the limit
+	MaxParts           int   // Max content parts and tool calls of a single message, 0 disables the limit
+	MaxInlineDataBytes int   // Max size of a single base64 payload inlined in a message, 0 disables the limit
+
+	RejectUnreferencedFiles bool // Reject multipart uploads with files no part references instead of warning
+
+	PreserveOpenAIContentArray bool // Convert OpenAI assistant content arrays back as arrays instead of a joined string
+}
+
+type MetricsCfg struct {
+	Enabled bool   // Expose Prometheus metrics on /metrics
+	Token   string // Bearer token required on /metrics, empty leaves it unavailable
+}
+
+type CompressionCfg struct {
+	Enabled      bool
+	MinSizeBytes int // Responses below this size are sent uncompressed
+	Level        int // gzip/deflate level 1-9, -1 for the default level
+}
+
+type CORSCfg struct {
+	AllowedOrigins   []string // Origins allowed to call the API, "*" for any. Empty allows localhost outside of release mode
+	AllowedMethods   []string
+	AllowedHeaders   []string // Empty allows the headers a preflight request asks for
+	ExposedHeaders   []string // Response headers readable by browser clients
+	AllowCredentials bool
+	MaxAgeSec        int // How long browsers cache a preflight response
+}
+
+type LearningStatusCfg struct {
+	SyncIntervalSec int // Interval of the local learning status sync, 0 disables it
+	MaxWaitSec      int // Cap of the timeout of a learning status wait, so that connections aren't held for long
+	WaitPollMs      int // Interval between the Core calls of a learning status wait
+}
+
+type ConcurrencyCfg struct {
+	MaxWaitMs int            // How long a request waits for a free slot before being rejected
+	Routes    map[string]int // Max in-flight requests keyed by "METHOD /full/route/path"
+}
+
+type RateLimitCfg struct {
+	Enabled        bool
+	RequestsPerSec float64 // Sustained requests per second of a project, projects can override it in their configs
+	Burst          int     // Requests a project can send at once, defaults to RequestsPerSec rounded up
+}
+
+type QuotaCfg struct {
+	MaxMessages      int64 // Messages a project can store, 0 is unlimited, projects can override it in their configs
+	MaxAssetBytes    int64 // Total size of the assets a project can store, 0 is unlimited, projects can override it in their configs
+	UsageCacheTTLSec int   // How long the usage of a project is cached in Redis before being counted again
+}
+
+type WebhookCfg struct {
+	URL        string // Endpoint receiving new message events, empty disables the webhook
+	Secret     string // HMAC-SHA256 signing secret
+	MaxRetries int
+	BackoffMs  int // Initial retry backoff, doubled on every retry
+	TimeoutSec int
+}
+
+type ScanCfg struct {
+	URL        string // Malware scanner receiving uploaded message files, empty disables scanning
+	Secret     string // HMAC-SHA256 signing secret, also verifies scan results posted back, which are refused without it
+	MaxRetries int
+	BackoffMs  int // Initial retry backoff, doubled on every retry
+	TimeoutSec int
+}
+
+type PricingCfg struct {
+	Currency string
+	Models   []ModelPriceCfg // Models a session cost can be estimated for
+}
+
+// ModelPriceCfg is a list entry rather than a map value, as viper would split model names like gpt-4.1 on the dot
+type ModelPriceCfg struct {
+	Name          string
+	InputPerMTok  float64 // Price of a million input tokens
+	OutputPerMTok float64 // Price of a million output tokens
+}
+
 type Config struct {
-	App       AppCfg
-	Root      RootCfg
-	Log       LogCfg
-	Database  DBCfg
-	Redis     RedisCfg
-	RabbitMQ  MQCfg
-	S3        S3Cfg
-	Core      CoreCfg
-	Telemetry TelemetryCfg
-	Artifact  ArtifactCfg
+	App          AppCfg
+	Root         RootCfg
+	Internal     InternalCfg
+	APIKey       APIKeyCfg
+	Log          LogCfg
+	Startup      StartupCfg
+	Database     DBCfg
+	Redis        RedisCfg
+	RabbitMQ     MQCfg
+	Storage      StorageCfg
+	S3           S3Cfg
+	GCS          GCSCfg
+	LocalStorage LocalStorageCfg
+	Core         CoreCfg
+	Telemetry    TelemetryCfg
+	Artifact     ArtifactCfg
+	Asset        AssetCfg
+	Space        SpaceCfg
+	Multipart    MultipartCfg
+	Message      MessageCfg
+	Metrics      MetricsCfg
+
+	Compression    CompressionCfg
+	CORS           CORSCfg
+	LearningStatus LearningStatusCfg
+	Concurrency    ConcurrencyCfg
+	RateLimit      RateLimitCfg
+	Quota          QuotaCfg
+	Webhook        WebhookCfg
+	Scan           ScanCfg
+	Pricing        PricingCfg
 }
 
 func setDefaults(v *viper.Viper) {
 	v.SetDefault("app.env", "debug")
 	v.SetDefault("app.port", 8029)
+	v.SetDefault("app.strictQueryParams", false)
+	v.SetDefault("startup.connectAttempts", 10)
+	v.SetDefault("startup.connectBackoffMs", 500)
+	v.SetDefault("startup.connectMaxBackoffMs", 10000)
 	v.SetDefault("root.apiBearerToken", "your-root-api-bearer-token")
 	v.SetDefault("root.projectBearerTokenPrefix", "sk-ac-")
+	v.SetDefault("apiKey.rotationOverlapSec", 3600)
+	v.SetDefault("apiKey.lastUsedFlushSec", 60)
 	v.SetDefault("database.dsn", "host=127.0.0.1 user=acontext password=helloworld dbname=acontext port=15432 sslmode=disable TimeZone=UTC")
 	v.SetDefault("database.enableTLS", false)
 	v.SetDefault("redis.addr", "127.0.0.1:16379")
@@ -110,6 +288,11 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("redis.db", 0)
 	v.SetDefault("redis.poolSize", 10)
 	v.SetDefault("redis.enableTLS", false)
+	v.SetDefault("redis.partsCacheTTLSec", 3600)
+	v.SetDefault("redis.breakerFailures", 5)
+	v.SetDefault("redis.breakerCooldownSec", 10)
+	v.SetDefault("storage.backend", "s3")
+	v.SetDefault("localStorage.dir", "./data/blobs")
 	v.SetDefault("s3.endpoint", "http://127.0.0.1:19000")
 	v.SetDefault("s3.internalEndpoint", "http://127.0.0.1:19000")
 	v.SetDefault("s3.region", "auto")
@@ -120,11 +303,80 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("rabbitmq.enableTLS", false)
 	v.SetDefault("rabbitmq.exchangeName.sessionMessage", "session.message")
 	v.SetDefault("rabbitmq.routingKey.sessionMessageInsert", "session.message.insert")
+	v.SetDefault("rabbitmq.retryIntervalSec", 10)
+	v.SetDefault("rabbitmq.retryBatchSize", 100)
+	v.SetDefault("rabbitmq.retryBackoffSec", 5)
+	v.SetDefault("rabbitmq.retryMaxBackoffSec", 600)
+	v.SetDefault("rabbitmq.retryMaxAttempts", 20)
 	v.SetDefault("core.baseURL", "http://127.0.0.1:8019")
+	v.SetDefault("core.timeoutSec", 30)
+	v.SetDefault("core.maxAttempts", 3)
+	v.SetDefault("core.retryBackoffMs", 200)
+	v.SetDefault("core.debugResponses", false)
+	v.SetDefault("core.batchConcurrency", 8)
 	v.SetDefault("telemetry.otlpEndpoint", "http://127.0.0.1:4317")
 	v.SetDefault("telemetry.enabled", true)
 	v.SetDefault("telemetry.sampleRatio", 1.0)            // Default 100% sampling
 	v.SetDefault("artifact.maxUploadSizeBytes", 16777216) // Default 16MB (16 * 1024 * 1024 bytes)
+	v.SetDefault("asset.sanitizeFilenames", true)
+	v.SetDefault("asset.maxFilenameBytes", 255)
+	v.SetDefault("asset.gcIntervalSec", 3600)
+	v.SetDefault("asset.gcMinAgeHours", 24)
+	v.SetDefault("asset.uploadConcurrency", 4)
+	v.SetDefault("space.maxPerProject", 0)
+	v.SetDefault("multipart.maxMemoryBytes", 8388608) // Default 8MB
+	v.SetDefault("multipart.maxBodyBytes", 33554432)  // Default 32MB
+	v.SetDefault("message.maxBodyBytes", 33554432)    // Default 32MB
+	v.SetDefault("message.maxParts", 1000)
+	v.SetDefault("message.maxInlineDataBytes", 20971520) // Default 20MB
+	v.SetDefault("message.rejectUnreferencedFiles", false)
+	v.SetDefault("message.preserveOpenAIContentArray", false)
+	v.SetDefault("metrics.enabled", true)
+	v.SetDefault("compression.enabled", true)
+	v.SetDefault("compression.minSizeBytes", 1024)
+	v.SetDefault("compression.level", -1)
+	v.SetDefault("cors.allowedOrigins", []string{})
+	v.SetDefault("cors.allowedMethods", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"})
+	v.SetDefault("cors.allowedHeaders", []string{"Authorization", "Content-Type", "If-None-Match", "X-Request-ID"})
+	v.SetDefault("cors.exposedHeaders", []string{"ETag", "Retry-After", "Warning", "X-Trace-Id", "X-Request-ID"})
+	v.SetDefault("cors.allowCredentials", false)
+	v.SetDefault("cors.maxAgeSec", 600)
+	v.SetDefault("learningStatus.syncIntervalSec", 30)
+	v.SetDefault("learningStatus.maxWaitSec", 60)
+	v.SetDefault("learningStatus.waitPollMs", 1000)
+	v.SetDefault("concurrency.maxWaitMs", 200)
+	v.SetDefault("rateLimit.enabled", false)
+	v.SetDefault("rateLimit.requestsPerSec", 50)
+	v.SetDefault("rateLimit.burst", 100)
+	v.SetDefault("quota.maxMessages", 0)
+	v.SetDefault("quota.maxAssetBytes", 0)
+	v.SetDefault("quota.usageCacheTTLSec", 30)
+	v.SetDefault("webhook.maxRetries", 3)
+	v.SetDefault("webhook.backoffMs", 1000)
+	v.SetDefault("webhook.timeoutSec", 10)
+	v.SetDefault("scan.maxRetries", 3)
+	v.SetDefault("scan.backoffMs", 1000)
+	v.SetDefault("scan.timeoutSec", 60)
+	v.SetDefault("pricing.currency", "USD")
+}
+
+// renamedKeys maps other names settings are known by to their key
+var renamedKeys = map[string]string{
+	"core.flushConcurrency": "core.batchConcurrency",
+}
+
+// applyRenamedKeys sets the settings given under another name, unless they are also set under their key
+// by the config file or the environment
+func applyRenamedKeys(v *viper.Viper) {
+	for name, key := range renamedKeys {
+		if !v.IsSet(name) || v.InConfig(key) {
+			continue
+		}
+		if _, ok := os.LookupEnv("APP_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))); ok {
+			continue
+		}
+		v.Set(key, v.Get(name))
+	}
 }
 
 func Load() (*Config, error) {
@@ -173,6 +425,7 @@ func Load() (*Config, error) {
 		v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 		v.SetEnvPrefix("APP")
 		setDefaults(v)
+		applyRenamedKeys(v)
 
 		cfg := new(Config)
 		if err := v.Unmarshal(&cfg); err != nil {
@@ -182,6 +435,7 @@ func Load() (*Config, error) {
 	}
 
 	// No files are also allowed, using only env + default values
+	applyRenamedKeys(base)
 	cfg := new(Config)
 	if err := base.Unmarshal(&cfg); err != nil {
 		return nil, err
@@ -0,0 +1,215 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/bytedance/sonic"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/pkg/metrics"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// GCSDeps stores objects in a Google Cloud Storage bucket
+type GCSDeps struct {
+	Client *storage.Client
+	Bucket string
+}
+
+func NewGCS(ctx context.Context, cfg *config.Config, opts ...option.ClientOption) (*GCSDeps, error) {
+	if cfg.GCS.Bucket == "" {
+		return nil, errors.New("gcs bucket is empty")
+	}
+	if cfg.GCS.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.GCS.CredentialsFile))
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create gcs client: %w", err)
+	}
+	if _, err := client.Bucket(cfg.GCS.Bucket).Attrs(ctx); err != nil {
+		return nil, fmt.Errorf("connect to gcs bucket %s: %w", cfg.GCS.Bucket, err)
+	}
+
+	return &GCSDeps{Client: client, Bucket: cfg.GCS.Bucket}, nil
+}
+
+func (g *GCSDeps) bucket() *storage.BucketHandle {
+	return g.Client.Bucket(g.Bucket)
+}
+
+// Upload uploads the content under keyPrefix, returning the object already holding content with the same
+// SHA256 under keyPrefix if there is one. Uploaded files are streamed from the multipart form.
+func (g *GCSDeps) Upload(ctx context.Context, keyPrefix string, c *Content) (*model.Asset, error) {
+	defer metrics.ObserveS3(metrics.S3Upload, time.Now())
+
+	q := &storage.Query{Prefix: keyPrefix}
+	if err := q.SetAttrSelection([]string{"Name", "Etag", "Size"}); err != nil {
+		return nil, err
+	}
+	it := g.bucket().Objects(ctx, q)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("list objects in GCS: %w", err)
+		}
+		if strings.Contains(attrs.Name, c.SHA256) {
+			return &model.Asset{
+				Bucket: g.Bucket,
+				S3Key:  attrs.Name,
+				ETag:   attrs.Etag,
+				SHA256: c.SHA256,
+				MIME:   c.ContentType,
+				SizeB:  attrs.Size,
+			}, nil
+		}
+	}
+
+	body, err := c.open()
+	if err != nil {
+		return nil, fmt.Errorf("open content: %w", err)
+	}
+	defer body.Close()
+
+	key := contentKey(keyPrefix, c.SHA256, c.Ext)
+	w := g.bucket().Object(key).NewWriter(ctx)
+	w.ContentType = c.ContentType
+	w.Metadata = c.Metadata
+	if _, err := io.Copy(w, body); err != nil {
+		_ = w.Close()
+		return nil, fmt.Errorf("upload object to GCS: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("upload object to GCS: %w", err)
+	}
+
+	return &model.Asset{
+		Bucket: g.Bucket,
+		S3Key:  key,
+		ETag:   w.Attrs().Etag,
+		SHA256: c.SHA256,
+		MIME:   c.ContentType,
+		SizeB:  c.Size,
+	}, nil
+}
+
+// UploadFormFile uploads a file to GCS with automatic deduplication, see Upload
+func (g *GCSDeps) UploadFormFile(ctx context.Context, keyPrefix string, fh *multipart.FileHeader) (*model.Asset, error) {
+	c, err := FormFileContent(fh)
+	if err != nil {
+		return nil, err
+	}
+	return g.Upload(ctx, keyPrefix, c)
+}
+
+// UploadJSON uploads JSON data to GCS and returns metadata
+func (g *GCSDeps) UploadJSON(ctx context.Context, keyPrefix string, data interface{}) (*model.Asset, error) {
+	c, err := JSONContent(data)
+	if err != nil {
+		return nil, err
+	}
+	return g.Upload(ctx, keyPrefix, c)
+}
+
+// DownloadJSON downloads JSON data from GCS and unmarshals it into the provided interface
+func (g *GCSDeps) DownloadJSON(ctx context.Context, key string, target interface{}) error {
+	data, err := g.DownloadFile(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := sonic.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("unmarshal json: %w", err)
+	}
+	return nil
+}
+
+// DownloadFile downloads file content from GCS and returns the content as bytes
+func (g *GCSDeps) DownloadFile(ctx context.Context, key string) ([]byte, error) {
+	if key == "" {
+		return nil, errors.New("key is empty")
+	}
+
+	defer metrics.ObserveS3(metrics.S3Download, time.Now())
+
+	r, err := g.bucket().Object(key).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get object from GCS: %w", err)
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, fmt.Errorf("read object body: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// PresignGet generates a signed GET URL
+func (g *GCSDeps) PresignGet(ctx context.Context, key string, expire time.Duration) (string, error) {
+	return g.PresignGetAs(ctx, key, "", expire)
+}
+
+// PresignGetAs generates a signed GET URL whose response carries contentType as Content-Type,
+// regardless of the type the object was stored with. An empty contentType keeps the stored one.
+// Signing uses the client's service account key, or the IAM signBlob API without one.
+func (g *GCSDeps) PresignGetAs(ctx context.Context, key, contentType string, expire time.Duration) (string, error) {
+	if key == "" {
+		return "", errors.New("key is empty")
+	}
+	opts := &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(expire),
+	}
+	if contentType != "" {
+		opts.QueryParameters = url.Values{"response-content-type": {contentType}}
+	}
+	return g.bucket().SignedURL(key, opts)
+}
+
+// ListObjects calls fn with the key and last modified time of every object under prefix, stopping at the first error
+func (g *GCSDeps) ListObjects(ctx context.Context, prefix string, fn func(key string, lastModified time.Time) error) error {
+	q := &storage.Query{Prefix: prefix}
+	if err := q.SetAttrSelection([]string{"Name", "Updated"}); err != nil {
+		return err
+	}
+	it := g.bucket().Objects(ctx, q)
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("list objects in GCS: %w", err)
+		}
+		if err := fn(attrs.Name, attrs.Updated); err != nil {
+			return err
+		}
+	}
+}
+
+// DeleteObject deletes an object from GCS, deleting an object that does not exist is not an error like on S3
+func (g *GCSDeps) DeleteObject(ctx context.Context, key string) error {
+	if key == "" {
+		return errors.New("key is empty")
+	}
+	if err := g.bucket().Object(key).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("delete object from GCS: %w", err)
+	}
+	return nil
+}
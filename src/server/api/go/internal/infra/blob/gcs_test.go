@@ -0,0 +1,126 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+// fakeGCS serves the parts of the GCS JSON API used by GCSDeps for a single bucket
+type fakeGCS struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads int
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/assets":
+		_, _ = io.WriteString(w, `{"name":"assets"}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/assets/o":
+		items := []map[string]string{}
+		for name, data := range f.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				items = append(items, map[string]string{
+					"name":    name,
+					"etag":    "etag-" + name,
+					"size":    fmt.Sprint(len(data)),
+					"updated": "2024-01-02T03:04:05Z",
+				})
+			}
+		}
+		_ = sonic.ConfigDefault.NewEncoder(w).Encode(map[string]any{"items": items})
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/assets/o":
+		// multipart/related: object metadata, then media
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		metaPart, _ := mr.NextPart()
+		var meta struct {
+			Name string `json:"name"`
+		}
+		_ = sonic.ConfigDefault.NewDecoder(metaPart).Decode(&meta)
+		mediaPart, _ := mr.NextPart()
+		data, _ := io.ReadAll(mediaPart)
+		f.objects[meta.Name] = data
+		f.uploads++
+		_, _ = fmt.Fprintf(w, `{"name":%q,"bucket":"assets","etag":"etag-new","size":"%d"}`, meta.Name, len(data))
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/storage/v1/b/assets/o/"):
+		name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/assets/o/")
+		if _, ok := f.objects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"error":{"code":404,"message":"Not Found"}}`)
+			return
+		}
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestGCSDeps(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeGCS{objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfg := &config.Config{GCS: config.GCSCfg{Bucket: "assets"}}
+	g, err := NewGCS(ctx, cfg, option.WithEndpoint(server.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	content, err := JSONContent(map[string]string{"hello": "world"})
+	require.NoError(t, err)
+
+	asset, err := g.Upload(ctx, "parts/p1", content)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(asset.S3Key, "parts/p1/"))
+	assert.Contains(t, asset.S3Key, content.SHA256)
+	assert.Equal(t, "assets", asset.Bucket)
+	assert.Equal(t, content.Size, asset.SizeB)
+
+	var got map[string]string
+	data := fake.objects[asset.S3Key]
+	require.NoError(t, sonic.Unmarshal(data, &got))
+	assert.Equal(t, "world", got["hello"])
+
+	// the same content is not uploaded again
+	again, err := g.Upload(ctx, "parts/p1", content)
+	require.NoError(t, err)
+	assert.Equal(t, asset.S3Key, again.S3Key)
+	assert.Equal(t, 1, fake.uploads)
+
+	var keys []string
+	require.NoError(t, g.ListObjects(ctx, "parts/", func(key string, lastModified time.Time) error {
+		keys = append(keys, key)
+		assert.False(t, lastModified.IsZero())
+		return nil
+	}))
+	assert.Equal(t, []string{asset.S3Key}, keys)
+
+	require.NoError(t, g.DeleteObject(ctx, asset.S3Key))
+	assert.Empty(t, fake.objects)
+	assert.NoError(t, g.DeleteObject(ctx, asset.S3Key), "deleting a missing object is not an error")
+}
+
+func TestNewStore_UnknownBackend(t *testing.T) {
+	_, err := NewStore(context.Background(), &config.Config{Storage: config.StorageCfg{Backend: "azure"}})
+	assert.ErrorContains(t, err, `unknown storage backend "azure"`)
+}
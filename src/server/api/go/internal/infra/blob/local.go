@@ -0,0 +1,313 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+)
+
+// LocalAssetsPath is the route LocalStore's presigned URLs are served from, followed by the object's SHA256
+const LocalAssetsPath = "/local-assets/"
+
+var (
+	// ErrInvalidToken is returned by LocalStore.Open for a token it did not sign or signed for another object
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned by LocalStore.Open for a token past its expiry
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// tmpPattern names the files uploads are written to before being renamed to their key
+const tmpPattern = ".upload-*"
+
+// LocalStore keeps objects as files under a directory, for development without an object storage service.
+// Presigned URLs point to this server's LocalAssetsPath route with an HMAC signed expiry token.
+// Object metadata is not kept.
+type LocalStore struct {
+	Dir     string
+	BaseURL string
+	secret  []byte
+}
+
+func NewLocal(cfg *config.Config) (*LocalStore, error) {
+	if !cfg.LocalStorage.DevMode {
+		return nil, errors.New("the local storage backend is for development only, set localStorage.devMode to use it")
+	}
+	if cfg.LocalStorage.Dir == "" {
+		return nil, errors.New("local storage dir is empty")
+	}
+	if err := os.MkdirAll(cfg.LocalStorage.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create local storage dir: %w", err)
+	}
+
+	baseURL := cfg.LocalStorage.BaseURL
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("http://127.0.0.1:%d", cfg.App.Port)
+	}
+
+	// without a configured secret, URLs signed before a restart stop working
+	secret := []byte(cfg.LocalStorage.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("generate local storage secret: %w", err)
+		}
+	}
+
+	return &LocalStore{Dir: cfg.LocalStorage.Dir, BaseURL: strings.TrimSuffix(baseURL, "/"), secret: secret}, nil
+}
+
+// path returns the file of key, rejecting keys that would resolve outside Dir
+func (l *LocalStore) path(key string) (string, error) {
+	if key == "" {
+		return "", errors.New("key is empty")
+	}
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
+
+// Upload writes the content under keyPrefix, returning the file already holding content with the same
+// SHA256 under keyPrefix if there is one
+func (l *LocalStore) Upload(ctx context.Context, keyPrefix string, c *Content) (*model.Asset, error) {
+	var existing *model.Asset
+	err := l.ListObjects(ctx, keyPrefix+"/", func(key string, _ time.Time) error {
+		if !strings.Contains(path.Base(key), c.SHA256) {
+			return nil
+		}
+		p, _ := l.path(key)
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		existing = &model.Asset{S3Key: key, ETag: c.SHA256, SHA256: c.SHA256, MIME: c.ContentType, SizeB: info.Size()}
+		return fs.SkipAll
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list local objects: %w", err)
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	key := contentKey(keyPrefix, c.SHA256, c.Ext)
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, fmt.Errorf("create object dir: %w", err)
+	}
+
+	body, err := c.open()
+	if err != nil {
+		return nil, fmt.Errorf("open content: %w", err)
+	}
+	defer body.Close()
+
+	// write next to the final file and rename, so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(p), tmpPattern)
+	if err != nil {
+		return nil, fmt.Errorf("create object file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		_ = tmp.Close()
+		return nil, fmt.Errorf("write object file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("write object file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return nil, fmt.Errorf("write object file: %w", err)
+	}
+
+	return &model.Asset{
+		S3Key:  key,
+		ETag:   c.SHA256,
+		SHA256: c.SHA256,
+		MIME:   c.ContentType,
+		SizeB:  c.Size,
+	}, nil
+}
+
+// UploadFormFile writes a file with automatic deduplication, see Upload
+func (l *LocalStore) UploadFormFile(ctx context.Context, keyPrefix string, fh *multipart.FileHeader) (*model.Asset, error) {
+	c, err := FormFileContent(fh)
+	if err != nil {
+		return nil, err
+	}
+	return l.Upload(ctx, keyPrefix, c)
+}
+
+// UploadJSON writes JSON data and returns metadata
+func (l *LocalStore) UploadJSON(ctx context.Context, keyPrefix string, data interface{}) (*model.Asset, error) {
+	c, err := JSONContent(data)
+	if err != nil {
+		return nil, err
+	}
+	return l.Upload(ctx, keyPrefix, c)
+}
+
+// DownloadJSON reads JSON data and unmarshals it into the provided interface
+func (l *LocalStore) DownloadJSON(ctx context.Context, key string, target interface{}) error {
+	data, err := l.DownloadFile(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := sonic.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("unmarshal json: %w", err)
+	}
+	return nil
+}
+
+// DownloadFile reads the content of an object
+func (l *LocalStore) DownloadFile(ctx context.Context, key string) ([]byte, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("read object file: %w", err)
+	}
+	return data, nil
+}
+
+// PresignGet generates a URL of the LocalAssetsPath route valid for expire
+func (l *LocalStore) PresignGet(ctx context.Context, key string, expire time.Duration) (string, error) {
+	return l.PresignGetAs(ctx, key, "", expire)
+}
+
+// PresignGetAs generates a URL of the LocalAssetsPath route valid for expire, whose response carries
+// contentType as Content-Type. An empty contentType lets the type be detected from the file.
+func (l *LocalStore) PresignGetAs(ctx context.Context, key, contentType string, expire time.Duration) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+	payload := strings.Join([]string{key, strconv.FormatInt(time.Now().Add(expire).Unix(), 10), contentType}, "\n")
+	token := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(l.sign(payload))
+	return l.BaseURL + LocalAssetsPath + objectSHA256(key) + "?" + url.Values{"token": {token}}.Encode(), nil
+}
+
+func (l *LocalStore) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// objectSHA256 is the SHA256 in a content-addressed key, the name of its file without the extension
+func objectSHA256(key string) string {
+	name := path.Base(key)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// Open verifies a token of a presigned URL for the object with the given SHA256, returning the file
+// to serve and the Content-Type it was signed with
+func (l *LocalStore) Open(sha256Hex, token string) (file, contentType string, err error) {
+	encPayload, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", "", ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encPayload)
+	if err != nil {
+		return "", "", ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encSig)
+	if err != nil || !hmac.Equal(sig, l.sign(string(payload))) {
+		return "", "", ErrInvalidToken
+	}
+
+	parts := strings.SplitN(string(payload), "\n", 3)
+	if len(parts) != 3 {
+		return "", "", ErrInvalidToken
+	}
+	key, contentType := parts[0], parts[2]
+	if objectSHA256(key) != sha256Hex {
+		return "", "", ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", "", ErrInvalidToken
+	}
+	if time.Now().Unix() > expires {
+		return "", "", ErrTokenExpired
+	}
+
+	file, err = l.path(key)
+	if err != nil {
+		return "", "", ErrInvalidToken
+	}
+	return file, contentType, nil
+}
+
+// ListObjects calls fn with the key and last modified time of every object under prefix, stopping at the first error
+func (l *LocalStore) ListObjects(ctx context.Context, prefix string, fn func(key string, lastModified time.Time) error) error {
+	// walk the deepest directory containing every key with the prefix
+	root := l.Dir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		p, err := l.path(prefix[:i])
+		if err != nil {
+			return err
+		}
+		root = p
+	}
+
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return ctx.Err()
+		}
+		if matched, _ := filepath.Match(tmpPattern, d.Name()); matched {
+			return nil
+		}
+		rel, err := filepath.Rel(l.Dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(key, info.ModTime())
+	})
+}
+
+// DeleteObject deletes an object, deleting an object that does not exist is not an error like on S3
+func (l *LocalStore) DeleteObject(ctx context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete object file: %w", err)
+	}
+	return nil
+}
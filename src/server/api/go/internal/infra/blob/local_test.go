@@ -0,0 +1,117 @@
+package blob
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLocalStore(t *testing.T) *LocalStore {
+	l, err := NewLocal(&config.Config{LocalStorage: config.LocalStorageCfg{
+		DevMode: true,
+		Dir:     t.TempDir(),
+		BaseURL: "http://localhost:8029/",
+		Secret:  "secret",
+	}})
+	require.NoError(t, err)
+	return l
+}
+
+func TestNewLocal_RequiresDevMode(t *testing.T) {
+	_, err := NewLocal(&config.Config{LocalStorage: config.LocalStorageCfg{Dir: t.TempDir()}})
+	assert.ErrorContains(t, err, "development only")
+}
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	l := newLocalStore(t)
+
+	content, err := JSONContent(map[string]string{"hello": "world"})
+	require.NoError(t, err)
+
+	asset, err := l.Upload(ctx, "parts/p1", content)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(asset.S3Key, "parts/p1/"))
+	assert.True(t, strings.HasSuffix(asset.S3Key, content.SHA256+".json"))
+	assert.Equal(t, content.Size, asset.SizeB)
+
+	var got map[string]string
+	require.NoError(t, l.DownloadJSON(ctx, asset.S3Key, &got))
+	assert.Equal(t, "world", got["hello"])
+
+	// the same content is not written again
+	again, err := l.Upload(ctx, "parts/p1", content)
+	require.NoError(t, err)
+	assert.Equal(t, asset.S3Key, again.S3Key)
+
+	var keys []string
+	require.NoError(t, l.ListObjects(ctx, "parts/", func(key string, lastModified time.Time) error {
+		keys = append(keys, key)
+		assert.False(t, lastModified.IsZero())
+		return nil
+	}))
+	assert.Equal(t, []string{asset.S3Key}, keys)
+
+	require.NoError(t, l.ListObjects(ctx, "parts/p2", func(key string, _ time.Time) error {
+		t.Errorf("unexpected key %s", key)
+		return nil
+	}))
+
+	require.NoError(t, l.DeleteObject(ctx, asset.S3Key))
+	_, err = os.Stat(filepath.Join(l.Dir, filepath.FromSlash(asset.S3Key)))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NoError(t, l.DeleteObject(ctx, asset.S3Key), "deleting a missing object is not an error")
+}
+
+func TestLocalStore_RejectsKeysOutsideDir(t *testing.T) {
+	l := newLocalStore(t)
+	_, err := l.DownloadFile(context.Background(), "../secret.json")
+	assert.ErrorContains(t, err, "invalid key")
+}
+
+func TestLocalStore_PresignedURL(t *testing.T) {
+	ctx := context.Background()
+	l := newLocalStore(t)
+	sha := strings.Repeat("a", 64)
+	key := "assets/p1/2024/01/02/" + sha + ".png"
+
+	token := func(t *testing.T, rawURL string) string {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		assert.Equal(t, "/local-assets/"+sha, u.Path)
+		return u.Query().Get("token")
+	}
+
+	signed, err := l.PresignGetAs(ctx, key, "image/png", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(signed, "http://localhost:8029/local-assets/"))
+
+	file, contentType, err := l.Open(sha, token(t, signed))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(l.Dir, filepath.FromSlash(key)), file)
+	assert.Equal(t, "image/png", contentType)
+
+	_, _, err = l.Open(strings.Repeat("b", 64), token(t, signed))
+	assert.ErrorIs(t, err, ErrInvalidToken, "a token only opens the object it was signed for")
+
+	_, _, err = l.Open(sha, token(t, signed)+"x")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	other := newLocalStore(t)
+	other.secret = []byte("other")
+	_, _, err = other.Open(sha, token(t, signed))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	expired, err := l.PresignGet(ctx, key, -time.Minute)
+	require.NoError(t, err)
+	_, _, err = l.Open(sha, token(t, expired))
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
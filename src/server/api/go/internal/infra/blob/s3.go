@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net/http"
 	"net/url"
 	"path/filepath"
 	"strings"
@@ -23,6 +24,7 @@ import (
 	"github.com/bytedance/sonic"
 	"github.com/memodb-io/Acontext/internal/config"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/pkg/metrics"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 	"go.opentelemetry.io/otel"
 )
@@ -147,13 +149,23 @@ func (s *S3Deps) PresignPut(ctx context.Context, key, contentType string, expire
 
 // Generate a pre-signed GET URL
 func (s *S3Deps) PresignGet(ctx context.Context, key string, expire time.Duration) (string, error) {
+	return s.PresignGetAs(ctx, key, "", expire)
+}
+
+// PresignGetAs generates a pre-signed GET URL whose response carries contentType as Content-Type,
+// regardless of the type the object was stored with. An empty contentType keeps the stored one.
+func (s *S3Deps) PresignGetAs(ctx context.Context, key, contentType string, expire time.Duration) (string, error) {
 	if key == "" {
 		return "", errors.New("key is empty")
 	}
-	ps, err := s.Presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+	input := &s3.GetObjectInput{
 		Bucket: &s.Bucket,
 		Key:    &key,
-	}, func(po *s3.PresignOptions) {
+	}
+	if contentType != "" {
+		input.ResponseContentType = aws.String(contentType)
+	}
+	ps, err := s.Presigner.PresignGetObject(ctx, input, func(po *s3.PresignOptions) {
 		po.Expires = expire
 	})
 	if err != nil {
@@ -184,6 +196,8 @@ func (u *S3Deps) uploadWithDedup(
 	body io.Reader,
 	metadata map[string]string,
 ) (*model.Asset, error) {
+	defer metrics.ObserveS3(metrics.S3Upload, time.Now())
+
 	// Check for existing object with pagination support
 	listInput := &s3.ListObjectsV2Input{
 		Bucket: &u.Bucket,
@@ -226,8 +240,7 @@ func (u *S3Deps) uploadWithDedup(
 	}
 
 	// No existing file found, upload new file with date prefix
-	datePrefix := time.Now().UTC().Format("2006/01/02")
-	key := fmt.Sprintf("%s/%s/%s%s", keyPrefix, datePrefix, sumHex, ext)
+	key := contentKey(keyPrefix, sumHex, ext)
 
 	input := &s3.PutObjectInput{
 		Bucket:      aws.String(u.Bucket),
@@ -255,48 +268,79 @@ func (u *S3Deps) uploadWithDedup(
 	}, nil
 }
 
-// UploadFormFile uploads a file to S3 with automatic deduplication
-// It checks if a file with the same SHA256 already exists under the keyPrefix
-// If found, returns the existing file metadata; otherwise uploads the new file
-func (u *S3Deps) UploadFormFile(ctx context.Context, keyPrefix string, fh *multipart.FileHeader) (*model.Asset, error) {
+// Content is a blob ready to be uploaded, hashed so callers can look it up before uploading it
+type Content struct {
+	SHA256      string
+	ContentType string
+	Ext         string
+	Size        int64
+	Metadata    map[string]string
+
+	// open returns a reader of the content, it is read again on every upload
+	open func() (io.ReadCloser, error)
+}
+
+// openBytes returns an open func of Content reading body from memory
+func openBytes(body []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+}
+
+// sniffLen is the number of leading bytes DetectContentType looks at
+const sniffLen = 512
+
+// FormFileContent hashes an uploaded file without holding it in memory, it is streamed again from the
+// multipart form when uploaded. Its content type is sniffed from the first 512 bytes, the type declared
+// by the client is only kept when the content is not recognized.
+func FormFileContent(fh *multipart.FileHeader) (*Content, error) {
 	file, err := fh.Open()
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	// Read file content into memory
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, file); err != nil {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
 		return nil, err
 	}
-	fileContent := buf.Bytes()
+	head = head[:n]
 
 	// Calculate SHA256 of the file content
 	h := sha256.New()
-	h.Write(fileContent)
+	h.Write(head)
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
 	sumHex := hex.EncodeToString(h.Sum(nil))
 
-	ext := strings.ToLower(filepath.Ext(fh.Filename))
-	contentType := fh.Header.Get("Content-Type")
+	contentType := DetectContentType(head)
+	if declared := fh.Header.Get("Content-Type"); contentType == unknownContentType && declared != "" {
+		contentType = declared
+	}
 
-	return u.uploadWithDedup(
-		ctx,
-		keyPrefix,
-		sumHex,
-		contentType,
-		ext,
-		int64(len(fileContent)),
-		bytes.NewReader(fileContent),
-		map[string]string{
+	return &Content{
+		SHA256:      sumHex,
+		ContentType: contentType,
+		Ext:         strings.ToLower(filepath.Ext(fh.Filename)),
+		Size:        fh.Size,
+		Metadata: map[string]string{
 			"sha256": sumHex,
 			"name":   fh.Filename,
 		},
-	)
+		open: func() (io.ReadCloser, error) { return fh.Open() },
+	}, nil
 }
 
-// UploadJSON uploads JSON data to S3 and returns metadata
-func (u *S3Deps) UploadJSON(ctx context.Context, keyPrefix string, data interface{}) (*model.Asset, error) {
+// unknownContentType is what DetectContentType returns for content it does not recognize
+const unknownContentType = "application/octet-stream"
+
+// DetectContentType sniffs the MIME type of data from its first 512 bytes
+func DetectContentType(data []byte) string {
+	return http.DetectContentType(data)
+}
+
+// JSONContent serializes data to JSON and hashes it
+func JSONContent(data interface{}) (*Content, error) {
 	// Serialize data to JSON
 	jsonData, err := sonic.Marshal(data)
 	if err != nil {
@@ -308,22 +352,63 @@ func (u *S3Deps) UploadJSON(ctx context.Context, keyPrefix string, data interfac
 	h.Write(jsonData)
 	sumHex := hex.EncodeToString(h.Sum(nil))
 
+	return &Content{
+		SHA256:      sumHex,
+		ContentType: "application/json",
+		Ext:         ".json",
+		Size:        int64(len(jsonData)),
+		Metadata: map[string]string{
+			"sha256": sumHex,
+		},
+		open: openBytes(jsonData),
+	}, nil
+}
+
+// Upload uploads the content under keyPrefix with automatic deduplication, see uploadWithDedup.
+// Uploaded files are streamed from the multipart form, their part is not read into memory.
+func (u *S3Deps) Upload(ctx context.Context, keyPrefix string, c *Content) (*model.Asset, error) {
+	body, err := c.open()
+	if err != nil {
+		return nil, fmt.Errorf("open content: %w", err)
+	}
+	defer body.Close()
+
 	return u.uploadWithDedup(
 		ctx,
 		keyPrefix,
-		sumHex,
-		"application/json",
-		".json",
-		int64(len(jsonData)),
-		bytes.NewReader(jsonData),
-		map[string]string{
-			"sha256": sumHex,
-		},
+		c.SHA256,
+		c.ContentType,
+		c.Ext,
+		c.Size,
+		body,
+		c.Metadata,
 	)
 }
 
+// UploadFormFile uploads a file to S3 with automatic deduplication
+// It checks if a file with the same SHA256 already exists under the keyPrefix
+// If found, returns the existing file metadata; otherwise uploads the new file
+func (u *S3Deps) UploadFormFile(ctx context.Context, keyPrefix string, fh *multipart.FileHeader) (*model.Asset, error) {
+	c, err := FormFileContent(fh)
+	if err != nil {
+		return nil, err
+	}
+	return u.Upload(ctx, keyPrefix, c)
+}
+
+// UploadJSON uploads JSON data to S3 and returns metadata
+func (u *S3Deps) UploadJSON(ctx context.Context, keyPrefix string, data interface{}) (*model.Asset, error) {
+	c, err := JSONContent(data)
+	if err != nil {
+		return nil, err
+	}
+	return u.Upload(ctx, keyPrefix, c)
+}
+
 // DownloadJSON downloads JSON data from S3 and unmarshals it into the provided interface
 func (u *S3Deps) DownloadJSON(ctx context.Context, key string, target interface{}) error {
+	defer metrics.ObserveS3(metrics.S3Download, time.Now())
+
 	result, err := u.Client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: &u.Bucket,
 		Key:    &key,
@@ -354,6 +439,8 @@ func (u *S3Deps) DownloadFile(ctx context.Context, key string) ([]byte, error) {
 		return nil, errors.New("key is empty")
 	}
 
+	defer metrics.ObserveS3(metrics.S3Download, time.Now())
+
 	result, err := u.Client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: &u.Bucket,
 		Key:    &key,
@@ -373,6 +460,26 @@ func (u *S3Deps) DownloadFile(ctx context.Context, key string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// ListObjects calls fn with the key and last modified time of every object under prefix, stopping at the first error
+func (u *S3Deps) ListObjects(ctx context.Context, prefix string, fn func(key string, lastModified time.Time) error) error {
+	p := s3.NewListObjectsV2Paginator(u.Client, &s3.ListObjectsV2Input{
+		Bucket: &u.Bucket,
+		Prefix: &prefix,
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("list objects in S3: %w", err)
+		}
+		for _, obj := range page.Contents {
+			if err := fn(aws.ToString(obj.Key), aws.ToTime(obj.LastModified)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // DeleteObject deletes an object from S3
 func (u *S3Deps) DeleteObject(ctx context.Context, key string) error {
 	if key == "" {
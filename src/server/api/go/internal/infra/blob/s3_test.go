@@ -0,0 +1,148 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is an S3 endpoint with no objects that hashes what is uploaded to it, in a single PUT
+// or as a multipart upload whose parts are assembled in a file to keep the test's own memory flat
+type fakeS3 struct {
+	mu       sync.Mutex
+	assembly *os.File
+	puts     map[string]string // key -> SHA256 of the uploaded bytes
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	key := strings.TrimPrefix(r.URL.Path, "/assets/")
+	switch {
+	case r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = io.WriteString(w, `<ListBucketResult><IsTruncated>false</IsTruncated></ListBucketResult>`)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		_, _ = io.WriteString(w, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && q.Has("partNumber"):
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		_, _ = io.Copy(io.NewOffsetWriter(f.assembly, int64(n-1)*manager.DefaultUploadPartSize), r.Body)
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, n))
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		_, _ = io.Copy(io.Discard, r.Body)
+		h := sha256.New()
+		_, _ = io.Copy(h, io.NewSectionReader(f.assembly, 0, 1<<62))
+		f.mu.Lock()
+		f.puts[key] = hex.EncodeToString(h.Sum(nil))
+		f.mu.Unlock()
+		_, _ = io.WriteString(w, `<CompleteMultipartUploadResult><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodPut:
+		h := sha256.New()
+		_, _ = io.Copy(h, r.Body)
+		f.mu.Lock()
+		f.puts[key] = hex.EncodeToString(h.Sum(nil))
+		f.mu.Unlock()
+		w.Header().Set("ETag", `"etag"`)
+	}
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3Deps) {
+	assembly, err := os.CreateTemp(t.TempDir(), "upload")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = assembly.Close() })
+
+	fake := &fakeS3{assembly: assembly, puts: map[string]string{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+	})
+	return fake, &S3Deps{Client: client, Uploader: manager.NewUploader(client), Bucket: "assets"}
+}
+
+// largeFormFile writes size pseudo-random bytes as a multipart file part, read back with
+// a small memory limit so the part is spooled to disk like a real large upload
+func largeFormFile(t *testing.T, size int64) (*multipart.FileHeader, string) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	sum := make(chan string, 1)
+	go func() {
+		part, err := writer.CreateFormFile("video", "clip.mp4")
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		h := sha256.New()
+		if _, err := io.CopyN(io.MultiWriter(part, h), rand.New(rand.NewSource(1)), size); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		sum <- hex.EncodeToString(h.Sum(nil))
+		pw.CloseWithError(writer.Close())
+	}()
+
+	form, err := multipart.NewReader(pr, writer.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = form.RemoveAll() })
+	return form.File["video"][0], <-sum
+}
+
+func TestS3Deps_Upload_StreamsLargeFormFile(t *testing.T) {
+	const size = 64 << 20
+	fake, deps := newFakeS3(t)
+	fh, wantSHA := largeFormFile(t, size)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	content, err := FormFileContent(fh)
+	require.NoError(t, err)
+	asset, err := deps.Upload(context.Background(), "assets/p1", content)
+	require.NoError(t, err)
+
+	runtime.ReadMemStats(&after)
+
+	assert.Equal(t, wantSHA, content.SHA256)
+	assert.Equal(t, int64(size), asset.SizeB)
+	assert.Contains(t, asset.S3Key, wantSHA, "keys stay content-addressed")
+	assert.Equal(t, wantSHA, fake.puts[asset.S3Key], "the uploaded bytes are the file")
+
+	// neither hashing nor uploading may read the file into memory
+	allocated := after.TotalAlloc - before.TotalAlloc
+	assert.Less(t, allocated, uint64(size/2), "upload allocated %d bytes for a %d bytes file", allocated, size)
+}
+
+func TestS3Deps_Upload_JSON(t *testing.T) {
+	fake, deps := newFakeS3(t)
+
+	content, err := JSONContent(map[string]string{"hello": "world"})
+	require.NoError(t, err)
+	asset, err := deps.Upload(context.Background(), "parts/p1", content)
+	require.NoError(t, err)
+
+	assert.Equal(t, content.SHA256, fake.puts[asset.S3Key])
+	assert.Equal(t, content.Size, asset.SizeB)
+}
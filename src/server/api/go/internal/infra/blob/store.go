@@ -0,0 +1,59 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"mime/multipart"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+)
+
+// Store is an object storage backend assets, message parts and artifacts are kept in.
+// Uploads are content-addressed: content already stored under the key prefix is not uploaded again.
+type Store interface {
+	Upload(ctx context.Context, keyPrefix string, c *Content) (*model.Asset, error)
+	UploadJSON(ctx context.Context, keyPrefix string, data interface{}) (*model.Asset, error)
+	UploadFormFile(ctx context.Context, keyPrefix string, fh *multipart.FileHeader) (*model.Asset, error)
+	DownloadJSON(ctx context.Context, key string, target interface{}) error
+	DownloadFile(ctx context.Context, key string) ([]byte, error)
+	PresignGet(ctx context.Context, key string, expire time.Duration) (string, error)
+	PresignGetAs(ctx context.Context, key, contentType string, expire time.Duration) (string, error)
+	ListObjects(ctx context.Context, prefix string, fn func(key string, lastModified time.Time) error) error
+	DeleteObject(ctx context.Context, key string) error
+}
+
+var (
+	_ Store = (*S3Deps)(nil)
+	_ Store = (*GCSDeps)(nil)
+	_ Store = (*LocalStore)(nil)
+)
+
+// Storage backends selectable with storage.backend
+const (
+	BackendS3    = "s3"
+	BackendGCS   = "gcs"
+	BackendLocal = "local"
+)
+
+// NewStore connects to the storage backend selected in the config
+func NewStore(ctx context.Context, cfg *config.Config) (Store, error) {
+	switch cfg.Storage.Backend {
+	case "", BackendS3:
+		return NewS3(ctx, cfg)
+	case BackendGCS:
+		return NewGCS(ctx, cfg)
+	case BackendLocal:
+		return NewLocal(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q, must be %s, %s or %s", cfg.Storage.Backend, BackendS3, BackendGCS, BackendLocal)
+	}
+}
+
+// contentKey is the key content with the given SHA256 is uploaded to under keyPrefix,
+// the SHA256 in the key is what uploads are deduplicated by
+func contentKey(keyPrefix, sumHex, ext string) string {
+	datePrefix := time.Now().UTC().Format("2006/01/02")
+	return fmt.Sprintf("%s/%s/%s%s", keyPrefix, datePrefix, sumHex, ext)
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/memodb-io/Acontext/internal/pkg/metrics"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen is returned instead of calling Redis while the circuit breaker considers it down
+var ErrCircuitOpen = errors.New("redis unavailable, call skipped by the circuit breaker")
+
+// Breaker is a go-redis hook that stops calling Redis after consecutive connection failures, so that
+// callers falling back on Redis errors don't wait for a timeout on every request. Once the cooldown
+// has elapsed, a single call probes Redis: its success closes the circuit, its failure reopens it.
+// Error replies and cache misses are not failures, Redis answered them.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	log       *zap.Logger
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int       // consecutive connection failures
+	openUntil time.Time // zero while the circuit is closed
+	probing   bool      // a call is probing Redis after the cooldown
+}
+
+// NewBreaker returns a breaker opening after threshold consecutive failures, for cooldown
+func NewBreaker(threshold int, cooldown time.Duration, log *zap.Logger) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown, log: log, now: time.Now}
+}
+
+func (b *Breaker) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (b *Breaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !b.allow() {
+			cmd.SetErr(ErrCircuitOpen)
+			return ErrCircuitOpen
+		}
+		err := next(ctx, cmd)
+		b.record(err)
+		return err
+	}
+}
+
+func (b *Breaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !b.allow() {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrCircuitOpen)
+			}
+			return ErrCircuitOpen
+		}
+		err := next(ctx, cmds)
+		b.record(err)
+		return err
+	}
+}
+
+// allow reports whether a call may go to Redis, letting a single probe through after the cooldown
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isConnectionError(err) {
+		// a canceled call tells nothing about Redis, let the next call probe instead
+		if errors.Is(err, context.Canceled) {
+			b.probing = false
+			return
+		}
+		if !b.openUntil.IsZero() {
+			b.log.Info("redis is reachable again, resuming calls")
+			metrics.RedisCircuitOpen.Set(0)
+		}
+		b.failures = 0
+		b.openUntil = time.Time{}
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		if b.openUntil.IsZero() {
+			b.log.Warn("redis looks down, skipping calls",
+				zap.Int("consecutive_failures", b.failures), zap.Duration("cooldown", b.cooldown), zap.Error(err))
+			metrics.RedisCircuitOpen.Set(1)
+		}
+		b.openUntil = b.now().Add(b.cooldown)
+		b.probing = false
+	}
+}
+
+// isConnectionError reports whether err means Redis could not be reached or did not answer in time
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	// error replies, redis.Nil included, come from a Redis that is up
+	var replyErr redis.Error
+	if errors.As(err, &replyErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, redis.ErrPoolTimeout)
+}
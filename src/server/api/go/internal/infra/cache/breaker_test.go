@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// replyError is an error reply of Redis, as go-redis returns them
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+func (replyError) RedisError()     {}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	now := time.Now()
+	b := NewBreaker(3, 10*time.Second, zap.NewNop())
+	b.now = func() time.Time { return now }
+
+	// next fails with the error of the current step, counting the calls that reached Redis
+	var reply error
+	calls := 0
+	process := b.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		calls++
+		cmd.SetErr(reply)
+		return reply
+	})
+	call := func(err error) error {
+		reply = err
+		return process(ctx, redis.NewStringCmd(ctx, "get", "key"))
+	}
+
+	// misses and error replies come from a Redis that is up
+	for range 5 {
+		assert.ErrorIs(t, call(redis.Nil), redis.Nil)
+	}
+	assert.Error(t, call(replyError("WRONGTYPE Operation against a key holding the wrong kind of value")))
+	assert.Equal(t, 6, calls)
+
+	// a success resets the failure count
+	assert.ErrorIs(t, call(refused), refused)
+	assert.ErrorIs(t, call(refused), refused)
+	assert.NoError(t, call(nil))
+	assert.ErrorIs(t, call(refused), refused)
+	assert.ErrorIs(t, call(context.DeadlineExceeded), context.DeadlineExceeded)
+	assert.Equal(t, 11, calls)
+
+	// the third consecutive failure opens the circuit, calls are skipped
+	assert.ErrorIs(t, call(refused), refused)
+	assert.ErrorIs(t, call(nil), ErrCircuitOpen)
+	assert.Equal(t, 12, calls)
+
+	// after the cooldown a failed probe reopens it at once
+	now = now.Add(10 * time.Second)
+	assert.ErrorIs(t, call(refused), refused)
+	assert.ErrorIs(t, call(nil), ErrCircuitOpen)
+	assert.Equal(t, 13, calls)
+
+	// a canceled probe tells nothing, the next call probes again
+	now = now.Add(10 * time.Second)
+	assert.ErrorIs(t, call(context.Canceled), context.Canceled)
+	assert.Equal(t, 14, calls)
+
+	// a successful probe closes it
+	assert.NoError(t, call(nil))
+	assert.NoError(t, call(nil))
+	assert.Equal(t, 16, calls)
+}
+
+func TestBreaker_Pipeline(t *testing.T) {
+	ctx := context.Background()
+	b := NewBreaker(1, time.Minute, zap.NewNop())
+
+	calls := 0
+	pipeline := b.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		calls++
+		return &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	})
+
+	cmds := []redis.Cmder{redis.NewStringCmd(ctx, "get", "a"), redis.NewStringCmd(ctx, "get", "b")}
+	assert.Error(t, pipeline(ctx, cmds))
+	assert.ErrorIs(t, pipeline(ctx, cmds), ErrCircuitOpen)
+	for _, cmd := range cmds {
+		assert.ErrorIs(t, cmd.Err(), ErrCircuitOpen)
+	}
+	assert.Equal(t, 1, calls)
+}
@@ -3,13 +3,15 @@ package cache
 import (
 	"context"
 	"crypto/tls"
+	"time"
 
 	"github.com/memodb-io/Acontext/internal/config"
 	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 )
 
-func New(cfg *config.Config) (*redis.Client, error) {
+func New(cfg *config.Config, log *zap.Logger) (*redis.Client, error) {
 	opts := &redis.Options{
 		Addr:     cfg.Redis.Addr,
 		Password: cfg.Redis.Password,
@@ -27,9 +29,15 @@ func New(cfg *config.Config) (*redis.Client, error) {
 	rdb := redis.NewClient(opts)
 
 	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		_ = rdb.Close()
 		return nil, err
 	}
 
+	// Added after the ping, so that a Redis down at startup is retried rather than skipped
+	if cfg.Redis.BreakerFailures > 0 {
+		rdb.AddHook(NewBreaker(cfg.Redis.BreakerFailures, time.Duration(cfg.Redis.BreakerCooldownSec)*time.Second, log))
+	}
+
 	return rdb, nil
 }
 
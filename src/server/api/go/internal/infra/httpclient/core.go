@@ -3,18 +3,25 @@ package httpclient
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/pkg/requestid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 )
 
 // CoreClient is the HTTP client for Acontext Core service
@@ -23,18 +30,211 @@ type CoreClient struct {
 	HTTPClient *http.Client
 	Logger     *zap.Logger
 	Propagator propagation.TextMapPropagator
+
+	// MaxAttempts caps the attempts of idempotent GET calls, values below 2 disable retries
+	MaxAttempts int
+	// RetryBackoff is the wait before the first retry, doubled on every retry
+	RetryBackoff time.Duration
+	// DebugResponses allows handlers to return Core's raw response bodies to callers
+	DebugResponses bool
+	// BatchConcurrency caps the concurrent Core calls of the batch methods, values below 1 make one call at a time
+	BatchConcurrency int
 }
 
 // NewCoreClient creates a new CoreClient
 func NewCoreClient(cfg *config.Config, log *zap.Logger) *CoreClient {
+	timeout := 30 * time.Second
+	if cfg.Core.TimeoutSec > 0 {
+		timeout = time.Duration(cfg.Core.TimeoutSec) * time.Second
+	}
+
 	return &CoreClient{
 		BaseURL: cfg.Core.BaseURL,
 		HTTPClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: timeout,
+			// Every attempt gets a client span, which Core's spans are linked to through the injected traceparent
+			Transport: otelhttp.NewTransport(http.DefaultTransport,
+				otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return "core " + r.Method }),
+			),
 		},
-		Logger:     log,
-		Propagator: otel.GetTextMapPropagator(), // Get global propagator
+		Logger:           log,
+		Propagator:       otel.GetTextMapPropagator(), // Get global propagator
+		MaxAttempts:      cfg.Core.MaxAttempts,
+		RetryBackoff:     time.Duration(cfg.Core.RetryBackoffMs) * time.Millisecond,
+		DebugResponses:   cfg.Core.DebugResponses,
+		BatchConcurrency: cfg.Core.BatchConcurrency,
+	}
+}
+
+// ErrUnexpectedResponse is wrapped by a CoreError when Core's response is not the expected JSON,
+// typically an HTML error page from a proxy or gateway in front of Core
+var ErrUnexpectedResponse = errors.New("unexpected response from core service")
+
+// CoreError is returned when Core answers with a non-200 status or with a body that isn't JSON
+type CoreError struct {
+	StatusCode  int
+	ContentType string
+	Body        string
+	Message     string // error message reported by Core, falls back to the raw body
+	Err         error  // ErrUnexpectedResponse for non-JSON responses, nil otherwise
+}
+
+func (e *CoreError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s, content type %q", e.Message, e.ContentType)
+	}
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *CoreError) Unwrap() error {
+	return e.Err
+}
+
+// newCoreError builds a CoreError, extracting the message from Core's
+// {"detail": ...} (FastAPI) or {"errmsg": ...} error bodies when present
+func newCoreError(statusCode int, contentType string, body []byte) *CoreError {
+	e := &CoreError{StatusCode: statusCode, ContentType: contentType, Body: string(body), Message: string(body)}
+
+	var parsed struct {
+		Detail any    `json:"detail"`
+		Errmsg string `json:"errmsg"`
+	}
+	if err := sonic.Unmarshal(body, &parsed); err == nil {
+		if detail, ok := parsed.Detail.(string); ok && detail != "" {
+			e.Message = detail
+		} else if parsed.Errmsg != "" {
+			e.Message = parsed.Errmsg
+		}
+		return e
+	}
+
+	// JSON and plain text errors are readable as is, anything else (e.g. an HTML page) is summarized
+	if isJSON(contentType) || mediaType(contentType) == "text/plain" {
+		return e
 	}
+	return newUnexpectedResponseError(statusCode, contentType, body)
+}
+
+func newUnexpectedResponseError(statusCode int, contentType string, body []byte) *CoreError {
+	return &CoreError{
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		Body:        string(body),
+		Message:     fmt.Sprintf("%s (status %d)", ErrUnexpectedResponse, statusCode),
+		Err:         ErrUnexpectedResponse,
+	}
+}
+
+// decodeResponse unmarshals a 200 response of Core into v. A body that isn't JSON is
+// reported as ErrUnexpectedResponse instead of an unmarshal error.
+func decodeResponse(statusCode int, contentType string, body []byte, v any) error {
+	if contentType != "" && !isJSON(contentType) {
+		return newUnexpectedResponseError(statusCode, contentType, body)
+	}
+	if err := sonic.Unmarshal(body, v); err != nil {
+		return newUnexpectedResponseError(statusCode, contentType, body)
+	}
+	return nil
+}
+
+func mediaType(contentType string) string {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return t
+}
+
+func isJSON(contentType string) bool {
+	t := mediaType(contentType)
+	return t == "application/json" || strings.HasSuffix(t, "+json")
+}
+
+// getWithRetry sends an idempotent GET request and decodes the body of a 200 response into out,
+// returning the raw body as well.
+// Connection errors and 5xx responses are retried with exponential backoff up to MaxAttempts,
+// and no retry is started once its backoff would run past the ctx deadline.
+func (c *CoreClient) getWithRetry(ctx context.Context, name, fullURL string, out any) ([]byte, error) {
+	backoff := c.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		statusCode, contentType, body, retryable, err := c.get(ctx, fullURL)
+		if err == nil && statusCode == http.StatusOK {
+			if err := decodeResponse(statusCode, contentType, body, out); err != nil {
+				return nil, err
+			}
+			return body, nil
+		}
+		if err == nil {
+			retryable = statusCode >= http.StatusInternalServerError
+		}
+
+		if !retryable || attempt >= c.MaxAttempts || !withinDeadline(ctx, backoff) {
+			if err != nil {
+				return nil, err
+			}
+			c.Logger.Error(name+" request failed",
+				zap.Int("status_code", statusCode),
+				zap.String("body", string(body)))
+			return nil, newCoreError(statusCode, contentType, body)
+		}
+
+		c.Logger.Warn(name+" request failed, retrying",
+			zap.Int("attempt", attempt),
+			zap.Int("status_code", statusCode),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("do request: %w", ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// injectHeaders propagates the trace context and the request ID of ctx to the request to Core.
+// The otelhttp transport of NewCoreClient injects the context of its client span over it.
+func (c *CoreClient) injectHeaders(ctx context.Context, httpReq *http.Request) {
+	c.Propagator.Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
+	if id := requestid.FromContext(ctx); id != "" {
+		httpReq.Header.Set(requestid.Header, id)
+	}
+}
+
+// get sends a single GET request, retryable reports whether the returned error is a transient connection error
+func (c *CoreClient) get(ctx context.Context, fullURL string) (statusCode int, contentType string, body []byte, retryable bool, err error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
+	if err != nil {
+		return 0, "", nil, false, fmt.Errorf("create request: %w", err)
+	}
+
+	// Important: propagate trace context and request ID to downstream service
+	c.injectHeaders(ctx, httpReq)
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return 0, "", nil, ctx.Err() == nil, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", nil, ctx.Err() == nil, fmt.Errorf("read response body: %w", err)
+	}
+
+	return resp.StatusCode, resp.Header.Get("Content-Type"), body, false, nil
+}
+
+// withinDeadline reports whether waiting for d still leaves time before the ctx deadline
+func withinDeadline(ctx context.Context, d time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > d
 }
 
 // SearchResultBlockItem represents a search result block item
@@ -49,6 +249,9 @@ type SearchResultBlockItem struct {
 // SpaceSearchResult represents the result of a space search
 type SpaceSearchResult struct {
 	CitedBlocks []SearchResultBlockItem `json:"cited_blocks"`
+
+	// Raw is the response body of Core the result was decoded from
+	Raw json.RawMessage `json:"-"`
 }
 
 // ExperienceSearchRequest represents the request for experience search
@@ -76,36 +279,12 @@ func (c *CoreClient) ExperienceSearch(ctx context.Context, projectID, spaceID uu
 
 	fullURL := fmt.Sprintf("%s?%s", endpoint, params.Encode())
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	// Important: propagate trace context to downstream service
-	c.Propagator.Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
-
-	resp, err := c.HTTPClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response body: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		c.Logger.Error("experience_search request failed",
-			zap.Int("status_code", resp.StatusCode),
-			zap.String("body", string(body)))
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var result SpaceSearchResult
-	if err := sonic.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+	raw, err := c.getWithRetry(ctx, "experience_search", fullURL, &result)
+	if err != nil {
+		return nil, err
 	}
+	result.Raw = raw
 
 	return &result, nil
 }
@@ -139,8 +318,8 @@ func (c *CoreClient) InsertBlock(ctx context.Context, projectID, spaceID uuid.UU
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	// Important: propagate trace context to downstream service
-	c.Propagator.Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
+	// Important: propagate trace context and request ID to downstream service
+	c.injectHeaders(ctx, httpReq)
 
 	resp, err := c.HTTPClient.Do(httpReq)
 	if err != nil {
@@ -157,12 +336,12 @@ func (c *CoreClient) InsertBlock(ctx context.Context, projectID, spaceID uuid.UU
 		c.Logger.Error("insert_block request failed",
 			zap.Int("status_code", resp.StatusCode),
 			zap.String("body", string(respBody)))
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return nil, newCoreError(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
 	}
 
 	var result InsertBlockResponse
-	if err := sonic.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+	if err := decodeResponse(resp.StatusCode, resp.Header.Get("Content-Type"), respBody, &result); err != nil {
+		return nil, err
 	}
 
 	return &result, nil
@@ -189,8 +368,8 @@ func (c *CoreClient) SessionFlush(ctx context.Context, projectID, sessionID uuid
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 
-	// Important: propagate trace context to downstream service
-	c.Propagator.Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
+	// Important: propagate trace context and request ID to downstream service
+	c.injectHeaders(ctx, httpReq)
 
 	resp, err := c.HTTPClient.Do(httpReq)
 	if err != nil {
@@ -207,53 +386,79 @@ func (c *CoreClient) SessionFlush(ctx context.Context, projectID, sessionID uuid
 		c.Logger.Error("session_flush request failed",
 			zap.Int("status_code", resp.StatusCode),
 			zap.String("body", string(respBody)))
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return nil, newCoreError(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
 	}
 
 	var result FlagResponse
-	if err := sonic.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+	if err := decodeResponse(resp.StatusCode, resp.Header.Get("Content-Type"), respBody, &result); err != nil {
+		return nil, err
 	}
 
 	return &result, nil
 }
 
+// SessionFlushResult is the outcome of flushing one session of a batch, Err is set when the call failed
+type SessionFlushResult struct {
+	SessionID uuid.UUID
+	Flag      *FlagResponse
+	Err       error
+}
+
+// SessionFlushBatch flushes several sessions. Core has no batch endpoint, so it calls SessionFlush for
+// every session, at most BatchConcurrency at a time. Results are in the order of sessionIDs.
+func (c *CoreClient) SessionFlushBatch(ctx context.Context, projectID uuid.UUID, sessionIDs []uuid.UUID) []SessionFlushResult {
+	results := make([]SessionFlushResult, len(sessionIDs))
+
+	var g errgroup.Group
+	g.SetLimit(max(c.BatchConcurrency, 1))
+	for i, sessionID := range sessionIDs {
+		g.Go(func() error {
+			flag, err := c.SessionFlush(ctx, projectID, sessionID)
+			results[i] = SessionFlushResult{SessionID: sessionID, Flag: flag, Err: err}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return results
+}
+
 // GetLearningStatus calls the get learning status endpoint
 func (c *CoreClient) GetLearningStatus(ctx context.Context, projectID, sessionID uuid.UUID) (*LearningStatusResponse, error) {
 	endpoint := fmt.Sprintf("%s/api/v1/project/%s/session/%s/get_learning_status", c.BaseURL, projectID.String(), sessionID.String())
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+	var result LearningStatusResponse
+	if _, err := c.getWithRetry(ctx, "get_learning_status", endpoint, &result); err != nil {
+		return nil, err
 	}
 
-	// Important: propagate trace context to downstream service
-	c.Propagator.Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
-
-	resp, err := c.HTTPClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
-	}
-	defer resp.Body.Close()
+	return &result, nil
+}
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response body: %w", err)
-	}
+// LearningStatusResult is the learning status of one session of a batch, Err is set when the call failed
+type LearningStatusResult struct {
+	SessionID uuid.UUID
+	Status    *LearningStatusResponse
+	Err       error
+}
 
-	if resp.StatusCode != http.StatusOK {
-		c.Logger.Error("get_learning_status request failed",
-			zap.Int("status_code", resp.StatusCode),
-			zap.String("body", string(respBody)))
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
-	}
+// GetLearningStatusBatch gets the learning status of several sessions, calling GetLearningStatus for
+// every session at most BatchConcurrency at a time. Results are in the order of sessionIDs.
+func (c *CoreClient) GetLearningStatusBatch(ctx context.Context, projectID uuid.UUID, sessionIDs []uuid.UUID) []LearningStatusResult {
+	results := make([]LearningStatusResult, len(sessionIDs))
 
-	var result LearningStatusResponse
-	if err := sonic.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+	var g errgroup.Group
+	g.SetLimit(max(c.BatchConcurrency, 1))
+	for i, sessionID := range sessionIDs {
+		g.Go(func() error {
+			status, err := c.GetLearningStatus(ctx, projectID, sessionID)
+			results[i] = LearningStatusResult{SessionID: sessionID, Status: status, Err: err}
+			return nil
+		})
 	}
+	_ = g.Wait()
 
-	return &result, nil
+	return results
 }
 
 // ToolRenameItem represents a single tool rename operation
@@ -290,8 +495,8 @@ func (c *CoreClient) ToolRename(ctx context.Context, projectID uuid.UUID, rename
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	// Important: propagate trace context to downstream service
-	c.Propagator.Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
+	// Important: propagate trace context and request ID to downstream service
+	c.injectHeaders(ctx, httpReq)
 
 	resp, err := c.HTTPClient.Do(httpReq)
 	if err != nil {
@@ -308,12 +513,12 @@ func (c *CoreClient) ToolRename(ctx context.Context, projectID uuid.UUID, rename
 		c.Logger.Error("tool_rename request failed",
 			zap.Int("status_code", resp.StatusCode),
 			zap.String("body", string(respBody)))
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return nil, newCoreError(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
 	}
 
 	var result FlagResponse
-	if err := sonic.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+	if err := decodeResponse(resp.StatusCode, resp.Header.Get("Content-Type"), respBody, &result); err != nil {
+		return nil, err
 	}
 
 	return &result, nil
@@ -323,35 +528,9 @@ func (c *CoreClient) ToolRename(ctx context.Context, projectID uuid.UUID, rename
 func (c *CoreClient) GetToolNames(ctx context.Context, projectID uuid.UUID) ([]ToolReferenceData, error) {
 	endpoint := fmt.Sprintf("%s/api/v1/project/%s/tool/name", c.BaseURL, projectID.String())
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	// Important: propagate trace context to downstream service
-	c.Propagator.Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
-
-	resp, err := c.HTTPClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response body: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		c.Logger.Error("get_tool_names request failed",
-			zap.Int("status_code", resp.StatusCode),
-			zap.String("body", string(respBody)))
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
-	}
-
 	var result []ToolReferenceData
-	if err := sonic.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+	if _, err := c.getWithRetry(ctx, "get_tool_names", endpoint, &result); err != nil {
+		return nil, err
 	}
 
 	return result, nil
@@ -0,0 +1,170 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+
+	"github.com/memodb-io/Acontext/internal/pkg/requestid"
+)
+
+// response is a canned answer of the fake Core server
+type response struct {
+	status      int
+	contentType string
+	body        string
+}
+
+// newTestCore starts a fake Core answering with responses in turn, repeating the last one, and returns
+// a client of it along with the count of requests received
+func newTestCore(t *testing.T, responses ...response) (*CoreClient, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		res := responses[min(n, len(responses))-1]
+		if res.contentType != "" {
+			w.Header().Set("Content-Type", res.contentType)
+		}
+		w.WriteHeader(res.status)
+		_, _ = w.Write([]byte(res.body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return &CoreClient{
+		BaseURL:      srv.URL,
+		HTTPClient:   srv.Client(),
+		Logger:       zap.NewNop(),
+		Propagator:   otel.GetTextMapPropagator(),
+		MaxAttempts:  3,
+		RetryBackoff: time.Millisecond,
+	}, &calls
+}
+
+func TestCoreClient_GetWithRetry(t *testing.T) {
+	ctx := context.Background()
+	ok := response{status: http.StatusOK, contentType: "application/json", body: `{"space_digested_count": 2, "not_space_digested_count": 1}`}
+
+	t.Run("retries 5xx", func(t *testing.T) {
+		client, calls := newTestCore(t, response{status: http.StatusServiceUnavailable, body: "unavailable"}, ok)
+		status, err := client.GetLearningStatus(ctx, uuid.New(), uuid.New())
+		require.NoError(t, err)
+		assert.Equal(t, &LearningStatusResponse{SpaceDigestedCount: 2, NotSpaceDigestedCount: 1}, status)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		client, calls := newTestCore(t, response{status: http.StatusBadGateway, contentType: "application/json", body: `{"detail":"core is down"}`})
+		_, err := client.GetLearningStatus(ctx, uuid.New(), uuid.New())
+		var ce *CoreError
+		require.ErrorAs(t, err, &ce)
+		assert.Equal(t, http.StatusBadGateway, ce.StatusCode)
+		assert.Equal(t, "core is down", ce.Message)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("does not retry 4xx", func(t *testing.T) {
+		client, calls := newTestCore(t, response{status: http.StatusNotFound, contentType: "application/json", body: `{"detail":"session not found"}`}, ok)
+		_, err := client.GetLearningStatus(ctx, uuid.New(), uuid.New())
+		var ce *CoreError
+		require.ErrorAs(t, err, &ce)
+		assert.Equal(t, http.StatusNotFound, ce.StatusCode)
+		assert.Equal(t, "session not found", ce.Message)
+		assert.NoError(t, ce.Unwrap())
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("retries disabled", func(t *testing.T) {
+		client, calls := newTestCore(t, response{status: http.StatusServiceUnavailable}, ok)
+		client.MaxAttempts = 1
+		_, err := client.GetLearningStatus(ctx, uuid.New(), uuid.New())
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("no retry past the deadline", func(t *testing.T) {
+		client, calls := newTestCore(t, response{status: http.StatusServiceUnavailable}, ok)
+		client.RetryBackoff = time.Minute
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		_, err := client.GetLearningStatus(ctx, uuid.New(), uuid.New())
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("html error page", func(t *testing.T) {
+		client, _ := newTestCore(t, response{status: http.StatusBadGateway, contentType: "text/html", body: "<html>Bad Gateway</html>"})
+		_, err := client.GetLearningStatus(ctx, uuid.New(), uuid.New())
+		assert.ErrorIs(t, err, ErrUnexpectedResponse)
+		var ce *CoreError
+		require.ErrorAs(t, err, &ce)
+		assert.Equal(t, http.StatusBadGateway, ce.StatusCode)
+	})
+
+	t.Run("200 that is not json", func(t *testing.T) {
+		client, calls := newTestCore(t, response{status: http.StatusOK, contentType: "text/html", body: "<html>login</html>"})
+		_, err := client.GetLearningStatus(ctx, uuid.New(), uuid.New())
+		assert.ErrorIs(t, err, ErrUnexpectedResponse)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+}
+
+func TestCoreClient_PropagatesRequestID(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(requestid.Header)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client := &CoreClient{BaseURL: srv.URL, HTTPClient: srv.Client(), Logger: zap.NewNop(), Propagator: otel.GetTextMapPropagator()}
+	_, err := client.GetLearningStatus(requestid.WithID(context.Background(), "req-1"), uuid.New(), uuid.New())
+	require.NoError(t, err)
+	assert.Equal(t, "req-1", got)
+}
+
+func TestNewCoreError(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantMessage string
+		wantErr     error
+	}{
+		{name: "fastapi detail", contentType: "application/json", body: `{"detail":"session not found"}`, wantMessage: "session not found"},
+		{name: "errmsg", contentType: "application/json", body: `{"errmsg":"invalid project"}`, wantMessage: "invalid project"},
+		{name: "validation detail list", contentType: "application/json", body: `{"detail":[{"msg":"field required"}]}`, wantMessage: `{"detail":[{"msg":"field required"}]}`},
+		{name: "plain text", contentType: "text/plain; charset=utf-8", body: "internal error", wantMessage: "internal error"},
+		{name: "html page", contentType: "text/html", body: "<html>502</html>", wantMessage: "unexpected response from core service (status 500)", wantErr: ErrUnexpectedResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newCoreError(http.StatusInternalServerError, tt.contentType, []byte(tt.body))
+			assert.Equal(t, tt.wantMessage, e.Message)
+			assert.Equal(t, tt.body, e.Body)
+			assert.Equal(t, tt.wantErr, e.Err)
+		})
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	var v LearningStatusResponse
+	require.NoError(t, decodeResponse(http.StatusOK, "application/json; charset=utf-8", []byte(`{"space_digested_count": 3}`), &v))
+	assert.Equal(t, 3, v.SpaceDigestedCount)
+
+	// a missing content type is decoded as JSON
+	require.NoError(t, decodeResponse(http.StatusOK, "", []byte(`{"not_space_digested_count": 1}`), &v))
+	assert.Equal(t, 1, v.NotSpaceDigestedCount)
+
+	assert.ErrorIs(t, decodeResponse(http.StatusOK, "text/html", []byte(`<html></html>`), &v), ErrUnexpectedResponse)
+	assert.ErrorIs(t, decodeResponse(http.StatusOK, "application/json", []byte(`not json`), &v), ErrUnexpectedResponse)
+}
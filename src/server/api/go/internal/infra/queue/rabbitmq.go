@@ -69,6 +69,12 @@ func NewPublisher(conn *amqp.Connection, log *zap.Logger, cfg *config.Config) (*
 func (p *Publisher) Close() error { return p.ch.Close() }
 
 func (p *Publisher) PublishJSON(ctx context.Context, exchangeName string, routingKey string, body any) error {
+	return p.PublishJSONWithID(ctx, exchangeName, routingKey, "", body)
+}
+
+// PublishJSONWithID publishes body with messageID as the AMQP message id. Messages published again after
+// a failure keep their id, consumers get them at least once and can drop the ones whose id they already handled.
+func (p *Publisher) PublishJSONWithID(ctx context.Context, exchangeName string, routingKey string, messageID string, body any) error {
 	b, err := sonic.Marshal(body)
 	if err != nil {
 		return err
@@ -91,6 +97,7 @@ func (p *Publisher) PublishJSON(ctx context.Context, exchangeName string, routin
 	propagator.Inject(ctx, tableCarrier{table: headers})
 
 	publishing := amqp.Publishing{
+		MessageId:    messageID,
 		ContentType:  "application/json",
 		DeliveryMode: amqp.Persistent,
 		Timestamp:    time.Now(),
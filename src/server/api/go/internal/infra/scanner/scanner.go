@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/webhook"
+	"go.uber.org/zap"
+)
+
+// Request is submitted to the scanner for every newly uploaded message file
+type Request struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	SHA256    string    `json:"sha256"`
+	Bucket    string    `json:"bucket"`
+	S3Key     string    `json:"s3_key"`
+}
+
+// Result is the verdict of the scanner, either in its response or posted back later.
+// An empty status means the scan is still running.
+type Result struct {
+	Status string `json:"status"`
+}
+
+// Scanner submits uploaded assets to a configured malware scanner endpoint
+type Scanner struct {
+	URL        string
+	Secret     string
+	MaxRetries int
+	Backoff    time.Duration
+	HTTPClient *http.Client
+	Logger     *zap.Logger
+}
+
+// NewScanner creates a new Scanner, or returns nil if no scanner URL is configured
+func NewScanner(cfg *config.Config, log *zap.Logger) *Scanner {
+	if cfg.Scan.URL == "" {
+		return nil
+	}
+	return &Scanner{
+		URL:        cfg.Scan.URL,
+		Secret:     cfg.Scan.Secret,
+		MaxRetries: cfg.Scan.MaxRetries,
+		Backoff:    time.Duration(cfg.Scan.BackoffMs) * time.Millisecond,
+		HTTPClient: &http.Client{
+			Timeout: time.Duration(cfg.Scan.TimeoutSec) * time.Second,
+		},
+		Logger: log,
+	}
+}
+
+// Scan submits req and returns the verdict of a scanner answering synchronously,
+// or an empty Result when the scanner accepted the request and posts the verdict back later.
+// Failed submissions are retried with exponential backoff.
+func (s *Scanner) Scan(ctx context.Context, req Request) (Result, error) {
+	body, err := sonic.Marshal(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("marshal scan request: %w", err)
+	}
+
+	backoff := s.Backoff
+	for attempt := 0; ; attempt++ {
+		res, err := s.submit(ctx, body)
+		if err == nil || attempt >= s.MaxRetries {
+			return res, err
+		}
+		s.Logger.Warn("retry scan request", zap.String("sha256", req.SHA256), zap.Int("attempt", attempt+1), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return Result{}, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (s *Scanner) submit(ctx context.Context, body []byte) (Result, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if s.Secret != "" {
+		ts := time.Now().Unix()
+		httpReq.Header.Set(webhook.TimestampHeader, strconv.FormatInt(ts, 10))
+		httpReq.Header.Set(webhook.SignatureHeader, webhook.SignAt(s.Secret, ts, body))
+	}
+
+	resp, err := s.HTTPClient.Do(httpReq)
+	if err != nil {
+		return Result{}, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Result{}, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var res Result
+	if resp.StatusCode == http.StatusAccepted || len(bytes.TrimSpace(respBody)) == 0 {
+		return res, nil
+	}
+	if err := sonic.Unmarshal(respBody, &res); err != nil {
+		return Result{}, fmt.Errorf("decode scan result: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,76 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/infra/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestScanner(url string) *Scanner {
+	return &Scanner{
+		URL:        url,
+		Secret:     "secret",
+		MaxRetries: 2,
+		Backoff:    time.Millisecond,
+		HTTPClient: &http.Client{Timeout: time.Second},
+		Logger:     zap.NewNop(),
+	}
+}
+
+func TestScanner_Scan_Retry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"status":"clean"}`))
+	}))
+	defer srv.Close()
+
+	res, err := newTestScanner(srv.URL).Scan(context.Background(), Request{ProjectID: uuid.New(), SHA256: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, "clean", res.Status)
+	assert.EqualValues(t, 3, calls.Load())
+}
+
+func TestScanner_Scan_GivesUp(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	_, err := newTestScanner(srv.URL).Scan(context.Background(), Request{ProjectID: uuid.New(), SHA256: "a"})
+	assert.Error(t, err)
+	assert.EqualValues(t, 3, calls.Load(), "the first attempt and two retries")
+}
+
+func TestScanner_Scan_Signed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, err := strconv.ParseInt(r.Header.Get(webhook.TimestampHeader), 10, 64)
+		if err != nil || r.Header.Get(webhook.SignatureHeader) != webhook.SignAt("secret", ts, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	res, err := newTestScanner(srv.URL).Scan(context.Background(), Request{ProjectID: uuid.New(), SHA256: "a"})
+	require.NoError(t, err)
+	assert.Empty(t, res.Status, "the verdict is posted back later")
+}
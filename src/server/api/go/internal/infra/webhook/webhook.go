@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/memodb-io/Acontext/internal/config"
+	"go.uber.org/zap"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body, prefixed with "sha256="
+const SignatureHeader = "X-Acontext-Signature"
+
+// TimestampHeader carries the unix time a request was signed at, which SignAt signs along with the body
+const TimestampHeader = "X-Acontext-Timestamp"
+
+// MaxSignatureAge is how far a signed timestamp may be from the current time before Verify rejects it as a replay
+const MaxSignatureAge = 5 * time.Minute
+
+var (
+	ErrBadSignature   = errors.New("invalid signature")
+	ErrStaleSignature = errors.New("signature timestamp is missing or too old")
+)
+
+// Sender delivers JSON payloads to a configured HTTP endpoint
+type Sender struct {
+	URL        string
+	Secret     string
+	MaxRetries int
+	Backoff    time.Duration
+	HTTPClient *http.Client
+	Logger     *zap.Logger
+}
+
+// NewSender creates a new Sender, or returns nil if no webhook URL is configured
+func NewSender(cfg *config.Config, log *zap.Logger) *Sender {
+	if cfg.Webhook.URL == "" {
+		return nil
+	}
+	return &Sender{
+		URL:        cfg.Webhook.URL,
+		Secret:     cfg.Webhook.Secret,
+		MaxRetries: cfg.Webhook.MaxRetries,
+		Backoff:    time.Duration(cfg.Webhook.BackoffMs) * time.Millisecond,
+		HTTPClient: &http.Client{
+			Timeout: time.Duration(cfg.Webhook.TimeoutSec) * time.Second,
+		},
+		Logger: log,
+	}
+}
+
+// Sign returns the signature header value of body for the given secret.
+// Senders should use SignAt, whose signatures Verify can check for replays.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignAt returns the signature header value of body signed at the unix time ts, covering "<ts>.<body>"
+func SignAt(secret string, ts int64, body []byte) string {
+	return Sign(secret, append([]byte(strconv.FormatInt(ts, 10)+"."), body...))
+}
+
+// Verify checks the signature and timestamp header values of a body signed with SignAt,
+// rejecting timestamps more than MaxSignatureAge away from now
+func Verify(secret, signature, timestamp string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrStaleSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > MaxSignatureAge || age < -MaxSignatureAge {
+		return ErrStaleSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(SignAt(secret, ts, body))) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// SendAsync delivers payload in the background, retrying with exponential backoff.
+// Delivery failures are only logged.
+func (s *Sender) SendAsync(payload any) {
+	body, err := sonic.Marshal(payload)
+	if err != nil {
+		s.Logger.Error("marshal webhook payload", zap.Error(err))
+		return
+	}
+
+	go func() {
+		backoff := s.Backoff
+		for attempt := 0; ; attempt++ {
+			err := s.send(context.Background(), body)
+			if err == nil {
+				return
+			}
+			if attempt >= s.MaxRetries {
+				s.Logger.Error("deliver webhook", zap.String("url", s.URL), zap.Int("attempts", attempt+1), zap.Error(err))
+				return
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}()
+}
+
+func (s *Sender) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Secret != "" {
+		ts := time.Now().Unix()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+		req.Header.Set(SignatureHeader, SignAt(s.Secret, ts, body))
+	}
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
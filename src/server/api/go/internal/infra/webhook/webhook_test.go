@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSignAt(t *testing.T) {
+	body := []byte(`{"event":"x"}`)
+	assert.Equal(t, Sign("secret", []byte(`1700000000.{"event":"x"}`)), SignAt("secret", 1700000000, body))
+	assert.NotEqual(t, SignAt("secret", 1700000000, body), SignAt("secret", 1700000001, body), "the timestamp is signed")
+	assert.NotEqual(t, SignAt("secret", 1700000000, body), SignAt("other", 1700000000, body))
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"event":"x"}`)
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name      string
+		signature string
+		timestamp string
+		body      []byte
+		want      error
+	}{
+		{name: "valid", signature: SignAt("secret", now.Unix(), body), timestamp: ts, body: body},
+		{name: "slight clock skew", signature: SignAt("secret", now.Unix()+60, body), timestamp: strconv.FormatInt(now.Unix()+60, 10), body: body},
+		{name: "wrong secret", signature: SignAt("other", now.Unix(), body), timestamp: ts, body: body, want: ErrBadSignature},
+		{name: "tampered body", signature: SignAt("secret", now.Unix(), body), timestamp: ts, body: []byte(`{"event":"y"}`), want: ErrBadSignature},
+		{name: "timestamp not signed", signature: Sign("secret", body), timestamp: ts, body: body, want: ErrBadSignature},
+		{name: "replayed with a new timestamp", signature: SignAt("secret", now.Unix()-10, body), timestamp: ts, body: body, want: ErrBadSignature},
+		{name: "missing timestamp", signature: SignAt("secret", now.Unix(), body), timestamp: "", body: body, want: ErrStaleSignature},
+		{name: "stale", signature: SignAt("secret", now.Add(-MaxSignatureAge-time.Second).Unix(), body), timestamp: strconv.FormatInt(now.Add(-MaxSignatureAge-time.Second).Unix(), 10), body: body, want: ErrStaleSignature},
+		{name: "from the future", signature: SignAt("secret", now.Add(MaxSignatureAge+time.Second).Unix(), body), timestamp: strconv.FormatInt(now.Add(MaxSignatureAge+time.Second).Unix(), 10), body: body, want: ErrStaleSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Verify("secret", tt.signature, tt.timestamp, tt.body, now))
+		})
+	}
+}
+
+func TestSender_Send(t *testing.T) {
+	t.Run("signs the timestamp and body", func(t *testing.T) {
+		var verifyErr error
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			verifyErr = Verify("secret", r.Header.Get(SignatureHeader), r.Header.Get(TimestampHeader), body, time.Now())
+		}))
+		defer srv.Close()
+
+		s := &Sender{URL: srv.URL, Secret: "secret", HTTPClient: srv.Client(), Logger: zap.NewNop()}
+		require.NoError(t, s.send(t.Context(), []byte(`{"event":"x"}`)))
+		assert.NoError(t, verifyErr)
+	})
+
+	t.Run("unsigned without a secret", func(t *testing.T) {
+		var header http.Header
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header.Clone()
+		}))
+		defer srv.Close()
+
+		s := &Sender{URL: srv.URL, HTTPClient: srv.Client(), Logger: zap.NewNop()}
+		require.NoError(t, s.send(t.Context(), []byte(`{}`)))
+		assert.Empty(t, header.Get(SignatureHeader))
+		assert.Empty(t, header.Get(TimestampHeader))
+	})
+
+	t.Run("non 2xx is an error", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+
+		s := &Sender{URL: srv.URL, HTTPClient: srv.Client(), Logger: zap.NewNop()}
+		assert.Error(t, s.send(t.Context(), []byte(`{}`)))
+	})
+}
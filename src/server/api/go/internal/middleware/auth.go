@@ -1,11 +1,14 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
@@ -17,10 +20,17 @@ import (
 	"github.com/memodb-io/Acontext/internal/pkg/utils/tokens"
 )
 
+// KeyUsageRecorder records the use of API keys, to write their last_used_at out of the request path
+type KeyUsageRecorder interface {
+	MarkUsed(keyID uuid.UUID, at time.Time)
+}
+
 // ProjectAuth returns a middleware that authenticates requests using project bearer tokens.
 // It validates the token, looks up the project in the database, and sets the project in the context.
+// The token is either the project token or one of its API keys, the scope it grants is set as "scope".
+// Revoked and expired API keys are rejected, the use of the others is recorded to usage.
 // It also sets the project_id attribute on the current span for telemetry filtering.
-func ProjectAuth(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
+func ProjectAuth(cfg *config.Config, db *gorm.DB, usage KeyUsageRecorder) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.GetHeader("Authorization")
 		if !strings.HasPrefix(auth, "Bearer ") {
@@ -37,9 +47,9 @@ func ProjectAuth(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
 
 		lookup := tokens.HMAC256Hex(cfg.Root.SecretPepper, secret)
 
-		var project model.Project
-		if err := db.WithContext(c.Request.Context()).Where(&model.Project{SecretKeyHMAC: lookup}).First(&project).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
+		project, key, err := lookupToken(c, db, cfg, secret, lookup)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errBadSecret) {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, serializer.AuthErr("Unauthorized"))
 				return
 			}
@@ -47,19 +57,100 @@ func ProjectAuth(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		pass, err := secrets.VerifySecret(secret, cfg.Root.SecretPepper, project.SecretKeyHashPHC)
-		if err != nil || !pass {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, serializer.AuthErr("Unauthorized"))
-			return
-		}
-
 		// Set project_id attribute on the current span for telemetry filtering
 		span := trace.SpanFromContext(c.Request.Context())
 		if span.SpanContext().IsValid() {
 			span.SetAttributes(attribute.String("project_id", project.ID.String()))
 		}
 
-		c.Set("project", &project)
+		scope := model.ScopeAdmin
+		if key != nil {
+			scope = key.Scope
+			if usage != nil {
+				usage.MarkUsed(key.ID, time.Now())
+			}
+		}
+
+		c.Set("project", project)
+		c.Set("scope", scope)
+		c.Next()
+	}
+}
+
+// StaticTokenAuth returns a middleware that requires the given bearer token, for routes outside of any project.
+// Without a token configured the routes are unavailable rather than open, and answer 503.
+func StaticTokenAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, serializer.Err(http.StatusServiceUnavailable, "no token is configured for this route", nil))
+			return
+		}
+		raw, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(raw), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, serializer.AuthErr("Unauthorized"))
+			return
+		}
+		c.Next()
+	}
+}
+
+var errBadSecret = errors.New("secret does not match")
+
+// lookupToken finds the project of a token, and the API key it is when it is not the project token.
+// The project token grants the admin scope, an API key its own scope until it is revoked or expires.
+func lookupToken(c *gin.Context, db *gorm.DB, cfg *config.Config, secret, lookup string) (*model.Project, *model.APIKey, error) {
+	ctx := c.Request.Context()
+
+	var project model.Project
+	err := db.WithContext(ctx).Where(&model.Project{SecretKeyHMAC: lookup}).First(&project).Error
+	if err == nil {
+		if pass, err := secrets.VerifySecret(secret, cfg.Root.SecretPepper, project.SecretKeyHashPHC); err != nil || !pass {
+			return nil, nil, errBadSecret
+		}
+		return &project, nil, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	var key model.APIKey
+	if err := db.WithContext(ctx).Preload("Project").
+		Where("secret_key_hmac = ? AND revoked_at IS NULL", lookup).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		First(&key).Error; err != nil {
+		return nil, nil, err
+	}
+	if key.Project == nil {
+		return nil, nil, gorm.ErrRecordNotFound
+	}
+	if pass, err := secrets.VerifySecret(secret, cfg.Root.SecretPepper, key.SecretKeyHashPHC); err != nil || !pass {
+		return nil, nil, errBadSecret
+	}
+	return key.Project, &key, nil
+}
+
+// RequireScope returns a middleware that rejects with 403 the requests whose token does not grant the scope.
+// It must run after ProjectAuth.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !model.ScopeAllows(c.GetString("scope"), scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, serializer.Err(http.StatusForbidden, "this API key requires the "+scope+" scope", nil))
+			return
+		}
 		c.Next()
 	}
 }
+
+// RequireScopeByMethod returns a middleware that requires the read scope for GET and HEAD requests,
+// and the write scope for any other method. It must run after ProjectAuth.
+func RequireScopeByMethod() gin.HandlerFunc {
+	read, write := RequireScope(model.ScopeRead), RequireScope(model.ScopeWrite)
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead:
+			read(c)
+		default:
+			write(c)
+		}
+	}
+}
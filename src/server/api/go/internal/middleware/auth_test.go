@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticTokenAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		token      string
+		header     string
+		wantStatus int
+	}{
+		{name: "valid token", token: "secret", header: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "wrong token", token: "secret", header: "Bearer other", wantStatus: http.StatusUnauthorized},
+		{name: "missing header", token: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "not a bearer token", token: "secret", header: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "no token configured", header: "Bearer ", wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.POST("/internal/assets/gc", StaticTokenAuth(tt.token), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodPost, "/internal/assets/gc", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
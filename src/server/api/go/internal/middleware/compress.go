@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/memodb-io/Acontext/internal/config"
+)
+
+// Content types that are already compressed or streamed, and are never compressed again
+var uncompressedContentTypes = []string{
+	"text/event-stream",
+	"image/",
+	"audio/",
+	"video/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/octet-stream",
+}
+
+// Compression returns a middleware that gzip (or deflate) compresses responses once they reach
+// MinSizeBytes, for clients that accept it. Smaller responses, responses that already set a
+// Content-Encoding and already-compressed or streamed content types are sent as is.
+// Every response that could be compressed has Vary: Accept-Encoding, whether it was or not, so that
+// caches do not serve one encoding to clients asking for another.
+// A handler calling Flush stops the buffering, so streaming responses are never held back.
+func Compression(cfg config.CompressionCfg) gin.HandlerFunc {
+	level := cfg.Level
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	pools := map[string]*sync.Pool{
+		"gzip": {New: func() any {
+			w, _ := gzip.NewWriterLevel(io.Discard, level)
+			return w
+		}},
+		// HTTP deflate is the zlib format, not raw deflate
+		"deflate": {New: func() any {
+			w, _ := zlib.NewWriterLevel(io.Discard, level)
+			return w
+		}},
+	}
+
+	return func(c *gin.Context) {
+		// responses are still wrapped when not compressed, to set Vary
+		var encoding string
+		if c.Request.Method != http.MethodHead {
+			encoding = negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: c.Writer,
+			encoding:       encoding,
+			pool:           pools[encoding],
+			minSize:        cfg.MinSizeBytes,
+		}
+		c.Writer = cw
+		defer func() {
+			cw.finish()
+			c.Writer = cw.ResponseWriter
+		}()
+
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header, "" if neither is accepted
+func negotiateEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+	switch {
+	case accepted["gzip"], accepted["*"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	default:
+		return ""
+	}
+}
+
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressWriter buffers the body until it reaches minSize, then switches to compressing it.
+// Bodies that end below minSize are written uncompressed by finish.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string // "" when the client accepts no encoding
+	pool     *sync.Pool
+	minSize  int
+
+	started     bool // set once the first write decided how the body is sent
+	buf         []byte
+	enc         flushWriteCloser // set once compressing
+	passthrough bool             // set once the body is written uncompressed
+}
+
+// start decides from the headers set by the handler whether the body may be compressed
+func (w *compressWriter) start() {
+	w.started = true
+	if !w.compressible() {
+		w.passthrough = true
+		return
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if w.encoding == "" {
+		w.passthrough = true
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.started {
+		w.start()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.enc != nil {
+		return w.enc.Write(data)
+	}
+
+	w.buf = append(w.buf, data...)
+	if len(w.buf) >= w.minSize {
+		if err := w.startCompression(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what was written so far. Before the threshold is reached the buffered bytes go out
+// uncompressed and the rest of the response follows them as is.
+func (w *compressWriter) Flush() {
+	if !w.started {
+		w.start()
+	}
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	} else if !w.passthrough {
+		w.passthrough = true
+		if len(w.buf) > 0 {
+			_, _ = w.ResponseWriter.Write(w.buf)
+			w.buf = nil
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// compressible reports whether the response may be compressed, judged from the headers set by the handler
+func (w *compressWriter) compressible() bool {
+	switch status := w.Status(); {
+	case status < http.StatusOK, status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, t := range uncompressedContentTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *compressWriter) startCompression() error {
+	header := w.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+
+	w.enc = w.pool.Get().(flushWriteCloser)
+	w.enc.Reset(w.ResponseWriter)
+	_, err := w.enc.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// finish writes out the remaining body once the handlers are done
+func (w *compressWriter) finish() {
+	if w.enc != nil {
+		_ = w.enc.Close()
+		w.enc.Reset(io.Discard)
+		w.pool.Put(w.enc)
+		w.enc = nil
+		return
+	}
+	if len(w.buf) > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/memodb-io/Acontext/internal/config"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "gzip", want: "gzip"},
+		{header: "deflate", want: "deflate"},
+		{header: "deflate, gzip", want: "gzip"},
+		{header: "gzip;q=0, deflate", want: "deflate"},
+		{header: "GZIP; q=0.5", want: "gzip"},
+		{header: "*", want: "gzip"},
+		{header: "br, identity", want: ""},
+		{header: "gzip;q=0", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, negotiateEncoding(tt.header))
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	large := strings.Repeat("compress me ", 200)
+
+	r := gin.New()
+	r.Use(Compression(config.CompressionCfg{Enabled: true, MinSizeBytes: 1024, Level: -1}))
+	r.Match([]string{http.MethodGet, http.MethodHead}, "/large", func(c *gin.Context) { c.String(http.StatusOK, large) })
+	r.GET("/small", func(c *gin.Context) { c.String(http.StatusOK, "small") })
+	r.GET("/image", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(large)) })
+	r.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain")
+		_, _ = c.Writer.WriteString("first")
+		c.Writer.Flush()
+		_, _ = c.Writer.WriteString(large)
+	})
+
+	decode := map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		accept       string
+		wantEncoding string
+		wantVary     bool
+		wantBody     string
+	}{
+		{name: "gzip", path: "/large", accept: "gzip", wantEncoding: "gzip", wantVary: true, wantBody: large},
+		{name: "deflate is zlib", path: "/large", accept: "deflate", wantEncoding: "deflate", wantVary: true, wantBody: large},
+		{name: "no accepted encoding", path: "/large", wantVary: true, wantBody: large},
+		{name: "below threshold", path: "/small", accept: "gzip", wantVary: true, wantBody: "small"},
+		{name: "head", method: http.MethodHead, path: "/large", accept: "gzip", wantVary: true},
+		{name: "already compressed content type", path: "/image", accept: "gzip", wantBody: large},
+		{name: "flush stops buffering", path: "/stream", accept: "gzip", wantVary: true, wantBody: "first" + large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantEncoding, w.Header().Get("Content-Encoding"))
+			if tt.wantVary {
+				assert.Equal(t, []string{"Accept-Encoding"}, w.Header().Values("Vary"))
+			} else {
+				assert.Empty(t, w.Header().Values("Vary"))
+			}
+
+			var body io.Reader = w.Body
+			if tt.wantEncoding != "" {
+				var err error
+				body, err = decode[tt.wantEncoding](w.Body)
+				require.NoError(t, err)
+			}
+			got, err := io.ReadAll(body)
+			require.NoError(t, err)
+			if method != http.MethodHead {
+				assert.Equal(t, tt.wantBody, string(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+)
+
+// ConcurrencyLimit returns a middleware that bounds the number of in-flight requests per route.
+// Routes are keyed by "METHOD /full/route/path" (e.g. "GET /api/v1/session/:session_id/token_counts").
+// A request waits up to MaxWaitMs for a free slot and is rejected with 503 otherwise.
+// Routes without a configured limit are not affected.
+func ConcurrencyLimit(cfg config.ConcurrencyCfg) gin.HandlerFunc {
+	sems := make(map[string]chan struct{}, len(cfg.Routes))
+	for route, limit := range cfg.Routes {
+		if limit <= 0 {
+			continue
+		}
+		// viper lowercases map keys, so match routes case-insensitively
+		sems[strings.ToLower(route)] = make(chan struct{}, limit)
+	}
+	maxWait := time.Duration(cfg.MaxWaitMs) * time.Millisecond
+
+	return func(c *gin.Context) {
+		sem, ok := sems[strings.ToLower(c.Request.Method+" "+c.FullPath())]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			if maxWait <= 0 {
+				abortTooManyConcurrent(c)
+				return
+			}
+			timer := time.NewTimer(maxWait)
+			defer timer.Stop()
+			select {
+			case sem <- struct{}{}:
+			case <-timer.C:
+				abortTooManyConcurrent(c)
+				return
+			case <-c.Request.Context().Done():
+				abortTooManyConcurrent(c)
+				return
+			}
+		}
+		defer func() { <-sem }()
+
+		c.Next()
+	}
+}
+
+func abortTooManyConcurrent(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, serializer.Err(http.StatusServiceUnavailable, "too many concurrent requests, please retry later", nil))
+}
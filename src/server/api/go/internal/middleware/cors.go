@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/memodb-io/Acontext/internal/config"
+)
+
+// CORS returns a middleware answering cross-origin requests from the allowed origins. Preflight OPTIONS
+// requests are answered with 204 without reaching the routes, or with 403 for origins that are not allowed.
+// With no allowed origins, localhost origins are allowed outside of gin's release mode and none in release mode.
+func CORS(cfg config.CORSCfg, env string) gin.HandlerFunc {
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	allowed := func(origin string) bool {
+		if len(cfg.AllowedOrigins) == 0 {
+			return env != gin.ReleaseMode && isLocalhostOrigin(origin)
+		}
+		return anyOrigin || slices.Contains(cfg.AllowedOrigins, origin)
+	}
+
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(cfg.MaxAgeSec)
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !allowed(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// without CORS headers, browsers hide the response from the page
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		if anyOrigin && !cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			} else if requested := c.GetHeader("Access-Control-Request-Headers"); requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+			if cfg.MaxAgeSec > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if exposed != "" {
+			h.Set("Access-Control-Expose-Headers", exposed)
+		}
+		c.Next()
+	}
+}
+
+// isLocalhostOrigin reports whether origin is served from localhost, on any port
+func isLocalhostOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
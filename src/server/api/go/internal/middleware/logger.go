@@ -9,7 +9,7 @@ import (
 )
 
 // ZapLogger returns a middleware that logs HTTP requests using zap logger.
-// It logs API paths (/api/*) at info level and other paths at debug level.
+// It logs API paths (/api/*) at info level and other paths at debug level, with the ID set by RequestID.
 func ZapLogger(log *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
@@ -27,6 +27,7 @@ func ZapLogger(log *zap.Logger) gin.HandlerFunc {
 				"status", c.Writer.Status(),
 				"latency", dur.String(),
 				"clientIP", c.ClientIP(),
+				"request_id", c.GetString("request_id"),
 			)
 		} else {
 			log.Sugar().Debugw("HTTP",
@@ -35,6 +36,7 @@ func ZapLogger(log *zap.Logger) gin.HandlerFunc {
 				"status", c.Writer.Status(),
 				"latency", dur.String(),
 				"clientIP", c.ClientIP(),
+				"request_id", c.GetString("request_id"),
 			)
 		}
 	}
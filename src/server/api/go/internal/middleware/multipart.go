@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+)
+
+// MultipartLimit returns a middleware that bounds the size of multipart/form-data requests.
+// A request declaring a larger Content-Length is rejected before its body is read. Otherwise the
+// form is parsed here through a capped reader, so a body that turns out larger is rejected with 413
+// as soon as the limit is hit, before it fills memory or temp files, and the connection is closed.
+// Handlers then read files from the already parsed form. Other requests are not affected.
+//
+// routeLimits holds the body limits of routes, keyed by route path, that cap their requests whatever
+// the content type, like message.maxBodyBytes for store message requests. A multipart request of such a
+// route must fit both limits: the smaller one applies, 0 standing for no limit.
+func MultipartLimit(cfg config.MultipartCfg, routeLimits map[string]int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			c.Next()
+			return
+		}
+		maxBytes := cfg.MaxBodyBytes
+		if l := routeLimits[c.FullPath()]; l > 0 && (maxBytes <= 0 || l < maxBytes) {
+			maxBytes = l
+		}
+		if maxBytes <= 0 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			c.Header("Connection", "close")
+			abortBodyTooLarge(c, maxBytes)
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		if err := c.Request.ParseMultipartForm(cfg.MaxMemoryBytes); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abortBodyTooLarge(c, maxBytes)
+				return
+			}
+			// leave malformed forms to the handler, which reports them as bad requests
+		}
+
+		c.Next()
+	}
+}
+
+func abortBodyTooLarge(c *gin.Context, maxBytes int64) {
+	maxMB := float64(maxBytes) / (1024 * 1024)
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, serializer.ParamErr("", fmt.Errorf("request body exceeds maximum allowed size of %.2fMB", maxMB)))
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/memodb-io/Acontext/internal/config"
+)
+
+// multipartBody returns a form with a file of size bytes, and its content type
+func multipartBody(t *testing.T, size int) (*bytes.Buffer, string) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	require.NoError(t, w.WriteField("payload", `{"blob":{}}`))
+	fw, err := w.CreateFormFile("file", "data.bin")
+	require.NoError(t, err)
+	_, err = fw.Write(bytes.Repeat([]byte("a"), size))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return &buf, w.FormDataContentType()
+}
+
+func TestMultipartLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const routePath = "/session/:session_id/messages"
+
+	tests := []struct {
+		name        string
+		cfg         config.MultipartCfg
+		routeLimit  int64
+		path        string
+		fileSize    int
+		contentType string // multipart when empty
+		streamed    bool   // sent without Content-Length
+		wantStatus  int
+	}{
+		{name: "within the limit", cfg: config.MultipartCfg{MaxBodyBytes: 4096}, path: "/upload", fileSize: 1024, wantStatus: http.StatusOK},
+		{name: "declared length over the limit", cfg: config.MultipartCfg{MaxBodyBytes: 4096}, path: "/upload", fileSize: 8192, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "streamed body over the limit", cfg: config.MultipartCfg{MaxBodyBytes: 4096}, path: "/upload", fileSize: 8192, streamed: true, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "no limit", path: "/upload", fileSize: 8192, wantStatus: http.StatusOK},
+		{name: "other content types are not capped", cfg: config.MultipartCfg{MaxBodyBytes: 4096}, path: "/upload", fileSize: 8192, contentType: "application/octet-stream", wantStatus: http.StatusOK},
+		{name: "smaller route limit applies", cfg: config.MultipartCfg{MaxBodyBytes: 16384}, routeLimit: 4096, path: "/session/abc/messages", fileSize: 8192, streamed: true, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "smaller multipart limit applies", cfg: config.MultipartCfg{MaxBodyBytes: 4096}, routeLimit: 16384, path: "/session/abc/messages", fileSize: 8192, streamed: true, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "route limit without multipart limit", routeLimit: 4096, path: "/session/abc/messages", fileSize: 8192, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "route limit only caps its route", cfg: config.MultipartCfg{MaxBodyBytes: 16384}, routeLimit: 4096, path: "/upload", fileSize: 8192, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(MultipartLimit(tt.cfg, map[string]int64{routePath: tt.routeLimit}))
+			var gotFileSize int64
+			handler := func(c *gin.Context) {
+				if form := c.Request.MultipartForm; form != nil && len(form.File["file"]) > 0 {
+					gotFileSize = form.File["file"][0].Size
+				}
+				c.Status(http.StatusOK)
+			}
+			r.POST("/upload", handler)
+			r.POST(routePath, handler)
+
+			body, contentType := multipartBody(t, tt.fileSize)
+			if tt.contentType != "" {
+				contentType = tt.contentType
+			}
+			var reader io.Reader = body
+			if tt.streamed {
+				reader = io.MultiReader(body) // hides the length from NewRequest
+			}
+			req := httptest.NewRequest(http.MethodPost, tt.path, reader)
+			req.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusRequestEntityTooLarge {
+				assert.Contains(t, w.Body.String(), "request body exceeds maximum allowed size")
+			}
+			if tt.wantStatus == http.StatusOK && tt.contentType == "" && (tt.cfg.MaxBodyBytes > 0 || tt.routeLimit > 0) {
+				// the form was parsed by the middleware
+				assert.Equal(t, int64(tt.fileSize), gotFileSize)
+			}
+		})
+	}
+}
+
+func TestMultipartLimit_MalformedForm(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(MultipartLimit(config.MultipartCfg{MaxBodyBytes: 4096}, nil))
+	r.POST("/upload", func(c *gin.Context) {
+		_, err := c.MultipartForm()
+		assert.Error(t, err)
+		c.Status(http.StatusBadRequest)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("not a form"))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+)
+
+// setupRateLimitRouter returns a router limited by RateLimit, the project of a request is the one
+// named by its X-Project header
+func setupRateLimitRouter(cfg config.RateLimitCfg, rdb *redis.Client, projects map[string]*model.Project) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("project", projects[c.GetHeader("X-Project")])
+		c.Next()
+	})
+	r.Use(RateLimit(cfg, rdb, zap.NewNop()))
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func TestRateLimit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	now := time.Now()
+	mr.SetTime(now)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	projects := map[string]*model.Project{
+		"a":      {ID: uuid.New()},
+		"b":      {ID: uuid.New()},
+		"custom": {ID: uuid.New(), Configs: datatypes.JSONMap{"rate_limit_per_sec": 10.0, "rate_limit_burst": 4.0}},
+	}
+	r := setupRateLimitRouter(config.RateLimitCfg{Enabled: true, RequestsPerSec: 0.5, Burst: 2}, rdb, projects)
+	get := func(project string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("X-Project", project)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// the burst goes through, then the bucket is empty
+	assert.Equal(t, http.StatusOK, get("a").Code)
+	assert.Equal(t, http.StatusOK, get("a").Code)
+	w := get("a")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	// a token comes back every 2s
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	var body struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, http.StatusTooManyRequests, body.Code)
+	assert.Equal(t, "rate limit exceeded, please retry later", body.Msg)
+
+	// every project has its own bucket
+	assert.Equal(t, http.StatusOK, get("b").Code)
+	assert.Equal(t, http.StatusOK, get("b").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get("b").Code)
+
+	// project configs override the global limits
+	for range 4 {
+		assert.Equal(t, http.StatusOK, get("custom").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, get("custom").Code)
+
+	// the bucket refills over time
+	mr.SetTime(now.Add(time.Second))
+	w = get("a")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	mr.SetTime(now.Add(2 * time.Second))
+	assert.Equal(t, http.StatusOK, get("a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get("a").Code)
+}
+
+func TestRateLimit_RedisUnavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	defer rdb.Close()
+	mr.Close()
+
+	projects := map[string]*model.Project{"a": {ID: uuid.New()}}
+	r := setupRateLimitRouter(config.RateLimitCfg{Enabled: true, RequestsPerSec: 1, Burst: 1}, rdb, projects)
+	for range 3 {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("X-Project", "a")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
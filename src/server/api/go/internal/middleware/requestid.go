@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/memodb-io/Acontext/internal/pkg/requestid"
+)
+
+// RequestID returns a middleware that keeps the X-Request-ID of the request, or generates one when it is
+// missing or invalid. The ID is echoed in the response header, set as "request_id" in the gin context and
+// in the request context for outbound calls and service logs (see requestid.Logger), and set on the current
+// span. ZapLogger logs it.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		c.Header(requestid.Header, id)
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(requestid.WithID(c.Request.Context(), id))
+
+		span := trace.SpanFromContext(c.Request.Context())
+		if span.SpanContext().IsValid() {
+			span.SetAttributes(attribute.String("request_id", id))
+		}
+		c.Next()
+	}
+}
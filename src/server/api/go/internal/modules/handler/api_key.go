@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type APIKeyHandler struct {
+	svc service.APIKeyService
+}
+
+func NewAPIKeyHandler(s service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{svc: s}
+}
+
+type CreateAPIKeyReq struct {
+	Name  string `form:"name" json:"name" example:"ci-reader"`
+	Scope string `form:"scope" json:"scope" binding:"required,oneof=read write admin" example:"read"`
+	// Seconds until the key expires, 0 never expires
+	ExpiresInSec int `form:"expires_in_sec" json:"expires_in_sec" binding:"min=0" example:"2592000"`
+}
+
+// CreateAPIKey godoc
+//
+//	@Summary		Create API key
+//	@Description	Create an API key of the project with a scope: read allows GET requests, write allows any request but managing API keys, admin allows any request. Expired keys are rejected with 401. The token is only returned in this response. Requires the admin scope.
+//	@Tags			api_key
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.CreateAPIKeyReq	true	"CreateAPIKey payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=service.CreateAPIKeyOutput}
+//	@Router			/api_keys [post]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Create a read-only API key, its token is only returned once\nkey = client.api_keys.create(name='ci-reader', scope='read')\nprint(f\"Created API key {key.id}: {key.token}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Create a read-only API key, its token is only returned once\nconst key = await client.apiKeys.create({ name: 'ci-reader', scope: 'read' });\nconsole.log(`Created API key ${key.id}: ${key.token}`);\n","label":"JavaScript"}]
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	req := CreateAPIKeyReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	in := service.CreateAPIKeyInput{
+		ProjectID: project.ID,
+		Name:      req.Name,
+		Scope:     req.Scope,
+	}
+	if req.ExpiresInSec > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInSec) * time.Second)
+		in.ExpiresAt = &expiresAt
+	}
+	out, err := h.svc.Create(c.Request.Context(), in)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: out})
+}
+
+// ListAPIKeys godoc
+//
+//	@Summary		List API keys
+//	@Description	List the API keys of the project, revoked ones included, newest first. Tokens are not returned. Requires the admin scope.
+//	@Tags			api_key
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.APIKey}
+//	@Router			/api_keys [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# List API keys\nfor key in client.api_keys.list():\n    print(f\"{key.id} {key.name} {key.scope} revoked={key.revoked_at is not None}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// List API keys\nfor (const key of await client.apiKeys.list()) {\n  console.log(`${key.id} ${key.name} ${key.scope} revoked=${key.revoked_at != null}`);\n}\n","label":"JavaScript"}]
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	keys, err := h.svc.List(c.Request.Context(), project.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: keys})
+}
+
+// RevokeAPIKey godoc
+//
+//	@Summary		Revoke API key
+//	@Description	Revoke an API key of the project, requests with its token are rejected from then on. Requires the admin scope.
+//	@Tags			api_key
+//	@Accept			json
+//	@Produce		json
+//	@Param			key_id	path	string	true	"API key ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Failure		404	{object}	serializer.Response{}
+//	@Router			/api_keys/{key_id} [delete]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Revoke an API key\nclient.api_keys.revoke(key_id='key-uuid')\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Revoke an API key\nawait client.apiKeys.revoke('key-uuid');\n","label":"JavaScript"}]
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	keyID, err := uuid.Parse(c.Param("key_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	if err := h.svc.Revoke(c.Request.Context(), project.ID, keyID); err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
+
+// RotateAPIKey godoc
+//
+//	@Summary		Rotate API key
+//	@Description	Replace an API key by a new one of the same name and scope, returning the new token only in this response. An expiring key is replaced by a key of the same lifetime. The previous token stays valid for a short overlap window (1 hour by default) so that clients can switch to the new one. Requires the admin scope.
+//	@Tags			api_key
+//	@Accept			json
+//	@Produce		json
+//	@Param			key_id	path	string	true	"API key ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=service.CreateAPIKeyOutput}
+//	@Failure		404	{object}	serializer.Response{}
+//	@Router			/api_keys/{key_id}/rotate [post]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Rotate an API key, the previous token keeps working for a while\nkey = client.api_keys.rotate(key_id='key-uuid')\nprint(f\"New API key {key.id}: {key.token}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Rotate an API key, the previous token keeps working for a while\nconst key = await client.apiKeys.rotate('key-uuid');\nconsole.log(`New API key ${key.id}: ${key.token}`);\n","label":"JavaScript"}]
+func (h *APIKeyHandler) RotateAPIKey(c *gin.Context) {
+	keyID, err := uuid.Parse(c.Param("key_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Rotate(c.Request.Context(), project.ID, keyID)
+	if err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: out})
+}
@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockAPIKeyService is a mock implementation of APIKeyService
+type MockAPIKeyService struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyService) Create(ctx context.Context, in service.CreateAPIKeyInput) (*service.CreateAPIKeyOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.CreateAPIKeyOutput), args.Error(1)
+}
+
+func (m *MockAPIKeyService) List(ctx context.Context, projectID uuid.UUID) ([]model.APIKey, error) {
+	args := m.Called(ctx, projectID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyService) Revoke(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) error {
+	args := m.Called(ctx, projectID, keyID)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyService) Rotate(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) (*service.CreateAPIKeyOutput, error) {
+	args := m.Called(ctx, projectID, keyID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.CreateAPIKeyOutput), args.Error(1)
+}
+
+func (m *MockAPIKeyService) MarkUsed(keyID uuid.UUID, at time.Time) {
+	m.Called(keyID, at)
+}
+
+func (m *MockAPIKeyService) FlushLastUsed(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func TestAPIKeyHandler_CreateAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	projectID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockAPIKeyService)
+		expectedStatus int
+	}{
+		{
+			name: "created",
+			body: `{"name":"ci","scope":"read"}`,
+			setup: func(svc *MockAPIKeyService) {
+				svc.On("Create", mock.Anything, service.CreateAPIKeyInput{ProjectID: projectID, Name: "ci", Scope: model.ScopeRead}).
+					Return(&service.CreateAPIKeyOutput{
+						APIKey: model.APIKey{ID: uuid.New(), ProjectID: projectID, Name: "ci", Scope: model.ScopeRead, SecretKeyHMAC: "hmac", SecretKeyHashPHC: "phc"},
+						Token:  "sk-ac-secret",
+					}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "expiring",
+			body: `{"scope":"read","expires_in_sec":3600}`,
+			setup: func(svc *MockAPIKeyService) {
+				svc.On("Create", mock.Anything, mock.MatchedBy(func(in service.CreateAPIKeyInput) bool {
+					return in.ExpiresAt != nil && time.Until(*in.ExpiresAt) > 59*time.Minute && time.Until(*in.ExpiresAt) <= time.Hour
+				})).Return(&service.CreateAPIKeyOutput{Token: "sk-ac-secret"}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "negative expiry",
+			body:           `{"scope":"read","expires_in_sec":-1}`,
+			setup:          func(svc *MockAPIKeyService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid scope",
+			body:           `{"scope":"owner"}`,
+			setup:          func(svc *MockAPIKeyService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing scope",
+			body:           `{"name":"ci"}`,
+			setup:          func(svc *MockAPIKeyService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "service error",
+			body: `{"scope":"write"}`,
+			setup: func(svc *MockAPIKeyService) {
+				svc.On("Create", mock.Anything, mock.Anything).Return(nil, errors.New("db down"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAPIKeyService{}
+			tt.setup(mockService)
+			handler := NewAPIKeyHandler(mockService)
+
+			router := gin.New()
+			router.POST("/api_keys", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.CreateAPIKey(c)
+			})
+
+			req := httptest.NewRequest("POST", "/api_keys", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusCreated {
+				var resp struct {
+					Data map[string]any `json:"data"`
+				}
+				require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, "sk-ac-secret", resp.Data["token"])
+				assert.NotContains(t, resp.Data, "secret_key_hmac")
+				assert.NotContains(t, w.Body.String(), "phc")
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAPIKeyHandler_ListAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	projectID := uuid.New()
+
+	mockService := &MockAPIKeyService{}
+	mockService.On("List", mock.Anything, projectID).Return([]model.APIKey{
+		{ID: uuid.New(), ProjectID: projectID, Scope: model.ScopeAdmin, SecretKeyHMAC: "hmac", SecretKeyHashPHC: "phc"},
+	}, nil)
+	handler := NewAPIKeyHandler(mockService)
+
+	router := gin.New()
+	router.GET("/api_keys", func(c *gin.Context) {
+		c.Set("project", &model.Project{ID: projectID})
+		handler.ListAPIKeys(c)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api_keys", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"scope":"admin"`)
+	assert.NotContains(t, w.Body.String(), "hmac")
+	assert.NotContains(t, w.Body.String(), "token")
+}
+
+func TestAPIKeyHandler_RevokeAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	projectID, keyID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name           string
+		keyID          string
+		setup          func(*MockAPIKeyService)
+		expectedStatus int
+	}{
+		{
+			name:  "revoked",
+			keyID: keyID.String(),
+			setup: func(svc *MockAPIKeyService) {
+				svc.On("Revoke", mock.Anything, projectID, keyID).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "not found",
+			keyID: keyID.String(),
+			setup: func(svc *MockAPIKeyService) {
+				svc.On("Revoke", mock.Anything, projectID, keyID).Return(service.ErrAPIKeyNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid key id",
+			keyID:          "not-a-uuid",
+			setup:          func(svc *MockAPIKeyService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAPIKeyService{}
+			tt.setup(mockService)
+			handler := NewAPIKeyHandler(mockService)
+
+			router := gin.New()
+			router.DELETE("/api_keys/:key_id", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.RevokeAPIKey(c)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("DELETE", "/api_keys/"+tt.keyID, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAPIKeyHandler_RotateAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	projectID, keyID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name           string
+		setup          func(*MockAPIKeyService)
+		expectedStatus int
+	}{
+		{
+			name: "rotated",
+			setup: func(svc *MockAPIKeyService) {
+				svc.On("Rotate", mock.Anything, projectID, keyID).Return(&service.CreateAPIKeyOutput{
+					APIKey: model.APIKey{ID: uuid.New(), ProjectID: projectID, Scope: model.ScopeWrite},
+					Token:  "sk-ac-new",
+				}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "revoked or expired",
+			setup: func(svc *MockAPIKeyService) {
+				svc.On("Rotate", mock.Anything, projectID, keyID).Return(nil, service.ErrAPIKeyNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAPIKeyService{}
+			tt.setup(mockService)
+			handler := NewAPIKeyHandler(mockService)
+
+			router := gin.New()
+			router.POST("/api_keys/:key_id/rotate", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.RotateAPIKey(c)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/api_keys/"+keyID.String()+"/rotate", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusCreated {
+				assert.Contains(t, w.Body.String(), `"token":"sk-ac-new"`)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
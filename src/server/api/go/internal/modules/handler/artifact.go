@@ -203,7 +203,7 @@ type GetArtifactResp struct {
 //	@Param			file_path		query	string	true	"File path including filename"								example(/documents/report.pdf)
 //	@Param			with_public_url	query	boolean	false	"Whether to return public URL, default is true"				example(true)
 //	@Param			with_content	query	boolean	false	"Whether to return parsed file content, default is true"	example(true)
-//	@Param			expire			query	int		false	"Expire time in seconds for presigned URL (default: 3600)"	example(3600)
+//	@Param			expire			query	int		false	"Expire time in seconds for presigned URL (default: 3600). Capped by the server s3.presignMaxExpireSec, a capped expiry is reported in a Warning header"	example(3600)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=handler.GetArtifactResp}
 //	@Router			/disk/{disk_id}/artifact [get]
@@ -240,7 +240,8 @@ func (h *ArtifactHandler) GetArtifact(c *gin.Context) {
 
 	// Generate presigned URL if requested
 	if req.WithPublicURL {
-		url, err := h.svc.GetPresignedURL(c.Request.Context(), artifact, time.Duration(req.Expire)*time.Second)
+		expire := presignExpire(c, h.config, time.Duration(req.Expire)*time.Second, c.Query("expire") != "")
+		url, err := h.svc.GetPresignedURL(c.Request.Context(), artifact, expire)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 			return
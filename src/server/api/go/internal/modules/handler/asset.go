@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/webhook"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+type AssetHandler struct {
+	svc    service.AssetService
+	config *config.Config
+}
+
+func NewAssetHandler(s service.AssetService, cfg *config.Config) *AssetHandler {
+	return &AssetHandler{svc: s, config: cfg}
+}
+
+// GC purges orphaned assets right away instead of waiting for the periodic run.
+// It is an internal endpoint and is not part of the public API docs.
+func (h *AssetHandler) GC(c *gin.Context) {
+	out, err := h.svc.GC(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, service.ErrAssetGCRunning) {
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.Err(http.StatusInternalServerError, "asset gc failed", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type ScanResultReq struct {
+	ProjectID string `json:"project_id" binding:"required,uuid"`
+	SHA256    string `json:"sha256" binding:"required,len=64"`
+	Status    string `json:"status" binding:"required,oneof=clean infected"`
+}
+
+// ScanResult records the verdict of a malware scanner that answered a scan request asynchronously.
+// The body must be signed with the scan secret along with a recent timestamp, like the scan requests are,
+// and results are refused while no secret is configured.
+// It is an internal endpoint and is not part of the public API docs.
+func (h *AssetHandler) ScanResult(c *gin.Context) {
+	secret := h.config.Scan.Secret
+	if secret == "" {
+		c.JSON(http.StatusServiceUnavailable, serializer.Err(http.StatusServiceUnavailable, "scan results are not accepted without a scan secret", nil))
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	if err := webhook.Verify(secret, c.GetHeader(webhook.SignatureHeader), c.GetHeader(webhook.TimestampHeader), body, time.Now()); err != nil {
+		c.JSON(http.StatusUnauthorized, serializer.AuthErr("invalid scan result signature: "+err.Error()))
+		return
+	}
+
+	req := ScanResultReq{}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := h.svc.SetScanStatus(c.Request.Context(), uuid.MustParse(req.ProjectID), req.SHA256, req.Status); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidScanStatus):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		case errors.Is(err, service.ErrAssetNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
+
+// sha256Pattern matches a lowercase hex SHA256 digest as assets are keyed by
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// assetErr responds to a failed asset lookup or deletion
+func assetErr(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrAssetNotFound):
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+	case errors.Is(err, service.ErrAssetInUse):
+		c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+	default:
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+	}
+}
+
+type ListAssetsReq struct {
+	Limit    int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
+	Cursor   string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	TimeDesc bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+}
+
+// ListAssets godoc
+//
+//	@Summary		List assets
+//	@Description	List the assets stored for the project with their reference counts. Assets are deduplicated by content, so each is listed once however many messages or artifacts reference it.
+//	@Tags			asset
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit		query	integer	false	"Limit of assets to return, default 20. Max 200."
+//	@Param			cursor		query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Param			time_desc	query	string	false	"Order by created_at descending if true, ascending if false (default false)"	example(false)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ListAssetsOutput}
+//	@Router			/assets [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# List assets\nassets = client.assets.list(limit=20)\nfor asset in assets.items:\n    print(f\"{asset.sha256}: {asset.ref_count} references\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// List assets\nconst assets = await client.assets.list({ limit: 20 });\nfor (const asset of assets.items) {\n  console.log(`${asset.sha256}: ${asset.ref_count} references`);\n}\n","label":"JavaScript"}]
+func (h *AssetHandler) ListAssets(c *gin.Context) {
+	req := ListAssetsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.List(c.Request.Context(), service.ListAssetsInput{
+		ProjectID: project.ID,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+		TimeDesc:  req.TimeDesc,
+	})
+	if err != nil {
+		listErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// GetAsset godoc
+//
+//	@Summary		Get asset
+//	@Description	Get an asset by its SHA256 with a presigned url valid for 24 hours, or the server s3.presignMaxExpireSec if lower. Assets reported infected by the malware scanner are quarantined and have no url.
+//	@Tags			asset
+//	@Accept			json
+//	@Produce		json
+//	@Param			sha256	path	string	true	"SHA256 of the asset content"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.AssetDetail}
+//	@Router			/assets/{sha256} [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get an asset\nasset = client.assets.get(sha256='asset-sha256')\nprint(asset.public_url.url)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get an asset\nconst asset = await client.assets.get('asset-sha256');\nconsole.log(asset.public_url?.url);\n","label":"JavaScript"}]
+func (h *AssetHandler) GetAsset(c *gin.Context) {
+	sha256 := c.Param("sha256")
+	if !sha256Pattern.MatchString(sha256) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("sha256 must be 64 lowercase hex characters", nil))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Get(c.Request.Context(), project.ID, sha256, presignExpire(c, h.config, time.Hour*24, false))
+	if err != nil {
+		assetErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// DeleteAsset godoc
+//
+//	@Summary		Delete asset
+//	@Description	Delete an asset no message or artifact references anymore, instead of waiting for the periodic cleanup. Returns 409 when the asset is still referenced.
+//	@Tags			asset
+//	@Accept			json
+//	@Produce		json
+//	@Param			sha256	path	string	true	"SHA256 of the asset content"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Router			/assets/{sha256} [delete]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Delete an unreferenced asset\nclient.assets.delete(sha256='asset-sha256')\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Delete an unreferenced asset\nawait client.assets.delete('asset-sha256');\n","label":"JavaScript"}]
+func (h *AssetHandler) DeleteAsset(c *gin.Context) {
+	sha256 := c.Param("sha256")
+	if !sha256Pattern.MatchString(sha256) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("sha256 must be 64 lowercase hex characters", nil))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	if err := h.svc.Delete(c.Request.Context(), project.ID, sha256); err != nil {
+		assetErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/webhook"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAssetService struct {
+	mock.Mock
+}
+
+func (m *MockAssetService) GC(ctx context.Context) (*service.AssetGCResult, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.AssetGCResult), args.Error(1)
+}
+
+func (m *MockAssetService) SetScanStatus(ctx context.Context, projectID uuid.UUID, sha256 string, status string) error {
+	args := m.Called(ctx, projectID, sha256, status)
+	return args.Error(0)
+}
+
+func (m *MockAssetService) List(ctx context.Context, in service.ListAssetsInput) (*service.ListAssetsOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ListAssetsOutput), args.Error(1)
+}
+
+func (m *MockAssetService) Get(ctx context.Context, projectID uuid.UUID, sha256 string, expire time.Duration) (*service.AssetDetail, error) {
+	args := m.Called(ctx, projectID, sha256, expire)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.AssetDetail), args.Error(1)
+}
+
+func (m *MockAssetService) Delete(ctx context.Context, projectID uuid.UUID, sha256 string) error {
+	args := m.Called(ctx, projectID, sha256)
+	return args.Error(0)
+}
+
+func TestAssetHandler_GC(t *testing.T) {
+	tests := []struct {
+		name           string
+		setup          func(*MockAssetService)
+		expectedStatus int
+	}{
+		{
+			name: "purged",
+			setup: func(svc *MockAssetService) {
+				svc.On("GC", mock.Anything).Return(&service.AssetGCResult{PurgedAssets: 2}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "already running",
+			setup: func(svc *MockAssetService) {
+				svc.On("GC", mock.Anything).Return(nil, service.ErrAssetGCRunning)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "service layer error",
+			setup: func(svc *MockAssetService) {
+				svc.On("GC", mock.Anything).Return(nil, errors.New("list objects in S3: timeout"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAssetService{}
+			tt.setup(mockService)
+
+			handler := NewAssetHandler(mockService, &config.Config{})
+			router := setupSessionRouter()
+			router.POST("/internal/assets/gc", handler.GC)
+
+			req := httptest.NewRequest("POST", "/internal/assets/gc", nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAssetHandler_ScanResult(t *testing.T) {
+	projectID := uuid.New()
+	sha := strings.Repeat("a", 64)
+	body := fmt.Sprintf(`{"project_id":%q,"sha256":%q,"status":"infected"}`, projectID, sha)
+	now := time.Now().Unix()
+	stale := time.Now().Add(-webhook.MaxSignatureAge - time.Minute).Unix()
+
+	tests := []struct {
+		name           string
+		secret         string
+		body           string
+		timestamp      int64
+		signature      string
+		setup          func(*MockAssetService)
+		expectedStatus int
+	}{
+		{
+			name:      "recorded",
+			secret:    "secret",
+			body:      body,
+			timestamp: now,
+			signature: webhook.SignAt("secret", now, []byte(body)),
+			setup: func(svc *MockAssetService) {
+				svc.On("SetScanStatus", mock.Anything, projectID, sha, "infected").Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "bad signature",
+			secret:         "secret",
+			body:           body,
+			timestamp:      now,
+			signature:      webhook.SignAt("other", now, []byte(body)),
+			setup:          func(svc *MockAssetService) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "stale timestamp",
+			secret:         "secret",
+			body:           body,
+			timestamp:      stale,
+			signature:      webhook.SignAt("secret", stale, []byte(body)),
+			setup:          func(svc *MockAssetService) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "signature without the timestamp",
+			secret:         "secret",
+			body:           body,
+			timestamp:      now,
+			signature:      webhook.Sign("secret", []byte(body)),
+			setup:          func(svc *MockAssetService) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "no secret configured",
+			body:           body,
+			timestamp:      now,
+			signature:      webhook.SignAt("", now, []byte(body)),
+			setup:          func(svc *MockAssetService) {},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "unknown status",
+			secret:         "secret",
+			body:           strings.Replace(body, "infected", "pending", 1),
+			timestamp:      now,
+			signature:      webhook.SignAt("secret", now, []byte(strings.Replace(body, "infected", "pending", 1))),
+			setup:          func(svc *MockAssetService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "unknown asset",
+			secret:    "secret",
+			body:      body,
+			timestamp: now,
+			signature: webhook.SignAt("secret", now, []byte(body)),
+			setup: func(svc *MockAssetService) {
+				svc.On("SetScanStatus", mock.Anything, projectID, sha, "infected").Return(service.ErrAssetNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAssetService{}
+			tt.setup(mockService)
+
+			handler := NewAssetHandler(mockService, &config.Config{Scan: config.ScanCfg{Secret: tt.secret}})
+			router := setupSessionRouter()
+			router.POST("/internal/assets/scan_result", handler.ScanResult)
+
+			req := httptest.NewRequest("POST", "/internal/assets/scan_result", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(webhook.TimestampHeader, strconv.FormatInt(tt.timestamp, 10))
+			req.Header.Set(webhook.SignatureHeader, tt.signature)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAssetHandler_Assets(t *testing.T) {
+	projectID := uuid.New()
+	sha := strings.Repeat("a", 64)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		setup          func(*MockAssetService)
+		expectedStatus int
+	}{
+		{
+			name:   "list",
+			method: "GET",
+			path:   "/assets?limit=10",
+			setup: func(svc *MockAssetService) {
+				svc.On("List", mock.Anything, service.ListAssetsInput{ProjectID: projectID, Limit: 10}).Return(&service.ListAssetsOutput{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "list limit too large",
+			method:         "GET",
+			path:           "/assets?limit=500",
+			setup:          func(svc *MockAssetService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "get",
+			method: "GET",
+			path:   "/assets/" + sha,
+			setup: func(svc *MockAssetService) {
+				svc.On("Get", mock.Anything, projectID, sha, 24*time.Hour).Return(&service.AssetDetail{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "get invalid sha256",
+			method:         "GET",
+			path:           "/assets/" + strings.Repeat("A", 64),
+			setup:          func(svc *MockAssetService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "get unknown asset",
+			method: "GET",
+			path:   "/assets/" + sha,
+			setup: func(svc *MockAssetService) {
+				svc.On("Get", mock.Anything, projectID, sha, 24*time.Hour).Return(nil, service.ErrAssetNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "delete",
+			method: "DELETE",
+			path:   "/assets/" + sha,
+			setup: func(svc *MockAssetService) {
+				svc.On("Delete", mock.Anything, projectID, sha).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "delete referenced asset",
+			method: "DELETE",
+			path:   "/assets/" + sha,
+			setup: func(svc *MockAssetService) {
+				svc.On("Delete", mock.Anything, projectID, sha).Return(service.ErrAssetInUse)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockAssetService{}
+			tt.setup(mockService)
+
+			handler := NewAssetHandler(mockService, &config.Config{})
+			router := setupSessionRouter()
+			router.Use(func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				c.Next()
+			})
+			router.GET("/assets", handler.ListAssets)
+			router.GET("/assets/:sha256", handler.GetAsset)
+			router.DELETE("/assets/:sha256", handler.DeleteAsset)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
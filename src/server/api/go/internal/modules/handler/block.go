@@ -123,7 +123,7 @@ func (h *BlockHandler) CreateBlock(c *gin.Context) {
 	// Call Core service to insert block
 	result, err := h.coreClient.InsertBlock(c.Request.Context(), project.ID, spaceID, coreReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.Err(http.StatusInternalServerError, "failed to insert block", err))
+		coreErr(c, "failed to insert block", err)
 		return
 	}
 
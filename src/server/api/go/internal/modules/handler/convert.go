@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/pkg/converter"
+	"github.com/memodb-io/Acontext/internal/pkg/normalizer"
+	"gorm.io/datatypes"
+)
+
+type ConvertHandler struct {
+	config *config.Config
+}
+
+func NewConvertHandler(cfg *config.Config) *ConvertHandler {
+	return &ConvertHandler{config: cfg}
+}
+
+type ConvertQuery struct {
+	From                  string `form:"from,default=openai" json:"from" binding:"omitempty,oneof=acontext openai anthropic gemini langchain" example:"openai" enums:"acontext,openai,anthropic,gemini,langchain"`
+	To                    string `form:"to" json:"to" binding:"required" example:"anthropic,acontext"`
+	LargeNumbersAsStrings bool   `form:"large_numbers_as_strings,default=false" json:"large_numbers_as_strings" example:"false"`
+	PreserveNames         bool   `form:"preserve_names,default=false" json:"preserve_names" example:"false"`
+}
+
+type ConvertReq struct {
+	Blob interface{} `form:"blob" json:"blob" binding:"required"`
+}
+
+type ConvertResp struct {
+	From  model.MessageFormat                 `json:"from"`
+	Items map[model.MessageFormat]interface{} `json:"items"` // converted messages keyed by target format
+}
+
+// Convert godoc
+//
+//	@Summary		Convert a message between formats
+//	@Description	Convert one message from the from format to every format listed in to, without storing it. Each target maps to the list of messages that format needs for the input, as a single message may be split (e.g. several tool results in OpenAI format). Parts referencing uploaded files are not supported. The message limits of StoreMessage apply: a larger body or a message with too many parts or too large inline data is rejected with 413.
+//	@Tags			message
+//	@Accept			json
+//	@Produce		json
+//	@Param			from	query	string				false	"Format of the input message (default openai)"		enums(acontext,openai,anthropic,gemini,langchain)
+//	@Param			to		query	string				true	"Comma separated target formats"					example(anthropic,acontext)
+//	@Param			large_numbers_as_strings	query	string	false	"Write the integers of tool-call arguments beyond ±(2^53-1), such as 64-bit IDs, as strings (default false)"	example(false)
+//	@Param			preserve_names	query	string	false	"Write the message name in a meta field of anthropic and gemini messages, which have no name, so that converting them back keeps it. Providers reject the field (default false)"	example(false)
+//	@Param			payload	body	handler.ConvertReq	true	"Convert payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.ConvertResp}
+//	@Router			/convert [post]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Convert an OpenAI message to Anthropic and Acontext format\nresult = client.messages.convert(\n    blob={'role': 'user', 'content': 'Hello'},\n    from_format='openai',\n    to=['anthropic', 'acontext']\n)\nprint(result.items['anthropic'])\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Convert an OpenAI message to Anthropic and Acontext format\nconst result = await client.messages.convert({\n  blob: { role: 'user', content: 'Hello' },\n  from: 'openai',\n  to: ['anthropic', 'acontext']\n});\nconsole.log(result.items.anthropic);\n","label":"JavaScript"}]
+func (h *ConvertHandler) Convert(c *gin.Context) {
+	query := ConvertQuery{}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	if !capBody(c, h.config.Message.MaxBodyBytes) {
+		return
+	}
+	req := ConvertReq{}
+	if err := bindBlobJSON(c, &req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			bodyTooLarge(c, h.config.Message.MaxBodyBytes)
+			return
+		}
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	from, err := converter.ValidateFormat(query.From)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid from format", err))
+		return
+	}
+	var targets []model.MessageFormat
+	for _, t := range strings.Split(query.To, ",") {
+		target, err := converter.ValidateFormat(strings.TrimSpace(t))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid to format", err))
+			return
+		}
+		targets = append(targets, target)
+	}
+
+	role, partsIn, meta, err := normalizeBlob(h.config.Message, from, req.Blob)
+	if err != nil {
+		blobErr(c, from, err)
+		return
+	}
+
+	parts := make([]model.Part, 0, len(partsIn))
+	for i, p := range partsIn {
+		if p.FileField != "" {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", fmt.Errorf("parts[%d]: file uploads cannot be converted", i)))
+			return
+		}
+		parts = append(parts, model.Part{Type: p.Type, Text: p.Text, Meta: p.Meta})
+	}
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	msgs := []model.Message{{
+		Role:  role,
+		Parts: parts,
+		Meta:  datatypes.NewJSONType(meta),
+	}}
+
+	out := ConvertResp{From: from, Items: make(map[model.MessageFormat]interface{}, len(targets))}
+	for _, target := range targets {
+		converted, err := converter.ConvertMessages(converter.ConvertMessagesInput{
+			Messages: msgs,
+			Format:   target,
+			Options:  converter.Options{LargeNumbersAsStrings: query.LargeNumbersAsStrings, PreserveNames: query.PreserveNames},
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr(fmt.Sprintf("failed to convert to %s", target), err))
+			return
+		}
+		out.Items[target] = converted
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// maxValidateBatchBlobs caps the blobs of a ValidateBatch request
+const maxValidateBatchBlobs = 100
+
+type ValidateBatchQuery struct {
+	Format string `form:"format,default=openai" json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini langchain" example:"openai" enums:"acontext,openai,anthropic,gemini,langchain"`
+}
+
+type ValidateBatchReq struct {
+	Blobs []interface{} `json:"blobs" binding:"required,min=1,max=100"`
+}
+
+type ValidateBatchItem struct {
+	Index int  `json:"index"`
+	Valid bool `json:"valid"`
+	// Error and the path of the offending field in the blob, when the error has one
+	Error string `json:"error,omitempty"`
+	Path  string `json:"path,omitempty"`
+	// Role and part types of the normalized message of a valid blob
+	Role      string   `json:"role,omitempty"`
+	PartTypes []string `json:"part_types,omitempty"`
+}
+
+type ValidateBatchResp struct {
+	Format  model.MessageFormat `json:"format"`
+	Valid   int                 `json:"valid"`
+	Invalid int                 `json:"invalid"`
+	Items   []ValidateBatchItem `json:"items"`
+}
+
+// ValidateBatch godoc
+//
+//	@Summary		Validate messages
+//	@Description	Check up to 100 message blobs of the given format as StoreMessage would, without a session and without storing anything. Each blob gets its own result: the normalized role and part types when it is valid, or the error and the path of the offending field. Invalid blobs don't fail the request. Parts referencing uploaded files are accepted as they are only checked on upload. The request body is capped like the body of StoreMessage, a larger one is rejected with 413.
+//	@Tags			message
+//	@Accept			json
+//	@Produce		json
+//	@Param			format	query	string						false	"Format of the blobs (default openai)"	enums(acontext,openai,anthropic,gemini,langchain)
+//	@Param			payload	body	handler.ValidateBatchReq	true	"ValidateBatch payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.ValidateBatchResp}
+//	@Router			/validate/batch [post]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Validate OpenAI messages without storing them\nresult = client.messages.validate_batch(\n    blobs=[{'role': 'user', 'content': 'Hello'}, {'role': 'user', 'content': [{'type': 'image_url'}]}],\n    format='openai'\n)\nfor item in result.items:\n    if not item.valid:\n        print(f\"blob {item.index}: {item.path}: {item.error}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Validate OpenAI messages without storing them\nconst result = await client.messages.validateBatch({\n  blobs: [{ role: 'user', content: 'Hello' }, { role: 'user', content: [{ type: 'image_url' }] }],\n  format: 'openai'\n});\nfor (const item of result.items) {\n  if (!item.valid) console.log(`blob ${item.index}: ${item.path}: ${item.error}`);\n}\n","label":"JavaScript"}]
+func (h *ConvertHandler) ValidateBatch(c *gin.Context) {
+	query := ValidateBatchQuery{}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	if !capBody(c, h.config.Message.MaxBodyBytes) {
+		return
+	}
+	req := ValidateBatchReq{}
+	if err := bindBlobJSON(c, &req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			bodyTooLarge(c, h.config.Message.MaxBodyBytes)
+			return
+		}
+		c.JSON(http.StatusBadRequest, serializer.ParamErr(fmt.Sprintf("blobs must hold 1 to %d messages", maxValidateBatchBlobs), err))
+		return
+	}
+
+	format, err := converter.ValidateFormat(query.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid format", err))
+		return
+	}
+
+	out := ValidateBatchResp{Format: format, Items: make([]ValidateBatchItem, 0, len(req.Blobs))}
+	for i, blob := range req.Blobs {
+		item := h.validateBlob(format, blob)
+		item.Index = i
+		if item.Valid {
+			out.Valid++
+		} else {
+			out.Invalid++
+		}
+		out.Items = append(out.Items, item)
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// validateBlob checks a blob like StoreMessage does before touching the session
+func (h *ConvertHandler) validateBlob(format model.MessageFormat, blob interface{}) ValidateBatchItem {
+	role, parts, _, err := normalizeBlob(h.config.Message, format, blob)
+	if err != nil {
+		var be *blobError
+		errors.As(err, &be)
+		return invalidBlob(be.msg, be.err)
+	}
+
+	item := ValidateBatchItem{Valid: true, Role: role, PartTypes: make([]string, 0, len(parts))}
+	for _, p := range parts {
+		item.PartTypes = append(item.PartTypes, p.Type)
+	}
+	return item
+}
+
+// invalidBlob is the result of a blob failing with err, with the field path of err when it has one
+func invalidBlob(msg string, err error) ValidateBatchItem {
+	item := ValidateBatchItem{Error: err.Error()}
+	var fe *normalizer.FieldError
+	if errors.As(err, &fe) {
+		item.Path = fe.Path
+		item.Error = fe.Message
+	}
+	if msg != "" {
+		item.Error = msg + ": " + item.Error
+	}
+	return item
+}
@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupConvertRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	h := NewConvertHandler(&config.Config{Message: config.MessageCfg{MaxParts: 3, MaxBodyBytes: 4096}})
+	router.POST("/convert", h.Convert)
+	router.POST("/validate/batch", h.ValidateBatch)
+	return router
+}
+
+func TestConvertHandler_Convert(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		body           string
+		expectedStatus int
+		expectedItems  []string
+	}{
+		{
+			name:           "openai to anthropic and acontext",
+			query:          "?from=openai&to=anthropic,acontext",
+			body:           `{"blob":{"role":"user","content":"Hello"}}`,
+			expectedStatus: http.StatusOK,
+			expectedItems:  []string{"anthropic", "acontext"},
+		},
+		{
+			name:           "from defaults to openai",
+			query:          "?to=gemini",
+			body:           `{"blob":{"role":"assistant","content":"Hi there"}}`,
+			expectedStatus: http.StatusOK,
+			expectedItems:  []string{"gemini"},
+		},
+		{
+			name:           "anthropic to openai with spaces in to",
+			query:          "?from=anthropic&to=openai,%20acontext",
+			body:           `{"blob":{"role":"user","content":[{"type":"text","text":"Hello"}]}}`,
+			expectedStatus: http.StatusOK,
+			expectedItems:  []string{"openai", "acontext"},
+		},
+		{
+			name:           "missing to",
+			query:          "?from=openai",
+			body:           `{"blob":{"role":"user","content":"Hello"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown target format",
+			query:          "?to=anthropic,cohere",
+			body:           `{"blob":{"role":"user","content":"Hello"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown source format",
+			query:          "?from=cohere&to=openai",
+			body:           `{"blob":{"role":"user","content":"Hello"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing blob",
+			query:          "?to=anthropic",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unrecognized blob",
+			query:          "?to=anthropic",
+			body:           `{"blob":{"role":"user"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "system message is rejected",
+			query:          "?to=anthropic",
+			body:           `{"blob":{"role":"system","content":"You are a bot"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "message over limits",
+			query:          "?to=anthropic",
+			body:           `{"blob":{"role":"user","content":[{"type":"text","text":"1"},{"type":"text","text":"2"},{"type":"text","text":"3"},{"type":"text","text":"4"}]}}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "body too large",
+			query:          "?to=anthropic",
+			body:           `{"blob":{"role":"user","content":"` + strings.Repeat("a", 4096) + `"}}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupConvertRouter()
+
+			req := httptest.NewRequest("POST", "/convert"+tt.query, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var resp struct {
+					Data struct {
+						From  string                      `json:"from"`
+						Items map[string][]map[string]any `json:"items"`
+					} `json:"data"`
+				}
+				require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Len(t, resp.Data.Items, len(tt.expectedItems))
+				for _, format := range tt.expectedItems {
+					assert.NotEmpty(t, resp.Data.Items[format], format)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertHandler_PreserveNames(t *testing.T) {
+	router := setupConvertRouter()
+	convert := func(query string, blob any) map[string][]map[string]any {
+		body, err := sonic.Marshal(map[string]any{"blob": blob})
+		require.NoError(t, err)
+		req := httptest.NewRequest("POST", "/convert"+query, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp struct {
+			Data struct {
+				Items map[string][]map[string]any `json:"items"`
+			} `json:"data"`
+		}
+		require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data.Items
+	}
+
+	tests := []struct {
+		name   string
+		blob   map[string]any
+		target string
+	}{
+		{name: "user through anthropic", blob: map[string]any{"role": "user", "name": "alice", "content": "Hello"}, target: "anthropic"},
+		{name: "user through gemini", blob: map[string]any{"role": "user", "name": "alice", "content": "Hello"}, target: "gemini"},
+		{name: "tool through anthropic", blob: map[string]any{"role": "tool", "name": "alice", "tool_call_id": "call_1", "content": "Sunny"}, target: "anthropic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := convert("?from=openai&to="+tt.target, tt.blob)[tt.target]
+			require.Len(t, plain, 1)
+			assert.NotContains(t, plain[0], "meta")
+
+			stashed := convert("?from=openai&to="+tt.target+"&preserve_names=true", tt.blob)[tt.target]
+			require.Len(t, stashed, 1)
+			assert.Equal(t, map[string]any{"name": "alice"}, stashed[0]["meta"])
+
+			back := convert("?from="+tt.target+"&to=openai", stashed[0])["openai"]
+			require.Len(t, back, 1)
+			assert.Equal(t, tt.blob["role"], back[0]["role"])
+			assert.Equal(t, "alice", back[0]["name"])
+		})
+	}
+}
+
+func TestConvertHandler_LargeNumbers(t *testing.T) {
+	router := setupConvertRouter()
+
+	// 2^53+1 is rounded to 2^53 by a float64
+	tests := []struct {
+		name string
+		from string
+		blob string
+	}{
+		{name: "anthropic tool_use input", from: "anthropic", blob: `{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"lookup","input":{"user_id":9007199254740993}}]}`},
+		{name: "gemini functionCall args", from: "gemini", blob: `{"role":"model","parts":[{"functionCall":{"id":"call_1","name":"lookup","args":{"user_id":9007199254740993}}}]}`},
+		{name: "acontext object arguments", from: "acontext", blob: `{"role":"assistant","parts":[{"type":"tool-call","meta":{"id":"call_1","name":"lookup","arguments":{"user_id":9007199254740993}}}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/convert?from="+tt.from+"&to=openai", strings.NewReader(`{"blob":`+tt.blob+`}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), `9007199254740993`)
+			assert.NotContains(t, w.Body.String(), `9007199254740992`)
+		})
+	}
+}
+
+func TestConvertHandler_NormalizeErrorPath(t *testing.T) {
+	router := setupConvertRouter()
+
+	body := `{"blob":{"role":"user","content":[{"type":"text","text":"Look"},{"type":"image_url","image_url":{"url":""}}]}}`
+	req := httptest.NewRequest("POST", "/convert?to=anthropic", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp struct {
+		Msg  string `json:"msg"`
+		Data struct {
+			Path    string `json:"path"`
+			Message string `json:"message"`
+		} `json:"data"`
+	}
+	require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "content[1].image_url.url", resp.Data.Path)
+	assert.Equal(t, "image url must not be empty", resp.Data.Message)
+	assert.Equal(t, "failed to normalize OpenAI message: content[1].image_url.url: image url must not be empty", resp.Msg)
+}
+
+func TestConvertHandler_ValidateBatch(t *testing.T) {
+	router := setupConvertRouter()
+
+	body := `{"blobs":[
+		{"role":"user","content":"Hello"},
+		{"role":"user","content":[{"type":"text","text":"Look"},{"type":"image_url","image_url":{"url":""}}]},
+		{"role":"assistant","content":[{"type":"text","text":"1"},{"type":"text","text":"2"},{"type":"text","text":"3"},{"type":"text","text":"4"}]},
+		{}
+	]}`
+	req := httptest.NewRequest("POST", "/validate/batch?format=openai", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Data ValidateBatchResp `json:"data"`
+	}
+	require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Data.Valid)
+	assert.Equal(t, 3, resp.Data.Invalid)
+	require.Len(t, resp.Data.Items, 4)
+
+	assert.Equal(t, ValidateBatchItem{Index: 0, Valid: true, Role: "user", PartTypes: []string{"text"}}, resp.Data.Items[0])
+	assert.Equal(t, ValidateBatchItem{Index: 1, Path: "content[1].image_url.url", Error: "failed to normalize OpenAI message: image url must not be empty"}, resp.Data.Items[1])
+	assert.False(t, resp.Data.Items[2].Valid)
+	assert.Contains(t, resp.Data.Items[2].Error, "message exceeds limits")
+	assert.False(t, resp.Data.Items[3].Valid)
+	assert.Contains(t, resp.Data.Items[3].Error, "empty or unrecognized message blob")
+
+	for name, tt := range map[string]struct {
+		query, body string
+		status      int
+	}{
+		"no blobs":       {"", `{"blobs":[]}`, http.StatusBadRequest},
+		"unknown format": {"?format=cohere", `{"blobs":[{"role":"user","content":"Hello"}]}`, http.StatusBadRequest},
+		"body too large": {"", `{"blobs":[{"role":"user","content":"` + strings.Repeat("a", 4096) + `"}]}`, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/validate/batch"+tt.query, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/infra/httpclient"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+)
+
+// coreErr responds to a failed Core call. Upstream 4xx statuses are passed through so clients can tell
+// a missing resource from a Core outage, everything else is a 500. Core's error message is appended to msg.
+func coreErr(c *gin.Context, msg string, err error) {
+	status := http.StatusInternalServerError
+	var ce *httpclient.CoreError
+	if errors.As(err, &ce) {
+		if ce.StatusCode >= http.StatusBadRequest && ce.StatusCode < http.StatusInternalServerError {
+			status = ce.StatusCode
+		}
+		if ce.Message != "" {
+			msg = msg + ": " + ce.Message
+		}
+	}
+	c.JSON(status, serializer.Err(status, msg, err))
+}
@@ -86,7 +86,7 @@ func (h *DiskHandler) ListDisks(c *gin.Context) {
 		TimeDesc:  req.TimeDesc,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		listErr(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/pkg/etag"
+)
+
+// notModified sets the ETag header and reports whether the request's If-None-Match matches it.
+// On a match a 304 is written and the handler must return without a body.
+func notModified(c *gin.Context, tag string) bool {
+	c.Header("ETag", tag)
+	if etag.Match(c.GetHeader("If-None-Match"), tag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
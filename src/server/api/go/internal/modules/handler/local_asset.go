@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+)
+
+// LocalAssetHandler serves the presigned URLs of the local storage backend
+type LocalAssetHandler struct {
+	store *blob.LocalStore
+}
+
+// NewLocalAssetHandler returns a handler that is only Enabled when store is the local storage backend
+func NewLocalAssetHandler(store blob.Store) *LocalAssetHandler {
+	local, _ := store.(*blob.LocalStore)
+	return &LocalAssetHandler{store: local}
+}
+
+// Enabled reports whether the local storage backend is in use and its route should be registered
+func (h *LocalAssetHandler) Enabled() bool {
+	return h.store != nil
+}
+
+// GetLocalAsset serves an object of the local storage backend to the holder of a URL it presigned.
+// It only exists in development setups and is not part of the public API docs.
+func (h *LocalAssetHandler) GetLocalAsset(c *gin.Context) {
+	sha256 := c.Param("sha256")
+	if !sha256Pattern.MatchString(sha256) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("sha256 must be 64 lowercase hex characters")))
+		return
+	}
+
+	file, contentType, err := h.store.Open(sha256, c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, serializer.Err(http.StatusForbidden, err.Error(), nil))
+		return
+	}
+	if _, err := os.Stat(file); err != nil {
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, "asset not found", nil))
+		return
+	}
+
+	if contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	c.File(file)
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalAssetHandler_Enabled(t *testing.T) {
+	assert.False(t, NewLocalAssetHandler(&blob.S3Deps{}).Enabled())
+}
+
+func TestLocalAssetHandler_GetLocalAsset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	store, err := blob.NewLocal(&config.Config{LocalStorage: config.LocalStorageCfg{DevMode: true, Dir: t.TempDir(), Secret: "secret"}})
+	require.NoError(t, err)
+	content, err := blob.JSONContent(map[string]string{"hello": "world"})
+	require.NoError(t, err)
+	asset, err := store.Upload(ctx, "assets/p1", content)
+	require.NoError(t, err)
+
+	handler := NewLocalAssetHandler(store)
+	require.True(t, handler.Enabled())
+	router := gin.New()
+	router.GET("/local-assets/:sha256", handler.GetLocalAsset)
+
+	path := func(t *testing.T, signed string) string {
+		u, err := url.Parse(signed)
+		require.NoError(t, err)
+		return u.RequestURI()
+	}
+	signed, err := store.PresignGetAs(ctx, asset.S3Key, "text/plain", time.Minute)
+	require.NoError(t, err)
+	expired, err := store.PresignGet(ctx, asset.S3Key, -time.Minute)
+	require.NoError(t, err)
+	missing, err := store.PresignGet(ctx, "assets/p1/2024/01/02/"+strings.Repeat("f", 64)+".json", time.Minute)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "signed", path: path(t, signed), expectedStatus: http.StatusOK},
+		{name: "expired", path: path(t, expired), expectedStatus: http.StatusForbidden},
+		{name: "no token", path: "/local-assets/" + content.SHA256, expectedStatus: http.StatusForbidden},
+		{name: "other asset", path: strings.Replace(path(t, signed), content.SHA256, strings.Repeat("e", 64), 1), expectedStatus: http.StatusForbidden},
+		{name: "invalid sha256", path: "/local-assets/abc", expectedStatus: http.StatusBadRequest},
+		{name: "deleted object", path: path(t, missing), expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+				assert.JSONEq(t, `{"hello":"world"}`, w.Body.String())
+			}
+		})
+	}
+}
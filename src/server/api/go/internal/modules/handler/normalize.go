@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/normalizer"
+)
+
+// blobErrKind is the check a message blob failed in normalizeBlob
+type blobErrKind int
+
+const (
+	blobOverLimits blobErrKind = iota
+	blobUnrecognized
+	blobNotNormalized
+	blobEmpty
+)
+
+// blobError is a message blob rejected by normalizeBlob
+type blobError struct {
+	kind blobErrKind
+	msg  string // what was wrong with the blob, "" when err says it all
+	err  error
+}
+
+func (e *blobError) Error() string {
+	if e.msg == "" {
+		return e.err.Error()
+	}
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e *blobError) Unwrap() error { return e.err }
+
+// normalizeBlob checks a message blob against the message limits, then validates and normalizes it.
+// StoreMessage, Convert and ValidateBatch all go through it, so that they accept the same blobs.
+// A rejected blob fails with a *blobError, see blobErr.
+func normalizeBlob(limits config.MessageCfg, format model.MessageFormat, blob any) (string, []service.PartIn, map[string]interface{}, error) {
+	// Reject oversized messages before normalization copies their parts around
+	if err := normalizer.CheckLimits(blob, normalizer.Limits{
+		MaxParts:           limits.MaxParts,
+		MaxInlineDataBytes: limits.MaxInlineDataBytes,
+	}); err != nil {
+		return "", nil, nil, &blobError{kind: blobOverLimits, msg: "message exceeds limits", err: err}
+	}
+
+	blobJSON, err := sonic.Marshal(blob)
+	if err != nil {
+		return "", nil, nil, &blobError{kind: blobUnrecognized, msg: "invalid blob", err: err}
+	}
+	if err := normalizer.ValidateBlob(format, blobJSON); err != nil {
+		return "", nil, nil, &blobError{kind: blobUnrecognized, msg: "empty or unrecognized message blob", err: err}
+	}
+	role, parts, meta, err := normalizer.Normalize(format, blobJSON, normalizer.Options{
+		PreserveOpenAIContentArray: limits.PreserveOpenAIContentArray,
+	})
+	if err != nil {
+		return "", nil, nil, &blobError{kind: blobNotNormalized, msg: normalizeFailedMsg(format), err: err}
+	}
+	if len(parts) == 0 {
+		return "", nil, nil, &blobError{kind: blobEmpty, err: errors.New("message must contain at least one part")}
+	}
+	return role, parts, meta, nil
+}
+
+// blobErr responds to a blob rejected by normalizeBlob: 413 when it is over the message limits, 400 otherwise
+func blobErr(c *gin.Context, format model.MessageFormat, err error) {
+	var be *blobError
+	if !errors.As(err, &be) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	switch be.kind {
+	case blobOverLimits:
+		messageLimitErr(c, be.err)
+	case blobNotNormalized:
+		normalizeErr(c, format, be.err)
+	default:
+		c.JSON(http.StatusBadRequest, serializer.ParamErr(be.msg, be.err))
+	}
+}
+
+// formatNames are the names of the message formats in error messages
+var formatNames = map[model.MessageFormat]string{
+	model.FormatAcontext:  "Acontext",
+	model.FormatOpenAI:    "OpenAI",
+	model.FormatAnthropic: "Anthropic",
+	model.FormatGemini:    "Gemini",
+}
+
+// normalizeFailedMsg returns the error message of a blob in format that failed to normalize
+func normalizeFailedMsg(format model.MessageFormat) string {
+	name, ok := formatNames[format]
+	if !ok {
+		name = string(format)
+	}
+	return "failed to normalize " + name + " message"
+}
+
+// normalizeErr responds 400 to a blob that failed to normalize. When the normalizer points at a
+// field, its path is added to the message and returned as data, as the error detail is hidden in release mode.
+func normalizeErr(c *gin.Context, format model.MessageFormat, err error) {
+	res := serializer.ParamErr(normalizeFailedMsg(format), err)
+	var fe *normalizer.FieldError
+	if errors.As(err, &fe) {
+		res.Msg += ": " + fe.Error()
+		res.Data = fe
+	}
+	c.JSON(http.StatusBadRequest, res)
+}
+
+// messageLimitErr responds 413 to a blob over the configured message limits, with the offending
+// field path as data when there is one, like normalizeErr.
+func messageLimitErr(c *gin.Context, err error) {
+	res := serializer.ParamErr("message exceeds limits", err)
+	var fe *normalizer.FieldError
+	if errors.As(err, &fe) {
+		res.Msg += ": " + fe.Error()
+		res.Data = fe
+	} else {
+		res.Msg += ": " + err.Error()
+	}
+	c.JSON(http.StatusRequestEntityTooLarge, res)
+}
+
+// bindBlobJSON binds a JSON request body like ShouldBindJSON, but decodes its numbers as json.Number:
+// message blobs are bound as interface{}, where a float64 rounds the integers beyond 2^53 of tool arguments
+func bindBlobJSON(c *gin.Context, obj any) error {
+	if c.Request.Body == nil {
+		return errors.New("invalid request")
+	}
+	if err := decodeBlobJSON(c.Request.Body, obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// decodeBlobJSON decodes JSON holding message blobs, with numbers as json.Number like bindBlobJSON
+func decodeBlobJSON(r io.Reader, obj any) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec.Decode(obj)
+}
+
+// capBody caps the request body at maxBytes before anything reads it, so that oversized requests are
+// rejected while streaming: reading past the cap fails with *http.MaxBytesError. A request declaring a
+// larger body is answered with 413 right away and false is returned. 0 disables the cap.
+func capBody(c *gin.Context, maxBytes int64) bool {
+	if maxBytes <= 0 {
+		return true
+	}
+	if c.Request.ContentLength > maxBytes {
+		c.Header("Connection", "close")
+		bodyTooLarge(c, maxBytes)
+		return false
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	return true
+}
+
+// bodyTooLarge responds 413 to a request body over maxBytes
+func bodyTooLarge(c *gin.Context, maxBytes int64) {
+	maxMB := float64(maxBytes) / (1024 * 1024)
+	c.JSON(http.StatusRequestEntityTooLarge, serializer.ParamErr("", fmt.Errorf("request body exceeds maximum allowed size of %.2fMB", maxMB)))
+}
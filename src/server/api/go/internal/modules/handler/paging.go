@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+)
+
+// listErr responds to a failed paginated list call. A cursor that doesn't decode was sent by the
+// client and is always a 400 "invalid cursor", other errors are answered with status.
+func listErr(c *gin.Context, status int, err error) {
+	if errors.Is(err, paging.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid cursor", err))
+		return
+	}
+	c.JSON(status, serializer.DBErr("", err))
+}
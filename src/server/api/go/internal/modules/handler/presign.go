@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memodb-io/Acontext/internal/config"
+)
+
+// presignExpire returns the lifetime of the presigned urls of a request, capped by s3.presignMaxExpireSec.
+// An expiry the client asked for beyond the cap is reported in a Warning header with the capped value,
+// a default expiry is capped silently.
+func presignExpire(c *gin.Context, cfg *config.Config, expire time.Duration, requested bool) time.Duration {
+	if cfg == nil || cfg.S3.PresignMaxExpireSec <= 0 {
+		return expire
+	}
+	maxExpire := time.Duration(cfg.S3.PresignMaxExpireSec) * time.Second
+	if expire <= maxExpire {
+		return expire
+	}
+	if requested {
+		msg := fmt.Sprintf("presigned url expiry of %ds capped to %ds", int64(expire/time.Second), cfg.S3.PresignMaxExpireSec)
+		c.Header("Warning", fmt.Sprintf("199 - %q", msg))
+	}
+	return maxExpire
+}
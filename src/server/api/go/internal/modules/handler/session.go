@@ -1,36 +1,46 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"mime/multipart"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
 	"github.com/memodb-io/Acontext/internal/infra/httpclient"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/serializer"
 	"github.com/memodb-io/Acontext/internal/modules/service"
 	"github.com/memodb-io/Acontext/internal/pkg/converter"
 	"github.com/memodb-io/Acontext/internal/pkg/editor"
-	"github.com/memodb-io/Acontext/internal/pkg/normalizer"
+	"github.com/memodb-io/Acontext/internal/pkg/etag"
+	"github.com/memodb-io/Acontext/internal/pkg/metrics"
 	"github.com/memodb-io/Acontext/internal/pkg/tokenizer"
+	"github.com/memodb-io/Acontext/internal/pkg/transcript"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type SessionHandler struct {
 	svc        service.SessionService
 	coreClient *httpclient.CoreClient
+	config     *config.Config
 }
 
-func NewSessionHandler(s service.SessionService, coreClient *httpclient.CoreClient) *SessionHandler {
+func NewSessionHandler(s service.SessionService, coreClient *httpclient.CoreClient, cfg *config.Config) *SessionHandler {
 	return &SessionHandler{
 		svc:        s,
 		coreClient: coreClient,
+		config:     cfg,
 	}
 }
 
@@ -38,14 +48,35 @@ type CreateSessionReq struct {
 	SpaceID             string                 `form:"space_id" json:"space_id" format:"uuid" example:"123e4567-e89b-12d3-a456-42661417"`
 	DisableTaskTracking *bool                  `form:"disable_task_tracking" json:"disable_task_tracking" example:"false"`
 	Configs             map[string]interface{} `form:"configs" json:"configs"`
+	ClientSessionID     string                 `form:"client_session_id" json:"client_session_id" binding:"omitempty,max=255" example:"chat-42"`
 }
 
+// defaultSessionsLimit is the page size of GetSessions without a limit
+const defaultSessionsLimit = 20
+
 type GetSessionsReq struct {
-	SpaceID      string `form:"space_id" json:"space_id" format:"uuid" example:"123e4567-e89b-12d3-a456-42661417"`
-	NotConnected bool   `form:"not_connected,default=false" json:"not_connected" example:"false"`
-	Limit        int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
-	Cursor       string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
-	TimeDesc     bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+	SpaceID        string `form:"space_id" json:"space_id" format:"uuid" example:"123e4567-e89b-12d3-a456-42661417"`
+	NotConnected   bool   `form:"not_connected,default=false" json:"not_connected" example:"false"`
+	LearningStatus string `form:"learning_status" json:"learning_status" binding:"omitempty,oneof=pending digested" example:"pending"`
+	CreatedAfter   string `form:"created_after" json:"created_after" format:"date-time" example:"2025-01-01T00:00:00Z"`
+	CreatedBefore  string `form:"created_before" json:"created_before" format:"date-time" example:"2025-01-08T00:00:00Z"`
+	Limit          *int   `form:"limit" json:"limit" binding:"omitempty,min=1,max=200" example:"20"`
+	Cursor         string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	SortBy         string `form:"sort_by" json:"sort_by" binding:"omitempty,oneof=created_at last_message_at message_count" example:"created_at"`
+	Include        string `form:"include" json:"include" binding:"omitempty,oneof=space" example:"space"`
+	TimeDesc       bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+}
+
+// SessionItem is a listed session, with its space embedded when listing with include=space
+type SessionItem struct {
+	model.Session
+	Space *model.Space `json:"space,omitempty"`
+}
+
+type ListSessionsResp struct {
+	Items      []SessionItem `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	HasMore    bool          `json:"has_more"`
 }
 
 // GetSessions godoc
@@ -57,11 +88,16 @@ type GetSessionsReq struct {
 //	@Produce		json
 //	@Param			space_id		query	string	false	"Space ID to filter sessions"									format(uuid)
 //	@Param			not_connected	query	boolean	false	"Filter sessions not connected to any space (default false)"	example(false)
-//	@Param			limit			query	integer	false	"Limit of sessions to return, default 20. Max 200."
+//	@Param			learning_status	query	string	false	"Filter sessions by their locally synced learning status: pending (some tasks not yet digested into the space) or digested"	Enums(pending, digested)
+//	@Param			created_after	query	string	false	"Only return sessions created after this time (RFC3339)"	format(date-time)
+//	@Param			created_before	query	string	false	"Only return sessions created before this time (RFC3339)"	format(date-time)
+//	@Param			limit			query	integer	false	"Limit of sessions to return, between 1 and 200, default 20."
 //	@Param			cursor			query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
-//	@Param			time_desc		query	string	false	"Order by created_at descending if true, ascending if false (default false)"	example(false)
+//	@Param			sort_by			query	string	false	"Column to order sessions by: created_at (default), last_message_at (sessions without messages by created_at) or message_count. A cursor is only valid with the sort_by it was returned for."	Enums(created_at, last_message_at, message_count)
+//	@Param			include			query	string	false	"Embed the space of connected sessions in each item, only space is supported"	Enums(space)
+//	@Param			time_desc		query	string	false	"Order by sort_by descending if true, ascending if false (default false)"	example(false)
 //	@Security		BearerAuth
-//	@Success		200	{object}	serializer.Response{data=service.ListSessionsOutput}
+//	@Success		200	{object}	serializer.Response{data=handler.ListSessionsResp}
 //	@Router			/session [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# List sessions\nsessions = client.sessions.list(\n    space_id='space-uuid',\n    limit=20,\n    time_desc=True\n)\nfor session in sessions.items:\n    print(f\"{session.id}: {session.space_id}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// List sessions\nconst sessions = await client.sessions.list({\n  spaceId: 'space-uuid',\n  limit: 20,\n  timeDesc: true\n});\nfor (const session of sessions.items) {\n  console.log(`${session.id}: ${session.space_id}`);\n}\n","label":"JavaScript"}]
 func (h *SessionHandler) GetSessions(c *gin.Context) {
@@ -88,16 +124,145 @@ func (h *SessionHandler) GetSessions(c *gin.Context) {
 		spaceID = &parsed
 	}
 
+	// Parse created_at range query parameters
+	var createdAfter, createdBefore *time.Time
+	if req.CreatedAfter != "" {
+		parsed, err := time.Parse(time.RFC3339, req.CreatedAfter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid created_after, must be RFC3339", err))
+			return
+		}
+		createdAfter = &parsed
+	}
+	if req.CreatedBefore != "" {
+		parsed, err := time.Parse(time.RFC3339, req.CreatedBefore)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid created_before, must be RFC3339", err))
+			return
+		}
+		createdBefore = &parsed
+	}
+	if createdAfter != nil && createdBefore != nil && !createdAfter.Before(*createdBefore) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("created_after must be earlier than created_before")))
+		return
+	}
+
+	limit := defaultSessionsLimit
+	if req.Limit != nil {
+		limit = *req.Limit
+	}
+
 	out, err := h.svc.List(c.Request.Context(), service.ListSessionsInput{
-		ProjectID:    project.ID,
-		SpaceID:      spaceID,
-		NotConnected: req.NotConnected,
-		Limit:        req.Limit,
-		Cursor:       req.Cursor,
-		TimeDesc:     req.TimeDesc,
+		ProjectID:      project.ID,
+		SpaceID:        spaceID,
+		NotConnected:   req.NotConnected,
+		LearningStatus: req.LearningStatus,
+		CreatedAfter:   createdAfter,
+		CreatedBefore:  createdBefore,
+		Limit:          limit,
+		SortBy:         req.SortBy,
+		WithSpace:      req.Include == "space",
+		Cursor:         req.Cursor,
+		TimeDesc:       req.TimeDesc,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		listErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := ListSessionsResp{Items: make([]SessionItem, 0, len(out.Items)), NextCursor: out.NextCursor, HasMore: out.HasMore}
+	for _, ss := range out.Items {
+		resp.Items = append(resp.Items, SessionItem{Session: ss, Space: ss.Space})
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: resp})
+}
+
+type GetFeedReq struct {
+	Limit  int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=50" example:"20"`
+	Cursor string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+}
+
+// GetFeed godoc
+//
+//	@Summary		Get activity feed
+//	@Description	Get the recently active sessions of the project, ordered by last_message_at descending, each with a preview of its latest message. Sessions without messages are not listed.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query	integer	false	"Limit of sessions to return, default 20. Max 50."
+//	@Param			cursor	query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.FeedOutput}
+//	@Router			/project/feed [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get recently active sessions\nfeed = client.project.feed(limit=20)\nfor item in feed.items:\n    print(f\"{item.session.id}: {item.last_message.preview}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get recently active sessions\nconst feed = await client.project.feed({ limit: 20 });\nfor (const item of feed.items) {\n  console.log(`${item.session.id}: ${item.last_message.preview}`);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) GetFeed(c *gin.Context) {
+	req := GetFeedReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.Feed(c.Request.Context(), service.FeedInput{
+		ProjectID: project.ID,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+	})
+	if err != nil {
+		listErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type SearchMessagesReq struct {
+	Q      string `form:"q" json:"q" binding:"required,max=256" example:"deployment plan"`
+	Limit  int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=50" example:"20"`
+	Cursor string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+}
+
+// SearchMessages godoc
+//
+//	@Summary		Search project messages
+//	@Description	Search the text of the messages of all sessions of the project, newest first, ignoring case. Text and tool-result parts are matched. Each hit has the session and message ids and a snippet around the match. A request reads a bounded number of messages, so a page may hold fewer hits than the limit while has_more is true: follow next_cursor to continue the search. Queries shorter than 3 characters can't use the search index and are slower on large projects. Messages stored before their text was indexed are matched once the server backfilled it at startup.
+//	@Tags			project
+//	@Accept			json
+//	@Produce		json
+//	@Param			q		query	string	true	"Text to search for. Max 256 characters."
+//	@Param			limit	query	integer	false	"Limit of hits to return, default 20. Max 50."
+//	@Param			cursor	query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.SearchMessagesOutput}
+//	@Router			/project/messages/search [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Find the conversations mentioning a topic\nresult = client.project.search_messages(q='deployment plan')\nfor hit in result.items:\n    print(f\"{hit.session_id}: {hit.snippet}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Find the conversations mentioning a topic\nconst result = await client.project.searchMessages({ q: 'deployment plan' });\nfor (const hit of result.items) {\n  console.log(`${hit.session_id}: ${hit.snippet}`);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) SearchMessages(c *gin.Context) {
+	req := SearchMessagesReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.SearchMessages(c.Request.Context(), service.SearchMessagesInput{
+		ProjectID: project.ID,
+		Query:     req.Q,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+	})
+	if err != nil {
+		listErr(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -107,13 +272,14 @@ func (h *SessionHandler) GetSessions(c *gin.Context) {
 // CreateSession godoc
 //
 //	@Summary		Create session
-//	@Description	Create a new session under a space
+//	@Description	Create a new session under a space. Pass a client_session_id to make retries safe: when the project already has a session with that id, it is returned as is with status 200 instead of creating a duplicate.
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body	handler.CreateSessionReq	true	"CreateSession payload"
 //	@Security		BearerAuth
 //	@Success		201	{object}	serializer.Response{data=model.Session}
+//	@Success		200	{object}	serializer.Response{data=model.Session}	"Existing session with the same client_session_id"
 //	@Router			/session [post]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Create a session\nsession = client.sessions.create(\n    space_id='space-uuid',\n    configs={\"mode\": \"chat\"}\n)\nprint(f\"Created session: {session.id}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Create a session\nconst session = await client.sessions.create({\n  spaceId: 'space-uuid',\n  configs: { mode: 'chat' }\n});\nconsole.log(`Created session: ${session.id}`);\n","label":"JavaScript"}]
 func (h *SessionHandler) CreateSession(c *gin.Context) {
@@ -145,24 +311,37 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 	if req.DisableTaskTracking != nil {
 		session.DisableTaskTracking = *req.DisableTaskTracking
 	}
-	if err := h.svc.Create(c.Request.Context(), &session); err != nil {
+	if req.ClientSessionID != "" {
+		session.ClientSessionID = &req.ClientSessionID
+	}
+	created, err := h.svc.GetOrCreate(c.Request.Context(), &session)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
 
-	c.JSON(http.StatusCreated, serializer.Response{Data: session})
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	c.JSON(status, serializer.Response{Data: session})
+}
+
+type DeleteSessionReq struct {
+	IncludeAssetDelta bool `form:"include_asset_delta,default=false" json:"include_asset_delta" example:"false"`
 }
 
 // DeleteSession godoc
 //
 //	@Summary		Delete session
-//	@Description	Delete a session by id
+//	@Description	Delete a session by id. With include_asset_delta, the response lists the assets of its messages whose references were decremented, and those freed and deleted from storage as their last reference went away.
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
-//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			session_id			path	string	true	"Session ID"	format(uuid)
+//	@Param			include_asset_delta	query	boolean	false	"Return the asset reference changes of the delete"	example(false)
 //	@Security		BearerAuth
-//	@Success		200	{object}	serializer.Response{}
+//	@Success		200	{object}	serializer.Response{data=model.AssetRefDelta}
 //	@Router			/session/{session_id} [delete]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Delete a session\nclient.sessions.delete(session_id='session-uuid')\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Delete a session\nawait client.sessions.delete('session-uuid');\n","label":"JavaScript"}]
 func (h *SessionHandler) DeleteSession(c *gin.Context) {
@@ -178,11 +357,22 @@ func (h *SessionHandler) DeleteSession(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.Delete(c.Request.Context(), project.ID, sessionID); err != nil {
+	req := DeleteSessionReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	delta, err := h.svc.Delete(c.Request.Context(), project.ID, sessionID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
 
+	if req.IncludeAssetDelta {
+		c.JSON(http.StatusOK, serializer.Response{Data: delta})
+		return
+	}
 	c.JSON(http.StatusOK, serializer.Response{})
 }
 
@@ -218,7 +408,7 @@ func (h *SessionHandler) UpdateConfigs(c *gin.Context) {
 	if err := h.svc.UpdateByID(c.Request.Context(), &model.Session{
 		ID:      sessionID,
 		Configs: datatypes.JSONMap(req.Configs),
-	}); err != nil {
+	}, "configs"); err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
@@ -233,9 +423,11 @@ func (h *SessionHandler) UpdateConfigs(c *gin.Context) {
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
-//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			session_id		path	string	true	"Session ID"	format(uuid)
+//	@Param			If-None-Match	header	string	false	"ETag of a previous response, 304 is returned if the session is unchanged"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=model.Session}
+//	@Success		304	"Session is unchanged since the given ETag"
 //	@Router			/session/{session_id}/configs [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get session configs\nsession = client.sessions.get_configs(session_id='session-uuid')\nprint(session.configs)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get session configs\nconst session = await client.sessions.getConfigs('session-uuid');\nconsole.log(session.configs);\n","label":"JavaScript"}]
 func (h *SessionHandler) GetConfigs(c *gin.Context) {
@@ -250,9 +442,109 @@ func (h *SessionHandler) GetConfigs(c *gin.Context) {
 		return
 	}
 
+	// The learning status sync doesn't touch updated_at, so its sync time is part of the ETag too
+	syncedAt := ""
+	if session.LearningStatusSyncedAt != nil {
+		syncedAt = session.LearningStatusSyncedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if notModified(c, etag.Weak(session.ID.String(), session.UpdatedAt.UTC().Format(time.RFC3339Nano), syncedAt)) {
+		return
+	}
+
 	c.JSON(http.StatusOK, serializer.Response{Data: session})
 }
 
+type SystemPromptResp struct {
+	SystemPrompt string `json:"system_prompt"`
+}
+
+// GetSystemPrompt godoc
+//
+//	@Summary		Get session system prompt
+//	@Description	Get the system prompt of a session. System messages are not stored as messages, the system prompt is kept in the session configs under the system_prompt key. Returns an empty string if none is set.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.SystemPromptResp}
+//	@Failure		404	{object}	serializer.Response{}
+//	@Router			/session/{session_id}/system_prompt [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get session system prompt\nresult = client.sessions.get_system_prompt(session_id='session-uuid')\nprint(result.system_prompt)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get session system prompt\nconst result = await client.sessions.getSystemPrompt('session-uuid');\nconsole.log(result.system_prompt);\n","label":"JavaScript"}]
+func (h *SessionHandler) GetSystemPrompt(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	session, err := h.svc.GetByID(c.Request.Context(), &model.Session{ID: sessionID})
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+	if err != nil || session.ProjectID != project.ID {
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, "session not found", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: SystemPromptResp{SystemPrompt: session.SystemPrompt()}})
+}
+
+type UpdateSystemPromptReq struct {
+	SystemPrompt *string `form:"system_prompt" json:"system_prompt" binding:"required" example:"You are a helpful assistant."`
+}
+
+// UpdateSystemPrompt godoc
+//
+//	@Summary		Update session system prompt
+//	@Description	Replace the system prompt of a session. Other session configs are kept as is. An empty string clears the system prompt.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string							true	"Session ID"	format(uuid)
+//	@Param			payload		body	handler.UpdateSystemPromptReq	true	"UpdateSystemPrompt payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Failure		404	{object}	serializer.Response{}
+//	@Router			/session/{session_id}/system_prompt [put]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Update session system prompt\nclient.sessions.update_system_prompt(\n    session_id='session-uuid',\n    system_prompt='You are a helpful assistant.'\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Update session system prompt\nawait client.sessions.updateSystemPrompt('session-uuid', {\n  systemPrompt: 'You are a helpful assistant.'\n});\n","label":"JavaScript"}]
+func (h *SessionHandler) UpdateSystemPrompt(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := UpdateSystemPromptReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := h.svc.UpdateSystemPrompt(c.Request.Context(), project.ID, sessionID, *req.SystemPrompt); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
+
 type ConnectToSpaceReq struct {
 	SpaceID string `form:"space_id" json:"space_id" binding:"required,uuid" format:"uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
 }
@@ -260,7 +552,7 @@ type ConnectToSpaceReq struct {
 // ConnectToSpace godoc
 //
 //	@Summary		Connect session to space
-//	@Description	Connect a session to a space by id
+//	@Description	Connect a session to a space by id. To move a session that is already connected to another space, use move_to_space, which also checks the space and triggers learning in it.
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
@@ -291,7 +583,105 @@ func (h *SessionHandler) ConnectToSpace(c *gin.Context) {
 	if err := h.svc.UpdateByID(c.Request.Context(), &model.Session{
 		ID:      sessionID,
 		SpaceID: &spaceID,
-	}); err != nil {
+	}, "space_id"); err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
+
+type MoveToSpaceReq struct {
+	SpaceID string `form:"space_id" json:"space_id" binding:"required,uuid" format:"uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// MoveToSpace godoc
+//
+//	@Summary		Move session to space
+//	@Description	Move a session, connected or not, to another space of the same project, then flush it so its pending messages are learned in the new space. Tasks already learned in the previous space are not learned again.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string					true	"Session ID"	format(uuid)
+//	@Param			payload		body	handler.MoveToSpaceReq	true	"MoveToSpace payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=httpclient.FlagResponse}
+//	@Router			/session/{session_id}/move_to_space [post]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Move session to another space\nclient.sessions.move_to_space(\n    session_id='session-uuid',\n    space_id='space-uuid'\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Move session to another space\nawait client.sessions.moveToSpace('session-uuid', {\n  spaceId: 'space-uuid'\n});\n","label":"JavaScript"}]
+func (h *SessionHandler) MoveToSpace(c *gin.Context) {
+	req := MoveToSpaceReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	spaceID, err := uuid.Parse(req.SpaceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := h.svc.MoveToSpace(c.Request.Context(), project.ID, sessionID, spaceID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrSessionNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+		case errors.Is(err, service.ErrSpaceNotInProject):
+			c.JSON(http.StatusForbidden, serializer.Err(http.StatusForbidden, err.Error(), nil))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	result, err := h.coreClient.SessionFlush(c.Request.Context(), project.ID, sessionID)
+	if err != nil {
+		coreErr(c, "session moved, but failed to flush it", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: result})
+}
+
+// DisconnectFromSpace godoc
+//
+//	@Summary		Disconnect session from space
+//	@Description	Disconnect a session from its space, so it is listed again with not_connected=true. Tasks already learned in the space are kept there.
+//	@Tags			session
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Router			/session/{session_id}/disconnect_from_space [post]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Disconnect session from its space\nclient.sessions.disconnect_from_space(session_id='session-uuid')\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Disconnect session from its space\nawait client.sessions.disconnectFromSpace('session-uuid');\n","label":"JavaScript"}]
+func (h *SessionHandler) DisconnectFromSpace(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := h.svc.DisconnectFromSpace(c.Request.Context(), project.ID, sessionID); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, err.Error(), nil))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
@@ -301,13 +691,15 @@ func (h *SessionHandler) ConnectToSpace(c *gin.Context) {
 
 type StoreMessageReq struct {
 	Blob   interface{} `form:"blob" json:"blob" binding:"required"`
-	Format string      `form:"format" json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini" example:"openai" enums:"acontext,openai,anthropic,gemini"`
+	Format string      `form:"format" json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini langchain" example:"openai" enums:"acontext,openai,anthropic,gemini,langchain"`
+	// Optional ordering key of the message in its session, for conversations replayed or imported out of order
+	ClientSeq *int64 `form:"client_seq" json:"client_seq" example:"42"`
 }
 
 // StoreMessage godoc
 //
 //	@Summary		Store message to session
-//	@Description	Supports JSON and multipart/form-data. In multipart mode: the payload is a JSON string placed in a form field. The format parameter indicates the format of the input message (default: openai, same as GET). The blob field should be a complete message object: for openai, use OpenAI ChatCompletionMessageParam format (with role and content); for anthropic, use Anthropic MessageParam format (with role and content); for acontext (internal), use {role, parts} format.
+//	@Description	Supports JSON and multipart/form-data. Requests over the configured body size, or messages with too many parts or an oversized inline base64 payload, are rejected with 413. In multipart mode: the payload is a JSON string placed in a form field. The format parameter indicates the format of the input message (default: openai, same as GET). The blob field should be a complete message object: for openai, use OpenAI ChatCompletionMessageParam format (with role and content); for anthropic, use Anthropic MessageParam format (with role and content); for acontext (internal), use {role, parts} format. Projects can enforce conversation structure through their configs: require_system_prompt rejects messages while the session has no system prompt, first_message_role rejects a first message with another role. The optional client_seq orders the message in its session: messages are listed by client_seq, messages without one after the others, then by creation time.
 //	@Tags			session
 //	@Accept			json
 //	@Accept			multipart/form-data
@@ -319,24 +711,44 @@ type StoreMessageReq struct {
 //
 //	// Content-Type: multipart/form-data
 //	@Param			payload		formData	string					false	"StoreMessage payload (Content-Type: multipart/form-data)"
-//	@Param			file		formData	file					false	"When uploading files, the field name must correspond to parts[*].file_field."
+//	@Param			file		formData	file					false	"When uploading files, the field name must correspond to parts[*].file_field. The file content must match the part type, e.g. an image part needs an image file. Every declared file_field must be uploaded, files no part references are reported in a Warning header, or rejected when message.rejectUnreferencedFiles is set."
 //	@Security		BearerAuth
 //	@Success		201	{object}	serializer.Response{data=model.Message}
 //	@Router			/session/{session_id}/messages [post]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\nfrom acontext.messages import build_acontext_message\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Store a message in Acontext format\nmessage = build_acontext_message(role='user', parts=['Hello!'])\nclient.sessions.store_message(\n    session_id='session-uuid',\n    blob=message,\n    format='acontext'\n)\n\n# Store a message in OpenAI format\nopenai_message = {'role': 'user', 'content': 'Hello from OpenAI format!'}\nclient.sessions.store_message(\n    session_id='session-uuid',\n    blob=openai_message,\n    format='openai'\n)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient, MessagePart } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Store a message in Acontext format\nawait client.sessions.storeMessage(\n  'session-uuid',\n  {\n    role: 'user',\n    parts: [MessagePart.textPart('Hello!')]\n  },\n  { format: 'acontext' }\n);\n\n// Store a message in OpenAI format\nawait client.sessions.storeMessage(\n  'session-uuid',\n  {\n    role: 'user',\n    content: 'Hello from OpenAI format!'\n  },\n  { format: 'openai' }\n);\n","label":"JavaScript"}]
 func (h *SessionHandler) StoreMessage(c *gin.Context) {
 	req := StoreMessageReq{}
+	limits := h.config.Message
 
+	// Cap the body before anything reads it, so oversized requests are rejected while streaming
+	if !capBody(c, limits.MaxBodyBytes) {
+		return
+	}
+
+	var tooLarge *http.MaxBytesError
 	ct := c.ContentType()
 	if strings.HasPrefix(ct, "multipart/form-data") {
+		// PostForm swallows parse errors, parse the form first to report a capped body
+		if _, err := c.MultipartForm(); errors.As(err, &tooLarge) {
+			bodyTooLarge(c, limits.MaxBodyBytes)
+			return
+		}
 		if p := c.PostForm("payload"); p != "" {
-			if err := sonic.Unmarshal([]byte(p), &req); err != nil {
+			if err := decodeBlobJSON(strings.NewReader(p), &req); err != nil {
 				c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid payload json", err))
 				return
 			}
 		}
 	} else {
-		if err := c.ShouldBind(&req); err != nil {
+		bind := c.ShouldBind
+		if ct == binding.MIMEJSON {
+			bind = func(obj any) error { return bindBlobJSON(c, obj) }
+		}
+		if err := bind(&req); err != nil {
+			if errors.As(err, &tooLarge) {
+				bodyTooLarge(c, limits.MaxBodyBytes)
+				return
+			}
 			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
 			return
 		}
@@ -356,105 +768,42 @@ func (h *SessionHandler) StoreMessage(c *gin.Context) {
 
 	// Parse and normalize based on format
 	// Blob contains the complete message object, directly use official SDK validation
-	var normalizedRole string
-	var normalizedParts []service.PartIn
-	var normalizedMeta map[string]interface{}
-	var fileFields []string
-
-	blobJSON, err := sonic.Marshal(req.Blob)
+	normalizedRole, normalizedParts, normalizedMeta, err := normalizeBlob(limits, format, req.Blob)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid blob", err))
+		blobErr(c, format, err)
 		return
 	}
 
-	switch format {
-	case model.FormatAcontext:
-		// Parse and validate using Acontext normalizer
-		norm := &normalizer.AcontextNormalizer{}
-		normalizedRole, normalizedParts, normalizedMeta, err = norm.NormalizeFromAcontextMessage(blobJSON)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, serializer.ParamErr("failed to normalize Acontext message", err))
-			return
-		}
-
-		// Collect file fields from normalized parts
-		for _, p := range normalizedParts {
-			if p.FileField != "" {
-				fileFields = append(fileFields, p.FileField)
-			}
+	// Collect file fields from normalized parts
+	var fileFields []string
+	for _, p := range normalizedParts {
+		if p.FileField != "" {
+			fileFields = append(fileFields, p.FileField)
 		}
+	}
 
-	case model.FormatOpenAI:
-		// Parse and validate using official OpenAI SDK
-		norm := &normalizer.OpenAINormalizer{}
-		normalizedRole, normalizedParts, normalizedMeta, err = norm.NormalizeFromOpenAIMessage(blobJSON)
+	// Handle file uploads if multipart
+	fileMap := map[string]*multipart.FileHeader{}
+	if strings.HasPrefix(ct, "multipart/form-data") {
+		form, err := c.MultipartForm()
 		if err != nil {
-			c.JSON(http.StatusBadRequest, serializer.ParamErr("failed to normalize OpenAI message", err))
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid multipart form", err))
 			return
 		}
-
-		// Collect file fields from normalized parts
-		for _, p := range normalizedParts {
-			if p.FileField != "" {
-				fileFields = append(fileFields, p.FileField)
-			}
-		}
-
-	case model.FormatAnthropic:
-		// Parse and validate using official Anthropic SDK
-		norm := &normalizer.AnthropicNormalizer{}
-		normalizedRole, normalizedParts, normalizedMeta, err = norm.NormalizeFromAnthropicMessage(blobJSON)
+		unreferenced, err := matchFormFiles(form, fileFields, fileMap)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, serializer.ParamErr("failed to normalize Anthropic message", err))
+			c.JSON(http.StatusBadRequest, serializer.ParamErr(err.Error(), nil))
 			return
 		}
-
-		// Collect file fields from normalized parts
-		for _, p := range normalizedParts {
-			if p.FileField != "" {
-				fileFields = append(fileFields, p.FileField)
+		if len(unreferenced) > 0 {
+			msg := fmt.Sprintf("uploaded files not referenced by any part: %s", strings.Join(unreferenced, ", "))
+			if h.config.Message.RejectUnreferencedFiles {
+				c.JSON(http.StatusBadRequest, serializer.ParamErr(msg, nil))
+				return
 			}
+			c.Header("Warning", fmt.Sprintf("199 - %q", msg))
 		}
-
-	case model.FormatGemini:
-		// Parse and validate using official Google Gemini SDK
-		norm := &normalizer.GeminiNormalizer{}
-		normalizedRole, normalizedParts, normalizedMeta, err = norm.NormalizeFromGeminiMessage(blobJSON)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, serializer.ParamErr("failed to normalize Gemini message", err))
-			return
-		}
-
-		// Collect file fields from normalized parts
-		for _, p := range normalizedParts {
-			if p.FileField != "" {
-				fileFields = append(fileFields, p.FileField)
-			}
-		}
-
-	default:
-		c.JSON(http.StatusBadRequest, serializer.ParamErr("unsupported format", fmt.Errorf("format %s is not supported", format)))
-		return
-	}
-
-	// Validate that we have at least one part
-	if len(normalizedParts) == 0 {
-		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("message must contain at least one part")))
-		return
-	}
-
-	// Handle file uploads if multipart
-	fileMap := map[string]*multipart.FileHeader{}
-	if strings.HasPrefix(ct, "multipart/form-data") {
-		for _, fileField := range fileFields {
-			fh, err := c.FormFile(fileField)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, serializer.ParamErr(fmt.Sprintf("missing file %s", fileField), err))
-				return
-			}
-			fileMap[fileField] = fh
-		}
-	}
+	}
 
 	project, ok := c.MustGet("project").(*model.Project)
 	if !ok {
@@ -475,40 +824,108 @@ func (h *SessionHandler) StoreMessage(c *gin.Context) {
 		Parts:       normalizedParts,
 		MessageMeta: normalizedMeta,
 		Files:       fileMap,
+		ClientSeq:   req.ClientSeq,
+		Rules:       project.MessageRules(),
+		Quota:       project.Quota(),
 	})
 	if err != nil {
+		if errors.Is(err, service.ErrMessageRuleViolation) || errors.Is(err, service.ErrAssetTypeMismatch) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		if errors.Is(err, service.ErrQuotaExceeded) {
+			c.JSON(http.StatusForbidden, serializer.Err(http.StatusForbidden, err.Error(), nil))
+			return
+		}
+		if errors.Is(err, service.ErrPartsNotLoaded) {
+			partsNotLoaded(c, err)
+			return
+		}
 		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
 		return
 	}
 
+	metrics.MessagesStored.WithLabelValues(string(format)).Inc()
+
 	c.JSON(http.StatusCreated, serializer.Response{Data: out})
 }
 
+// partsNotLoaded responds 503 to a check that could not load the parts of every message it needs,
+// the parts store is failing and the request can be retried
+func partsNotLoaded(c *gin.Context, err error) {
+	c.JSON(http.StatusServiceUnavailable, serializer.Err(http.StatusServiceUnavailable, "message parts could not be loaded", err))
+}
+
+// matchFormFiles fills fileMap with the uploaded file of every file field declared by the parts,
+// and returns the uploaded fields no part references. All missing fields are reported at once.
+func matchFormFiles(form *multipart.Form, fileFields []string, fileMap map[string]*multipart.FileHeader) ([]string, error) {
+	var missing []string
+	for _, field := range fileFields {
+		if fhs := form.File[field]; len(fhs) > 0 {
+			fileMap[field] = fhs[0]
+		} else if !slices.Contains(missing, field) {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing file %s", strings.Join(missing, ", "))
+	}
+
+	var unreferenced []string
+	for field := range form.File {
+		if _, ok := fileMap[field]; !ok {
+			unreferenced = append(unreferenced, field)
+		}
+	}
+	slices.Sort(unreferenced)
+	return unreferenced, nil
+}
+
 type GetMessagesReq struct {
-	Limit              *int   `form:"limit" json:"limit" binding:"omitempty,min=0,max=200" example:"20"`
-	Cursor             string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
-	WithAssetPublicURL bool   `form:"with_asset_public_url,default=true" json:"with_asset_public_url" example:"true"`
-	Format             string `form:"format,default=openai" json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini" example:"openai" enums:"acontext,openai,anthropic,gemini"`
-	TimeDesc           bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
-	EditStrategies     string `form:"edit_strategies" json:"edit_strategies" example:"[{\"type\":\"remove_tool_result\",\"params\":{\"keep_recent_n_tool_results\":3}}]"`
+	Limit                 *int   `form:"limit" json:"limit" binding:"omitempty,min=0,max=200" example:"20"`
+	Cursor                string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	WithAssetPublicURL    *bool  `form:"with_asset_public_url" json:"with_asset_public_url" example:"true"`
+	AssetURLExpireSeconds *int   `form:"asset_url_expire_seconds" json:"asset_url_expire_seconds" binding:"omitempty,min=1,max=604800" example:"86400"`
+	Format                string `form:"format" json:"format" binding:"omitempty,oneof=acontext openai anthropic gemini langchain" example:"openai" enums:"acontext,openai,anthropic,gemini,langchain"`
+	TimeDesc              bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+	OutputDesc            bool   `form:"output_desc,default=false" json:"output_desc" example:"false"`
+	SummaryOnly           bool   `form:"summary_only,default=false" json:"summary_only" example:"false"`
+	EditStrategies        string `form:"edit_strategies" json:"edit_strategies" example:"[{\"type\":\"remove_tool_result\",\"params\":{\"keep_recent_n_tool_results\":3}}]"`
+	TZ                    string `form:"tz" json:"tz" example:"Asia/Shanghai"`
+	OnlySourceFormat      bool   `form:"only_source_format,default=false" json:"only_source_format" example:"false"`
+	WithPartsSource       bool   `form:"with_parts_source,default=false" json:"with_parts_source" example:"false"`
+	LargeNumbersAsStrings bool   `form:"large_numbers_as_strings,default=false" json:"large_numbers_as_strings" example:"false"`
+	PreserveNames         bool   `form:"preserve_names,default=false" json:"preserve_names" example:"false"`
+	WithSystemPrompt      bool   `form:"with_system_prompt,default=false" json:"with_system_prompt" example:"false"`
 }
 
 // GetMessages godoc
 //
 //	@Summary		Get messages from session
-//	@Description	Get messages from session. Default format is openai. Can convert to acontext (original), anthropic, or gemini format.
+//	@Description	Get messages from session. Default format is the project default_message_format config, or openai. Can convert to acontext (original), anthropic, gemini, or langchain format. With tz, timestamps are rendered in that timezone with its offset. Messages are ordered by their client_seq, messages without one last, then by creation time. The last message of the session is flagged with is_latest in the acontext format and summary_only, and named by latest_id in the other formats, when it is on the returned page. System prompts are not messages, and an Anthropic messages array can't hold a system role: with format anthropic and with_system_prompt, the session system prompt is returned in a system field next to items, to pass as the top-level system parameter of Anthropic.
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
 //	@Param			session_id				path	string	true	"Session ID"	format(uuid)
 //	@Param			limit					query	integer	false	"Limit of messages to return. Max 200. If limit is 0 or not provided, all messages will be returned. \n\nWARNING!\n Use `limit` only for read-only/display purposes (pagination, viewing). Do NOT use `limit` to truncate messages before sending to LLM as it may cause tool-call and tool-result unpairing issues. Instead, use the `token_limit` edit strategy in `edit_strategies` parameter to safely manage message context size."
 //	@Param			cursor					query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
-//	@Param			with_asset_public_url	query	string	false	"Whether to return asset public url, default is true"										example(true)
-//	@Param			format					query	string	false	"Format to convert messages to: acontext (original), openai (default), anthropic, gemini."	enums(acontext,openai,anthropic,gemini)
+//	@Param			with_asset_public_url	query	string	false	"Whether to return asset public url, defaults to the project with_asset_public_url config (true if unset)"	example(true)
+//	@Param			asset_url_expire_seconds	query	integer	false	"Lifetime of the asset public urls in seconds, at most 604800 (default 86400). Capped by the server s3.presignMaxExpireSec, a capped expiry is reported in a Warning header"	example(86400)
+//	@Param			format					query	string	false	"Format to convert messages to: acontext (original), openai, anthropic, gemini, langchain. Defaults to the project default_message_format config, or openai."	enums(acontext,openai,anthropic,gemini,langchain)
 //	@Param			time_desc				query	string	false	"Order by created_at descending if true, ascending if false (default false)"				example(false)
+//	@Param			output_desc				query	string	false	"Return items newest-first if true, oldest-first if false (default false)"					example(false)
+//	@Param			summary_only			query	string	false	"Return messages without parts, only with part_type_counts. Ignores format (default false)"	example(false)
 //	@Param			edit_strategies			query	string	false	"JSON array of edit strategies to apply before format conversion"							example([{"type":"remove_tool_result","params":{"keep_recent_n_tool_results":3}}])
+//	@Param			tz						query	string	false	"IANA timezone, e.g. Asia/Shanghai, to render created_at and updated_at in. Only the acontext format and summary_only return timestamps (default UTC)"	example(Asia/Shanghai)
+//	@Param			only_source_format		query	string	false	"Only return the messages sent in the requested format, skipping those that would be converted from another format. Pages can then hold fewer messages than limit. Cannot be used with summary_only (default false)"	example(false)
+//	@Param			with_parts_source		query	string	false	"Debug option returning parts_sources, mapping each message ID to where its parts were loaded from: redis, s3, or none when neither had them. Requires the admin scope, cannot be used with summary_only and is never answered with 304 (default false)"	example(false)
+//	@Param			large_numbers_as_strings	query	string	false	"Write the integers of tool-call arguments beyond ±(2^53-1), such as 64-bit IDs, as strings, for clients parsing JSON numbers as float64 (default false)"	example(false)
+//	@Param			with_system_prompt		query	string	false	"Return the session system prompt in a system field, as Anthropic takes it, left out when the session has none. Requires format anthropic and cannot be used with summary_only (default false)"	example(false)
+//	@Param			preserve_names			query	string	false	"Write the name of messages in a meta field of anthropic and gemini messages, which have no name, so that storing them back keeps it. Providers reject the field, remove it before sending the messages to them (default false)"	example(false)
+//	@Param			If-None-Match			header	string	false	"ETag of a previous response, 304 is returned if the messages are unchanged"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=service.GetMessagesOutput}
+//	@Success		304	"Messages are unchanged since the given ETag"
 //	@Router			/session/{session_id}/messages [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get messages from session\nmessages = client.sessions.get_messages(\n    session_id='session-uuid',\n    limit=50,\n    format='acontext',\n    time_desc=True\n)\nfor message in messages.items:\n    print(f\"{message.role}: {message.parts}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get messages from session\nconst messages = await client.sessions.getMessages('session-uuid', {\n  limit: 50,\n  format: 'acontext',\n  timeDesc: true\n});\nfor (const message of messages.items) {\n  console.log(`${message.role}: ${JSON.stringify(message.parts)}`);\n}\n","label":"JavaScript"}]
 func (h *SessionHandler) GetMessages(c *gin.Context) {
@@ -538,48 +955,367 @@ func (h *SessionHandler) GetMessages(c *gin.Context) {
 			return
 		}
 	}
+	if req.SummaryOnly && len(editStrategies) > 0 {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("edit_strategies cannot be used with summary_only")))
+		return
+	}
+	if req.SummaryOnly && req.OnlySourceFormat {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("only_source_format cannot be used with summary_only")))
+		return
+	}
+	if req.WithPartsSource {
+		if req.SummaryOnly {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("with_parts_source cannot be used with summary_only")))
+			return
+		}
+		if !model.ScopeAllows(c.GetString("scope"), model.ScopeAdmin) {
+			c.JSON(http.StatusForbidden, serializer.Err(http.StatusForbidden, "with_parts_source requires the admin scope", nil))
+			return
+		}
+	}
+
+	// Local is the server zone, not something a client can ask for
+	var loc *time.Location
+	if req.TZ != "" {
+		loc, err = time.LoadLocation(req.TZ)
+		if err != nil || req.TZ == "Local" {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid tz, expected an IANA timezone such as Asia/Shanghai", err))
+			return
+		}
+	}
+
+	// An explicit with_asset_public_url wins over the project default
+	withAssetPublicURL := true
+	if req.WithAssetPublicURL != nil {
+		withAssetPublicURL = *req.WithAssetPublicURL
+	} else if project, ok := c.Value("project").(*model.Project); ok {
+		withAssetPublicURL = project.DefaultWithAssetPublicURL()
+	}
+	assetExpire := time.Hour * 24
+	if req.AssetURLExpireSeconds != nil {
+		assetExpire = time.Duration(*req.AssetURLExpireSeconds) * time.Second
+	}
+	assetExpire = presignExpire(c, h.config, assetExpire, req.AssetURLExpireSeconds != nil)
+
+	// An explicit format wins over the project default, openai without either
+	format := model.MessageFormat(req.Format)
+	if format == "" {
+		if project, ok := c.Value("project").(*model.Project); ok {
+			format = project.DefaultMessageFormat()
+		}
+	}
+	if format == "" {
+		format = model.FormatOpenAI
+	}
+
+	// Anthropic takes the system prompt as a parameter of its own, its messages have no system role
+	var systemPrompt string
+	if req.WithSystemPrompt {
+		if format != model.FormatAnthropic || req.SummaryOnly {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("with_system_prompt requires the anthropic format and cannot be used with summary_only")))
+			return
+		}
+		session, err := h.svc.GetByID(c.Request.Context(), &model.Session{ID: sessionID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+			return
+		}
+		systemPrompt = session.SystemPrompt()
+	}
+
+	// The ETag covers the message version and the query that shapes the response. With public urls
+	// it also rolls over hourly, or as often as the urls expire if sooner, so that a 304 never keeps
+	// the client on urls close to expiry.
+	version, err := h.svc.GetMessagesVersion(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+	tagParts := []string{
+		sessionID.String(),
+		strconv.FormatInt(version.Count, 10),
+		"",
+		c.Request.URL.RawQuery,
+		strconv.FormatBool(withAssetPublicURL),
+		string(format),
+	}
+	if version.LastUpdatedAt != nil {
+		tagParts[2] = strconv.FormatInt(version.LastUpdatedAt.UnixNano(), 10)
+	}
+	if req.WithSystemPrompt {
+		tagParts = append(tagParts, systemPrompt)
+	}
+	if withAssetPublicURL {
+		rollover := int64(min(time.Hour, assetExpire) / time.Second)
+		tagParts = append(tagParts, strconv.FormatInt(time.Now().Unix()/max(rollover, 1), 10))
+	}
+	// where the parts come from changes between identical requests, a debugging request is always answered in full
+	if !req.WithPartsSource && notModified(c, etag.Weak(tagParts...)) {
+		return
+	}
 
 	out, err := h.svc.GetMessages(c.Request.Context(), service.GetMessagesInput{
 		SessionID:          sessionID,
 		Limit:              limit,
 		Cursor:             req.Cursor,
-		WithAssetPublicURL: req.WithAssetPublicURL,
-		AssetExpire:        time.Hour * 24,
+		WithAssetPublicURL: withAssetPublicURL,
+		AssetExpire:        assetExpire,
 		TimeDesc:           req.TimeDesc,
+		OutputDesc:         req.OutputDesc,
+		SummaryOnly:        req.SummaryOnly,
 		EditStrategies:     editStrategies,
+		WithPartsSource:    req.WithPartsSource,
 	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
+		listErr(c, http.StatusBadRequest, err)
 		return
 	}
 
-	// Convert messages to specified format (default: openai)
-	formatStr := req.Format
-	if formatStr == "" {
-		formatStr = string(model.FormatOpenAI)
+	if loc != nil {
+		for i := range out.Items {
+			out.Items[i].CreatedAt = out.Items[i].CreatedAt.In(loc)
+			out.Items[i].UpdatedAt = out.Items[i].UpdatedAt.In(loc)
+		}
 	}
 
-	format, err := converter.ValidateFormat(formatStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid format", err))
+	// Summary listing has no parts to convert
+	if req.SummaryOnly {
+		c.JSON(http.StatusOK, serializer.Response{Data: out})
 		return
 	}
 
+	// Skip the messages a lossy conversion from another format would return, and their asset urls
+	if req.OnlySourceFormat {
+		out.Items = slices.DeleteFunc(out.Items, func(m model.Message) bool { return m.SourceFormat() != format })
+		publicURLs := make(map[string]service.PublicURL, len(out.PublicURLs))
+		for _, m := range out.Items {
+			for _, p := range m.Parts {
+				if p.Asset == nil {
+					continue
+				}
+				if u, ok := out.PublicURLs[p.Asset.SHA256]; ok {
+					publicURLs[p.Asset.SHA256] = u
+				}
+			}
+		}
+		out.PublicURLs = publicURLs
+	}
+
 	convertedOut, err := converter.GetConvertedMessagesOutput(
 		out.Items,
 		format,
 		out.PublicURLs,
 		out.NextCursor,
 		out.HasMore,
+		converter.Options{LargeNumbersAsStrings: req.LargeNumbersAsStrings, PreserveNames: req.PreserveNames, SystemPrompt: systemPrompt},
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.DBErr("failed to convert messages", err))
+		// Name the failing message, its id and part types are all it takes to reproduce, even in release mode
+		msg := "failed to convert messages"
+		var convErr *converter.ConversionError
+		if errors.As(err, &convErr) && convErr.MessageID != uuid.Nil {
+			msg = fmt.Sprintf("failed to convert message %s with parts [%s] to %s", convErr.MessageID, strings.Join(convErr.PartTypes, ", "), convErr.Format)
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr(msg, err))
 		return
 	}
+	if req.WithPartsSource {
+		// only the returned messages, edit strategies and only_source_format may have dropped some
+		sources := make(map[string]string, len(out.Items))
+		for _, m := range out.Items {
+			if source, ok := out.PartsSources[m.ID.String()]; ok {
+				sources[m.ID.String()] = source
+			}
+		}
+		convertedOut["parts_sources"] = sources
+	}
 
 	c.JSON(http.StatusOK, serializer.Response{Data: convertedOut})
 }
 
+type GetAssetsReq struct {
+	GroupBy string `form:"group_by" json:"group_by" binding:"omitempty,oneof=type" example:"type" enums:"type"`
+}
+
+// GetAssets godoc
+//
+//	@Summary		Get session assets
+//	@Description	Get the assets of all messages in a session with presigned urls, oldest first. Assets are deduplicated by content. With group_by=type, assets are grouped by their part type (image, audio, file...).
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"									format(uuid)
+//	@Param			group_by	query	string	false	"Group assets by part type, only type is supported"	enums(type)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.GetAssetsOutput}
+//	@Router			/session/{session_id}/assets [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get session assets grouped by type\nresult = client.sessions.get_assets(session_id='session-uuid', group_by='type')\nfor asset in result.groups.get('image', []):\n    print(asset.public_url.url)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get session assets grouped by type\nconst result = await client.sessions.getAssets('session-uuid', { groupBy: 'type' });\nfor (const asset of result.groups.image ?? []) {\n  console.log(asset.public_url.url);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) GetAssets(c *gin.Context) {
+	req := GetAssetsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	out, err := h.svc.GetAssets(c.Request.Context(), service.GetAssetsInput{
+		SessionID:   sessionID,
+		GroupByType: req.GroupBy == "type",
+		AssetExpire: presignExpire(c, h.config, time.Hour*24, false),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// GetAssetReferences godoc
+//
+//	@Summary		Get asset references
+//	@Description	Get the IDs of the messages in a session whose parts reference the asset, oldest first. Useful to see where an asset is used before deleting it.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"					format(uuid)
+//	@Param			sha256		path	string	true	"SHA256 of the asset content"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.GetAssetReferencesOutput}
+//	@Router			/session/{session_id}/assets/{sha256}/references [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Find the messages using an asset\nresult = client.sessions.get_asset_references(session_id='session-uuid', sha256='asset-sha256')\nprint(result.message_ids)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Find the messages using an asset\nconst result = await client.sessions.getAssetReferences('session-uuid', 'asset-sha256');\nconsole.log(result.message_ids);\n","label":"JavaScript"}]
+func (h *SessionHandler) GetAssetReferences(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sha256 := c.Param("sha256")
+	if !sha256Pattern.MatchString(sha256) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("sha256 must be 64 lowercase hex characters", nil))
+		return
+	}
+
+	out, err := h.svc.GetAssetReferences(c.Request.Context(), sessionID, sha256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+type ExportMessagesReq struct {
+	Format string `form:"format,default=markdown" json:"format" binding:"omitempty,oneof=markdown text" example:"markdown" enums:"markdown,text"`
+}
+
+// exportBatchSize is the number of messages loaded and written at a time by ExportMessages
+const exportBatchSize = 100
+
+// ExportMessages godoc
+//
+//	@Summary		Export session messages
+//	@Description	Download the messages of a session as a readable transcript, oldest first. Each message is rendered as role: content, tool calls and results as fenced code blocks, and images and files as links to presigned urls. The transcript is streamed as messages are loaded.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		text/markdown
+//	@Produce		text/plain
+//	@Param			session_id	path	string	true	"Session ID"						format(uuid)
+//	@Param			format		query	string	false	"Transcript format, default markdown"	enums(markdown,text)
+//	@Security		BearerAuth
+//	@Success		200	{file}	file
+//	@Router			/session/{session_id}/export [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Export a session as Markdown\ntranscript = client.sessions.export(session_id='session-uuid', format='markdown')\nwith open('session.md', 'wb') as f:\n    f.write(transcript)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Export a session as Markdown\nconst transcript = await client.sessions.export('session-uuid', { format: 'markdown' });\nconsole.log(transcript);\n","label":"JavaScript"}]
+func (h *SessionHandler) ExportMessages(c *gin.Context) {
+	req := ExportMessagesReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	format := transcript.Format(req.Format)
+
+	in := service.GetMessagesInput{
+		SessionID:          sessionID,
+		Limit:              exportBatchSize,
+		WithAssetPublicURL: true,
+		AssetExpire:        presignExpire(c, h.config, time.Hour*24, false),
+	}
+	// the first batch is loaded before writing anything, so that a failure still gets an error response
+	out, err := h.svc.GetMessages(c.Request.Context(), in)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="session-%s.%s"`, sessionID, format.Extension()))
+	c.Status(http.StatusOK)
+
+	for {
+		for _, m := range out.Items {
+			if err := transcript.WriteMessage(c.Writer, format, m, out.PublicURLs); err != nil {
+				_ = c.Error(err)
+				return
+			}
+		}
+		c.Writer.Flush()
+		if !out.HasMore {
+			return
+		}
+
+		in.Cursor = out.NextCursor
+		if out, err = h.svc.GetMessages(c.Request.Context(), in); err != nil {
+			// the headers are already sent, so the transcript can only end early
+			_ = c.Error(err)
+			return
+		}
+	}
+}
+
+// WarmPartsCache godoc
+//
+//	@Summary		Warm session parts cache
+//	@Description	Load the parts of all messages of a session into the cache ahead of time, so that the first read of the session doesn't fall back to object storage. Calling it again only reports the parts as already cached.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.WarmPartsCacheOutput}
+//	@Router			/session/{session_id}/cache/warm [post]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Warm session parts cache\nresult = client.sessions.warm_cache(session_id='session-uuid')\nprint(result.cached, result.already_cached)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Warm session parts cache\nconst result = await client.sessions.warmCache('session-uuid');\nconsole.log(result.cached, result.already_cached);\n","label":"JavaScript"}]
+func (h *SessionHandler) WarmPartsCache(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	out, err := h.svc.WarmPartsCache(c.Request.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, service.ErrPartsCacheUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, serializer.Err(http.StatusServiceUnavailable, err.Error(), nil))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
 // SessionFlush godoc
 //
 //	@Summary		Flush session
@@ -607,13 +1343,93 @@ func (h *SessionHandler) SessionFlush(c *gin.Context) {
 
 	result, err := h.coreClient.SessionFlush(c.Request.Context(), project.ID, sessionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.Err(http.StatusInternalServerError, "failed to flush session", err))
+		coreErr(c, "failed to flush session", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, serializer.Response{Data: result})
 }
 
+type SessionFlushBatchReq struct {
+	SessionIDs []string `json:"session_ids" binding:"required,min=1,max=100,dive,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// SessionFlushBatchItem is the flush outcome of one session, Error is set when Core could not be reached
+// or refused the call, Status and Errmsg are Core's answer otherwise with a non-zero Status for a failure
+type SessionFlushBatchItem struct {
+	SessionID string `json:"session_id"`
+	Status    int    `json:"status"`
+	Errmsg    string `json:"errmsg,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type SessionFlushBatchResp struct {
+	Flushed int                     `json:"flushed"`
+	Failed  int                     `json:"failed"`
+	Items   []SessionFlushBatchItem `json:"items"`
+}
+
+// SessionFlushBatch godoc
+//
+//	@Summary		Flush sessions
+//	@Description	Flush the session buffers of up to 100 sessions. Sessions are flushed in parallel and the response reports the outcome of each one, in the order of the request; a failed session does not fail the batch. Duplicate session IDs are flushed once.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	handler.SessionFlushBatchReq	true	"Session IDs"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.SessionFlushBatchResp}
+//	@Router			/session/flush_batch [post]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Flush several session buffers\nresult = client.sessions.flush_batch(session_ids=['session-uuid-1', 'session-uuid-2'])\nfor item in result.items:\n    print(item.session_id, item.status, item.error)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Flush several session buffers\nconst result = await client.sessions.flushBatch(['session-uuid-1', 'session-uuid-2']);\nfor (const item of result.items) {\n  console.log(item.session_id, item.status, item.error);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) SessionFlushBatch(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := SessionFlushBatchReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	seen := make(map[uuid.UUID]bool, len(req.SessionIDs))
+	sessionIDs := make([]uuid.UUID, 0, len(req.SessionIDs))
+	for _, raw := range req.SessionIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			sessionIDs = append(sessionIDs, id)
+		}
+	}
+
+	results := h.coreClient.SessionFlushBatch(c.Request.Context(), project.ID, sessionIDs)
+
+	resp := SessionFlushBatchResp{Items: make([]SessionFlushBatchItem, 0, len(results))}
+	for _, r := range results {
+		item := SessionFlushBatchItem{SessionID: r.SessionID.String()}
+		if r.Err != nil {
+			item.Error = r.Err.Error()
+		} else {
+			item.Status = r.Flag.Status
+			item.Errmsg = r.Flag.Errmsg
+		}
+		if r.Err == nil && r.Flag.Status == 0 {
+			resp.Flushed++
+		} else {
+			resp.Failed++
+		}
+		resp.Items = append(resp.Items, item)
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: resp})
+}
+
 // GetLearningStatus godoc
 //
 //	@Summary		Get learning status
@@ -641,21 +1457,115 @@ func (h *SessionHandler) GetLearningStatus(c *gin.Context) {
 
 	result, err := h.coreClient.GetLearningStatus(c.Request.Context(), project.ID, sessionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.Err(http.StatusInternalServerError, "failed to get learning status", err))
+		coreErr(c, "failed to get learning status", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, serializer.Response{Data: result})
 }
 
+// Fallbacks of the learning status wait settings when they are not configured
+const (
+	defaultLearningStatusMaxWait  = time.Minute
+	defaultLearningStatusWaitPoll = time.Second
+)
+
+type WaitLearningStatusReq struct {
+	Timeout string `form:"timeout,default=30s" json:"timeout" example:"30s"`
+}
+
+type WaitLearningStatusResp struct {
+	httpclient.LearningStatusResponse
+	Completed bool `json:"completed"` // whether not_space_digested_count reached zero before the timeout
+}
+
+// WaitLearningStatus godoc
+//
+//	@Summary		Wait for learning completion
+//	@Description	Long-poll the learning status of a session until every task is space digested (not_space_digested_count is 0) or the timeout elapses, returning the last status and whether learning completed. Call it after flushing a session instead of polling get_learning_status. The timeout is capped by the server, 60s by default; a timeout without completion is not an error. A session not connected to a space completes at once.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			timeout		query	string	false	"How long to wait, as a duration such as 30s or 2m (default 30s)"	example(30s)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.WaitLearningStatusResp}
+//	@Router			/session/{session_id}/learning_status/wait [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Flush the session, then wait for learning to complete\nclient.sessions.flush(session_id='session-uuid')\nresult = client.sessions.wait_learning_status(session_id='session-uuid', timeout='30s')\nprint(result.completed, result.not_space_digested_count)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Flush the session, then wait for learning to complete\nawait client.sessions.flush('session-uuid');\nconst result = await client.sessions.waitLearningStatus('session-uuid', { timeout: '30s' });\nconsole.log(result.completed, result.not_space_digested_count);\n","label":"JavaScript"}]
+func (h *SessionHandler) WaitLearningStatus(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := WaitLearningStatusReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	timeout, err := time.ParseDuration(req.Timeout)
+	if err != nil || timeout <= 0 {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", fmt.Errorf("timeout must be a positive duration such as 30s, got %q", req.Timeout)))
+		return
+	}
+
+	maxWait := defaultLearningStatusMaxWait
+	if h.config.LearningStatus.MaxWaitSec > 0 {
+		maxWait = time.Duration(h.config.LearningStatus.MaxWaitSec) * time.Second
+	}
+	poll := defaultLearningStatusWaitPoll
+	if h.config.LearningStatus.WaitPollMs > 0 {
+		poll = time.Duration(h.config.LearningStatus.WaitPollMs) * time.Millisecond
+	}
+
+	// the request context also ends the wait, when the client goes away or on an earlier deadline
+	ctx, cancel := context.WithTimeout(c.Request.Context(), min(timeout, maxWait))
+	defer cancel()
+
+	var last *httpclient.LearningStatusResponse
+	for {
+		status, err := h.coreClient.GetLearningStatus(ctx, project.ID, sessionID)
+		if err != nil && ctx.Err() == nil {
+			coreErr(c, "failed to get learning status", err)
+			return
+		}
+		if err == nil {
+			last = status
+			if status.NotSpaceDigestedCount == 0 {
+				c.JSON(http.StatusOK, serializer.Response{Data: WaitLearningStatusResp{LearningStatusResponse: *status, Completed: true}})
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if last == nil {
+				c.JSON(http.StatusGatewayTimeout, serializer.Err(http.StatusGatewayTimeout, "timed out before core answered the learning status", ctx.Err()))
+				return
+			}
+			c.JSON(http.StatusOK, serializer.Response{Data: WaitLearningStatusResp{LearningStatusResponse: *last}})
+			return
+		case <-time.After(poll):
+		}
+	}
+}
+
 type TokenCountsResp struct {
-	TotalTokens int `json:"total_tokens"`
+	TotalTokens int    `json:"total_tokens"`
+	Encoding    string `json:"encoding" example:"o200k_base"` // tiktoken encoding that produced the count
 }
 
 // GetTokenCounts godoc
 //
 //	@Summary		Get token counts for session
-//	@Description	Get total token counts for all text and tool-call parts in a session
+//	@Description	Get total token counts for all text and tool-call parts in a session. The encoding field names the tiktoken encoding used (o200k_base, as used by GPT-4o), so client-side counts can be reconciled.
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
@@ -687,9 +1597,343 @@ func (h *SessionHandler) GetTokenCounts(c *gin.Context) {
 
 	c.JSON(http.StatusOK, serializer.Response{Data: TokenCountsResp{
 		TotalTokens: totalTokens,
+		Encoding:    tokenizer.Encoding,
 	}})
 }
 
+type EstimatedCostReq struct {
+	Model string `form:"model" json:"model" binding:"required" example:"gpt-4o"`
+}
+
+type EstimatedCostResp struct {
+	Model        string  `json:"model" example:"gpt-4o"`
+	InputTokens  int     `json:"input_tokens"`  // tokens of the messages sent to the model
+	OutputTokens int     `json:"output_tokens"` // tokens of the assistant messages, generated by the model
+	InputCost    float64 `json:"input_cost"`
+	OutputCost   float64 `json:"output_cost"`
+	TotalCost    float64 `json:"total_cost"`
+	Currency     string  `json:"currency" example:"USD"`
+	Encoding     string  `json:"encoding" example:"o200k_base"` // tiktoken encoding that produced the counts
+}
+
+// GetEstimatedCost godoc
+//
+//	@Summary		Get estimated cost of session
+//	@Description	Estimate what replaying the session to a model would cost, from the token counts of its text and tool-call parts and the per-token prices of the model in the server config. Assistant messages are priced as output tokens, every other message as input tokens. Prompt caching, images and the growing context of a turn by turn replay are not accounted for, so this is an estimate. Models without a configured price are rejected with 400.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			model		query	string	true	"Model to price the session with, as named in the server pricing config"	example(gpt-4o)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.EstimatedCostResp}
+//	@Router			/session/{session_id}/estimated_cost [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Estimate the cost of replaying a session\nresult = client.sessions.get_estimated_cost(session_id='session-uuid', model='gpt-4o')\nprint(f\"Estimated cost: {result.total_cost} {result.currency}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Estimate the cost of replaying a session\nconst result = await client.sessions.getEstimatedCost('session-uuid', { model: 'gpt-4o' });\nconsole.log(`Estimated cost: ${result.total_cost} ${result.currency}`);\n","label":"JavaScript"}]
+func (h *SessionHandler) GetEstimatedCost(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := EstimatedCostReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	idx := slices.IndexFunc(h.config.Pricing.Models, func(m config.ModelPriceCfg) bool { return m.Name == req.Model })
+	if idx < 0 {
+		names := make([]string, 0, len(h.config.Pricing.Models))
+		for _, m := range h.config.Pricing.Models {
+			names = append(names, m.Name)
+		}
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", fmt.Errorf("no price configured for model %q, priced models: [%s]", req.Model, strings.Join(names, ", "))))
+		return
+	}
+	price := h.config.Pricing.Models[idx]
+
+	messages, err := h.svc.GetAllMessages(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("failed to get messages", err))
+		return
+	}
+
+	resp := EstimatedCostResp{
+		Model:    price.Name,
+		Currency: h.config.Pricing.Currency,
+		Encoding: tokenizer.Encoding,
+	}
+	for _, msg := range messages {
+		count, err := tokenizer.CountSingleMessageTokens(c.Request.Context(), msg)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, serializer.Err(http.StatusInternalServerError, "failed to count tokens", err))
+			return
+		}
+		if msg.Role == "assistant" {
+			resp.OutputTokens += count
+		} else {
+			resp.InputTokens += count
+		}
+	}
+	resp.InputCost = float64(resp.InputTokens) * price.InputPerMTok / 1e6
+	resp.OutputCost = float64(resp.OutputTokens) * price.OutputPerMTok / 1e6
+	resp.TotalCost = resp.InputCost + resp.OutputCost
+
+	c.JSON(http.StatusOK, serializer.Response{Data: resp})
+}
+
+// GetFingerprint godoc
+//
+//	@Summary		Get session fingerprint
+//	@Description	Get a hash of the content of the session's messages, computed from the SHA256 of the parts of each message in message order, so no message parts are loaded. It changes only when messages are added, removed or their parts change, message meta edits leave it unchanged. Compare it to a stored fingerprint to know whether a session must be reprocessed. The ETag of the response follows the fingerprint.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.SessionFingerprint}
+//	@Success		304	"Fingerprint unchanged since the If-None-Match ETag"
+//	@Router			/session/{session_id}/fingerprint [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Check whether a session changed since it was last processed\nresult = client.sessions.get_fingerprint(session_id='session-uuid')\nif result.fingerprint != last_fingerprint:\n    print(f\"Session changed, {result.message_count} messages\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Check whether a session changed since it was last processed\nconst result = await client.sessions.getFingerprint('session-uuid');\nif (result.fingerprint !== lastFingerprint) {\n  console.log(`Session changed, ${result.message_count} messages`);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) GetFingerprint(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	fp, err := h.svc.GetFingerprint(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+	if notModified(c, etag.Weak(fp.Fingerprint)) {
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: fp})
+}
+
+// GetReplayCheck godoc
+//
+//	@Summary		Check session replay order
+//	@Description	Check that every tool-result of the session's messages follows its tool-call, in the messages right after the message of the call and before any other message, as providers require to replay a conversation. Tool calls without results at the end of the session are reported too. Each violation has the index of the message breaking the order, from 0 in message order. Set the tool_results_follow_calls project config to reject such messages when they are sent.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ToolOrderCheck}
+//	@Router			/session/{session_id}/replay_check [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Check the session can be replayed to a provider\nresult = client.sessions.replay_check(session_id='session-uuid')\nfor v in result.violations:\n    print(f\"Message {v.index}: {v.reason}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Check the session can be replayed to a provider\nconst result = await client.sessions.replayCheck('session-uuid');\nfor (const v of result.violations) {\n  console.log(`Message ${v.index}: ${v.reason}`);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) GetReplayCheck(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	check, err := h.svc.CheckToolOrder(c.Request.Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, service.ErrPartsNotLoaded) {
+			partsNotLoaded(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: check})
+}
+
+// PendingToolCall is a tool-call part that no tool-result part answers yet
+type PendingToolCall struct {
+	MessageID uuid.UUID `json:"message_id"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Arguments any       `json:"arguments" swaggertype:"object"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PendingToolCallsResp struct {
+	Count int               `json:"count"`
+	Items []PendingToolCall `json:"items"`
+}
+
+// GetPendingToolCalls godoc
+//
+//	@Summary		Get pending tool calls of session
+//	@Description	Get the tool calls of a session that have no tool result yet, oldest first. Tool calls and results are paired by tool_call_id, tool calls without an id are ignored. Useful to detect stuck or incomplete tool loops.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.PendingToolCallsResp}
+//	@Router			/session/{session_id}/pending_tool_calls [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get tool calls awaiting results\nresult = client.sessions.get_pending_tool_calls(session_id='session-uuid')\nprint(f\"Pending tool calls: {result.count}\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get tool calls awaiting results\nconst result = await client.sessions.getPendingToolCalls('session-uuid');\nconsole.log(`Pending tool calls: ${result.count}`);\n","label":"JavaScript"}]
+func (h *SessionHandler) GetPendingToolCalls(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	messages, err := h.svc.GetAllMessages(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("failed to get messages", err))
+		return
+	}
+
+	items := pendingToolCalls(messages)
+	c.JSON(http.StatusOK, serializer.Response{Data: PendingToolCallsResp{
+		Count: len(items),
+		Items: items,
+	}})
+}
+
+// pendingToolCalls pairs the tool-call parts of messages with tool-result parts by tool_call_id
+// and returns the unmatched tool calls in message order
+func pendingToolCalls(messages []model.Message) []PendingToolCall {
+	answered := map[string]bool{}
+	for _, m := range messages {
+		for _, p := range m.Parts {
+			if p.Type != "tool-result" {
+				continue
+			}
+			if id, _ := p.Meta["tool_call_id"].(string); id != "" {
+				answered[id] = true
+			}
+		}
+	}
+
+	pending := []PendingToolCall{}
+	for _, m := range messages {
+		for _, p := range m.Parts {
+			if p.Type != "tool-call" {
+				continue
+			}
+			id, _ := p.Meta["id"].(string)
+			if id == "" || answered[id] {
+				continue
+			}
+			name, _ := p.Meta["name"].(string)
+			pending = append(pending, PendingToolCall{
+				MessageID: m.ID,
+				ID:        id,
+				Name:      name,
+				Arguments: p.Meta["arguments"],
+				CreatedAt: m.CreatedAt,
+			})
+		}
+	}
+	return pending
+}
+
+type GetActivityReq struct {
+	Bucket string `form:"bucket,default=hour" json:"bucket" binding:"omitempty,oneof=minute hour day" example:"hour" enums:"minute,hour,day"`
+	Start  string `form:"start" json:"start" format:"date-time" example:"2025-01-01T00:00:00Z"`
+	End    string `form:"end" json:"end" format:"date-time" example:"2025-01-02T00:00:00Z"`
+}
+
+// GetActivity godoc
+//
+//	@Summary		Get session activity
+//	@Description	Get the number of messages of a session per time bucket, oldest first, empty buckets included. Buckets are aligned in UTC. The range is bounded per bucket: 24 hours for minute, 31 days for hour, 366 days for day. end defaults to now and start to end minus the max range.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"								format(uuid)
+//	@Param			bucket		query	string	false	"Bucket granularity, default hour"			enums(minute,hour,day)
+//	@Param			start		query	string	false	"Range start (inclusive), RFC3339"			example(2025-01-01T00:00:00Z)
+//	@Param			end			query	string	false	"Range end (exclusive), RFC3339"			example(2025-01-02T00:00:00Z)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.GetActivityOutput}
+//	@Router			/session/{session_id}/activity [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get hourly message activity\nresult = client.sessions.get_activity(session_id='session-uuid', bucket='hour')\nfor item in result.items:\n    print(item.start, item.count)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get hourly message activity\nconst result = await client.sessions.getActivity('session-uuid', { bucket: 'hour' });\nfor (const item of result.items) {\n  console.log(item.start, item.count);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) GetActivity(c *gin.Context) {
+	req := GetActivityReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	var start, end *time.Time
+	if req.Start != "" {
+		parsed, err := time.Parse(time.RFC3339, req.Start)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid start, must be RFC3339", err))
+			return
+		}
+		start = &parsed
+	}
+	if req.End != "" {
+		parsed, err := time.Parse(time.RFC3339, req.End)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid end, must be RFC3339", err))
+			return
+		}
+		end = &parsed
+	}
+
+	out, err := h.svc.GetActivity(c.Request.Context(), service.GetActivityInput{
+		SessionID: sessionID,
+		Bucket:    req.Bucket,
+		Start:     start,
+		End:       end,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidActivityRange) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// GetUsage godoc
+//
+//	@Summary		Get project usage
+//	@Description	Get the number of messages and the total size of the assets the project stores, against its quota. A max of 0 is unlimited. Usage is cached for a short while, so it can lag behind the latest messages. Messages are rejected with 403 once a quota is reached.
+//	@Tags			usage
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.GetUsageOutput}
+//	@Router			/usage [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get project usage\nusage = client.usage.get()\nprint(f\"{usage.messages}/{usage.max_messages} messages, {usage.asset_bytes}/{usage.max_asset_bytes} asset bytes\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get project usage\nconst usage = await client.usage.get();\nconsole.log(`${usage.messages}/${usage.max_messages} messages, ${usage.asset_bytes}/${usage.max_asset_bytes} asset bytes`);\n","label":"JavaScript"}]
+func (h *SessionHandler) GetUsage(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	out, err := h.svc.GetUsage(c.Request.Context(), project.ID, project.Quota())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
+// GetPartsCacheStats returns the message parts cache counters of this instance.
+// It is an internal endpoint for sizing the parts cache TTL and is not part of the public API docs.
+func (h *SessionHandler) GetPartsCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, serializer.Response{Data: h.svc.GetPartsCacheStats()})
+}
+
 // GetSessionObservingStatus godoc
 //
 //	@Summary		Get message observing status for a session
@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -10,7 +13,9 @@ import (
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/serializer"
 	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/etag"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type SpaceHandler struct {
@@ -69,7 +74,7 @@ func (h *SpaceHandler) GetSpaces(c *gin.Context) {
 		TimeDesc:  req.TimeDesc,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		listErr(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -79,7 +84,7 @@ func (h *SpaceHandler) GetSpaces(c *gin.Context) {
 // CreateSpace godoc
 //
 //	@Summary		Create space
-//	@Description	Create a new space under a project
+//	@Description	Create a new space under a project. Returns 409 when the project already has the configured maximum number of spaces.
 //	@Tags			space
 //	@Accept			json
 //	@Produce		json
@@ -106,6 +111,10 @@ func (h *SpaceHandler) CreateSpace(c *gin.Context) {
 		Configs:   datatypes.JSONMap(req.Configs),
 	}
 	if err := h.svc.Create(c.Request.Context(), &space); err != nil {
+		if errors.Is(err, service.ErrSpaceLimitReached) {
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, err.Error(), nil))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
@@ -178,7 +187,7 @@ func (h *SpaceHandler) UpdateConfigs(c *gin.Context) {
 	if err := h.svc.UpdateByID(c.Request.Context(), &model.Space{
 		ID:      spaceID,
 		Configs: datatypes.JSONMap(req.Configs),
-	}); err != nil {
+	}, "configs"); err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
@@ -193,9 +202,11 @@ func (h *SpaceHandler) UpdateConfigs(c *gin.Context) {
 //	@Tags			space
 //	@Accept			json
 //	@Produce		json
-//	@Param			space_id	path	string	true	"Space ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			space_id		path	string	true	"Space ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			If-None-Match	header	string	false	"ETag of a previous response, 304 is returned if the space is unchanged"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=model.Space}
+//	@Success		304	"Space is unchanged since the given ETag"
 //	@Router			/space/{space_id}/configs [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get space configs\nspace = client.spaces.get_configs(space_id='space-uuid')\nprint(space.configs)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get space configs\nconst space = await client.spaces.getConfigs('space-uuid');\nconsole.log(space.configs);\n","label":"JavaScript"}]
 func (h *SpaceHandler) GetConfigs(c *gin.Context) {
@@ -210,6 +221,10 @@ func (h *SpaceHandler) GetConfigs(c *gin.Context) {
 		return
 	}
 
+	if notModified(c, etag.Weak(space.ID.String(), space.UpdatedAt.UTC().Format(time.RFC3339Nano))) {
+		return
+	}
+
 	c.JSON(http.StatusOK, serializer.Response{Data: space})
 }
 
@@ -219,6 +234,14 @@ type GetExperienceSearchReq struct {
 	Mode              string   `form:"mode,default=fast" json:"mode" binding:"omitempty,oneof=fast agentic"`
 	SemanticThreshold *float64 `form:"semantic_threshold" json:"semantic_threshold" binding:"omitempty,min=0,max=2"`
 	MaxIterations     int      `form:"max_iterations,default=16" json:"max_iterations" binding:"omitempty,min=1,max=100"`
+	// IncludeCoreResponse adds Core's raw response to the result, only allowed when core.debugResponses is enabled
+	IncludeCoreResponse bool `form:"include_core_response" json:"include_core_response"`
+}
+
+type GetExperienceSearchResp struct {
+	httpclient.SpaceSearchResult
+	MaxIterations int             `json:"max_iterations"` // effective max_iterations, after the project cap
+	CoreResponse  json.RawMessage `json:"core_response,omitempty" swaggertype:"object"`
 }
 
 // GetExperienceSearch godoc
@@ -233,9 +256,10 @@ type GetExperienceSearchReq struct {
 //	@Param			limit				query	int		false	"Maximum number of results to return (1-50, default 10)"
 //	@Param			mode				query	string	false	"Search mode: fast or agentic (default fast)"
 //	@Param			semantic_threshold	query	float64	false	"Cosine distance threshold (0=identical, 2=opposite)"
-//	@Param			max_iterations		query	int		false	"Maximum number of iterations for agentic search (1-100, default 16)"
+//	@Param			max_iterations		query	int		false	"Maximum number of iterations for agentic search (1-100, default 16), lowered to the project max_search_iterations config if set"
+//	@Param			include_core_response	query	bool	false	"Include the raw Core response for debugging, requires core.debugResponses to be enabled on the server"
 //	@Security		BearerAuth
-//	@Success		200	{object}	serializer.Response{data=httpclient.SpaceSearchResult}
+//	@Success		200	{object}	serializer.Response{data=handler.GetExperienceSearchResp}
 //	@Router			/space/{space_id}/experience_search [get]
 //	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Experience search\nresult = client.spaces.experience_search(\n    space_id='space-uuid',\n    query='How to implement authentication?',\n    limit=10,\n    mode='agentic',\n    max_iterations=20\n)\nfor block in result.cited_blocks:\n    print(f\"{block.title} (distance: {block.distance})\")\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Experience search\nconst result = await client.spaces.experienceSearch('space-uuid', {\n  query: 'How to implement authentication?',\n  limit: 10,\n  mode: 'agentic',\n  maxIterations: 20\n});\nfor (const block of result.cited_blocks) {\n  console.log(`${block.title} (distance: ${block.distance})`);\n}\n","label":"JavaScript"}]
 func (h *SpaceHandler) GetExperienceSearch(c *gin.Context) {
@@ -254,12 +278,19 @@ func (h *SpaceHandler) GetExperienceSearch(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
 		return
 	}
+	if req.IncludeCoreResponse && !h.coreClient.DebugResponses {
+		c.JSON(http.StatusForbidden, serializer.Err(http.StatusForbidden, "include_core_response requires core debug responses to be enabled", nil))
+		return
+	}
 
 	project, ok := c.MustGet("project").(*model.Project)
 	if !ok {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
 		return
 	}
+	if maxIterations := project.MaxSearchIterations(); maxIterations > 0 {
+		req.MaxIterations = min(req.MaxIterations, maxIterations)
+	}
 
 	// Call core service
 	result, err := h.coreClient.ExperienceSearch(c.Request.Context(), project.ID, spaceID, httpclient.ExperienceSearchRequest{
@@ -270,11 +301,113 @@ func (h *SpaceHandler) GetExperienceSearch(c *gin.Context) {
 		MaxIterations:     req.MaxIterations,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.Err(http.StatusInternalServerError, "Failed to call core service", err))
+		coreErr(c, "failed to call core service", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, serializer.Response{Data: result})
+	resp := GetExperienceSearchResp{SpaceSearchResult: *result, MaxIterations: req.MaxIterations}
+	if req.IncludeCoreResponse {
+		resp.CoreResponse = result.Raw
+	}
+	c.JSON(http.StatusOK, serializer.Response{Data: resp})
+}
+
+// SpaceSessionLearningStatus is the learning status of one session of a space
+type SpaceSessionLearningStatus struct {
+	SessionID uuid.UUID `json:"session_id"`
+	httpclient.LearningStatusResponse
+}
+
+type GetSpaceLearningStatusReq struct {
+	Limit  int    `form:"limit,default=50" json:"limit" binding:"required,min=1,max=200" example:"50"`
+	Cursor string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+}
+
+type SpaceLearningStatusResp struct {
+	SpaceDigestedCount    int                          `json:"space_digested_count"`
+	NotSpaceDigestedCount int                          `json:"not_space_digested_count"`
+	Sessions              []SpaceSessionLearningStatus `json:"sessions"`
+	Skipped               []uuid.UUID                  `json:"skipped"` // sessions Core no longer knows, e.g. deleted while listing
+	NextCursor            string                       `json:"next_cursor,omitempty"`
+	HasMore               bool                         `json:"has_more"`
+}
+
+// GetLearningStatus godoc
+//
+//	@Summary		Get learning status of space
+//	@Description	Get the learning status of the sessions connected to a space, a page of sessions at a time: the counts of space digested and not space digested tasks summed over the sessions of the page, and the counts of each session, oldest session first. Sessions Core answers with a 4xx for, such as sessions deleted meanwhile, are listed in skipped instead. Follow next_cursor while has_more is true to get the other sessions. A space without sessions returns zero counts, an unknown space or a space of another project returns 404.
+//	@Tags			space
+//	@Accept			json
+//	@Produce		json
+//	@Param			space_id	path	string	true	"Space ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			limit		query	integer	false	"Limit of sessions to return, default 50. Max 200."
+//	@Param			cursor		query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.SpaceLearningStatusResp}
+//	@Router			/space/{space_id}/learning_status [get]
+//	@x-code-samples	[{"lang":"python","source":"from acontext import AcontextClient\n\nclient = AcontextClient(api_key='sk_project_token')\n\n# Get the learning status of a space\nresult = client.spaces.get_learning_status(space_id='space-uuid')\nprint(f\"Space digested: {result.space_digested_count}, Not digested: {result.not_space_digested_count}\")\nfor session in result.sessions:\n    print(session.session_id, session.space_digested_count, session.not_space_digested_count)\n","label":"Python"},{"lang":"javascript","source":"import { AcontextClient } from '@acontext/acontext';\n\nconst client = new AcontextClient({ apiKey: 'sk_project_token' });\n\n// Get the learning status of a space\nconst result = await client.spaces.getLearningStatus('space-uuid');\nconsole.log(`Space digested: ${result.space_digested_count}, Not digested: ${result.not_space_digested_count}`);\nfor (const session of result.sessions) {\n  console.log(session.session_id, session.space_digested_count, session.not_space_digested_count);\n}\n","label":"JavaScript"}]
+func (h *SpaceHandler) GetLearningStatus(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	spaceID, err := uuid.Parse(c.Param("space_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := GetSpaceLearningStatusReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	space, err := h.svc.GetByID(c.Request.Context(), &model.Space{ID: spaceID})
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+	if err != nil || space.ProjectID != project.ID {
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, "space not found", nil))
+		return
+	}
+
+	page, err := h.svc.ListSessionIDs(c.Request.Context(), service.ListSessionIDsInput{
+		ProjectID: project.ID,
+		SpaceID:   spaceID,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+	})
+	if err != nil {
+		listErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := SpaceLearningStatusResp{
+		Sessions:   make([]SpaceSessionLearningStatus, 0, len(page.Items)),
+		Skipped:    []uuid.UUID{},
+		NextCursor: page.NextCursor,
+		HasMore:    page.HasMore,
+	}
+	for _, r := range h.coreClient.GetLearningStatusBatch(c.Request.Context(), project.ID, page.Items) {
+		if r.Err != nil {
+			var ce *httpclient.CoreError
+			if errors.As(r.Err, &ce) && ce.StatusCode >= http.StatusBadRequest && ce.StatusCode < http.StatusInternalServerError {
+				resp.Skipped = append(resp.Skipped, r.SessionID)
+				continue
+			}
+			coreErr(c, fmt.Sprintf("failed to get learning status of session %s", r.SessionID), r.Err)
+			return
+		}
+		resp.SpaceDigestedCount += r.Status.SpaceDigestedCount
+		resp.NotSpaceDigestedCount += r.Status.NotSpaceDigestedCount
+		resp.Sessions = append(resp.Sessions, SpaceSessionLearningStatus{SessionID: r.SessionID, LearningStatusResponse: *r.Status})
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: resp})
 }
 
 type ListExperienceConfirmationsReq struct {
@@ -324,7 +457,7 @@ func (h *SpaceHandler) ListExperienceConfirmations(c *gin.Context) {
 		return
 	}
 	if space.ProjectID != project.ID {
-		c.JSON(http.StatusForbidden, serializer.ParamErr("", errors.New("space does not belong to project")))
+		c.JSON(http.StatusForbidden, serializer.Err(http.StatusForbidden, "space does not belong to project", nil))
 		return
 	}
 
@@ -335,7 +468,7 @@ func (h *SpaceHandler) ListExperienceConfirmations(c *gin.Context) {
 		TimeDesc: req.TimeDesc,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		listErr(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -392,7 +525,7 @@ func (h *SpaceHandler) ConfirmExperience(c *gin.Context) {
 		return
 	}
 	if space.ProjectID != project.ID {
-		c.JSON(http.StatusForbidden, serializer.ParamErr("", errors.New("space does not belong to project")))
+		c.JSON(http.StatusForbidden, serializer.Err(http.StatusForbidden, "space does not belong to project", nil))
 		return
 	}
 
@@ -4,21 +4,29 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/infra/httpclient"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/serializer"
 	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // MockSpaceService is a mock implementation of SpaceService
@@ -36,8 +44,8 @@ func (m *MockSpaceService) Delete(ctx context.Context, projectID uuid.UUID, spac
 	return args.Error(0)
 }
 
-func (m *MockSpaceService) UpdateByID(ctx context.Context, s *model.Space) error {
-	args := m.Called(ctx, s)
+func (m *MockSpaceService) UpdateByID(ctx context.Context, s *model.Space, columns ...string) error {
+	args := m.Called(ctx, s, columns)
 	return args.Error(0)
 }
 
@@ -73,6 +81,14 @@ func (m *MockSpaceService) ConfirmExperience(ctx context.Context, spaceID uuid.U
 	return args.Get(0).(*model.ExperienceConfirmation), args.Error(1)
 }
 
+func (m *MockSpaceService) ListSessionIDs(ctx context.Context, in service.ListSessionIDsInput) (*service.ListSessionIDsOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ListSessionIDsOutput), args.Error(1)
+}
+
 func setupSpaceRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	return gin.New()
@@ -209,6 +225,17 @@ func TestSpaceHandler_CreateSpace(t *testing.T) {
 			expectedStatus: http.StatusInternalServerError,
 			expectedError:  true,
 		},
+		{
+			name: "space limit reached",
+			requestBody: CreateSpaceReq{
+				Configs: map[string]interface{}{},
+			},
+			setup: func(svc *MockSpaceService) {
+				svc.On("Create", mock.Anything, mock.Anything).Return(fmt.Errorf("%w (10)", service.ErrSpaceLimitReached))
+			},
+			expectedStatus: http.StatusConflict,
+			expectedError:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -318,7 +345,7 @@ func TestSpaceHandler_UpdateConfigs(t *testing.T) {
 			setup: func(svc *MockSpaceService) {
 				svc.On("UpdateByID", mock.Anything, mock.MatchedBy(func(s *model.Space) bool {
 					return s.ID == spaceID
-				})).Return(nil)
+				}), []string{"configs"}).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
@@ -334,7 +361,7 @@ func TestSpaceHandler_UpdateConfigs(t *testing.T) {
 			spaceIDParam: spaceID.String(),
 			requestBody:  UpdateSpaceConfigsReq{Configs: map[string]interface{}{}},
 			setup: func(svc *MockSpaceService) {
-				svc.On("UpdateByID", mock.Anything, mock.Anything).Return(errors.New("update failed"))
+				svc.On("UpdateByID", mock.Anything, mock.Anything, []string{"configs"}).Return(errors.New("update failed"))
 			},
 			expectedStatus: http.StatusInternalServerError,
 		},
@@ -421,6 +448,45 @@ func TestSpaceHandler_GetConfigs(t *testing.T) {
 	}
 }
 
+func TestSpaceHandler_GetConfigs_ETag(t *testing.T) {
+	spaceID := uuid.New()
+	updatedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mockService := &MockSpaceService{}
+	mockService.On("GetByID", mock.Anything, mock.Anything).Return(&model.Space{ID: spaceID, UpdatedAt: updatedAt}, nil).Once()
+	mockService.On("GetByID", mock.Anything, mock.Anything).Return(&model.Space{ID: spaceID, UpdatedAt: updatedAt}, nil).Once()
+	mockService.On("GetByID", mock.Anything, mock.Anything).Return(&model.Space{ID: spaceID, UpdatedAt: updatedAt.Add(time.Second)}, nil).Once()
+
+	handler := NewSpaceHandler(mockService, getMockCoreClient())
+	router := setupSpaceRouter()
+	router.GET("/space/:space_id/configs", handler.GetConfigs)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/space/"+spaceID.String()+"/configs", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("")
+	assert.Equal(t, http.StatusOK, first.Code)
+	tag := first.Header().Get("ETag")
+	require.NotEmpty(t, tag)
+
+	unchanged := get(tag)
+	assert.Equal(t, http.StatusNotModified, unchanged.Code)
+	assert.Empty(t, unchanged.Body.String())
+
+	updated := get(tag)
+	assert.Equal(t, http.StatusOK, updated.Code)
+	assert.NotEqual(t, tag, updated.Header().Get("ETag"))
+
+	mockService.AssertExpectations(t)
+}
+
 func TestSpaceHandler_GetExperienceSearch(t *testing.T) {
 	spaceID := uuid.New()
 
@@ -476,6 +542,432 @@ func TestSpaceHandler_GetExperienceSearch(t *testing.T) {
 	}
 }
 
+func TestSpaceHandler_GetExperienceSearch_CoreError(t *testing.T) {
+	tests := []struct {
+		name            string
+		coreStatus      int
+		coreContentType string
+		coreBody        string
+		expectedStatus  int
+		expectedMsg     string
+	}{
+		{
+			name:           "core 404 is passed through",
+			coreStatus:     http.StatusNotFound,
+			coreBody:       `{"detail":"space not found"}`,
+			expectedStatus: http.StatusNotFound,
+			expectedMsg:    "failed to call core service: space not found",
+		},
+		{
+			name:           "core 400 is passed through",
+			coreStatus:     http.StatusBadRequest,
+			coreBody:       `{"detail":"Invalid search mode: foo"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedMsg:    "failed to call core service: Invalid search mode: foo",
+		},
+		{
+			name:           "core 503 is a 500",
+			coreStatus:     http.StatusServiceUnavailable,
+			coreBody:       "upstream unavailable",
+			expectedStatus: http.StatusInternalServerError,
+			expectedMsg:    "failed to call core service: upstream unavailable",
+		},
+		{
+			name:            "gateway html error page is summarized",
+			coreStatus:      http.StatusBadGateway,
+			coreContentType: "text/html",
+			coreBody:        "<html><body><h1>502 Bad Gateway</h1></body></html>",
+			expectedStatus:  http.StatusInternalServerError,
+			expectedMsg:     "failed to call core service: unexpected response from core service (status 502)",
+		},
+		{
+			name:            "non-json 200 is not an unmarshal error",
+			coreStatus:      http.StatusOK,
+			coreContentType: "text/html; charset=utf-8",
+			coreBody:        "<html><body>Login required</body></html>",
+			expectedStatus:  http.StatusInternalServerError,
+			expectedMsg:     "failed to call core service: unexpected response from core service (status 200)",
+		},
+		{
+			name:            "malformed json 200",
+			coreStatus:      http.StatusOK,
+			coreContentType: "application/json",
+			coreBody:        `{"cited_blocks": [`,
+			expectedStatus:  http.StatusInternalServerError,
+			expectedMsg:     "failed to call core service: unexpected response from core service (status 200)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.coreContentType != "" {
+					w.Header().Set("Content-Type", tt.coreContentType)
+				}
+				w.WriteHeader(tt.coreStatus)
+				_, _ = w.Write([]byte(tt.coreBody))
+			}))
+			defer core.Close()
+
+			coreClient := &httpclient.CoreClient{
+				BaseURL:    core.URL,
+				HTTPClient: core.Client(),
+				Logger:     zap.NewNop(),
+				Propagator: otel.GetTextMapPropagator(),
+			}
+			handler := NewSpaceHandler(&MockSpaceService{}, coreClient)
+			router := setupSpaceRouter()
+			router.Use(func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: uuid.New()})
+				c.Next()
+			})
+			router.GET("/space/:space_id/experience_search", handler.GetExperienceSearch)
+
+			req := httptest.NewRequest("GET", "/space/"+uuid.New().String()+"/experience_search?query=test", nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			var resp struct {
+				Code int    `json:"code"`
+				Msg  string `json:"msg"`
+			}
+			assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+			assert.Equal(t, tt.expectedMsg, resp.Msg)
+		})
+	}
+}
+
+func TestSpaceHandler_GetLearningStatus(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	first, deleted, last := uuid.New(), uuid.New(), uuid.New()
+	space := &model.Space{ID: spaceID, ProjectID: projectID}
+	firstPage := service.ListSessionIDsInput{ProjectID: projectID, SpaceID: spaceID, Limit: 50}
+
+	tests := []struct {
+		name           string
+		query          string
+		setup          func(*MockSpaceService)
+		lastStatus     int
+		expectedStatus int
+		check          func(t *testing.T, resp SpaceLearningStatusResp)
+	}{
+		{
+			name: "totals and per-session counts, skipping sessions core doesn't know",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, &model.Space{ID: spaceID}).Return(space, nil)
+				svc.On("ListSessionIDs", mock.Anything, firstPage).Return(&service.ListSessionIDsOutput{Items: []uuid.UUID{first, deleted, last}}, nil)
+			},
+			lastStatus:     http.StatusOK,
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, resp SpaceLearningStatusResp) {
+				assert.Equal(t, 5, resp.SpaceDigestedCount)
+				assert.Equal(t, 1, resp.NotSpaceDigestedCount)
+				require.Len(t, resp.Sessions, 2)
+				assert.Equal(t, first, resp.Sessions[0].SessionID)
+				assert.Equal(t, 2, resp.Sessions[0].SpaceDigestedCount)
+				assert.Equal(t, 1, resp.Sessions[0].NotSpaceDigestedCount)
+				assert.Equal(t, last, resp.Sessions[1].SessionID)
+				assert.Equal(t, 3, resp.Sessions[1].SpaceDigestedCount)
+				assert.Equal(t, []uuid.UUID{deleted}, resp.Skipped)
+				assert.False(t, resp.HasMore)
+			},
+		},
+		{
+			name:  "page of sessions",
+			query: "?limit=1&cursor=abc",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, &model.Space{ID: spaceID}).Return(space, nil)
+				svc.On("ListSessionIDs", mock.Anything, service.ListSessionIDsInput{ProjectID: projectID, SpaceID: spaceID, Limit: 1, Cursor: "abc"}).
+					Return(&service.ListSessionIDsOutput{Items: []uuid.UUID{first}, NextCursor: "next", HasMore: true}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, resp SpaceLearningStatusResp) {
+				assert.Equal(t, 2, resp.SpaceDigestedCount)
+				require.Len(t, resp.Sessions, 1)
+				assert.True(t, resp.HasMore)
+				assert.Equal(t, "next", resp.NextCursor)
+			},
+		},
+		{
+			name:           "limit over max",
+			query:          "?limit=201",
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "space without sessions",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, &model.Space{ID: spaceID}).Return(space, nil)
+				svc.On("ListSessionIDs", mock.Anything, firstPage).Return(&service.ListSessionIDsOutput{Items: []uuid.UUID{}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, resp SpaceLearningStatusResp) {
+				assert.Zero(t, resp.SpaceDigestedCount)
+				assert.Empty(t, resp.Sessions)
+				assert.Empty(t, resp.Skipped)
+			},
+		},
+		{
+			name: "unknown space",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, &model.Space{ID: spaceID}).Return(nil, gorm.ErrRecordNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "space of another project",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, &model.Space{ID: spaceID}).Return(&model.Space{ID: spaceID, ProjectID: uuid.New()}, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "core unavailable",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, &model.Space{ID: spaceID}).Return(space, nil)
+				svc.On("ListSessionIDs", mock.Anything, firstPage).Return(&service.ListSessionIDsOutput{Items: []uuid.UUID{first, last}}, nil)
+			},
+			lastStatus:     http.StatusServiceUnavailable,
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "service error",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, &model.Space{ID: spaceID}).Return(space, nil)
+				svc.On("ListSessionIDs", mock.Anything, firstPage).Return(nil, errors.New("database error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				prefix := "/api/v1/project/" + projectID.String() + "/session/"
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case prefix + first.String() + "/get_learning_status":
+					_, _ = w.Write([]byte(`{"space_digested_count": 2, "not_space_digested_count": 1}`))
+				case prefix + last.String() + "/get_learning_status":
+					w.WriteHeader(tt.lastStatus)
+					_, _ = w.Write([]byte(`{"space_digested_count": 3, "not_space_digested_count": 0}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"detail":"session not found"}`))
+				}
+			}))
+			defer core.Close()
+
+			mockService := &MockSpaceService{}
+			tt.setup(mockService)
+
+			coreClient := &httpclient.CoreClient{
+				BaseURL:          core.URL,
+				HTTPClient:       core.Client(),
+				Logger:           zap.NewNop(),
+				Propagator:       otel.GetTextMapPropagator(),
+				BatchConcurrency: 2,
+			}
+			handler := NewSpaceHandler(mockService, coreClient)
+			router := setupSpaceRouter()
+			router.Use(func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				c.Next()
+			})
+			router.GET("/space/:space_id/learning_status", handler.GetLearningStatus)
+
+			req := httptest.NewRequest("GET", "/space/"+spaceID.String()+"/learning_status"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.check != nil {
+				var body struct {
+					Data SpaceLearningStatusResp `json:"data"`
+				}
+				require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &body))
+				tt.check(t, body.Data)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSpaceHandler_GetExperienceSearch_ProjectMaxIterations(t *testing.T) {
+	tests := []struct {
+		name           string
+		configs        map[string]any
+		query          string
+		wantIterations string
+	}{
+		{name: "no project cap", query: "&max_iterations=50", wantIterations: "50"},
+		{name: "request below cap", configs: map[string]any{"max_search_iterations": float64(20)}, query: "&max_iterations=10", wantIterations: "10"},
+		{name: "request above cap", configs: map[string]any{"max_search_iterations": float64(20)}, query: "&max_iterations=50", wantIterations: "20"},
+		{name: "default above cap", configs: map[string]any{"max_search_iterations": float64(8)}, wantIterations: "8"},
+		{name: "invalid cap is ignored", configs: map[string]any{"max_search_iterations": "5"}, wantIterations: "16"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotIterations string
+			core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotIterations = r.URL.Query().Get("max_iterations")
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"cited_blocks": []}`))
+			}))
+			defer core.Close()
+
+			coreClient := &httpclient.CoreClient{
+				BaseURL:    core.URL,
+				HTTPClient: core.Client(),
+				Logger:     zap.NewNop(),
+				Propagator: otel.GetTextMapPropagator(),
+			}
+			handler := NewSpaceHandler(&MockSpaceService{}, coreClient)
+			router := setupSpaceRouter()
+			router.Use(func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: uuid.New(), Configs: tt.configs})
+				c.Next()
+			})
+			router.GET("/space/:space_id/experience_search", handler.GetExperienceSearch)
+
+			req := httptest.NewRequest("GET", "/space/"+uuid.New().String()+"/experience_search?query=test"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantIterations, gotIterations)
+			var resp struct {
+				Data GetExperienceSearchResp `json:"data"`
+			}
+			assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantIterations, strconv.Itoa(resp.Data.MaxIterations))
+		})
+	}
+}
+
+func TestSpaceHandler_GetExperienceSearch_IncludeCoreResponse(t *testing.T) {
+	const coreBody = `{"cited_blocks": [], "debug": {"rounds": 2}}`
+
+	tests := []struct {
+		name           string
+		debugResponses bool
+		query          string
+		expectedStatus int
+		wantRaw        bool
+	}{
+		{name: "not requested", debugResponses: true, expectedStatus: http.StatusOK},
+		{name: "requested and enabled", debugResponses: true, query: "&include_core_response=true", expectedStatus: http.StatusOK, wantRaw: true},
+		{name: "requested but disabled", query: "&include_core_response=true", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(coreBody))
+			}))
+			defer core.Close()
+
+			coreClient := &httpclient.CoreClient{
+				BaseURL:        core.URL,
+				HTTPClient:     core.Client(),
+				Logger:         zap.NewNop(),
+				Propagator:     otel.GetTextMapPropagator(),
+				DebugResponses: tt.debugResponses,
+			}
+			handler := NewSpaceHandler(&MockSpaceService{}, coreClient)
+			router := setupSpaceRouter()
+			router.Use(func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: uuid.New()})
+				c.Next()
+			})
+			router.GET("/space/:space_id/experience_search", handler.GetExperienceSearch)
+
+			req := httptest.NewRequest("GET", "/space/"+uuid.New().String()+"/experience_search?query=test"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Data map[string]any `json:"data"`
+			}
+			assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Contains(t, resp.Data, "cited_blocks")
+			if tt.wantRaw {
+				assert.Equal(t, map[string]any{"cited_blocks": []any{}, "debug": map[string]any{"rounds": float64(2)}}, resp.Data["core_response"])
+			} else {
+				assert.NotContains(t, resp.Data, "core_response")
+			}
+		})
+	}
+}
+
+func TestSpaceHandler_InvalidCursor(t *testing.T) {
+	projectID := uuid.New()
+	spaceID := uuid.New()
+	cursorErr := fmt.Errorf("%w: bad cursor", paging.ErrInvalidCursor)
+
+	tests := []struct {
+		name  string
+		path  string
+		setup func(*MockSpaceService)
+	}{
+		{
+			name: "GetSpaces",
+			path: "/space?cursor=Zm9v",
+			setup: func(svc *MockSpaceService) {
+				svc.On("List", mock.Anything, mock.Anything).Return(nil, cursorErr)
+			},
+		},
+		{
+			name: "ListExperienceConfirmations",
+			path: "/space/" + spaceID.String() + "/experience_confirmations?cursor=Zm9v",
+			setup: func(svc *MockSpaceService) {
+				svc.On("GetByID", mock.Anything, mock.Anything).Return(&model.Space{ID: spaceID, ProjectID: projectID}, nil)
+				svc.On("ListExperienceConfirmations", mock.Anything, mock.Anything).Return(nil, cursorErr)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSpaceService{}
+			tt.setup(mockService)
+
+			handler := NewSpaceHandler(mockService, getMockCoreClient())
+			router := setupSpaceRouter()
+			router.Use(func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				c.Next()
+			})
+			router.GET("/space", handler.GetSpaces)
+			router.GET("/space/:space_id/experience_confirmations", handler.ListExperienceConfirmations)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var resp serializer.Response
+			require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "invalid cursor", resp.Msg)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
 func TestSpaceHandler_ListExperienceConfirmations(t *testing.T) {
 	projectID := uuid.New()
 	spaceID := uuid.New()
@@ -58,7 +58,7 @@ func (h *TaskHandler) GetTasks(c *gin.Context) {
 		TimeDesc:  req.TimeDesc,
 	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
+		listErr(c, http.StatusBadRequest, err)
 		return
 	}
 
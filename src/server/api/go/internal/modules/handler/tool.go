@@ -67,7 +67,7 @@ func (h *ToolHandler) RenameToolName(c *gin.Context) {
 	// Call Core service to rename tools
 	result, err := h.coreClient.ToolRename(c.Request.Context(), project.ID, renameItems)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.Err(http.StatusInternalServerError, "failed to rename tools", err))
+		coreErr(c, "failed to rename tools", err)
 		return
 	}
 
@@ -96,7 +96,7 @@ func (h *ToolHandler) GetToolName(c *gin.Context) {
 	// Call Core service to get tool names
 	result, err := h.coreClient.GetToolNames(c.Request.Context(), project.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.Err(http.StatusInternalServerError, "failed to get tool names", err))
+		coreErr(c, "failed to get tool names", err)
 		return
 	}
 
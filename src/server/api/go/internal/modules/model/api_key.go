@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey is an additional bearer token of a project, limited to a scope.
+// The token itself is never stored, only its HMAC for lookup and its argon2id hash for verification.
+type APIKey struct {
+	ID               uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID        uuid.UUID `gorm:"type:uuid;not null;index" json:"project_id"`
+	Name             string    `gorm:"type:text;not null;default:''" json:"name"`
+	Scope            string    `gorm:"type:text;not null" json:"scope"`
+	SecretKeyHMAC    string    `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	SecretKeyHashPHC string    `gorm:"type:varchar(255);not null" json:"-"`
+
+	CreatedAt  time.Time  `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	ExpiresAt  *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"` // recorded asynchronously, can lag behind by APIKey.LastUsedFlushSec
+	RevokedAt  *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+
+	// APIKey <-> Project
+	Project *Project `gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (APIKey) TableName() string { return "api_keys" }
+
+// Expired reports whether the key has expired at now
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// Scopes of API keys, each allowing what the previous ones allow. The project token has the admin scope.
+const (
+	ScopeRead  = "read"  // read-only requests
+	ScopeWrite = "write" // any request but managing API keys
+	ScopeAdmin = "admin" // any request
+)
+
+var scopeRanks = map[string]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+
+// ValidScope reports whether scope is one of read, write and admin
+func ValidScope(scope string) bool {
+	_, ok := scopeRanks[scope]
+	return ok
+}
+
+// ScopeAllows reports whether a token with the granted scope may make a request requiring the required scope
+func ScopeAllows(granted, required string) bool {
+	g, ok := scopeRanks[granted]
+	return ok && g >= scopeRanks[required]
+}
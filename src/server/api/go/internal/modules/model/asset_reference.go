@@ -12,6 +12,21 @@ import (
 // PostgreSQL's row-level locking and transaction isolation to prevent race conditions even
 // under high concurrency, eliminating the need for application-level synchronization or Redis.
 
+// AssetRefChange is the change of the reference count of an asset
+type AssetRefChange struct {
+	SHA256        string `json:"sha256"`
+	S3Key         string `json:"s3_key"`
+	DecrementedBy int    `json:"decremented_by"`
+	RefCount      int    `json:"ref_count"` // references left, 0 once the asset is deleted
+}
+
+// AssetRefDelta lists the assets a delete decremented that are still referenced, and those it freed
+// and deleted from S3 as their last reference went away
+type AssetRefDelta struct {
+	Decremented []AssetRefChange `json:"decremented"`
+	Deleted     []AssetRefChange `json:"deleted"`
+}
+
 // AssetReference tracks references to assets stored in S3
 // This allows for reference counting and safe deletion of assets
 type AssetReference struct {
@@ -43,12 +58,21 @@ type AssetReference struct {
 	// Optional: Last referenced timestamp to help with garbage collection
 	LastReferencedAt time.Time `gorm:"type:timestamp;index" json:"last_referenced_at"`
 
+	// Malware scan result, empty when the asset was never submitted to a scanner
+	ScanStatus string `gorm:"type:text;not null;default:''" json:"scan_status,omitempty"`
+
 	// AssetReference <-> Project
 	Project *Project `gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
 }
 
 func (AssetReference) TableName() string { return "asset_references" }
 
+const (
+	ScanStatusPending  = "pending"
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+)
+
 type Asset struct {
 	Bucket string `json:"bucket"`
 	S3Key  string `json:"s3_key"`
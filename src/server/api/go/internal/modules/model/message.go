@@ -15,11 +15,12 @@ const (
 	FormatOpenAI    MessageFormat = "openai"
 	FormatAnthropic MessageFormat = "anthropic"
 	FormatGemini    MessageFormat = "gemini"
+	FormatLangChain MessageFormat = "langchain"
 )
 
 type Message struct {
 	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	SessionID uuid.UUID  `gorm:"type:uuid;not null;index;index:idx_session_created,priority:1" json:"session_id"`
+	SessionID uuid.UUID  `gorm:"type:uuid;not null;index;index:idx_session_created,priority:1;index:idx_session_client_seq,priority:1" json:"session_id"`
 	ParentID  *uuid.UUID `gorm:"type:uuid;index" json:"parent_id"`
 	Parent    *Message   `gorm:"foreignKey:ParentID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
 	Children  []Message  `gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
@@ -31,11 +32,26 @@ type Message struct {
 	PartsAssetMeta datatypes.JSONType[Asset] `gorm:"type:jsonb;not null" swaggertype:"-" json:"-"`
 	Parts          []Part                    `gorm:"-" swaggertype:"array,object" json:"parts"`
 
+	// PartTypeCounts summarizes the parts by type (e.g. {"text": 1, "image": 2}), computed at insert time
+	PartTypeCounts datatypes.JSONType[map[string]int] `gorm:"type:jsonb;not null;default:'{}'" swaggertype:"object" json:"part_type_counts"`
+
+	// ClientSeq is an optional ordering key given by the client, e.g. for imported conversations. Messages of a
+	// session are ordered by it, messages without it after the others, then by CreatedAt.
+	ClientSeq *int64 `gorm:"index:idx_session_client_seq,priority:2" json:"client_seq"`
+
+	// SearchText is the text of the text and tool-result parts, computed at insert time and matched by
+	// message search. It is NULL for messages stored before it existed until they are backfilled.
+	SearchText *string `gorm:"type:text" json:"-"`
+
+	// IsLatest flags the head of the conversation, the last message of the session in message order,
+	// when listing messages. It is not stored.
+	IsLatest bool `gorm:"-" json:"is_latest,omitempty"`
+
 	TaskID *uuid.UUID `gorm:"type:uuid;index" json:"task_id"`
 
 	SessionTaskProcessStatus string `gorm:"type:text;not null;default:'pending';check:session_task_process_status IN ('success','failed','running','pending')" json:"session_task_process_status"`
 
-	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP;index:idx_session_created,priority:2,sort:desc" json:"created_at"`
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP;index:idx_session_created,priority:2,sort:desc;index:idx_session_client_seq,priority:3" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
 
 	// Message <-> Session
@@ -47,6 +63,12 @@ type Message struct {
 
 func (Message) TableName() string { return "messages" }
 
+// SourceFormat returns the format the message was sent in, from its source_format meta, or "" if unknown
+func (m *Message) SourceFormat() MessageFormat {
+	f, _ := m.Meta.Data()["source_format"].(string)
+	return MessageFormat(f)
+}
+
 type Part struct {
 	// "text" | "image" | "audio" | "video" | "file" | "tool-call" | "tool-result" | "data"
 	Type string `json:"type"`
@@ -61,3 +83,6 @@ type Part struct {
 	// embedding、ocr、asr、caption...
 	Meta map[string]any `json:"meta,omitempty"`
 }
+
+// PartMetaOriginalFilename is the part meta key keeping the uploaded filename when Filename had to be sanitized
+const PartMetaOriginalFilename = "original_filename"
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Statuses of a pending MQ event
+const (
+	MQEventPending = "pending" // not published yet
+	MQEventDone    = "done"    // published, the row is deleted then
+	MQEventDead    = "dead"    // gave up after RabbitMQ.RetryMaxAttempts attempts
+)
+
+// PendingMQEvent is an outbox row: a RabbitMQ message inserted in the transaction of the change it reports,
+// published once the transaction commits and retried in the background until it is.
+// Its ID is published as the AMQP message id, the same for every attempt.
+type PendingMQEvent struct {
+	ID         uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Exchange   string         `gorm:"type:text;not null" json:"exchange"`
+	RoutingKey string         `gorm:"type:text;not null" json:"routing_key"`
+	Body       datatypes.JSON `gorm:"type:jsonb;not null" swaggertype:"object" json:"body"`
+
+	Status        string    `gorm:"type:text;not null;default:'pending';check:status IN ('pending','done','dead');index:idx_pending_mq_events_due,priority:1" json:"status"`
+	Attempts      int       `gorm:"not null;default:0" json:"attempts"`
+	LastError     string    `gorm:"type:text;not null;default:''" json:"last_error"`
+	NextAttemptAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP;index:idx_pending_mq_events_due,priority:2" json:"next_attempt_at"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (PendingMQEvent) TableName() string { return "pending_mq_events" }
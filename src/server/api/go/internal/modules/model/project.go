@@ -33,3 +33,126 @@ type Project struct {
 }
 
 func (Project) TableName() string { return "projects" }
+
+// Project config keys of the conversation structure rules enforced when a message is stored
+const (
+	// ProjectConfigRequireSystemPrompt requires the session system prompt to be set before any message is stored
+	ProjectConfigRequireSystemPrompt = "require_system_prompt"
+	// ProjectConfigFirstMessageRole requires the first message of every session to have the given role,
+	// "user" or "assistant"
+	ProjectConfigFirstMessageRole = "first_message_role"
+	// ProjectConfigToolResultsFollowCalls requires tool results to immediately follow the message of their tool calls
+	ProjectConfigToolResultsFollowCalls = "tool_results_follow_calls"
+)
+
+// MessageRules are the conversation structure rules of a project, the zero value enforces nothing
+type MessageRules struct {
+	RequireSystemPrompt    bool
+	FirstMessageRole       string
+	ToolResultsFollowCalls bool
+}
+
+// Enabled reports whether any rule is set
+func (r MessageRules) Enabled() bool {
+	return r.RequireSystemPrompt || r.FirstMessageRole != "" || r.ToolResultsFollowCalls
+}
+
+// MessageRules returns the conversation structure rules configured in the project configs. A first message
+// role other than "user" or "assistant" is ignored, as no message could be stored with it.
+func (p *Project) MessageRules() MessageRules {
+	requireSystemPrompt, _ := p.Configs[ProjectConfigRequireSystemPrompt].(bool)
+	firstMessageRole, _ := p.Configs[ProjectConfigFirstMessageRole].(string)
+	if firstMessageRole != "user" && firstMessageRole != "assistant" {
+		firstMessageRole = ""
+	}
+	toolResultsFollowCalls, _ := p.Configs[ProjectConfigToolResultsFollowCalls].(bool)
+	return MessageRules{
+		RequireSystemPrompt:    requireSystemPrompt,
+		FirstMessageRole:       firstMessageRole,
+		ToolResultsFollowCalls: toolResultsFollowCalls,
+	}
+}
+
+// ProjectConfigWithAssetPublicURL is the project config key holding the default of with_asset_public_url
+// when listing messages. Projects handling assets out-of-band can set it to false to skip presigning.
+const ProjectConfigWithAssetPublicURL = "with_asset_public_url"
+
+// DefaultWithAssetPublicURL returns whether messages are listed with asset public urls by default, true unless configured
+func (p *Project) DefaultWithAssetPublicURL() bool {
+	withAssetPublicURL, ok := p.Configs[ProjectConfigWithAssetPublicURL].(bool)
+	return !ok || withAssetPublicURL
+}
+
+// ProjectConfigDefaultMessageFormat is the project config key holding the format messages are listed in
+// when the request does not set one, so that projects on a single provider need not pass it every time
+const ProjectConfigDefaultMessageFormat = "default_message_format"
+
+// DefaultMessageFormat returns the configured default format of listed messages, empty if not configured or not a known format
+func (p *Project) DefaultMessageFormat() MessageFormat {
+	format, _ := p.Configs[ProjectConfigDefaultMessageFormat].(string)
+	switch f := MessageFormat(format); f {
+	case FormatAcontext, FormatOpenAI, FormatAnthropic, FormatGemini, FormatLangChain:
+		return f
+	}
+	return ""
+}
+
+// ProjectConfigMaxSearchIterations is the project config key capping max_iterations of experience search,
+// on top of the global limit of 100
+const ProjectConfigMaxSearchIterations = "max_search_iterations"
+
+// MaxSearchIterations returns the max_iterations cap of experience search, 0 if not configured
+func (p *Project) MaxSearchIterations() int {
+	switch v := p.Configs[ProjectConfigMaxSearchIterations].(type) {
+	case float64:
+		if v >= 1 {
+			return int(v)
+		}
+	case int:
+		if v >= 1 {
+			return v
+		}
+	}
+	return 0
+}
+
+// Project config keys overriding the global rate limit of the project's requests
+const (
+	ProjectConfigRateLimitPerSec = "rate_limit_per_sec"
+	ProjectConfigRateLimitBurst  = "rate_limit_burst"
+)
+
+// RateLimit returns the rate limit overrides of the project, 0 for the values that are not configured
+func (p *Project) RateLimit() (perSec float64, burst int) {
+	if v, ok := p.Configs[ProjectConfigRateLimitPerSec].(float64); ok && v > 0 {
+		perSec = v
+	}
+	if v, ok := p.Configs[ProjectConfigRateLimitBurst].(float64); ok && v >= 1 {
+		burst = int(v)
+	}
+	return perSec, burst
+}
+
+// Project config keys overriding the global storage quotas of the project
+const (
+	ProjectConfigMaxMessages   = "max_messages"
+	ProjectConfigMaxAssetBytes = "max_asset_bytes"
+)
+
+// Quota caps what a project stores, 0 leaves a value unlimited
+type Quota struct {
+	MaxMessages   int64
+	MaxAssetBytes int64
+}
+
+// Quota returns the storage quota overrides of the project, 0 for the values that are not configured
+func (p *Project) Quota() Quota {
+	var q Quota
+	if v, ok := p.Configs[ProjectConfigMaxMessages].(float64); ok && v >= 1 {
+		q.MaxMessages = int64(v)
+	}
+	if v, ok := p.Configs[ProjectConfigMaxAssetBytes].(float64); ok && v >= 1 {
+		q.MaxAssetBytes = int64(v)
+	}
+	return q
+}
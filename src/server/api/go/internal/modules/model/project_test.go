@@ -0,0 +1,34 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+)
+
+func TestProject_MessageRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs datatypes.JSONMap
+		want    MessageRules
+	}{
+		{name: "no configs", want: MessageRules{}},
+		{
+			name:    "all rules",
+			configs: datatypes.JSONMap{"require_system_prompt": true, "first_message_role": "user", "tool_results_follow_calls": true},
+			want:    MessageRules{RequireSystemPrompt: true, FirstMessageRole: "user", ToolResultsFollowCalls: true},
+		},
+		{name: "assistant first", configs: datatypes.JSONMap{"first_message_role": "assistant"}, want: MessageRules{FirstMessageRole: "assistant"}},
+		{name: "unknown role ignored", configs: datatypes.JSONMap{"first_message_role": "system"}, want: MessageRules{}},
+		{name: "role not a string", configs: datatypes.JSONMap{"first_message_role": 1}, want: MessageRules{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Project{Configs: tt.configs}
+			assert.Equal(t, tt.want, p.MessageRules())
+			assert.Equal(t, tt.want != MessageRules{}, p.MessageRules().Enabled())
+		})
+	}
+}
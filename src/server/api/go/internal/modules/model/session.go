@@ -9,14 +9,27 @@ import (
 
 type Session struct {
 	ID                  uuid.UUID         `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	ProjectID           uuid.UUID         `gorm:"type:uuid;not null;index" json:"project_id"`
+	ProjectID           uuid.UUID         `gorm:"type:uuid;not null;index;uniqueIndex:idx_session_project_client_id,priority:1" json:"project_id"`
 	DisableTaskTracking bool              `gorm:"not null;default:false" json:"disable_task_tracking"`
 	SpaceID             *uuid.UUID        `gorm:"type:uuid;index" json:"space_id"`
 	Configs             datatypes.JSONMap `gorm:"type:jsonb" swaggertype:"object" json:"configs"`
 
+	// ClientSessionID is an optional key chosen by the client, unique within the project,
+	// so that retried creations return the existing session instead of a duplicate
+	ClientSessionID *string `gorm:"type:text;uniqueIndex:idx_session_project_client_id,priority:2" json:"client_session_id,omitempty"`
+
+	// LearningStatus is a locally maintained copy of the session's learning status,
+	// refreshed periodically from the tasks table. Empty when not connected to a space.
+	LearningStatus         string     `gorm:"type:text;not null;default:'';index" json:"learning_status"`
+	LearningStatusSyncedAt *time.Time `json:"learning_status_synced_at,omitempty"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
 
+	// LastMessageAt and MessageCount are not stored, they are computed when listing sessions sorted by them
+	LastMessageAt *time.Time `gorm:"->;-:migration" json:"last_message_at,omitempty"`
+	MessageCount  *int64     `gorm:"->;-:migration" json:"message_count,omitempty"`
+
 	// Session <-> Project
 	Project *Project `gorm:"foreignKey:ProjectID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
 
@@ -32,6 +45,31 @@ type Session struct {
 
 func (Session) TableName() string { return "sessions" }
 
+// SessionConfigSystemPrompt is the session config key holding the session's system prompt.
+// System role messages are not stored as messages, so the system prompt lives in the session configs.
+const SessionConfigSystemPrompt = "system_prompt"
+
+// SystemPrompt returns the session's system prompt, or "" if none is set
+func (s *Session) SystemPrompt() string {
+	prompt, _ := s.Configs[SessionConfigSystemPrompt].(string)
+	return prompt
+}
+
+// Learning status values stored in Session.LearningStatus.
+// A session is pending while any of its tasks has not been digested into its space yet,
+// and digested once it is connected to a space and every task has been digested.
+const (
+	LearningStatusPending  = "pending"
+	LearningStatusDigested = "digested"
+)
+
+// Orderings of the session list, by the column sorted on
+const (
+	SessionSortCreatedAt     = "created_at"
+	SessionSortLastMessageAt = "last_message_at"
+	SessionSortMessageCount  = "message_count"
+)
+
 // MessageObservingStatus represents the count of messages by their observing status
 type MessageObservingStatus struct {
 	Observed  int       `json:"observed"`
@@ -39,3 +77,16 @@ type MessageObservingStatus struct {
 	Pending   int       `json:"pending"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// MessagesVersion identifies the current state of a session's messages. It changes whenever
+// a message is added, removed or updated, and is used to build the ETag of the message list.
+type MessagesVersion struct {
+	Count         int64      `json:"count"`
+	LastUpdatedAt *time.Time `json:"last_updated_at"` // nil when the session has no messages
+}
+
+// MessageActivityBucket is the number of messages created in the bucket starting at Start
+type MessageActivityBucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
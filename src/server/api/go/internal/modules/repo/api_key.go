@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepo interface {
+	Create(ctx context.Context, k *model.APIKey) error
+	ListByProject(ctx context.Context, projectID uuid.UUID) ([]model.APIKey, error)
+	Get(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) (*model.APIKey, error)
+	Revoke(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) error
+	Rotate(ctx context.Context, old *model.APIKey, next *model.APIKey, oldExpiresAt time.Time) error
+	TouchLastUsed(ctx context.Context, lastUsed map[uuid.UUID]time.Time) error
+}
+
+type apiKeyRepo struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepo(db *gorm.DB) APIKeyRepo {
+	return &apiKeyRepo{db: db}
+}
+
+func (r *apiKeyRepo) Create(ctx context.Context, k *model.APIKey) error {
+	return r.db.WithContext(ctx).Create(k).Error
+}
+
+// ListByProject lists the API keys of the project, revoked ones included, newest first
+func (r *apiKeyRepo) ListByProject(ctx context.Context, projectID uuid.UUID) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := r.db.WithContext(ctx).
+		Where("project_id = ?", projectID).
+		Order("created_at DESC, id DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// Get returns an API key of the project, returning gorm.ErrRecordNotFound if it is revoked or expired
+func (r *apiKeyRepo) Get(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) (*model.APIKey, error) {
+	var k model.APIKey
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND project_id = ? AND revoked_at IS NULL", keyID, projectID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		First(&k).Error
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// Revoke revokes an API key of the project, returning gorm.ErrRecordNotFound if there is no such key not yet revoked
+func (r *apiKeyRepo) Revoke(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) error {
+	res := r.db.WithContext(ctx).Model(&model.APIKey{}).
+		Where("id = ? AND project_id = ? AND revoked_at IS NULL", keyID, projectID).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Rotate creates next and has old expire at oldExpiresAt, unless it expires earlier, in one transaction.
+// It returns gorm.ErrRecordNotFound if old was revoked or expired in the meantime.
+func (r *apiKeyRepo) Rotate(ctx context.Context, old *model.APIKey, next *model.APIKey, oldExpiresAt time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.APIKey{}).
+			Where("id = ? AND project_id = ? AND revoked_at IS NULL", old.ID, old.ProjectID).
+			Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+			Update("expires_at", gorm.Expr("LEAST(COALESCE(expires_at, ?), ?)", oldExpiresAt, oldExpiresAt))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(next).Error
+	})
+}
+
+// TouchLastUsed sets the last_used_at of API keys, never moving it backwards
+func (r *apiKeyRepo) TouchLastUsed(ctx context.Context, lastUsed map[uuid.UUID]time.Time) error {
+	for id, at := range lastUsed {
+		if err := r.db.WithContext(ctx).Model(&model.APIKey{}).
+			Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, at).
+			Update("last_used_at", at).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package repo
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,14 +20,25 @@ type AssetReferenceRepo interface {
 	DecrementAssetRef(ctx context.Context, projectID uuid.UUID, asset model.Asset) error
 	BatchIncrementAssetRefs(ctx context.Context, projectID uuid.UUID, assets []model.Asset) error
 	BatchDecrementAssetRefs(ctx context.Context, projectID uuid.UUID, assets []model.Asset) error
+	BatchDecrementAssetRefsDelta(ctx context.Context, projectID uuid.UUID, assets []model.Asset) (*model.AssetRefDelta, error)
+	IncrementExistingAssetRef(ctx context.Context, projectID uuid.UUID, sha256 string) (*model.AssetReference, error)
+	Get(ctx context.Context, projectID uuid.UUID, sha256 string) (*model.AssetReference, error)
+	ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.AssetReference, error)
+	ListUnreferenced(ctx context.Context, updatedBefore time.Time, limit int) ([]model.AssetReference, error)
+	DeleteUnreferenced(ctx context.Context, id uuid.UUID, updatedBefore time.Time) (string, error)
+	UntrackedS3Keys(ctx context.Context, keys []string) ([]string, error)
+	MarkScanPending(ctx context.Context, projectID uuid.UUID, sha256 string) (bool, error)
+	SetScanStatus(ctx context.Context, projectID uuid.UUID, sha256 string, status string) error
+	InfectedS3Keys(ctx context.Context, keys []string) ([]string, error)
+	TotalSizeByProject(ctx context.Context, projectID uuid.UUID) (int64, error)
 }
 
 type assetReferenceRepo struct {
 	db *gorm.DB
-	s3 *blob.S3Deps
+	s3 blob.Store
 }
 
-func NewAssetReferenceRepo(db *gorm.DB, s3 *blob.S3Deps) AssetReferenceRepo {
+func NewAssetReferenceRepo(db *gorm.DB, s3 blob.Store) AssetReferenceRepo {
 	return &assetReferenceRepo{db: db, s3: s3}
 }
 
@@ -164,11 +177,19 @@ func (r *assetReferenceRepo) BatchIncrementAssetRefs(ctx context.Context, projec
 // When count reaches zero or below, the asset reference row is deleted.
 // Uses SkipHooks to prevent recursive hook triggers when called from other hooks.
 func (r *assetReferenceRepo) BatchDecrementAssetRefs(ctx context.Context, projectID uuid.UUID, assets []model.Asset) error {
+	_, err := r.BatchDecrementAssetRefsDelta(ctx, projectID, assets)
+	return err
+}
+
+// BatchDecrementAssetRefsDelta is BatchDecrementAssetRefs, also returning which assets were decremented and
+// which were deleted. On error, the delta lists the changes made before it.
+func (r *assetReferenceRepo) BatchDecrementAssetRefsDelta(ctx context.Context, projectID uuid.UUID, assets []model.Asset) (*model.AssetRefDelta, error) {
+	delta := &model.AssetRefDelta{Decremented: []model.AssetRefChange{}, Deleted: []model.AssetRefChange{}}
 	if projectID == uuid.Nil {
-		return fmt.Errorf("BatchDecrementAssetRefs: project_id is required")
+		return delta, fmt.Errorf("BatchDecrementAssetRefs: project_id is required")
 	}
 	if len(assets) == 0 {
-		return nil
+		return delta, nil
 	}
 
 	// group by sha256
@@ -180,35 +201,206 @@ func (r *assetReferenceRepo) BatchDecrementAssetRefs(ctx context.Context, projec
 		grouped[a.SHA256]++
 	}
 	if len(grouped) == 0 {
-		return nil
+		return delta, nil
 	}
 
 	// For each sha, decrement or delete
 	// Use SkipHooks to prevent recursive hook triggers when called from other hooks
 	sessionTx := r.db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true})
-	for sha, dec := range grouped {
+	for _, sha := range slices.Sorted(maps.Keys(grouped)) {
+		dec := grouped[sha]
 		var ref model.AssetReference
 		err := sessionTx.Where("project_id = ? AND sha256 = ?", projectID, sha).First(&ref).Error
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
 				continue
 			}
-			return err
+			return delta, err
 		}
 		if ref.RefCount <= dec {
 			if err := r.s3.DeleteObject(ctx, ref.S3Key); err != nil {
-				return err
+				return delta, err
 			}
 			if err := sessionTx.Delete(&ref).Error; err != nil {
-				return err
+				return delta, err
 			}
+			delta.Deleted = append(delta.Deleted, model.AssetRefChange{SHA256: sha, S3Key: ref.S3Key, DecrementedBy: ref.RefCount})
 			continue
 		}
 		if err := sessionTx.Model(&model.AssetReference{}).
 			Where("project_id = ? AND sha256 = ?", projectID, sha).
 			UpdateColumn("ref_count", gorm.Expr("ref_count - ?", dec)).Error; err != nil {
-			return err
+			return delta, err
+		}
+		delta.Decremented = append(delta.Decremented, model.AssetRefChange{SHA256: sha, S3Key: ref.S3Key, DecrementedBy: dec, RefCount: ref.RefCount - dec})
+	}
+	return delta, nil
+}
+
+// IncrementExistingAssetRef increments RefCount of the project's asset with the given content hash when it
+// is still referenced, and returns the updated reference, or gorm.ErrRecordNotFound when the project has no
+// such asset. The check and the increment are one statement, so a concurrent decrement can't delete the
+// object between them.
+func (r *assetReferenceRepo) IncrementExistingAssetRef(ctx context.Context, projectID uuid.UUID, sha256 string) (*model.AssetReference, error) {
+	now := time.Now()
+	var refs []model.AssetReference
+	err := r.db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true}).Model(&refs).
+		Clauses(clause.Returning{}).
+		Where("project_id = ? AND sha256 = ? AND ref_count > 0", projectID, sha256).
+		UpdateColumns(map[string]any{
+			"ref_count":          gorm.Expr("ref_count + 1"),
+			"last_referenced_at": now,
+			"updated_at":         now,
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &refs[0], nil
+}
+
+// Get returns the project's reference to the asset with the given content hash, including one left
+// with no references that was not purged yet, or gorm.ErrRecordNotFound when the project has no such asset
+func (r *assetReferenceRepo) Get(ctx context.Context, projectID uuid.UUID, sha256 string) (*model.AssetReference, error) {
+	var ref model.AssetReference
+	err := r.db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true}).
+		Where("project_id = ? AND sha256 = ?", projectID, sha256).
+		First(&ref).Error
+	if err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// ListWithCursor returns up to limit asset references of the project ordered by (created_at, id),
+// starting after the given cursor position when one is set
+func (r *assetReferenceRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.AssetReference, error) {
+	q := r.db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true}).Where("project_id = ?", projectID)
+
+	// Apply cursor-based pagination filter if cursor is provided
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		comparisonOp := ">"
+		if timeDesc {
+			comparisonOp = "<"
+		}
+		q = q.Where(
+			"(created_at "+comparisonOp+" ?) OR (created_at = ? AND id "+comparisonOp+" ?)",
+			afterCreatedAt, afterCreatedAt, afterID,
+		)
+	}
+
+	orderBy := "created_at ASC, id ASC"
+	if timeDesc {
+		orderBy = "created_at DESC, id DESC"
+	}
+
+	var refs []model.AssetReference
+	return refs, q.Order(orderBy).Limit(limit).Find(&refs).Error
+}
+
+// ListUnreferenced returns up to limit rows left with no references that were last updated before updatedBefore
+func (r *assetReferenceRepo) ListUnreferenced(ctx context.Context, updatedBefore time.Time, limit int) ([]model.AssetReference, error) {
+	var refs []model.AssetReference
+	err := r.db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true}).
+		Where("ref_count <= 0 AND updated_at < ?", updatedBefore).
+		Order("updated_at ASC").
+		Limit(limit).
+		Find(&refs).Error
+	return refs, err
+}
+
+// DeleteUnreferenced deletes the row if it still has no references and was last updated before updatedBefore,
+// in a single statement, and returns the s3 key of the deleted row. It returns "" when the row was referenced
+// or updated again in the meantime. A zero updatedBefore skips the age check.
+func (r *assetReferenceRepo) DeleteUnreferenced(ctx context.Context, id uuid.UUID, updatedBefore time.Time) (string, error) {
+	q := r.db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true}).
+		Where("id = ? AND ref_count <= 0", id)
+	if !updatedBefore.IsZero() {
+		q = q.Where("updated_at < ?", updatedBefore)
+	}
+
+	var deleted []model.AssetReference
+	if err := q.Clauses(clause.Returning{Columns: []clause.Column{{Name: "s3_key"}}}).Delete(&deleted).Error; err != nil {
+		return "", err
+	}
+	if len(deleted) == 0 {
+		return "", nil
+	}
+	return deleted[0].S3Key, nil
+}
+
+// UntrackedS3Keys returns the keys that no asset reference row points to
+func (r *assetReferenceRepo) UntrackedS3Keys(ctx context.Context, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	var tracked []string
+	if err := r.db.WithContext(ctx).Model(&model.AssetReference{}).
+		Where("s3_key IN ?", keys).
+		Distinct().
+		Pluck("s3_key", &tracked).Error; err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(tracked))
+	for _, k := range tracked {
+		seen[k] = true
+	}
+	var untracked []string
+	for _, k := range keys {
+		if !seen[k] {
+			untracked = append(untracked, k)
 		}
 	}
+	return untracked, nil
+}
+
+// MarkScanPending marks an asset never submitted to the scanner as pending,
+// reporting whether it did so and the asset should be submitted now
+func (r *assetReferenceRepo) MarkScanPending(ctx context.Context, projectID uuid.UUID, sha256 string) (bool, error) {
+	res := r.db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true}).Model(&model.AssetReference{}).
+		Where("project_id = ? AND sha256 = ? AND scan_status = ''", projectID, sha256).
+		Update("scan_status", model.ScanStatusPending)
+	return res.RowsAffected > 0, res.Error
+}
+
+// SetScanStatus records the scan result of an asset
+func (r *assetReferenceRepo) SetScanStatus(ctx context.Context, projectID uuid.UUID, sha256 string, status string) error {
+	res := r.db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true}).Model(&model.AssetReference{}).
+		Where("project_id = ? AND sha256 = ?", projectID, sha256).
+		Update("scan_status", status)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
 	return nil
 }
+
+// InfectedS3Keys returns the keys among keys whose asset was reported infected by the scanner
+func (r *assetReferenceRepo) InfectedS3Keys(ctx context.Context, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	var infected []string
+	err := r.db.WithContext(ctx).Model(&model.AssetReference{}).
+		Where("s3_key IN ? AND scan_status = ?", keys, model.ScanStatusInfected).
+		Distinct().
+		Pluck("s3_key", &infected).Error
+	return infected, err
+}
+
+// TotalSizeByProject sums the size of the assets of the project that are still referenced
+func (r *assetReferenceRepo) TotalSizeByProject(ctx context.Context, projectID uuid.UUID) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).Model(&model.AssetReference{}).
+		Where("project_id = ? AND ref_count > 0", projectID).
+		Select("COALESCE(SUM((asset_meta->>'size_b')::bigint), 0)").
+		Scan(&total).Error
+	return total, err
+}
@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// TestAssetReferenceRepo_IncrementExistingAssetRef increments only references still held, and returns the row
+func TestAssetReferenceRepo_IncrementExistingAssetRef(t *testing.T) {
+	db := setupSessionTestDB(t)
+	if db == nil {
+		return // Test was skipped
+	}
+	require.NoError(t, db.AutoMigrate(&model.AssetReference{}))
+
+	repo := NewAssetReferenceRepo(db, nil)
+	ctx := context.Background()
+
+	project := &model.Project{
+		ID:               uuid.New(),
+		SecretKeyHMAC:    "test_hmac_asset_refs",
+		SecretKeyHashPHC: "test_hash_asset_refs",
+	}
+	require.NoError(t, db.Create(project).Error)
+	defer cleanupSessionTestDB(t, db, project.ID)
+	defer db.Exec("DELETE FROM asset_references WHERE project_id = ?", project.ID)
+
+	held := model.Asset{SHA256: strings.Repeat("a", 64), S3Key: "assets/held.png", MIME: "image/png"}
+	released := model.Asset{SHA256: strings.Repeat("b", 64), S3Key: "assets/released.png", MIME: "image/png"}
+	for _, ref := range []model.AssetReference{
+		{ProjectID: project.ID, SHA256: held.SHA256, S3Key: held.S3Key, RefCount: 2, AssetMeta: datatypes.NewJSONType(held)},
+		{ProjectID: project.ID, SHA256: released.SHA256, S3Key: released.S3Key, RefCount: 0, AssetMeta: datatypes.NewJSONType(released)},
+	} {
+		require.NoError(t, db.Create(&ref).Error)
+	}
+
+	ref, err := repo.IncrementExistingAssetRef(ctx, project.ID, held.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, 3, ref.RefCount)
+	assert.Equal(t, held.S3Key, ref.S3Key)
+	assert.Equal(t, held.MIME, ref.AssetMeta.Data().MIME)
+
+	t.Run("a released asset is not revived", func(t *testing.T) {
+		_, err := repo.IncrementExistingAssetRef(ctx, project.ID, released.SHA256)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		var got model.AssetReference
+		require.NoError(t, db.Where("project_id = ? AND sha256 = ?", project.ID, released.SHA256).First(&got).Error)
+		assert.Equal(t, 0, got.RefCount)
+	})
+
+	t.Run("another project's asset is not shared", func(t *testing.T) {
+		_, err := repo.IncrementExistingAssetRef(ctx, uuid.New(), held.SHA256)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+}
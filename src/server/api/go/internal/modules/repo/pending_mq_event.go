@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+type PendingMQEventRepo interface {
+	Create(ctx context.Context, e *model.PendingMQEvent) error
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.PendingMQEvent, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	MarkFailed(ctx context.Context, id uuid.UUID, attempts int, lastErr string, nextAttemptAt time.Time, dead bool) error
+	CountByStatus(ctx context.Context) (map[string]int64, error)
+}
+
+type pendingMQEventRepo struct {
+	db *gorm.DB
+}
+
+func NewPendingMQEventRepo(db *gorm.DB) PendingMQEventRepo {
+	return &pendingMQEventRepo{db: db}
+}
+
+func (r *pendingMQEventRepo) Create(ctx context.Context, e *model.PendingMQEvent) error {
+	return r.db.WithContext(ctx).Create(e).Error
+}
+
+// ClaimDue returns up to limit pending events due at now, oldest first, counting an attempt for each of them.
+// Claimed events are not due again before now+lease, so that API replicas retrying at the same time skip them.
+func (r *pendingMQEventRepo) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.PendingMQEvent, error) {
+	var events []model.PendingMQEvent
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE pending_mq_events SET attempts = attempts + 1, next_attempt_at = ?, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM pending_mq_events
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(lease), now, model.MQEventPending, now, limit,
+	).Scan(&events).Error
+	return events, err
+}
+
+// Delete removes a published event, the outbox only keeps the events still to publish and the dead ones
+func (r *pendingMQEventRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&model.PendingMQEvent{}).Error
+}
+
+// MarkFailed records the attempts-th failed attempt, the event is retried at nextAttemptAt unless dead
+func (r *pendingMQEventRepo) MarkFailed(ctx context.Context, id uuid.UUID, attempts int, lastErr string, nextAttemptAt time.Time, dead bool) error {
+	status := model.MQEventPending
+	if dead {
+		status = model.MQEventDead
+	}
+	return r.db.WithContext(ctx).Model(&model.PendingMQEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"status": status, "attempts": attempts, "last_error": lastErr, "next_attempt_at": nextAttemptAt}).Error
+}
+
+// CountByStatus counts the pending and dead events
+func (r *pendingMQEventRepo) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := r.db.WithContext(ctx).Model(&model.PendingMQEvent{}).
+		Select("status, COUNT(*) AS count").
+		Where("status IN ?", []string{model.MQEventPending, model.MQEventDead}).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int64{model.MQEventPending: 0, model.MQEventDead: 0}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
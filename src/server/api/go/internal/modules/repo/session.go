@@ -3,6 +3,7 @@ package repo
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,29 +11,44 @@ import (
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SessionRepo interface {
 	Create(ctx context.Context, s *model.Session) error
-	Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error
-	Update(ctx context.Context, s *model.Session) error
+	GetOrCreateByClientID(ctx context.Context, s *model.Session) (bool, error)
+	Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*model.AssetRefDelta, error)
+	Update(ctx context.Context, s *model.Session, columns ...string) error
 	Get(ctx context.Context, s *model.Session) (*model.Session, error)
 	GetDisableTaskTracking(ctx context.Context, sessionID uuid.UUID) (bool, error)
-	ListWithCursor(ctx context.Context, projectID uuid.UUID, spaceID *uuid.UUID, notConnected bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error)
-	CreateMessageWithAssets(ctx context.Context, msg *model.Message) error
-	ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error)
+	ListWithCursor(ctx context.Context, in ListSessionsQuery) ([]model.Session, error)
+	CreateMessageWithAssets(ctx context.Context, msg *model.Message, event *model.PendingMQEvent) error
+	ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterSeq *int64, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error)
 	ListAllMessagesBySession(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error)
+	ListLatestMessagesWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error)
+	SearchMessagesByProject(ctx context.Context, projectID uuid.UUID, query string, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error)
+	ListMessagesWithoutSearchText(ctx context.Context, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error)
+	SetMessageSearchText(ctx context.Context, messageID uuid.UUID, text string) error
 	GetObservingStatus(ctx context.Context, sessionID string) (*model.MessageObservingStatus, error)
+	SyncLearningStatus(ctx context.Context) (int64, error)
+	SetSystemPrompt(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, prompt string) error
+	CountMessagesByBucket(ctx context.Context, sessionID uuid.UUID, bucket string, start, end time.Time) ([]model.MessageActivityBucket, error)
+	GetMessagesVersion(ctx context.Context, sessionID uuid.UUID) (*model.MessagesVersion, error)
+	ListPartsSHA256(ctx context.Context, sessionID uuid.UUID) ([]string, error)
+	GetLatestMessageID(ctx context.Context, sessionID uuid.UUID) (uuid.UUID, error)
+	MoveToSpace(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, spaceID uuid.UUID) error
+	DisconnectFromSpace(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error
+	CountMessagesByProject(ctx context.Context, projectID uuid.UUID) (int64, error)
 }
 
 type sessionRepo struct {
 	db                 *gorm.DB
 	assetReferenceRepo AssetReferenceRepo
-	s3                 *blob.S3Deps
+	s3                 blob.Store
 	log                *zap.Logger
 }
 
-func NewSessionRepo(db *gorm.DB, assetReferenceRepo AssetReferenceRepo, s3 *blob.S3Deps, log *zap.Logger) SessionRepo {
+func NewSessionRepo(db *gorm.DB, assetReferenceRepo AssetReferenceRepo, s3 blob.Store, log *zap.Logger) SessionRepo {
 	return &sessionRepo{
 		db:                 db,
 		assetReferenceRepo: assetReferenceRepo,
@@ -45,9 +61,35 @@ func (r *sessionRepo) Create(ctx context.Context, s *model.Session) error {
 	return r.db.WithContext(ctx).Create(s).Error
 }
 
-func (r *sessionRepo) Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error {
+// GetOrCreateByClientID inserts s unless the project already has a session with its ClientSessionID,
+// in which case s is replaced by the existing session. It reports whether s was created.
+func (r *sessionRepo) GetOrCreateByClientID(ctx context.Context, s *model.Session) (bool, error) {
+	res := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}, {Name: "client_session_id"}},
+		DoNothing: true,
+	}).Create(s)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return true, nil
+	}
+
+	existing := model.Session{}
+	if err := r.db.WithContext(ctx).
+		Where("project_id = ? AND client_session_id = ?", s.ProjectID, s.ClientSessionID).
+		First(&existing).Error; err != nil {
+		return false, err
+	}
+	*s = existing
+	return false, nil
+}
+
+// Delete deletes the session and its messages, returning the changes to the references of their assets
+func (r *sessionRepo) Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*model.AssetRefDelta, error) {
+	delta := &model.AssetRefDelta{Decremented: []model.AssetRefChange{}, Deleted: []model.AssetRefChange{}}
 	// Use transaction to ensure atomicity: query messages, delete session, and decrement asset references
-	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Verify session exists and belongs to project
 		var session model.Session
 		if err := tx.Where("id = ? AND project_id = ?", sessionID, projectID).First(&session).Error; err != nil {
@@ -78,9 +120,11 @@ func (r *sessionRepo) Delete(ctx context.Context, projectID uuid.UUID, sessionID
 					continue
 				}
 
-				// Extract assets from parts
+				// Extract assets from parts, a message holds one reference per distinct asset
+				seen := make(map[string]bool)
 				for _, part := range parts {
-					if part.Asset != nil && part.Asset.SHA256 != "" {
+					if part.Asset != nil && part.Asset.SHA256 != "" && !seen[part.Asset.SHA256] {
+						seen[part.Asset.SHA256] = true
 						assets = append(assets, *part.Asset)
 					}
 				}
@@ -96,17 +140,29 @@ func (r *sessionRepo) Delete(ctx context.Context, projectID uuid.UUID, sessionID
 		// The database operations within BatchDecrementAssetRefs will not be part of this transaction,
 		// but the session and messages deletion will be atomic
 		if len(assets) > 0 {
-			if err := r.assetReferenceRepo.BatchDecrementAssetRefs(ctx, projectID, assets); err != nil {
+			d, err := r.assetReferenceRepo.BatchDecrementAssetRefsDelta(ctx, projectID, assets)
+			if err != nil {
 				return fmt.Errorf("decrement asset references: %w", err)
 			}
+			delta = d
 		}
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return delta, nil
 }
 
-func (r *sessionRepo) Update(ctx context.Context, s *model.Session) error {
-	return r.db.WithContext(ctx).Where(&model.Session{ID: s.ID}).Updates(s).Error
+// Update writes the given columns of s, including zero values such as a nil space_id or empty configs.
+// Without columns only the non-zero fields of s are written, as gorm does for struct updates.
+func (r *sessionRepo) Update(ctx context.Context, s *model.Session, columns ...string) error {
+	q := r.db.WithContext(ctx).Where(&model.Session{ID: s.ID})
+	if len(columns) > 0 {
+		q = q.Select(columns)
+	}
+	return q.Updates(s).Error
 }
 
 func (r *sessionRepo) Get(ctx context.Context, s *model.Session) (*model.Session, error) {
@@ -124,39 +180,171 @@ func (r *sessionRepo) GetDisableTaskTracking(ctx context.Context, sessionID uuid
 	return result.DisableTaskTracking, err
 }
 
-func (r *sessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, spaceID *uuid.UUID, notConnected bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error) {
-	q := r.db.WithContext(ctx).Where("project_id = ?", projectID)
+// ListSessionsQuery selects the sessions of ListWithCursor
+type ListSessionsQuery struct {
+	ProjectID      uuid.UUID
+	SpaceID        *uuid.UUID // only sessions connected to this space
+	NotConnected   bool       // only sessions not connected to a space, takes precedence over SpaceID
+	LearningStatus string     // only sessions with this learning status, any when empty
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	SortBy         string    // one of the model.SessionSort orderings
+	AfterKey       int64     // sort key of the cursor, unix nanoseconds for times
+	AfterID        uuid.UUID // id of the cursor, no cursor when nil
+	Limit          int
+	TimeDesc       bool
+	WithSpace      bool // load the Space of connected sessions
+}
 
-	if notConnected {
+// ListWithCursor returns up to in.Limit sessions of the project ordered by (in.SortBy, id), with the
+// sort key loaded for the computed orderings. The cursor is the sort key of the last session of the
+// previous page and its id. Sessions without messages sort on their created_at by last_message_at.
+func (r *sessionRepo) ListWithCursor(ctx context.Context, in ListSessionsQuery) ([]model.Session, error) {
+	q := r.db.WithContext(ctx).Model(&model.Session{}).Where("project_id = ?", in.ProjectID)
+
+	if in.NotConnected {
 		q = q.Where("space_id IS NULL")
-	} else if spaceID != nil {
-		q = q.Where("space_id = ?", spaceID)
+	} else if in.SpaceID != nil {
+		q = q.Where("space_id = ?", in.SpaceID)
+	}
+
+	// Filter by the locally maintained learning status, see SyncLearningStatus
+	if in.LearningStatus != "" {
+		q = q.Where("learning_status = ?", in.LearningStatus)
+	}
+
+	// Restrict to the requested created_at window; the cursor filter below still applies within it
+	if in.CreatedAfter != nil {
+		q = q.Where("created_at > ?", *in.CreatedAfter)
+	}
+	if in.CreatedBefore != nil {
+		q = q.Where("created_at < ?", *in.CreatedBefore)
+	}
+
+	// Computed sort keys are selected by a subquery, so that the cursor and the ordering can refer to them
+	sortKey := "created_at"
+	var after any = time.Unix(0, in.AfterKey).UTC()
+	switch in.SortBy {
+	case model.SessionSortLastMessageAt:
+		q = r.db.WithContext(ctx).Table("(?) AS sessions", q.Select(
+			"sessions.*, (SELECT MAX(messages.created_at) FROM messages WHERE messages.session_id = sessions.id) AS last_message_at"))
+		sortKey = "COALESCE(last_message_at, created_at)"
+	case model.SessionSortMessageCount:
+		q = r.db.WithContext(ctx).Table("(?) AS sessions", q.Select(
+			"sessions.*, (SELECT COUNT(*) FROM messages WHERE messages.session_id = sessions.id) AS message_count"))
+		sortKey = "message_count"
+		after = in.AfterKey
 	}
 
 	// Apply cursor-based pagination filter if cursor is provided
-	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+	if in.AfterID != uuid.Nil {
 		// Determine comparison operator based on sort direction
 		comparisonOp := ">"
-		if timeDesc {
+		if in.TimeDesc {
 			comparisonOp = "<"
 		}
 		q = q.Where(
-			"(created_at "+comparisonOp+" ?) OR (created_at = ? AND id "+comparisonOp+" ?)",
-			afterCreatedAt, afterCreatedAt, afterID,
+			"("+sortKey+" "+comparisonOp+" ?) OR ("+sortKey+" = ? AND id "+comparisonOp+" ?)",
+			after, after, in.AfterID,
 		)
 	}
 
 	// Apply ordering based on sort direction
-	orderBy := "created_at ASC, id ASC"
-	if timeDesc {
-		orderBy = "created_at DESC, id DESC"
+	orderBy := sortKey + " ASC, id ASC"
+	if in.TimeDesc {
+		orderBy = sortKey + " DESC, id DESC"
+	}
+
+	if in.WithSpace {
+		q = q.Preload("Space")
 	}
 
 	var sessions []model.Session
-	return sessions, q.Order(orderBy).Limit(limit).Find(&sessions).Error
+	return sessions, q.Order(orderBy).Limit(in.Limit).Find(&sessions).Error
+}
+
+// ListLatestMessagesWithCursor returns the latest message of every session of the project that has
+// messages, newest first, with its Session loaded. The cursor is the (created_at, id) of the last
+// message of the previous page.
+func (r *sessionRepo) ListLatestMessagesWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error) {
+	// the lateral subquery picks each session's latest message through idx_session_created
+	q := r.db.WithContext(ctx).Table("sessions").
+		Joins("CROSS JOIN LATERAL (SELECT id, created_at FROM messages WHERE messages.session_id = sessions.id ORDER BY created_at DESC, id DESC LIMIT 1) AS latest").
+		Where("sessions.project_id = ?", projectID)
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		q = q.Where("(latest.created_at < ?) OR (latest.created_at = ? AND latest.id < ?)", afterCreatedAt, afterCreatedAt, afterID)
+	}
+
+	var ids []uuid.UUID
+	if err := q.Order("latest.created_at DESC, latest.id DESC").Limit(limit).Pluck("latest.id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []model.Message{}, nil
+	}
+
+	var msgs []model.Message
+	err := r.db.WithContext(ctx).Preload("Session").
+		Where("id IN ?", ids).
+		Order("created_at DESC, id DESC").
+		Find(&msgs).Error
+	return msgs, err
+}
+
+// SearchMessagesByProject lists the messages of all sessions of the project whose search text contains
+// query, ignoring case, newest first, after the (created_at, id) cursor when given. Messages without search
+// text yet are not listed, see ListMessagesWithoutSearchText. The trigram index on search_text only serves
+// queries of 3 characters or more, shorter ones scan the messages of the project.
+func (r *sessionRepo) SearchMessagesByProject(ctx context.Context, projectID uuid.UUID, query string, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error) {
+	q := r.db.WithContext(ctx).
+		Joins("JOIN sessions ON sessions.id = messages.session_id").
+		Where("sessions.project_id = ?", projectID).
+		Where(`messages.search_text ILIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(query)+"%")
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		q = q.Where("(messages.created_at < ?) OR (messages.created_at = ? AND messages.id < ?)", afterCreatedAt, afterCreatedAt, afterID)
+	}
+
+	var msgs []model.Message
+	err := q.Order("messages.created_at DESC, messages.id DESC").Limit(limit).Find(&msgs).Error
+	return msgs, err
+}
+
+// ListMessagesWithoutSearchText lists up to limit messages stored before search text was indexed, oldest
+// first, after the (created_at, id) cursor when given
+func (r *sessionRepo) ListMessagesWithoutSearchText(ctx context.Context, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error) {
+	q := r.db.WithContext(ctx).Where("search_text IS NULL")
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		q = q.Where("(created_at > ?) OR (created_at = ? AND id > ?)", afterCreatedAt, afterCreatedAt, afterID)
+	}
+
+	var msgs []model.Message
+	err := q.Order("created_at ASC, id ASC").Limit(limit).Find(&msgs).Error
+	return msgs, err
 }
 
-func (r *sessionRepo) CreateMessageWithAssets(ctx context.Context, msg *model.Message) error {
+// SetMessageSearchText sets the search text of a message stored without one
+func (r *sessionRepo) SetMessageSearchText(ctx context.Context, messageID uuid.UUID, text string) error {
+	return r.db.WithContext(ctx).Model(&model.Message{}).
+		Where("id = ? AND search_text IS NULL", messageID).
+		UpdateColumn("search_text", text).Error
+}
+
+// likeEscaper escapes the LIKE wildcards of a string matched literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// CountMessagesByProject counts the messages of all sessions of the project
+func (r *sessionRepo) CountMessagesByProject(ctx context.Context, projectID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.Message{}).
+		Joins("JOIN sessions ON sessions.id = messages.session_id").
+		Where("sessions.project_id = ?", projectID).
+		Count(&count).Error
+	return count, err
+}
+
+// CreateMessageWithAssets creates a message, and in the same transaction its outbox event when there is one,
+// so that the event is published eventually if and only if the message is created
+func (r *sessionRepo) CreateMessageWithAssets(ctx context.Context, msg *model.Message, event *model.PendingMQEvent) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// First get the message parent id in session
 		parent := model.Message{}
@@ -171,11 +359,18 @@ func (r *sessionRepo) CreateMessageWithAssets(ctx context.Context, msg *model.Me
 			return err
 		}
 
+		if event != nil {
+			if err := tx.Create(event).Error; err != nil {
+				return fmt.Errorf("create outbox event: %w", err)
+			}
+		}
 		return nil
 	})
 }
 
-func (r *sessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
+// ListBySessionWithCursor lists the messages of a session in order of client_seq, messages without it last,
+// then created_at and id. The cursor is the key of the last message of the previous page.
+func (r *sessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterSeq *int64, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
 	q := r.db.WithContext(ctx).Where("session_id = ?", sessionID)
 
 	// Apply cursor-based pagination filter if cursor is provided
@@ -185,16 +380,23 @@ func (r *sessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uui
 		if timeDesc {
 			comparisonOp = "<"
 		}
-		q = q.Where(
-			"(created_at "+comparisonOp+" ?) OR (created_at = ? AND id "+comparisonOp+" ?)",
-			afterCreatedAt, afterCreatedAt, afterID,
-		)
+		afterTime := "(created_at " + comparisonOp + " ?) OR (created_at = ? AND id " + comparisonOp + " ?)"
+		switch {
+		case afterSeq == nil && timeDesc:
+			q = q.Where("client_seq IS NOT NULL OR ("+afterTime+")", afterCreatedAt, afterCreatedAt, afterID)
+		case afterSeq == nil:
+			q = q.Where("client_seq IS NULL AND ("+afterTime+")", afterCreatedAt, afterCreatedAt, afterID)
+		case timeDesc:
+			q = q.Where("client_seq < ? OR (client_seq = ? AND ("+afterTime+"))", *afterSeq, *afterSeq, afterCreatedAt, afterCreatedAt, afterID)
+		default:
+			q = q.Where("client_seq > ? OR client_seq IS NULL OR (client_seq = ? AND ("+afterTime+"))", *afterSeq, *afterSeq, afterCreatedAt, afterCreatedAt, afterID)
+		}
 	}
 
 	// Apply ordering based on sort direction
-	orderBy := "created_at ASC, id ASC"
+	orderBy := "client_seq ASC NULLS LAST, created_at ASC, id ASC"
 	if timeDesc {
-		orderBy = "created_at DESC, id DESC"
+		orderBy = "client_seq DESC NULLS FIRST, created_at DESC, id DESC"
 	}
 
 	var items []model.Message
@@ -203,7 +405,9 @@ func (r *sessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uui
 
 func (r *sessionRepo) ListAllMessagesBySession(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error) {
 	var messages []model.Message
-	err := r.db.WithContext(ctx).Where("session_id = ?", sessionID).Find(&messages).Error
+	err := r.db.WithContext(ctx).Where("session_id = ?", sessionID).
+		Order("client_seq ASC NULLS LAST, created_at ASC, id ASC").
+		Find(&messages).Error
 	return messages, err
 }
 
@@ -259,3 +463,133 @@ func (r *sessionRepo) GetObservingStatus(
 
 	return status, nil
 }
+
+// learningStatusExpr computes a session's learning status from the tasks table shared with Core,
+// mirroring how Core computes the learning status of a single session
+const learningStatusExpr = `CASE
+	WHEN sessions.space_id IS NULL THEN ''
+	WHEN EXISTS (SELECT 1 FROM tasks WHERE tasks.session_id = sessions.id AND tasks.space_digested = false) THEN 'pending'
+	ELSE 'digested'
+END`
+
+// SyncLearningStatus refreshes the learning_status column of every session whose status changed
+// and returns the number of updated sessions. The status is computed once per session in a joined
+// subquery, so unchanged sessions are neither rewritten nor evaluated twice.
+func (r *sessionRepo) SyncLearningStatus(ctx context.Context) (int64, error) {
+	res := r.db.WithContext(ctx).Exec(
+		"UPDATE sessions SET learning_status = computed.status, learning_status_synced_at = ? "+
+			"FROM (SELECT sessions.id, "+learningStatusExpr+" AS status FROM sessions) AS computed "+
+			"WHERE sessions.id = computed.id AND sessions.learning_status IS DISTINCT FROM computed.status",
+		time.Now(),
+	)
+	if res.Error != nil {
+		return 0, fmt.Errorf("sync learning status: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// SetSystemPrompt replaces the system prompt kept in the session configs in a single statement,
+// leaving the other config keys untouched. An empty prompt removes the key.
+// It returns gorm.ErrRecordNotFound when the session is not in the project.
+func (r *sessionRepo) SetSystemPrompt(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, prompt string) error {
+	expr := gorm.Expr("COALESCE(configs, '{}'::jsonb) - ?::text", model.SessionConfigSystemPrompt)
+	if prompt != "" {
+		expr = gorm.Expr("COALESCE(configs, '{}'::jsonb) || jsonb_build_object(?::text, ?::text)", model.SessionConfigSystemPrompt, prompt)
+	}
+
+	res := r.db.WithContext(ctx).Model(&model.Session{}).Where("id = ? AND project_id = ?", sessionID, projectID).Update("configs", expr)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// MoveToSpace connects the session to the space in a single statement, provided both belong to the project.
+// It returns gorm.ErrRecordNotFound when the session or the space is not in the project.
+func (r *sessionRepo) MoveToSpace(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, spaceID uuid.UUID) error {
+	res := r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("id = ? AND project_id = ?", sessionID, projectID).
+		Where("EXISTS (SELECT 1 FROM spaces WHERE spaces.id = ? AND spaces.project_id = ?)", spaceID, projectID).
+		Update("space_id", spaceID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DisconnectFromSpace sets the session's space_id to NULL and clears its learning status.
+// Updates with a struct skip nil fields, so the columns are set from a map.
+// It returns gorm.ErrRecordNotFound when the session is not in the project.
+func (r *sessionRepo) DisconnectFromSpace(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error {
+	res := r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("id = ? AND project_id = ?", sessionID, projectID).
+		Updates(map[string]any{"space_id": nil, "learning_status": ""})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CountMessagesByBucket counts the session's messages created in [start, end) grouped by date_trunc(bucket, created_at).
+// bucket must be a valid date_trunc field (e.g. minute, hour, day). Buckets are truncated in UTC whatever the
+// database session time zone, so that day buckets start at UTC midnight. Empty buckets are not returned.
+func (r *sessionRepo) CountMessagesByBucket(ctx context.Context, sessionID uuid.UUID, bucket string, start, end time.Time) ([]model.MessageActivityBucket, error) {
+	var buckets []model.MessageActivityBucket
+	err := r.db.WithContext(ctx).
+		Model(&model.Message{}).
+		Select("date_trunc(?, created_at AT TIME ZONE 'UTC') AS start, COUNT(*) AS count", bucket).
+		Where("session_id = ? AND created_at >= ? AND created_at < ?", sessionID, start, end).
+		Group("1").
+		Order("1").
+		Scan(&buckets).Error
+	return buckets, err
+}
+
+// GetMessagesVersion returns the message count and latest updated_at of the session's messages
+func (r *sessionRepo) GetMessagesVersion(ctx context.Context, sessionID uuid.UUID) (*model.MessagesVersion, error) {
+	var version model.MessagesVersion
+	err := r.db.WithContext(ctx).
+		Model(&model.Message{}).
+		Select("COUNT(*) AS count, MAX(updated_at) AS last_updated_at").
+		Where("session_id = ?", sessionID).
+		Scan(&version).Error
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// GetLatestMessageID returns the id of the last message of the session in message order, uuid.Nil without messages
+func (r *sessionRepo) GetLatestMessageID(ctx context.Context, sessionID uuid.UUID) (uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.WithContext(ctx).
+		Model(&model.Message{}).
+		Where("session_id = ?", sessionID).
+		Order("client_seq DESC NULLS FIRST, created_at DESC, id DESC").
+		Limit(1).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return uuid.Nil, err
+	}
+	return ids[0], nil
+}
+
+// ListPartsSHA256 lists the SHA256 of the parts blob of each message of the session, in message order
+func (r *sessionRepo) ListPartsSHA256(ctx context.Context, sessionID uuid.UUID) ([]string, error) {
+	var shas []string
+	err := r.db.WithContext(ctx).
+		Model(&model.Message{}).
+		Where("session_id = ?", sessionID).
+		Order("client_seq ASC NULLS LAST, created_at ASC, id ASC").
+		Pluck("parts_asset_meta->>'sha256'", &shas).Error
+	return shas, err
+}
@@ -3,12 +3,14 @@ package repo
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"gorm.io/datatypes"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -26,6 +28,7 @@ func setupSessionTestDB(t *testing.T) *gorm.DB {
 	// Auto migrate all required tables
 	err = db.AutoMigrate(
 		&model.Project{},
+		&model.Space{},
 		&model.Session{},
 	)
 	require.NoError(t, err)
@@ -37,6 +40,7 @@ func setupSessionTestDB(t *testing.T) *gorm.DB {
 func cleanupSessionTestDB(t *testing.T, db *gorm.DB, projectID uuid.UUID) {
 	// Clean up in reverse order of foreign key dependencies
 	db.Exec("DELETE FROM sessions WHERE project_id = ?", projectID)
+	db.Exec("DELETE FROM spaces WHERE project_id = ?", projectID)
 	db.Exec("DELETE FROM projects WHERE id = ?", projectID)
 }
 
@@ -124,3 +128,406 @@ func TestSessionRepo_GetDisableTaskTracking(t *testing.T) {
 		db.Delete(session)
 	})
 }
+
+// TestSessionRepo_DisconnectFromSpace tests that disconnecting sets space_id to NULL
+func TestSessionRepo_DisconnectFromSpace(t *testing.T) {
+	db := setupSessionTestDB(t)
+	if db == nil {
+		return // Test was skipped
+	}
+
+	logger, _ := zap.NewDevelopment()
+	repo := NewSessionRepo(db, nil, nil, logger)
+	ctx := context.Background()
+
+	project := &model.Project{
+		ID:               uuid.New(),
+		SecretKeyHMAC:    "test_hmac_disconnect",
+		SecretKeyHashPHC: "test_hash_disconnect",
+	}
+	require.NoError(t, db.Create(project).Error)
+	defer cleanupSessionTestDB(t, db, project.ID)
+
+	space := &model.Space{ID: uuid.New(), ProjectID: project.ID}
+	require.NoError(t, db.Create(space).Error)
+
+	t.Run("session is listed as not connected afterwards", func(t *testing.T) {
+		session := &model.Session{
+			ID:             uuid.New(),
+			ProjectID:      project.ID,
+			SpaceID:        &space.ID,
+			LearningStatus: model.LearningStatusDigested,
+		}
+		require.NoError(t, db.Create(session).Error)
+
+		require.NoError(t, repo.DisconnectFromSpace(ctx, project.ID, session.ID))
+
+		stored := &model.Session{ID: session.ID}
+		_, err := repo.Get(ctx, stored)
+		require.NoError(t, err)
+		assert.Nil(t, stored.SpaceID)
+		assert.Empty(t, stored.LearningStatus)
+
+		sessions, err := repo.ListWithCursor(ctx, ListSessionsQuery{ProjectID: project.ID, NotConnected: true, SortBy: model.SessionSortCreatedAt, Limit: 100})
+		require.NoError(t, err)
+		ids := make([]uuid.UUID, 0, len(sessions))
+		for _, s := range sessions {
+			ids = append(ids, s.ID)
+		}
+		assert.Contains(t, ids, session.ID)
+	})
+
+	t.Run("returns error when session is in another project", func(t *testing.T) {
+		session := &model.Session{ID: uuid.New(), ProjectID: project.ID, SpaceID: &space.ID}
+		require.NoError(t, db.Create(session).Error)
+
+		err := repo.DisconnectFromSpace(ctx, uuid.New(), session.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		stored := &model.Session{ID: session.ID}
+		_, err = repo.Get(ctx, stored)
+		require.NoError(t, err)
+		assert.Equal(t, &space.ID, stored.SpaceID)
+	})
+}
+
+// TestSessionRepo_Update tests that selected columns are written even when zero
+func TestSessionRepo_Update(t *testing.T) {
+	db := setupSessionTestDB(t)
+	if db == nil {
+		return // Test was skipped
+	}
+
+	logger, _ := zap.NewDevelopment()
+	repo := NewSessionRepo(db, nil, nil, logger)
+	ctx := context.Background()
+
+	project := &model.Project{
+		ID:               uuid.New(),
+		SecretKeyHMAC:    "test_hmac_update",
+		SecretKeyHashPHC: "test_hash_update",
+	}
+	require.NoError(t, db.Create(project).Error)
+	defer cleanupSessionTestDB(t, db, project.ID)
+
+	space := &model.Space{ID: uuid.New(), ProjectID: project.ID}
+	require.NoError(t, db.Create(space).Error)
+
+	newSession := func(t *testing.T) *model.Session {
+		session := &model.Session{
+			ID:        uuid.New(),
+			ProjectID: project.ID,
+			SpaceID:   &space.ID,
+			Configs:   datatypes.JSONMap{"mode": "test"},
+		}
+		require.NoError(t, db.Create(session).Error)
+		return session
+	}
+
+	t.Run("sets space_id to NULL", func(t *testing.T) {
+		session := newSession(t)
+
+		require.NoError(t, repo.Update(ctx, &model.Session{ID: session.ID, SpaceID: nil}, "space_id"))
+
+		stored, err := repo.Get(ctx, &model.Session{ID: session.ID})
+		require.NoError(t, err)
+		assert.Nil(t, stored.SpaceID)
+		assert.Equal(t, "test", stored.Configs["mode"], "unselected columns are left untouched")
+	})
+
+	t.Run("clears configs", func(t *testing.T) {
+		session := newSession(t)
+
+		require.NoError(t, repo.Update(ctx, &model.Session{ID: session.ID, Configs: datatypes.JSONMap{}}, "configs"))
+
+		stored, err := repo.Get(ctx, &model.Session{ID: session.ID})
+		require.NoError(t, err)
+		assert.Empty(t, stored.Configs)
+		assert.Equal(t, &space.ID, stored.SpaceID, "unselected columns are left untouched")
+	})
+
+	t.Run("without columns skips zero fields", func(t *testing.T) {
+		session := newSession(t)
+
+		require.NoError(t, repo.Update(ctx, &model.Session{ID: session.ID, DisableTaskTracking: true}))
+
+		stored, err := repo.Get(ctx, &model.Session{ID: session.ID})
+		require.NoError(t, err)
+		assert.True(t, stored.DisableTaskTracking)
+		assert.Equal(t, &space.ID, stored.SpaceID)
+		assert.Equal(t, "test", stored.Configs["mode"])
+	})
+}
+
+// TestSessionRepo_GetOrCreateByClientID tests that a client session id creates a single session per project
+func TestSessionRepo_GetOrCreateByClientID(t *testing.T) {
+	db := setupSessionTestDB(t)
+	if db == nil {
+		return // Test was skipped
+	}
+
+	logger, _ := zap.NewDevelopment()
+	repo := NewSessionRepo(db, nil, nil, logger)
+	ctx := context.Background()
+
+	project := &model.Project{
+		ID:               uuid.New(),
+		SecretKeyHMAC:    "test_hmac_client_id",
+		SecretKeyHashPHC: "test_hash_client_id",
+	}
+	require.NoError(t, db.Create(project).Error)
+	defer cleanupSessionTestDB(t, db, project.ID)
+
+	clientID := "chat-" + uuid.NewString()
+
+	first := &model.Session{ProjectID: project.ID, ClientSessionID: &clientID, Configs: datatypes.JSONMap{"mode": "first"}}
+	created, err := repo.GetOrCreateByClientID(ctx, first)
+	require.NoError(t, err)
+	assert.True(t, created)
+	require.NotEqual(t, uuid.Nil, first.ID)
+
+	retry := &model.Session{ProjectID: project.ID, ClientSessionID: &clientID, Configs: datatypes.JSONMap{"mode": "retry"}}
+	created, err = repo.GetOrCreateByClientID(ctx, retry)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, first.ID, retry.ID)
+	assert.Equal(t, "first", retry.Configs["mode"], "the existing session is returned as is")
+
+	var count int64
+	require.NoError(t, db.Model(&model.Session{}).Where("project_id = ? AND client_session_id = ?", project.ID, clientID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// sessions without a client session id are never deduplicated
+	require.NoError(t, repo.Create(ctx, &model.Session{ProjectID: project.ID}))
+	require.NoError(t, repo.Create(ctx, &model.Session{ProjectID: project.ID}))
+}
+
+// TestSessionRepo_CountMessagesByBucket tests that buckets are truncated in UTC whatever the session time zone
+func TestSessionRepo_CountMessagesByBucket(t *testing.T) {
+	db := setupSessionTestDB(t)
+	if db == nil {
+		return // Test was skipped
+	}
+	require.NoError(t, db.AutoMigrate(&model.Message{}))
+
+	// a single connection, so that the time zone set below applies to the queries of the repo
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.Exec("SET TIME ZONE 'Asia/Tokyo'").Error)
+	defer db.Exec("SET TIME ZONE 'UTC'")
+
+	logger, _ := zap.NewDevelopment()
+	repo := NewSessionRepo(db, nil, nil, logger)
+	ctx := context.Background()
+
+	project := &model.Project{
+		ID:               uuid.New(),
+		SecretKeyHMAC:    "test_hmac_buckets",
+		SecretKeyHashPHC: "test_hash_buckets",
+	}
+	require.NoError(t, db.Create(project).Error)
+	defer cleanupSessionTestDB(t, db, project.ID)
+
+	session := &model.Session{ID: uuid.New(), ProjectID: project.ID}
+	require.NoError(t, db.Create(session).Error)
+
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	// 20:00 UTC is already the next day in Tokyo
+	for _, at := range []time.Time{day.Add(time.Hour), day.Add(20 * time.Hour), day.Add(30 * time.Hour)} {
+		msg := &model.Message{SessionID: session.ID, Role: "user", PartsAssetMeta: datatypes.NewJSONType(model.Asset{}), CreatedAt: at}
+		require.NoError(t, db.Create(msg).Error)
+	}
+
+	buckets, err := repo.CountMessagesByBucket(ctx, session.ID, "day", day, day.Add(48*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, buckets, 2)
+	assert.True(t, day.Equal(buckets[0].Start), "got %s", buckets[0].Start)
+	assert.Equal(t, int64(2), buckets[0].Count)
+	assert.True(t, day.Add(24*time.Hour).Equal(buckets[1].Start), "got %s", buckets[1].Start)
+	assert.Equal(t, int64(1), buckets[1].Count)
+}
+
+// TestSessionRepo_ListWithCursor_WithSpace loads the Space of listed sessions, also for the computed
+// sort keys that list from a subquery aliased as sessions
+func TestSessionRepo_ListWithCursor_WithSpace(t *testing.T) {
+	db := setupSessionTestDB(t)
+	if db == nil {
+		return // Test was skipped
+	}
+	require.NoError(t, db.AutoMigrate(&model.Message{}))
+
+	logger, _ := zap.NewDevelopment()
+	repo := NewSessionRepo(db, nil, nil, logger)
+	ctx := context.Background()
+
+	project := &model.Project{
+		ID:               uuid.New(),
+		SecretKeyHMAC:    "test_hmac_with_space",
+		SecretKeyHashPHC: "test_hash_with_space",
+	}
+	require.NoError(t, db.Create(project).Error)
+	defer cleanupSessionTestDB(t, db, project.ID)
+
+	space := &model.Space{ID: uuid.New(), ProjectID: project.ID}
+	require.NoError(t, db.Create(space).Error)
+
+	connected := &model.Session{ID: uuid.New(), ProjectID: project.ID, SpaceID: &space.ID}
+	notConnected := &model.Session{ID: uuid.New(), ProjectID: project.ID}
+	require.NoError(t, db.Create(connected).Error)
+	require.NoError(t, db.Create(notConnected).Error)
+	msg := &model.Message{SessionID: connected.ID, Role: "user", PartsAssetMeta: datatypes.NewJSONType(model.Asset{})}
+	require.NoError(t, db.Create(msg).Error)
+
+	for _, sortBy := range []string{model.SessionSortCreatedAt, model.SessionSortLastMessageAt, model.SessionSortMessageCount} {
+		t.Run(sortBy, func(t *testing.T) {
+			sessions, err := repo.ListWithCursor(ctx, ListSessionsQuery{ProjectID: project.ID, SortBy: sortBy, Limit: 10, TimeDesc: true, WithSpace: true})
+			require.NoError(t, err)
+			require.Len(t, sessions, 2)
+
+			byID := map[uuid.UUID]model.Session{}
+			for _, s := range sessions {
+				byID[s.ID] = s
+			}
+			require.NotNil(t, byID[connected.ID].Space)
+			assert.Equal(t, space.ID, byID[connected.ID].Space.ID)
+			assert.Nil(t, byID[notConnected.ID].Space)
+
+			switch sortBy {
+			case model.SessionSortLastMessageAt:
+				assert.NotNil(t, byID[connected.ID].LastMessageAt)
+			case model.SessionSortMessageCount:
+				require.NotNil(t, byID[connected.ID].MessageCount)
+				assert.Equal(t, int64(1), *byID[connected.ID].MessageCount)
+			}
+		})
+	}
+
+	sessions, err := repo.ListWithCursor(ctx, ListSessionsQuery{ProjectID: project.ID, SortBy: model.SessionSortMessageCount, Limit: 10})
+	require.NoError(t, err)
+	for _, s := range sessions {
+		assert.Nil(t, s.Space, "the space is only loaded with WithSpace")
+	}
+}
+
+func TestSessionRepo_SyncLearningStatus(t *testing.T) {
+	db := setupSessionTestDB(t)
+	if db == nil {
+		return // Test was skipped
+	}
+	require.NoError(t, db.AutoMigrate(&model.Task{}))
+
+	logger, _ := zap.NewDevelopment()
+	repo := NewSessionRepo(db, nil, nil, logger)
+	ctx := context.Background()
+
+	project := &model.Project{
+		ID:               uuid.New(),
+		SecretKeyHMAC:    "test_hmac_sync_status",
+		SecretKeyHashPHC: "test_hash_sync_status",
+	}
+	require.NoError(t, db.Create(project).Error)
+	defer cleanupSessionTestDB(t, db, project.ID)
+	defer db.Exec("DELETE FROM tasks WHERE project_id = ?", project.ID)
+
+	space := &model.Space{ID: uuid.New(), ProjectID: project.ID}
+	require.NoError(t, db.Create(space).Error)
+
+	pending := &model.Session{ID: uuid.New(), ProjectID: project.ID, SpaceID: &space.ID}
+	digested := &model.Session{ID: uuid.New(), ProjectID: project.ID, SpaceID: &space.ID}
+	notConnected := &model.Session{ID: uuid.New(), ProjectID: project.ID}
+	for _, s := range []*model.Session{pending, digested, notConnected} {
+		require.NoError(t, db.Create(s).Error)
+	}
+	task := &model.Task{SessionID: pending.ID, ProjectID: project.ID, Order: 1}
+	require.NoError(t, db.Create(task).Error)
+
+	status := func(id uuid.UUID) model.Session {
+		var s model.Session
+		require.NoError(t, db.Where("id = ?", id).First(&s).Error)
+		return s
+	}
+
+	n, err := repo.SyncLearningStatus(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, int64(2))
+	assert.Equal(t, model.LearningStatusPending, status(pending.ID).LearningStatus)
+	assert.Equal(t, model.LearningStatusDigested, status(digested.ID).LearningStatus)
+	assert.Empty(t, status(notConnected.ID).LearningStatus)
+	assert.Nil(t, status(notConnected.ID).LearningStatusSyncedAt, "unchanged sessions are not written")
+
+	// nothing changed since, so nothing is written
+	syncedAt := status(pending.ID).LearningStatusSyncedAt
+	n, err = repo.SyncLearningStatus(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Equal(t, syncedAt.UnixMicro(), status(pending.ID).LearningStatusSyncedAt.UnixMicro())
+
+	require.NoError(t, db.Model(task).Update("space_digested", true).Error)
+	n, err = repo.SyncLearningStatus(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, model.LearningStatusDigested, status(pending.ID).LearningStatus)
+}
+
+// TestSessionRepo_SearchMessagesByProject matches the search text only, and lists the messages without one
+// for the backfill
+func TestSessionRepo_SearchMessagesByProject(t *testing.T) {
+	db := setupSessionTestDB(t)
+	if db == nil {
+		return // Test was skipped
+	}
+	require.NoError(t, db.AutoMigrate(&model.Message{}))
+
+	logger, _ := zap.NewDevelopment()
+	repo := NewSessionRepo(db, nil, nil, logger)
+	ctx := context.Background()
+
+	project := &model.Project{
+		ID:               uuid.New(),
+		SecretKeyHMAC:    "test_hmac_search",
+		SecretKeyHashPHC: "test_hash_search",
+	}
+	require.NoError(t, db.Create(project).Error)
+	defer cleanupSessionTestDB(t, db, project.ID)
+	defer db.Exec("DELETE FROM messages WHERE session_id IN (SELECT id FROM sessions WHERE project_id = ?)", project.ID)
+
+	session := &model.Session{ID: uuid.New(), ProjectID: project.ID}
+	require.NoError(t, db.Create(session).Error)
+
+	matching, other := "ready to 100% deploy", "nothing to see"
+	at := time.Now().Add(-time.Hour)
+	stored := &model.Message{SessionID: session.ID, Role: "user", PartsAssetMeta: datatypes.NewJSONType(model.Asset{}), SearchText: &matching, CreatedAt: at}
+	unrelated := &model.Message{SessionID: session.ID, Role: "user", PartsAssetMeta: datatypes.NewJSONType(model.Asset{}), SearchText: &other, CreatedAt: at.Add(time.Second)}
+	legacy := &model.Message{SessionID: session.ID, Role: "user", PartsAssetMeta: datatypes.NewJSONType(model.Asset{}), CreatedAt: at.Add(2 * time.Second)}
+	for _, m := range []*model.Message{stored, unrelated, legacy} {
+		require.NoError(t, db.Create(m).Error)
+	}
+
+	msgs, err := repo.SearchMessagesByProject(ctx, project.ID, "DEPLOY", time.Time{}, uuid.Nil, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, stored.ID, msgs[0].ID)
+
+	msgs, err = repo.SearchMessagesByProject(ctx, project.ID, "0% d", time.Time{}, uuid.Nil, 10)
+	require.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	msgs, err = repo.SearchMessagesByProject(ctx, project.ID, "_", time.Time{}, uuid.Nil, 10)
+	require.NoError(t, err)
+	assert.Empty(t, msgs, "LIKE wildcards are matched literally")
+
+	missing, err := repo.ListMessagesWithoutSearchText(ctx, at.Add(-time.Second), uuid.Max, 10)
+	require.NoError(t, err)
+	ids := make([]uuid.UUID, 0, len(missing))
+	for _, m := range missing {
+		ids = append(ids, m.ID)
+	}
+	assert.Contains(t, ids, legacy.ID)
+	assert.NotContains(t, ids, stored.ID)
+
+	require.NoError(t, repo.SetMessageSearchText(ctx, legacy.ID, "deploy on Friday"))
+	msgs, err = repo.SearchMessagesByProject(ctx, project.ID, "deploy", time.Time{}, uuid.Nil, 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, legacy.ID, msgs[0].ID)
+}
@@ -7,17 +7,20 @@ import (
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SpaceRepo interface {
 	Create(ctx context.Context, s *model.Space) error
+	CreateWithLimit(ctx context.Context, s *model.Space, maxSpaces int) (bool, error)
 	Delete(ctx context.Context, s *model.Space) error
-	Update(ctx context.Context, s *model.Space) error
+	Update(ctx context.Context, s *model.Space, columns ...string) error
 	Get(ctx context.Context, s *model.Space) (*model.Space, error)
 	ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Space, error)
 	ListExperienceConfirmationsWithCursor(ctx context.Context, spaceID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.ExperienceConfirmation, error)
 	GetExperienceConfirmation(ctx context.Context, spaceID uuid.UUID, experienceID uuid.UUID) (*model.ExperienceConfirmation, error)
 	DeleteExperienceConfirmation(ctx context.Context, spaceID uuid.UUID, experienceID uuid.UUID) error
+	ListSessionsWithCursor(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Session, error)
 }
 
 type spaceRepo struct{ db *gorm.DB }
@@ -30,12 +33,46 @@ func (r *spaceRepo) Create(ctx context.Context, s *model.Space) error {
 	return r.db.WithContext(ctx).Create(s).Error
 }
 
+// CreateWithLimit creates the space unless its project already has maxSpaces spaces, reporting
+// whether it was created. The project row is locked while counting, so concurrent creates
+// cannot overshoot the limit.
+func (r *spaceRepo) CreateWithLimit(ctx context.Context, s *model.Space, maxSpaces int) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var p model.Project
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where(&model.Project{ID: s.ProjectID}).First(&p).Error; err != nil {
+			return err
+		}
+
+		var n int64
+		if err := tx.Model(&model.Space{}).Where("project_id = ?", s.ProjectID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n >= int64(maxSpaces) {
+			return nil
+		}
+
+		if err := tx.Create(s).Error; err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
+
 func (r *spaceRepo) Delete(ctx context.Context, s *model.Space) error {
 	return r.db.WithContext(ctx).Delete(s).Error
 }
 
-func (r *spaceRepo) Update(ctx context.Context, s *model.Space) error {
-	return r.db.WithContext(ctx).Where(&model.Space{ID: s.ID}).Updates(s).Error
+// Update writes the given columns of s, including zero values such as empty configs.
+// Without columns only the non-zero fields of s are written, as gorm does for struct updates.
+func (r *spaceRepo) Update(ctx context.Context, s *model.Space, columns ...string) error {
+	q := r.db.WithContext(ctx).Where(&model.Space{ID: s.ID})
+	if len(columns) > 0 {
+		q = q.Select(columns)
+	}
+	return q.Updates(s).Error
 }
 
 func (r *spaceRepo) Get(ctx context.Context, s *model.Space) (*model.Space, error) {
@@ -110,3 +147,17 @@ func (r *spaceRepo) DeleteExperienceConfirmation(ctx context.Context, spaceID uu
 		Where("id = ? AND space_id = ?", experienceID, spaceID).
 		Delete(&model.ExperienceConfirmation{}).Error
 }
+
+// ListSessionsWithCursor lists the project's sessions connected to the space, oldest first, after the
+// (created_at, id) cursor when given. Only their IDs and creation times are loaded.
+func (r *spaceRepo) ListSessionsWithCursor(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Session, error) {
+	q := r.db.WithContext(ctx).
+		Select("id", "created_at").
+		Where("project_id = ? AND space_id = ?", projectID, spaceID)
+	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+		q = q.Where("(created_at > ?) OR (created_at = ? AND id > ?)", afterCreatedAt, afterCreatedAt, afterID)
+	}
+
+	var sessions []model.Session
+	return sessions, q.Order("created_at ASC, id ASC").Limit(limit).Find(&sessions).Error
+}
@@ -1,11 +1,14 @@
 package serializer
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+
+	"github.com/memodb-io/Acontext/internal/pkg/strictquery"
 )
 
 var logger *zap.Logger
@@ -60,6 +63,11 @@ func DBErr(msg string, err error) Response {
 
 // ParamErr
 func ParamErr(msg string, err error) Response {
+	// unknown query parameters are listed in the message, as the error detail is hidden in release mode
+	var unknown *strictquery.UnknownParamsError
+	if msg == "" && errors.As(err, &unknown) {
+		msg = unknown.Error()
+	}
 	if msg == "" {
 		msg = "parameter error"
 	}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/memodb-io/Acontext/internal/pkg/strictquery"
 )
 
 func TestErr(t *testing.T) {
@@ -152,6 +154,12 @@ func TestParamErr(t *testing.T) {
 			err:     nil,
 			wantMsg: "missing required field",
 		},
+		{
+			name:    "unknown query parameters are listed",
+			msg:     "",
+			err:     &strictquery.UnknownParamsError{Params: []string{"fromat"}},
+			wantMsg: "unknown query parameters: fromat",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/secrets"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/tokens"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidScope is returned by Create for a scope other than read, write and admin
+	ErrInvalidScope = errors.New("scope must be read, write or admin")
+	// ErrAPIKeyNotFound is returned by Revoke and Rotate for a key unknown to the project, revoked or expired
+	ErrAPIKeyNotFound = errors.New("api key not found")
+)
+
+// apiKeySecretBytes is the size of the random secret of a new API key
+const apiKeySecretBytes = 32
+
+type APIKeyService interface {
+	Create(ctx context.Context, in CreateAPIKeyInput) (*CreateAPIKeyOutput, error)
+	List(ctx context.Context, projectID uuid.UUID) ([]model.APIKey, error)
+	Revoke(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) error
+	Rotate(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) (*CreateAPIKeyOutput, error)
+
+	// MarkUsed records that a key was used at, without writing it until FlushLastUsed
+	MarkUsed(keyID uuid.UUID, at time.Time)
+	FlushLastUsed(ctx context.Context) (int, error)
+}
+
+type CreateAPIKeyInput struct {
+	ProjectID uuid.UUID
+	Name      string
+	Scope     string
+	ExpiresAt *time.Time // nil never expires
+}
+
+// CreateAPIKeyOutput is a new API key with its token, which is not returned again
+type CreateAPIKeyOutput struct {
+	model.APIKey
+	Token string `json:"token"`
+}
+
+type apiKeyService struct {
+	r   repo.APIKeyRepo
+	cfg *config.Config
+
+	mu       sync.Mutex
+	lastUsed map[uuid.UUID]time.Time
+}
+
+func NewAPIKeyService(r repo.APIKeyRepo, cfg *config.Config) APIKeyService {
+	return &apiKeyService{r: r, cfg: cfg, lastUsed: map[uuid.UUID]time.Time{}}
+}
+
+// Create generates an API key, its token is made like project tokens of the project bearer token prefix and a random secret
+func (s *apiKeyService) Create(ctx context.Context, in CreateAPIKeyInput) (*CreateAPIKeyOutput, error) {
+	if !model.ValidScope(in.Scope) {
+		return nil, ErrInvalidScope
+	}
+
+	out, err := s.newKey(in)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.r.Create(ctx, &out.APIKey); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// newKey generates an API key with a new secret, without storing it
+func (s *apiKeyService) newKey(in CreateAPIKeyInput) (*CreateAPIKeyOutput, error) {
+	raw := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("generate secret: %w", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+
+	phc, err := secrets.HashSecret(secret, s.cfg.Root.SecretPepper)
+	if err != nil {
+		return nil, fmt.Errorf("hash secret: %w", err)
+	}
+
+	key := model.APIKey{
+		ProjectID:        in.ProjectID,
+		Name:             in.Name,
+		Scope:            in.Scope,
+		SecretKeyHMAC:    tokens.HMAC256Hex(s.cfg.Root.SecretPepper, secret),
+		SecretKeyHashPHC: phc,
+		CreatedAt:        time.Now(),
+		ExpiresAt:        in.ExpiresAt,
+	}
+	return &CreateAPIKeyOutput{APIKey: key, Token: s.cfg.Root.ProjectBearerTokenPrefix + secret}, nil
+}
+
+func (s *apiKeyService) List(ctx context.Context, projectID uuid.UUID) ([]model.APIKey, error) {
+	return s.r.ListByProject(ctx, projectID)
+}
+
+// Revoke revokes an API key, requests with its token are rejected from then on
+func (s *apiKeyService) Revoke(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) error {
+	if err := s.r.Revoke(ctx, projectID, keyID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Rotate replaces an API key by a new one of the same name and scope, with the same lifetime if it expires.
+// The previous key stays valid for APIKey.RotationOverlapSec, so that clients can switch to the new token.
+func (s *apiKeyService) Rotate(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) (*CreateAPIKeyOutput, error) {
+	old, err := s.r.Get(ctx, projectID, keyID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	in := CreateAPIKeyInput{ProjectID: projectID, Name: old.Name, Scope: old.Scope}
+	if old.ExpiresAt != nil {
+		expiresAt := now.Add(old.ExpiresAt.Sub(old.CreatedAt))
+		in.ExpiresAt = &expiresAt
+	}
+	out, err := s.newKey(in)
+	if err != nil {
+		return nil, err
+	}
+
+	overlap := time.Duration(s.cfg.APIKey.RotationOverlapSec) * time.Second
+	if err := s.r.Rotate(ctx, old, &out.APIKey, now.Add(overlap)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *apiKeyService) MarkUsed(keyID uuid.UUID, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if at.After(s.lastUsed[keyID]) {
+		s.lastUsed[keyID] = at
+	}
+}
+
+// FlushLastUsed writes the last_used_at recorded by MarkUsed since the previous flush, returning the number of keys.
+// Usage failing to be written is kept for the next flush.
+func (s *apiKeyService) FlushLastUsed(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	lastUsed := s.lastUsed
+	s.lastUsed = map[uuid.UUID]time.Time{}
+	s.mu.Unlock()
+
+	if len(lastUsed) == 0 {
+		return 0, nil
+	}
+	if err := s.r.TouchLastUsed(ctx, lastUsed); err != nil {
+		for id, at := range lastUsed {
+			s.MarkUsed(id, at)
+		}
+		return 0, err
+	}
+	return len(lastUsed), nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/secrets"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// MockAPIKeyRepo is a mock implementation of APIKeyRepo
+type MockAPIKeyRepo struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepo) Create(ctx context.Context, k *model.APIKey) error {
+	args := m.Called(ctx, k)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepo) ListByProject(ctx context.Context, projectID uuid.UUID) ([]model.APIKey, error) {
+	args := m.Called(ctx, projectID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepo) Get(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) (*model.APIKey, error) {
+	args := m.Called(ctx, projectID, keyID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepo) Rotate(ctx context.Context, old *model.APIKey, next *model.APIKey, oldExpiresAt time.Time) error {
+	args := m.Called(ctx, old, next, oldExpiresAt)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepo) TouchLastUsed(ctx context.Context, lastUsed map[uuid.UUID]time.Time) error {
+	args := m.Called(ctx, lastUsed)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepo) Revoke(ctx context.Context, projectID uuid.UUID, keyID uuid.UUID) error {
+	args := m.Called(ctx, projectID, keyID)
+	return args.Error(0)
+}
+
+func testAPIKeyConfig() *config.Config {
+	return &config.Config{
+		Root:   config.RootCfg{ProjectBearerTokenPrefix: "sk-ac-", SecretPepper: "pepper"},
+		APIKey: config.APIKeyCfg{RotationOverlapSec: 3600},
+	}
+}
+
+func TestAPIKeyService_Create(t *testing.T) {
+	ctx := context.Background()
+	cfg := testAPIKeyConfig()
+	projectID := uuid.New()
+
+	t.Run("token is only kept as its hmac and hash", func(t *testing.T) {
+		repo := &MockAPIKeyRepo{}
+		repo.On("Create", ctx, mock.AnythingOfType("*model.APIKey")).Return(nil)
+
+		out, err := NewAPIKeyService(repo, cfg).Create(ctx, CreateAPIKeyInput{ProjectID: projectID, Name: "ci", Scope: model.ScopeRead})
+		require.NoError(t, err)
+
+		secret, ok := tokens.ParseToken(out.Token, cfg.Root.ProjectBearerTokenPrefix)
+		require.True(t, ok)
+		assert.Equal(t, projectID, out.ProjectID)
+		assert.Equal(t, model.ScopeRead, out.Scope)
+		assert.Equal(t, tokens.HMAC256Hex(cfg.Root.SecretPepper, secret), out.SecretKeyHMAC)
+		assert.NotContains(t, out.SecretKeyHashPHC, secret)
+		pass, err := secrets.VerifySecret(secret, cfg.Root.SecretPepper, out.SecretKeyHashPHC)
+		require.NoError(t, err)
+		assert.True(t, pass)
+
+		stored := repo.Calls[0].Arguments.Get(1).(*model.APIKey)
+		assert.Equal(t, out.SecretKeyHMAC, stored.SecretKeyHMAC)
+	})
+
+	t.Run("tokens differ between keys", func(t *testing.T) {
+		repo := &MockAPIKeyRepo{}
+		repo.On("Create", ctx, mock.Anything).Return(nil)
+		s := NewAPIKeyService(repo, cfg)
+
+		a, err := s.Create(ctx, CreateAPIKeyInput{ProjectID: projectID, Scope: model.ScopeWrite})
+		require.NoError(t, err)
+		b, err := s.Create(ctx, CreateAPIKeyInput{ProjectID: projectID, Scope: model.ScopeWrite})
+		require.NoError(t, err)
+		assert.NotEqual(t, a.Token, b.Token)
+		assert.True(t, strings.HasPrefix(a.Token, cfg.Root.ProjectBearerTokenPrefix))
+	})
+
+	t.Run("invalid scope", func(t *testing.T) {
+		repo := &MockAPIKeyRepo{}
+		_, err := NewAPIKeyService(repo, cfg).Create(ctx, CreateAPIKeyInput{ProjectID: projectID, Scope: "owner"})
+		assert.ErrorIs(t, err, ErrInvalidScope)
+		repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAPIKeyService_Revoke(t *testing.T) {
+	ctx := context.Background()
+	projectID, keyID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name        string
+		repoErr     error
+		expectedErr error
+	}{
+		{name: "revoked", repoErr: nil, expectedErr: nil},
+		{name: "unknown or already revoked", repoErr: gorm.ErrRecordNotFound, expectedErr: ErrAPIKeyNotFound},
+		{name: "db error", repoErr: errors.New("db down"), expectedErr: errors.New("db down")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockAPIKeyRepo{}
+			repo.On("Revoke", ctx, projectID, keyID).Return(tt.repoErr)
+
+			err := NewAPIKeyService(repo, testAPIKeyConfig()).Revoke(ctx, projectID, keyID)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			}
+		})
+	}
+}
+
+func TestAPIKeyService_Rotate(t *testing.T) {
+	ctx := context.Background()
+	projectID, keyID := uuid.New(), uuid.New()
+	createdAt := time.Now().Add(-24 * time.Hour)
+	expiresAt := createdAt.Add(30 * 24 * time.Hour)
+
+	t.Run("new key of the same lifetime, old one valid for the overlap", func(t *testing.T) {
+		old := &model.APIKey{ID: keyID, ProjectID: projectID, Name: "ci", Scope: model.ScopeWrite, CreatedAt: createdAt, ExpiresAt: &expiresAt}
+		repo := &MockAPIKeyRepo{}
+		repo.On("Get", ctx, projectID, keyID).Return(old, nil)
+		repo.On("Rotate", ctx, old, mock.AnythingOfType("*model.APIKey"), mock.MatchedBy(func(until time.Time) bool {
+			return time.Until(until) > 59*time.Minute && time.Until(until) <= time.Hour
+		})).Return(nil)
+
+		out, err := NewAPIKeyService(repo, testAPIKeyConfig()).Rotate(ctx, projectID, keyID)
+		require.NoError(t, err)
+		assert.Equal(t, "ci", out.Name)
+		assert.Equal(t, model.ScopeWrite, out.Scope)
+		require.NotNil(t, out.ExpiresAt)
+		assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), *out.ExpiresAt, time.Minute)
+		assert.NotEmpty(t, out.Token)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("revoked or expired", func(t *testing.T) {
+		repo := &MockAPIKeyRepo{}
+		repo.On("Get", ctx, projectID, keyID).Return(nil, gorm.ErrRecordNotFound)
+
+		_, err := NewAPIKeyService(repo, testAPIKeyConfig()).Rotate(ctx, projectID, keyID)
+		assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+	})
+}
+
+func TestAPIKeyService_FlushLastUsed(t *testing.T) {
+	ctx := context.Background()
+	a, b := uuid.New(), uuid.New()
+	t0 := time.Now()
+
+	repo := &MockAPIKeyRepo{}
+	s := NewAPIKeyService(repo, testAPIKeyConfig())
+
+	n, err := s.FlushLastUsed(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n, "nothing to write")
+
+	s.MarkUsed(a, t0)
+	s.MarkUsed(a, t0.Add(-time.Second)) // out of order, kept at the latest use
+	s.MarkUsed(b, t0)
+
+	want := map[uuid.UUID]time.Time{a: t0, b: t0}
+	repo.On("TouchLastUsed", ctx, want).Return(errors.New("db down")).Once()
+	_, err = s.FlushLastUsed(ctx)
+	assert.Error(t, err)
+
+	// kept for the next flush
+	repo.On("TouchLastUsed", ctx, want).Return(nil).Once()
+	n, err = s.FlushLastUsed(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	repo.AssertExpectations(t)
+}
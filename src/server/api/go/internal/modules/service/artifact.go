@@ -28,10 +28,10 @@ type ArtifactService interface {
 
 type artifactService struct {
 	r  repo.ArtifactRepo
-	s3 *blob.S3Deps
+	s3 blob.Store
 }
 
-func NewArtifactService(r repo.ArtifactRepo, s3 *blob.S3Deps) ArtifactService {
+func NewArtifactService(r repo.ArtifactRepo, s3 blob.Store) ArtifactService {
 	return &artifactService{r: r, s3: s3}
 }
 
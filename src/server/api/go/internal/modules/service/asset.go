@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+	"github.com/memodb-io/Acontext/internal/pkg/requestid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrAssetGCRunning is returned by GC while another run is in progress on this instance
+var ErrAssetGCRunning = errors.New("asset gc is already running")
+
+var (
+	// ErrInvalidScanStatus is returned by SetScanStatus for a status other than clean or infected
+	ErrInvalidScanStatus = errors.New("scan status must be clean or infected")
+	// ErrAssetNotFound is returned for an asset unknown to the project
+	ErrAssetNotFound = errors.New("asset not found")
+	// ErrAssetInUse is returned by Delete for an asset still referenced by messages or artifacts
+	ErrAssetInUse = errors.New("asset is still referenced")
+)
+
+// validScanResult reports whether status is a final scan verdict
+func validScanResult(status string) bool {
+	return status == model.ScanStatusClean || status == model.ScanStatusInfected
+}
+
+// assetKeyPrefixes are the S3 key prefixes of objects tracked by asset references,
+// they must match the prefixes used when uploading message files, message parts and artifacts
+var assetKeyPrefixes = []string{"assets/", "parts/", "disks/"}
+
+const (
+	// assetGCBatchSize bounds the unreferenced rows purged per run and the keys checked per query
+	assetGCBatchSize = 500
+)
+
+type AssetService interface {
+	GC(ctx context.Context) (*AssetGCResult, error)
+	SetScanStatus(ctx context.Context, projectID uuid.UUID, sha256 string, status string) error
+	List(ctx context.Context, in ListAssetsInput) (*ListAssetsOutput, error)
+	Get(ctx context.Context, projectID uuid.UUID, sha256 string, expire time.Duration) (*AssetDetail, error)
+	Delete(ctx context.Context, projectID uuid.UUID, sha256 string) error
+}
+
+// AssetInfo describes an asset stored for a project
+type AssetInfo struct {
+	SHA256      string    `json:"sha256"`
+	SizeB       int64     `json:"size_b"`
+	ContentType string    `json:"content_type"`
+	RefCount    int       `json:"ref_count"`
+	ScanStatus  string    `json:"scan_status,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newAssetInfo(ref model.AssetReference) AssetInfo {
+	meta := ref.AssetMeta.Data()
+	return AssetInfo{
+		SHA256:      ref.SHA256,
+		SizeB:       meta.SizeB,
+		ContentType: meta.MIME,
+		RefCount:    ref.RefCount,
+		ScanStatus:  ref.ScanStatus,
+		CreatedAt:   ref.CreatedAt,
+	}
+}
+
+// AssetDetail is an asset with a url to download it.
+// Quarantined assets, reported infected by the malware scanner, have no url.
+type AssetDetail struct {
+	AssetInfo
+	PublicURL   *PublicURL `json:"public_url,omitempty"`
+	Quarantined bool       `json:"quarantined,omitempty"`
+}
+
+type ListAssetsInput struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	Limit     int       `json:"limit"`
+	Cursor    string    `json:"cursor"`
+	TimeDesc  bool      `json:"time_desc"`
+}
+
+type ListAssetsOutput struct {
+	Items      []AssetInfo `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	HasMore    bool        `json:"has_more"`
+}
+
+// AssetGCResult summarizes an orphaned asset purge
+type AssetGCResult struct {
+	// PurgedAssets is the number of unreferenced assets whose object and reference row were deleted
+	PurgedAssets int `json:"purged_assets"`
+	// FailedAssets is the number of unreferenced assets that could not be purged, they are retried on the next run
+	FailedAssets int `json:"failed_assets"`
+	// UntrackedObjects is the number of S3 objects without a reference row, they are logged but kept
+	UntrackedObjects int `json:"untracked_objects"`
+}
+
+// objectStore is the part of blob.Store used by the asset service
+type objectStore interface {
+	presigner
+	ListObjects(ctx context.Context, prefix string, fn func(key string, lastModified time.Time) error) error
+	DeleteObject(ctx context.Context, key string) error
+}
+
+type assetService struct {
+	r      repo.AssetReferenceRepo
+	s3     objectStore
+	minAge time.Duration
+	log    *zap.Logger
+
+	running sync.Mutex
+}
+
+func NewAssetService(r repo.AssetReferenceRepo, s3 blob.Store, cfg *config.Config, log *zap.Logger) AssetService {
+	return &assetService{
+		r:      r,
+		s3:     s3,
+		minAge: time.Duration(cfg.Asset.GCMinAgeHours) * time.Hour,
+		log:    log,
+	}
+}
+
+// GC reconciles S3 with the asset references: it deletes the objects and rows of assets left with
+// no references, and logs objects under the asset prefixes that no reference row points to,
+// e.g. after a crash between an upload and its reference increment. Assets changed within the
+// configured minimum age are left alone so in-flight uploads are not mistaken for orphans.
+func (s *assetService) GC(ctx context.Context) (*AssetGCResult, error) {
+	if !s.running.TryLock() {
+		return nil, ErrAssetGCRunning
+	}
+	defer s.running.Unlock()
+
+	cutoff := time.Now().Add(-s.minAge)
+	out := &AssetGCResult{}
+
+	refs, err := s.r.ListUnreferenced(ctx, cutoff, assetGCBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("list unreferenced assets: %w", err)
+	}
+	for _, ref := range refs {
+		// delete the row first, and only while it is still unreferenced and old enough, so that an upload
+		// reusing the asset meanwhile either keeps it or finds no row to reuse
+		key, err := s.r.DeleteUnreferenced(ctx, ref.ID, cutoff)
+		if err != nil {
+			requestid.Logger(ctx, s.log).Sugar().Warnw("failed to delete unreferenced asset reference", "s3_key", ref.S3Key, "err", err)
+			out.FailedAssets++
+			continue
+		}
+		if key == "" {
+			requestid.Logger(ctx, s.log).Sugar().Warnw("asset was referenced again while being purged", "s3_key", ref.S3Key)
+			continue
+		}
+		if err := s.deleteObject(ctx, key); err != nil {
+			out.FailedAssets++
+			continue
+		}
+		out.PurgedAssets++
+	}
+
+	for _, prefix := range assetKeyPrefixes {
+		n, err := s.reportUntracked(ctx, prefix, cutoff)
+		out.UntrackedObjects += n
+		if err != nil {
+			return out, err
+		}
+	}
+
+	return out, nil
+}
+
+// SetScanStatus records the verdict a malware scanner posted back for an asset.
+// Infected assets are quarantined: no public url is generated for them anymore.
+func (s *assetService) SetScanStatus(ctx context.Context, projectID uuid.UUID, sha256 string, status string) error {
+	if !validScanResult(status) {
+		return ErrInvalidScanStatus
+	}
+	if err := s.r.SetScanStatus(ctx, projectID, sha256, status); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAssetNotFound
+		}
+		return err
+	}
+	if status == model.ScanStatusInfected {
+		requestid.Logger(ctx, s.log).Sugar().Warnw("asset quarantined as infected", "project_id", projectID, "sha256", sha256)
+	}
+	return nil
+}
+
+func (s *assetService) List(ctx context.Context, in ListAssetsInput) (*ListAssetsOutput, error) {
+	// Parse cursor (createdAt, id); an empty cursor indicates starting from the beginning
+	var afterT time.Time
+	var afterID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Query limit+1 is used to determine has_more
+	refs, err := s.r.ListWithCursor(ctx, in.ProjectID, afterT, afterID, in.Limit+1, in.TimeDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListAssetsOutput{Items: make([]AssetInfo, 0, len(refs))}
+	if len(refs) > in.Limit {
+		out.HasMore = true
+		refs = refs[:in.Limit]
+		last := refs[len(refs)-1]
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, ref := range refs {
+		out.Items = append(out.Items, newAssetInfo(ref))
+	}
+	return out, nil
+}
+
+// Get returns the asset of the project with the given content hash and a url to download it valid for expire
+func (s *assetService) Get(ctx context.Context, projectID uuid.UUID, sha256 string, expire time.Duration) (*AssetDetail, error) {
+	ref, err := s.r.Get(ctx, projectID, sha256)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAssetNotFound
+		}
+		return nil, err
+	}
+
+	out := &AssetDetail{AssetInfo: newAssetInfo(*ref)}
+	if ref.ScanStatus == model.ScanStatusInfected {
+		out.Quarantined = true
+		return out, nil
+	}
+
+	asset := ref.AssetMeta.Data()
+	asset.S3Key = ref.S3Key
+	publicURL, err := presignPublicURL(ctx, s.s3, asset, expire)
+	if err != nil {
+		return nil, err
+	}
+	out.PublicURL = &publicURL
+	return out, nil
+}
+
+// Delete deletes an asset no message or artifact references anymore, before the gc gets to it.
+// Like the gc, the row is deleted first while it is still unreferenced, then the object.
+func (s *assetService) Delete(ctx context.Context, projectID uuid.UUID, sha256 string) error {
+	ref, err := s.r.Get(ctx, projectID, sha256)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAssetNotFound
+		}
+		return err
+	}
+	if !ref.IsOrphaned() {
+		return ErrAssetInUse
+	}
+
+	key, err := s.r.DeleteUnreferenced(ctx, ref.ID, time.Time{})
+	if err != nil {
+		return fmt.Errorf("delete asset reference: %w", err)
+	}
+	if key == "" {
+		requestid.Logger(ctx, s.log).Sugar().Warnw("asset was referenced again while being deleted", "s3_key", ref.S3Key)
+		return ErrAssetInUse
+	}
+	if err := s.deleteObject(ctx, key); err != nil {
+		return fmt.Errorf("delete asset object: %w", err)
+	}
+	return nil
+}
+
+// deleteObject deletes the object of an asset whose row is already deleted. On failure the object is left
+// untracked, the gc then reports it with the other objects without a reference row.
+func (s *assetService) deleteObject(ctx context.Context, key string) error {
+	if err := s.s3.DeleteObject(ctx, key); err != nil {
+		requestid.Logger(ctx, s.log).Sugar().Warnw("failed to delete the object of a deleted asset reference", "s3_key", key, "err", err)
+		return err
+	}
+	return nil
+}
+
+// reportUntracked logs the objects under prefix last modified before cutoff that have no reference row
+func (s *assetService) reportUntracked(ctx context.Context, prefix string, cutoff time.Time) (int, error) {
+	found := 0
+	batch := make([]string, 0, assetGCBatchSize)
+	flush := func() error {
+		untracked, err := s.r.UntrackedS3Keys(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("check asset references: %w", err)
+		}
+		for _, key := range untracked {
+			requestid.Logger(ctx, s.log).Sugar().Warnw("S3 object has no asset reference", "s3_key", key)
+		}
+		found += len(untracked)
+		batch = batch[:0]
+		return nil
+	}
+
+	err := s.s3.ListObjects(ctx, prefix, func(key string, lastModified time.Time) error {
+		if lastModified.After(cutoff) {
+			return nil
+		}
+		batch = append(batch, key)
+		if len(batch) < assetGCBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && len(batch) > 0 {
+		err = flush()
+	}
+	return found, err
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// fakeObjectStore is an in-memory objectStore keyed by S3 key
+type fakeObjectStore struct {
+	objects map[string]time.Time
+	failOn  map[string]bool
+	deleted []string
+}
+
+func (f *fakeObjectStore) ListObjects(ctx context.Context, prefix string, fn func(key string, lastModified time.Time) error) error {
+	for key, modified := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			if err := fn(key, modified); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fakeObjectStore) DeleteObject(ctx context.Context, key string) error {
+	if f.failOn[key] {
+		return errors.New("access denied")
+	}
+	f.deleted = append(f.deleted, key)
+	delete(f.objects, key)
+	return nil
+}
+
+func (f *fakeObjectStore) PresignGetAs(ctx context.Context, key, contentType string, expire time.Duration) (string, error) {
+	return "https://s3.example.com/" + key + "?response-content-type=" + contentType, nil
+}
+
+func TestAssetService_GC(t *testing.T) {
+	ctx := context.Background()
+	old := time.Now().Add(-48 * time.Hour)
+
+	purged := model.AssetReference{ID: uuid.New(), S3Key: "assets/p1/purged.png"}
+	failing := model.AssetReference{ID: uuid.New(), S3Key: "assets/p1/failing.png"}
+	reused := model.AssetReference{ID: uuid.New(), S3Key: "parts/p1/reused.json"}
+
+	store := &fakeObjectStore{
+		objects: map[string]time.Time{
+			purged.S3Key:            old,
+			failing.S3Key:           old,
+			reused.S3Key:            old,
+			"assets/p1/orphan.png":  old,
+			"assets/p1/fresh.png":   time.Now(),
+			"disks/p1/tracked.pdf":  old,
+			"unrelated/p1/file.txt": old,
+		},
+		failOn: map[string]bool{failing.S3Key: true},
+	}
+
+	r := &MockAssetReferenceRepo{}
+	var cutoff time.Time
+	r.On("ListUnreferenced", ctx, mock.Anything, assetGCBatchSize).
+		Run(func(args mock.Arguments) { cutoff = args.Get(1).(time.Time) }).
+		Return([]model.AssetReference{purged, failing, reused}, nil)
+	// rows are deleted first and only while still unreferenced and older than the cutoff of the listing
+	sameCutoff := mock.MatchedBy(func(at time.Time) bool { return at.Equal(cutoff) })
+	r.On("DeleteUnreferenced", ctx, purged.ID, sameCutoff).Return(purged.S3Key, nil)
+	r.On("DeleteUnreferenced", ctx, failing.ID, sameCutoff).Return(failing.S3Key, nil)
+	r.On("DeleteUnreferenced", ctx, reused.ID, sameCutoff).Return("", nil)
+	r.On("UntrackedS3Keys", ctx, mock.MatchedBy(func(keys []string) bool {
+		// the object whose delete failed is left without a row and reported as untracked
+		sorted := slices.Sorted(slices.Values(keys))
+		return slices.Equal([]string{failing.S3Key, "assets/p1/orphan.png"}, sorted)
+	})).Return([]string{failing.S3Key, "assets/p1/orphan.png"}, nil)
+	r.On("UntrackedS3Keys", ctx, []string{reused.S3Key}).Return(nil, nil)
+	r.On("UntrackedS3Keys", ctx, []string{"disks/p1/tracked.pdf"}).Return(nil, nil)
+
+	svc := &assetService{r: r, s3: store, minAge: 24 * time.Hour, log: zap.NewNop()}
+	out, err := svc.GC(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, &AssetGCResult{PurgedAssets: 1, FailedAssets: 1, UntrackedObjects: 2}, out)
+	assert.Equal(t, []string{purged.S3Key}, store.deleted, "the object of an asset referenced again is kept")
+	assert.Contains(t, store.objects, "assets/p1/orphan.png", "untracked objects are only reported")
+	r.AssertExpectations(t)
+}
+
+func TestAssetService_GC_AlreadyRunning(t *testing.T) {
+	svc := &assetService{r: &MockAssetReferenceRepo{}, s3: &fakeObjectStore{}, log: zap.NewNop()}
+	svc.running.Lock()
+	defer svc.running.Unlock()
+
+	_, err := svc.GC(context.Background())
+	assert.ErrorIs(t, err, ErrAssetGCRunning)
+}
+
+func TestAssetService_SetScanStatus(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sha := strings.Repeat("a", 64)
+
+	r := &MockAssetReferenceRepo{}
+	r.On("SetScanStatus", ctx, projectID, sha, model.ScanStatusInfected).Return(nil)
+	r.On("SetScanStatus", ctx, projectID, sha, model.ScanStatusClean).Return(gorm.ErrRecordNotFound)
+	svc := &assetService{r: r, log: zap.NewNop()}
+
+	assert.NoError(t, svc.SetScanStatus(ctx, projectID, sha, model.ScanStatusInfected))
+	assert.ErrorIs(t, svc.SetScanStatus(ctx, projectID, sha, model.ScanStatusClean), ErrAssetNotFound)
+	assert.ErrorIs(t, svc.SetScanStatus(ctx, projectID, sha, model.ScanStatusPending), ErrInvalidScanStatus)
+	r.AssertExpectations(t)
+}
+
+func TestAssetService_List(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	now := time.Now()
+
+	refs := []model.AssetReference{
+		{ID: uuid.New(), SHA256: "a", RefCount: 2, CreatedAt: now, AssetMeta: datatypes.NewJSONType(model.Asset{MIME: "image/png", SizeB: 10})},
+		{ID: uuid.New(), SHA256: "b", RefCount: 0, CreatedAt: now.Add(time.Second), AssetMeta: datatypes.NewJSONType(model.Asset{MIME: "application/pdf", SizeB: 20})},
+		{ID: uuid.New(), SHA256: "c", RefCount: 1, CreatedAt: now.Add(2 * time.Second)},
+	}
+	r := &MockAssetReferenceRepo{}
+	r.On("ListWithCursor", ctx, projectID, time.Time{}, uuid.Nil, 3, false).Return(refs, nil)
+	svc := &assetService{r: r, log: zap.NewNop()}
+
+	out, err := svc.List(ctx, ListAssetsInput{ProjectID: projectID, Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, out.HasMore)
+	assert.Equal(t, []AssetInfo{
+		{SHA256: "a", SizeB: 10, ContentType: "image/png", RefCount: 2, CreatedAt: now},
+		{SHA256: "b", SizeB: 20, ContentType: "application/pdf", RefCount: 0, CreatedAt: now.Add(time.Second)},
+	}, out.Items)
+
+	afterT, afterID, err := paging.DecodeCursor(out.NextCursor)
+	require.NoError(t, err)
+	assert.True(t, afterT.Equal(refs[1].CreatedAt))
+	assert.Equal(t, refs[1].ID, afterID)
+	r.AssertExpectations(t)
+}
+
+func TestAssetService_Get(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	clean := &model.AssetReference{SHA256: "a", S3Key: "assets/p1/a.png", RefCount: 1, AssetMeta: datatypes.NewJSONType(model.Asset{MIME: "image/png"})}
+	infected := &model.AssetReference{SHA256: "b", S3Key: "assets/p1/b.exe", RefCount: 1, ScanStatus: model.ScanStatusInfected}
+
+	r := &MockAssetReferenceRepo{}
+	r.On("Get", ctx, projectID, "a").Return(clean, nil)
+	r.On("Get", ctx, projectID, "b").Return(infected, nil)
+	r.On("Get", ctx, projectID, "c").Return(nil, gorm.ErrRecordNotFound)
+	svc := &assetService{r: r, s3: &fakeObjectStore{}, log: zap.NewNop()}
+
+	out, err := svc.Get(ctx, projectID, "a", time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, out.PublicURL)
+	assert.Equal(t, "https://s3.example.com/assets/p1/a.png?response-content-type=image/png", out.PublicURL.URL)
+
+	out, err = svc.Get(ctx, projectID, "b", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, out.Quarantined)
+	assert.Nil(t, out.PublicURL, "infected assets get no url")
+
+	_, err = svc.Get(ctx, projectID, "c", time.Hour)
+	assert.ErrorIs(t, err, ErrAssetNotFound)
+	r.AssertExpectations(t)
+}
+
+func TestAssetService_Delete(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	unused := &model.AssetReference{ID: uuid.New(), SHA256: "a", S3Key: "assets/p1/a.png", RefCount: 0}
+	used := &model.AssetReference{ID: uuid.New(), SHA256: "b", S3Key: "assets/p1/b.png", RefCount: 1}
+	raced := &model.AssetReference{ID: uuid.New(), SHA256: "c", S3Key: "assets/p1/c.png", RefCount: 0}
+
+	r := &MockAssetReferenceRepo{}
+	r.On("Get", ctx, projectID, "a").Return(unused, nil)
+	r.On("Get", ctx, projectID, "b").Return(used, nil)
+	r.On("Get", ctx, projectID, "c").Return(raced, nil)
+	r.On("Get", ctx, projectID, "d").Return(nil, gorm.ErrRecordNotFound)
+	r.On("DeleteUnreferenced", ctx, unused.ID, time.Time{}).Return(unused.S3Key, nil)
+	r.On("DeleteUnreferenced", ctx, raced.ID, time.Time{}).Return("", nil)
+	store := &fakeObjectStore{objects: map[string]time.Time{unused.S3Key: time.Now(), used.S3Key: time.Now(), raced.S3Key: time.Now()}}
+	svc := &assetService{r: r, s3: store, log: zap.NewNop()}
+
+	assert.NoError(t, svc.Delete(ctx, projectID, "a"))
+	assert.ErrorIs(t, svc.Delete(ctx, projectID, "b"), ErrAssetInUse)
+	assert.ErrorIs(t, svc.Delete(ctx, projectID, "c"), ErrAssetInUse)
+	assert.ErrorIs(t, svc.Delete(ctx, projectID, "d"), ErrAssetNotFound)
+	assert.Equal(t, []string{unused.S3Key}, store.deleted, "referenced assets are never deleted")
+	assert.Contains(t, store.objects, raced.S3Key, "the object of an asset referenced again is kept")
+	r.AssertExpectations(t)
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/metrics"
+	"github.com/memodb-io/Acontext/internal/pkg/requestid"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+// mqEventClaimLease is how long a claimed event is left alone by other replicas while it is published
+const mqEventClaimLease = time.Minute
+
+// MQPublisher publishes JSON messages to RabbitMQ, implemented by mq.Publisher
+type MQPublisher interface {
+	PublishJSONWithID(ctx context.Context, exchangeName string, routingKey string, messageID string, body any) error
+}
+
+// MQOutboxService publishes RabbitMQ messages through pending_mq_events (the transactional outbox): the event
+// of a change is inserted in the transaction of the change, relayed once it commits, and retried in the
+// background until published, so that it reaches Core even if RabbitMQ or the API fails in between.
+// Delivery is at least once: an event whose publish succeeded but was not recorded is published again,
+// with the event ID as the AMQP message id so that consumers can deduplicate it.
+type MQOutboxService interface {
+	NewEvent(exchangeName string, routingKey string, body any) (*model.PendingMQEvent, error)
+	Relay(ctx context.Context, e *model.PendingMQEvent)
+	RetryPending(ctx context.Context) (*RetryPendingMQEventsOutput, error)
+}
+
+type RetryPendingMQEventsOutput struct {
+	Published int `json:"published"`
+	Failed    int `json:"failed"` // failed again, retried later
+	Dead      int `json:"dead"`   // failed for the last time
+}
+
+type mqOutboxService struct {
+	publisher MQPublisher
+	r         repo.PendingMQEventRepo
+	cfg       *config.Config
+	log       *zap.Logger
+}
+
+func NewMQOutboxService(publisher MQPublisher, r repo.PendingMQEventRepo, cfg *config.Config, log *zap.Logger) MQOutboxService {
+	return &mqOutboxService{publisher: publisher, r: r, cfg: cfg, log: log}
+}
+
+// NewEvent builds the outbox event publishing body, to be inserted in the transaction of the change it reports.
+// It is only due for the background retries after mqEventClaimLease, leaving time to Relay.
+func (s *mqOutboxService) NewEvent(exchangeName string, routingKey string, body any) (*model.PendingMQEvent, error) {
+	b, err := sonic.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal event: %w", err)
+	}
+	return &model.PendingMQEvent{
+		ID:            uuid.New(),
+		Exchange:      exchangeName,
+		RoutingKey:    routingKey,
+		Body:          datatypes.JSON(b),
+		Status:        model.MQEventPending,
+		NextAttemptAt: time.Now().Add(mqEventClaimLease),
+	}, nil
+}
+
+// Relay publishes an event once its transaction committed. An event failing to be published is left
+// to RetryPending, Relay never fails the change the event reports.
+func (s *mqOutboxService) Relay(ctx context.Context, e *model.PendingMQEvent) {
+	// the request may be cancelled already, the change is committed and its event must follow
+	ctx = context.WithoutCancel(ctx)
+	e.Attempts++
+	s.publish(ctx, e)
+}
+
+// RetryPending publishes again the stored messages that are due, up to RabbitMQ.RetryBatchSize, and
+// refreshes the pending events gauge. A message failing RabbitMQ.RetryMaxAttempts times is marked dead.
+func (s *mqOutboxService) RetryPending(ctx context.Context) (*RetryPendingMQEventsOutput, error) {
+	batch := s.cfg.RabbitMQ.RetryBatchSize
+	if batch <= 0 {
+		batch = 100
+	}
+	events, err := s.r.ClaimDue(ctx, time.Now(), mqEventClaimLease, batch)
+	if err != nil {
+		return nil, fmt.Errorf("claim pending events: %w", err)
+	}
+
+	out := &RetryPendingMQEventsOutput{}
+	for _, e := range events {
+		switch s.publish(ctx, &e) {
+		case model.MQEventDone:
+			out.Published++
+		case model.MQEventDead:
+			out.Dead++
+		default:
+			out.Failed++
+		}
+	}
+
+	counts, err := s.r.CountByStatus(ctx)
+	if err != nil {
+		return out, fmt.Errorf("count pending events: %w", err)
+	}
+	for status, n := range counts {
+		metrics.MQPendingEvents.WithLabelValues(status).Set(float64(n))
+	}
+	return out, nil
+}
+
+// publish makes the e.Attempts-th attempt to publish e and records its outcome, returning the new status of e
+func (s *mqOutboxService) publish(ctx context.Context, e *model.PendingMQEvent) string {
+	pubErr := s.publisher.PublishJSONWithID(ctx, e.Exchange, e.RoutingKey, e.ID.String(), e.Body)
+	if pubErr == nil {
+		if err := s.r.Delete(ctx, e.ID); err != nil {
+			// left pending, it is published again once due
+			requestid.Logger(ctx, s.log).Warn("failed to delete published mq event", zap.String("event_id", e.ID.String()), zap.Error(err))
+		}
+		return model.MQEventDone
+	}
+
+	dead := s.cfg.RabbitMQ.RetryMaxAttempts > 0 && e.Attempts >= s.cfg.RabbitMQ.RetryMaxAttempts
+	if err := s.r.MarkFailed(ctx, e.ID, e.Attempts, pubErr.Error(), time.Now().Add(s.backoff(e.Attempts)), dead); err != nil {
+		requestid.Logger(ctx, s.log).Warn("failed to record failed publish", zap.String("event_id", e.ID.String()), zap.Error(err))
+	}
+	if dead {
+		requestid.Logger(ctx, s.log).Error("giving up publishing mq event",
+			zap.String("event_id", e.ID.String()),
+			zap.Int("attempts", e.Attempts),
+			zap.Error(pubErr))
+		return model.MQEventDead
+	}
+	requestid.Logger(ctx, s.log).Warn("failed to publish mq event, retrying later",
+		zap.String("event_id", e.ID.String()),
+		zap.String("exchange", e.Exchange),
+		zap.String("routing_key", e.RoutingKey),
+		zap.Int("attempts", e.Attempts),
+		zap.Error(pubErr))
+	return model.MQEventPending
+}
+
+// backoff is the wait after the attempts-th failed attempt, starting at RetryBackoffSec and doubling up to RetryMaxBackoffSec
+func (s *mqOutboxService) backoff(attempts int) time.Duration {
+	d := time.Duration(max(1, s.cfg.RabbitMQ.RetryBackoffSec)) * time.Second
+	maxBackoff := time.Duration(s.cfg.RabbitMQ.RetryMaxBackoffSec) * time.Second
+	for i := 1; i < attempts && (maxBackoff <= 0 || d < maxBackoff); i++ {
+		d *= 2
+	}
+	if maxBackoff > 0 && d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
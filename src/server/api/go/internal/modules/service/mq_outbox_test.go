@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+)
+
+type MockPendingMQEventRepo struct {
+	mock.Mock
+}
+
+func (m *MockPendingMQEventRepo) Create(ctx context.Context, e *model.PendingMQEvent) error {
+	args := m.Called(ctx, e)
+	return args.Error(0)
+}
+
+func (m *MockPendingMQEventRepo) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.PendingMQEvent, error) {
+	args := m.Called(ctx, now, lease, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.PendingMQEvent), args.Error(1)
+}
+
+func (m *MockPendingMQEventRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockPendingMQEventRepo) MarkFailed(ctx context.Context, id uuid.UUID, attempts int, lastErr string, nextAttemptAt time.Time, dead bool) error {
+	args := m.Called(ctx, id, attempts, lastErr, nextAttemptAt, dead)
+	return args.Error(0)
+}
+
+func (m *MockPendingMQEventRepo) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+func newTestMQOutboxConfig() *config.Config {
+	return &config.Config{RabbitMQ: config.MQCfg{RetryBatchSize: 10, RetryBackoffSec: 5, RetryMaxBackoffSec: 60, RetryMaxAttempts: 3}}
+}
+
+func TestMQOutboxService_NewEvent(t *testing.T) {
+	svc := NewMQOutboxService(&MockPublisher{}, &MockPendingMQEventRepo{}, newTestMQOutboxConfig(), zap.NewNop())
+
+	e, err := svc.NewEvent("session.message", "session.message.insert", map[string]string{"message_id": "m1"})
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, e.ID)
+	assert.Equal(t, "session.message", e.Exchange)
+	assert.Equal(t, "session.message.insert", e.RoutingKey)
+	assert.JSONEq(t, `{"message_id":"m1"}`, string(e.Body))
+	assert.Equal(t, model.MQEventPending, e.Status)
+	assert.Zero(t, e.Attempts)
+	assert.WithinDuration(t, time.Now().Add(mqEventClaimLease), e.NextAttemptAt, time.Second, "left to Relay before the retries")
+
+	_, err = svc.NewEvent("x", "y", func() {})
+	assert.Error(t, err)
+}
+
+func TestMQOutboxService_Relay(t *testing.T) {
+	ctx := context.Background()
+	event := func() *model.PendingMQEvent {
+		return &model.PendingMQEvent{ID: uuid.New(), Exchange: "session.message", RoutingKey: "session.message.insert", Body: datatypes.JSON(`{"message_id":"m1"}`)}
+	}
+
+	t.Run("published", func(t *testing.T) {
+		pub, r := &MockPublisher{}, &MockPendingMQEventRepo{}
+		e := event()
+		// the event ID is published as the message id, and the published event deleted
+		pub.On("PublishJSONWithID", mock.Anything, "session.message", "session.message.insert", e.ID.String(), e.Body).Return(nil)
+		r.On("Delete", mock.Anything, e.ID).Return(nil)
+
+		NewMQOutboxService(pub, r, newTestMQOutboxConfig(), zap.NewNop()).Relay(ctx, e)
+		pub.AssertExpectations(t)
+		r.AssertExpectations(t)
+	})
+
+	t.Run("left to the retries when publishing fails", func(t *testing.T) {
+		pub, r := &MockPublisher{}, &MockPendingMQEventRepo{}
+		e := event()
+		pub.On("PublishJSONWithID", mock.Anything, "session.message", "session.message.insert", e.ID.String(), e.Body).Return(errors.New("channel closed"))
+		r.On("MarkFailed", mock.Anything, e.ID, 1, "channel closed", mock.MatchedBy(func(at time.Time) bool {
+			return time.Until(at) > 4*time.Second && time.Until(at) <= 5*time.Second
+		}), false).Return(nil)
+
+		// a cancelled request still gets its event published
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		NewMQOutboxService(pub, r, newTestMQOutboxConfig(), zap.NewNop()).Relay(cancelled, e)
+		assert.NoError(t, pub.Calls[0].Arguments.Get(0).(context.Context).Err())
+		r.AssertExpectations(t)
+	})
+}
+
+func TestMQOutboxService_RetryPending(t *testing.T) {
+	ctx := context.Background()
+	published := model.PendingMQEvent{ID: uuid.New(), Exchange: "x", RoutingKey: "a", Body: datatypes.JSON(`{"n":1}`), Attempts: 2}
+	failed := model.PendingMQEvent{ID: uuid.New(), Exchange: "x", RoutingKey: "b", Body: datatypes.JSON(`{"n":2}`), Attempts: 2}
+	dead := model.PendingMQEvent{ID: uuid.New(), Exchange: "x", RoutingKey: "c", Body: datatypes.JSON(`{"n":3}`), Attempts: 3}
+
+	pub, r := &MockPublisher{}, &MockPendingMQEventRepo{}
+	r.On("ClaimDue", ctx, mock.AnythingOfType("time.Time"), mqEventClaimLease, 10).Return([]model.PendingMQEvent{published, failed, dead}, nil)
+	pub.On("PublishJSONWithID", ctx, "x", "a", published.ID.String(), published.Body).Return(nil)
+	pub.On("PublishJSONWithID", ctx, "x", "b", failed.ID.String(), failed.Body).Return(errors.New("channel closed"))
+	pub.On("PublishJSONWithID", ctx, "x", "c", dead.ID.String(), dead.Body).Return(errors.New("channel closed"))
+	r.On("Delete", ctx, published.ID).Return(nil)
+	r.On("MarkFailed", ctx, failed.ID, 2, "channel closed", mock.MatchedBy(func(at time.Time) bool {
+		return at.Sub(time.Now()) > 9*time.Second && at.Sub(time.Now()) <= 10*time.Second
+	}), false).Return(nil)
+	r.On("MarkFailed", ctx, dead.ID, 3, "channel closed", mock.AnythingOfType("time.Time"), true).Return(nil)
+	r.On("CountByStatus", ctx).Return(map[string]int64{model.MQEventPending: 1, model.MQEventDead: 1}, nil)
+
+	svc := NewMQOutboxService(pub, r, newTestMQOutboxConfig(), zap.NewNop())
+	out, err := svc.RetryPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &RetryPendingMQEventsOutput{Published: 1, Failed: 1, Dead: 1}, out)
+	pub.AssertExpectations(t)
+	r.AssertExpectations(t)
+}
+
+func TestMQOutboxService_Backoff(t *testing.T) {
+	svc := &mqOutboxService{cfg: newTestMQOutboxConfig()}
+	assert.Equal(t, 5*time.Second, svc.backoff(1))
+	assert.Equal(t, 10*time.Second, svc.backoff(2))
+	assert.Equal(t, 40*time.Second, svc.backoff(4))
+	assert.Equal(t, 60*time.Second, svc.backoff(5))
+	assert.Equal(t, 60*time.Second, svc.backoff(100))
+}
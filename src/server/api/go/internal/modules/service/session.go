@@ -2,65 +2,108 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"maps"
 	"mime/multipart"
+	"slices"
 	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/bytedance/sonic"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/config"
 	"github.com/memodb-io/Acontext/internal/infra/blob"
-	mq "github.com/memodb-io/Acontext/internal/infra/queue"
+	"github.com/memodb-io/Acontext/internal/infra/cache"
+	"github.com/memodb-io/Acontext/internal/infra/scanner"
+	"github.com/memodb-io/Acontext/internal/infra/webhook"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/repo"
 	"github.com/memodb-io/Acontext/internal/pkg/editor"
+	"github.com/memodb-io/Acontext/internal/pkg/metrics"
 	"github.com/memodb-io/Acontext/internal/pkg/paging"
+	"github.com/memodb-io/Acontext/internal/pkg/requestid"
+	"github.com/memodb-io/Acontext/internal/pkg/utils/path"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type SessionService interface {
 	Create(ctx context.Context, ss *model.Session) error
-	Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error
-	UpdateByID(ctx context.Context, ss *model.Session) error
+	GetOrCreate(ctx context.Context, ss *model.Session) (bool, error)
+	Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*model.AssetRefDelta, error)
+	UpdateByID(ctx context.Context, ss *model.Session, columns ...string) error
 	GetByID(ctx context.Context, ss *model.Session) (*model.Session, error)
 	List(ctx context.Context, in ListSessionsInput) (*ListSessionsOutput, error)
+	Feed(ctx context.Context, in FeedInput) (*FeedOutput, error)
+	SearchMessages(ctx context.Context, in SearchMessagesInput) (*SearchMessagesOutput, error)
+	BackfillSearchText(ctx context.Context) (int64, error)
 	StoreMessage(ctx context.Context, in StoreMessageInput) (*model.Message, error)
 	GetMessages(ctx context.Context, in GetMessagesInput) (*GetMessagesOutput, error)
 	GetAllMessages(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error)
+	GetMessagesVersion(ctx context.Context, sessionID uuid.UUID) (*model.MessagesVersion, error)
+	GetFingerprint(ctx context.Context, sessionID uuid.UUID) (*SessionFingerprint, error)
+	CheckToolOrder(ctx context.Context, sessionID uuid.UUID) (*ToolOrderCheck, error)
+	GetAssets(ctx context.Context, in GetAssetsInput) (*GetAssetsOutput, error)
+	GetAssetReferences(ctx context.Context, sessionID uuid.UUID, sha256 string) (*GetAssetReferencesOutput, error)
 	GetSessionObservingStatus(ctx context.Context, sessionID string) (*model.MessageObservingStatus, error)
+	SyncLearningStatus(ctx context.Context) (int64, error)
+	GetPartsCacheStats() PartsCacheStats
+	WarmPartsCache(ctx context.Context, sessionID uuid.UUID) (*WarmPartsCacheOutput, error)
+	GetActivity(ctx context.Context, in GetActivityInput) (*GetActivityOutput, error)
+	GetUsage(ctx context.Context, projectID uuid.UUID, quota model.Quota) (*GetUsageOutput, error)
+	UpdateSystemPrompt(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, prompt string) error
+	MoveToSpace(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, spaceID uuid.UUID) error
+	DisconnectFromSpace(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error
 }
 
 type sessionService struct {
 	sessionRepo        repo.SessionRepo
 	assetReferenceRepo repo.AssetReferenceRepo
 	log                *zap.Logger
-	s3                 *blob.S3Deps
-	publisher          *mq.Publisher
+	s3                 blob.Store
+	outbox             MQOutboxService
 	cfg                *config.Config
 	redis              *redis.Client
+	webhook            *webhook.Sender
+	scanner            *scanner.Scanner
+
+	// parts cache counters of loadPartsForMessage, see GetPartsCacheStats
+	partsCacheHits   atomic.Uint64
+	partsCacheMisses atomic.Uint64
+	partsS3Fallbacks atomic.Uint64
 }
 
 const (
 	// Redis key prefix for message parts cache
 	redisKeyPrefixParts = "message:parts:"
-	// Default TTL for message parts cache (1 hour)
+	// Default TTL for message parts cache (1 hour), used when redis.partsCacheTTLSec is not set
 	defaultPartsCacheTTL = time.Hour
 )
 
-func NewSessionService(sessionRepo repo.SessionRepo, assetReferenceRepo repo.AssetReferenceRepo, log *zap.Logger, s3 *blob.S3Deps, publisher *mq.Publisher, cfg *config.Config, redis *redis.Client) SessionService {
+// ErrPartsCacheUnavailable is returned by WarmPartsCache when Redis is not configured, or considered down
+var ErrPartsCacheUnavailable = errors.New("parts cache is not available")
+
+func NewSessionService(sessionRepo repo.SessionRepo, assetReferenceRepo repo.AssetReferenceRepo, log *zap.Logger, s3 blob.Store, outbox MQOutboxService, cfg *config.Config, redis *redis.Client, webhook *webhook.Sender, scanner *scanner.Scanner) SessionService {
 	return &sessionService{
 		sessionRepo:        sessionRepo,
 		assetReferenceRepo: assetReferenceRepo,
 		log:                log,
 		s3:                 s3,
-		publisher:          publisher,
+		outbox:             outbox,
 		cfg:                cfg,
 		redis:              redis,
+		webhook:            webhook,
+		scanner:            scanner,
 	}
 }
 
@@ -68,20 +111,39 @@ func (s *sessionService) Create(ctx context.Context, ss *model.Session) error {
 	return s.sessionRepo.Create(ctx, ss)
 }
 
-func (s *sessionService) Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error {
+// GetOrCreate creates the session, or loads the project's session with the same ClientSessionID
+// into ss when it exists already. It reports whether the session was created.
+func (s *sessionService) GetOrCreate(ctx context.Context, ss *model.Session) (bool, error) {
+	if ss.ClientSessionID == nil {
+		return true, s.sessionRepo.Create(ctx, ss)
+	}
+	return s.sessionRepo.GetOrCreateByClientID(ctx, ss)
+}
+
+// Delete deletes the session, logging and returning which assets were decremented and which were freed
+func (s *sessionService) Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*model.AssetRefDelta, error) {
 	if len(sessionID) == 0 {
-		return errors.New("space id is empty")
+		return nil, errors.New("space id is empty")
 	}
 
-	if err := s.sessionRepo.Delete(ctx, projectID, sessionID); err != nil {
-		return fmt.Errorf("delete session: %w", err)
+	delta, err := s.sessionRepo.Delete(ctx, projectID, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("delete session: %w", err)
 	}
 
-	return nil
+	if delta != nil && (len(delta.Decremented) > 0 || len(delta.Deleted) > 0) {
+		requestid.Logger(ctx, s.log).Info("session assets released",
+			zap.String("project_id", projectID.String()),
+			zap.String("session_id", sessionID.String()),
+			zap.Any("decremented", delta.Decremented),
+			zap.Any("deleted", delta.Deleted))
+	}
+	return delta, nil
 }
 
-func (s *sessionService) UpdateByID(ctx context.Context, ss *model.Session) error {
-	return s.sessionRepo.Update(ctx, ss)
+// UpdateByID updates the session, see repo.SessionRepo.Update for how columns are picked
+func (s *sessionService) UpdateByID(ctx context.Context, ss *model.Session, columns ...string) error {
+	return s.sessionRepo.Update(ctx, ss, columns...)
 }
 
 func (s *sessionService) GetByID(ctx context.Context, ss *model.Session) (*model.Session, error) {
@@ -92,12 +154,17 @@ func (s *sessionService) GetByID(ctx context.Context, ss *model.Session) (*model
 }
 
 type ListSessionsInput struct {
-	ProjectID    uuid.UUID  `json:"project_id"`
-	SpaceID      *uuid.UUID `json:"space_id,omitempty"`
-	NotConnected bool       `json:"not_connected"`
-	Limit        int        `json:"limit"`
-	Cursor       string     `json:"cursor"`
-	TimeDesc     bool       `json:"time_desc"`
+	ProjectID      uuid.UUID  `json:"project_id"`
+	SpaceID        *uuid.UUID `json:"space_id,omitempty"`
+	NotConnected   bool       `json:"not_connected"`
+	LearningStatus string     `json:"learning_status,omitempty"`
+	CreatedAfter   *time.Time `json:"created_after,omitempty"`
+	CreatedBefore  *time.Time `json:"created_before,omitempty"`
+	SortBy         string     `json:"sort_by"`    // one of the model.SessionSort orderings, created_at when empty
+	WithSpace      bool       `json:"with_space"` // load the Space of connected sessions
+	Limit          int        `json:"limit"`
+	Cursor         string     `json:"cursor"`
+	TimeDesc       bool       `json:"time_desc"`
 }
 
 type ListSessionsOutput struct {
@@ -107,19 +174,44 @@ type ListSessionsOutput struct {
 }
 
 func (s *sessionService) List(ctx context.Context, in ListSessionsInput) (*ListSessionsOutput, error) {
-	// Parse cursor (createdAt, id); an empty cursor indicates starting from the latest
-	var afterT time.Time
+	sortBy := in.SortBy
+	if sortBy == "" {
+		sortBy = model.SessionSortCreatedAt
+	}
+
+	// Parse cursor (sort key, id); an empty cursor indicates starting from the latest. A created_at
+	// cursor is a plain cursor, the others name their ordering and are only valid with it.
+	var afterKey int64
 	var afterID uuid.UUID
-	var err error
 	if in.Cursor != "" {
-		afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		cursorSort, key, id, err := paging.DecodeSortCursor(in.Cursor)
 		if err != nil {
 			return nil, err
 		}
+		if cursorSort == "" {
+			cursorSort = model.SessionSortCreatedAt
+		}
+		if cursorSort != sortBy {
+			return nil, fmt.Errorf("%w: cursor of a list sorted by %s, not %s", paging.ErrInvalidCursor, cursorSort, sortBy)
+		}
+		afterKey, afterID = key, id
 	}
 
 	// Query limit+1 is used to determine has_more
-	sessions, err := s.sessionRepo.ListWithCursor(ctx, in.ProjectID, in.SpaceID, in.NotConnected, afterT, afterID, in.Limit+1, in.TimeDesc)
+	sessions, err := s.sessionRepo.ListWithCursor(ctx, repo.ListSessionsQuery{
+		ProjectID:      in.ProjectID,
+		SpaceID:        in.SpaceID,
+		NotConnected:   in.NotConnected,
+		LearningStatus: in.LearningStatus,
+		CreatedAfter:   in.CreatedAfter,
+		CreatedBefore:  in.CreatedBefore,
+		SortBy:         sortBy,
+		AfterKey:       afterKey,
+		AfterID:        afterID,
+		Limit:          in.Limit + 1,
+		TimeDesc:       in.TimeDesc,
+		WithSpace:      in.WithSpace,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -131,13 +223,33 @@ func (s *sessionService) List(ctx context.Context, in ListSessionsInput) (*ListS
 	if len(sessions) > in.Limit {
 		out.HasMore = true
 		out.Items = sessions[:in.Limit]
-		last := out.Items[len(out.Items)-1]
-		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+		out.NextCursor = sessionCursor(sortBy, out.Items[len(out.Items)-1])
 	}
 
 	return out, nil
 }
 
+// sessionCursor returns the cursor of the list sorted by sortBy that continues after ss
+func sessionCursor(sortBy string, ss model.Session) string {
+	switch sortBy {
+	case model.SessionSortLastMessageAt:
+		// sessions without messages sort on their created_at, see ListWithCursor
+		t := ss.CreatedAt
+		if ss.LastMessageAt != nil {
+			t = *ss.LastMessageAt
+		}
+		return paging.EncodeSortCursor(sortBy, t.UnixNano(), ss.ID)
+	case model.SessionSortMessageCount:
+		var count int64
+		if ss.MessageCount != nil {
+			count = *ss.MessageCount
+		}
+		return paging.EncodeSortCursor(sortBy, count, ss.ID)
+	default:
+		return paging.EncodeCursor(ss.CreatedAt, ss.ID)
+	}
+}
+
 type StoreMessageInput struct {
 	ProjectID   uuid.UUID
 	SessionID   uuid.UUID
@@ -145,6 +257,45 @@ type StoreMessageInput struct {
 	Parts       []PartIn
 	MessageMeta map[string]interface{} // Message-level metadata (e.g., name, source_format)
 	Files       map[string]*multipart.FileHeader
+	ClientSeq   *int64             // Optional ordering key of the message in its session
+	Rules       model.MessageRules // Conversation structure rules of the project
+	Quota       model.Quota        // Storage quota overrides of the project
+}
+
+// ErrMessageRuleViolation is returned by StoreMessage when the message breaks a project message rule
+var ErrMessageRuleViolation = errors.New("message rule violation")
+
+// uploadedFile is a distinct content of StoreMessageInput.Files, stored once as an asset
+type uploadedFile struct {
+	field   string // first file field with this content
+	content *blob.Content
+	asset   *model.Asset // set once uploaded
+}
+
+// ErrAssetTypeMismatch is returned by StoreMessage when an uploaded file does not match its part type
+var ErrAssetTypeMismatch = errors.New("uploaded file does not match part type")
+
+// partTypeMIMEs are the sniffed MIME type prefixes accepted for the media part types, other part
+// types accept any file. Audio in mp4, webm or ogg containers sniffs as the container type.
+var partTypeMIMEs = map[string][]string{
+	"image": {"image/"},
+	"audio": {"audio/", "video/mp4", "video/webm", "application/ogg"},
+	"video": {"video/", "application/ogg"},
+}
+
+// checkAssetType reports whether an uploaded file of the given MIME type can back a part of partType.
+// Content that could not be sniffed is let through, as its type is only known to the client.
+func checkAssetType(partType, mime string) error {
+	prefixes, ok := partTypeMIMEs[partType]
+	if !ok || mime == "" || mime == "application/octet-stream" {
+		return nil
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(mime, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s part got %s", ErrAssetTypeMismatch, partType, mime)
 }
 
 type StoreMQPublishJSON struct {
@@ -207,33 +358,370 @@ func (p *PartIn) Validate() error {
 	return nil
 }
 
-func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput) (*model.Message, error) {
-	parts := make([]model.Part, 0, len(in.Parts))
+type FeedInput struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	Limit     int       `json:"limit"`
+	Cursor    string    `json:"cursor"`
+}
 
-	for idx, p := range in.Parts {
-		part := model.Part{
-			Type: p.Type,
-			Meta: p.Meta,
+// feedPreviewRunes bounds the text preview of the latest message in the feed
+const feedPreviewRunes = 200
+
+// FeedMessage is the preview of the latest message of a session
+type FeedMessage struct {
+	ID             uuid.UUID      `json:"id"`
+	Role           string         `json:"role"`
+	Preview        string         `json:"preview"` // first text part, truncated
+	PartTypeCounts map[string]int `json:"part_type_counts"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+type FeedItem struct {
+	Session       model.Session `json:"session"`
+	LastMessage   FeedMessage   `json:"last_message"`
+	LastMessageAt time.Time     `json:"last_message_at"`
+}
+
+type FeedOutput struct {
+	Items      []FeedItem `json:"items"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+	HasMore    bool       `json:"has_more"`
+}
+
+// Feed lists the sessions of a project by their latest activity, newest first, each with a preview of
+// its latest message. Sessions without messages are left out.
+func (s *sessionService) Feed(ctx context.Context, in FeedInput) (*FeedOutput, error) {
+	var afterT time.Time
+	var afterID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		if p.FileField != "" {
-			fh, ok := in.Files[p.FileField]
-			if !ok || fh == nil {
-				return nil, fmt.Errorf("parts[%d]: missing uploaded file %s", idx, p.FileField)
+	// Query limit+1 is used to determine has_more
+	msgs, err := s.sessionRepo.ListLatestMessagesWithCursor(ctx, in.ProjectID, afterT, afterID, in.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &FeedOutput{Items: make([]FeedItem, 0, min(len(msgs), in.Limit))}
+	if len(msgs) > in.Limit {
+		out.HasMore = true
+		msgs = msgs[:in.Limit]
+		last := msgs[len(msgs)-1]
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	for _, m := range msgs {
+		parts, _ := s.loadPartsForMessage(ctx, m.PartsAssetMeta.Data())
+		item := FeedItem{
+			LastMessage: FeedMessage{
+				ID:             m.ID,
+				Role:           m.Role,
+				Preview:        textPreview(parts, feedPreviewRunes),
+				PartTypeCounts: m.PartTypeCounts.Data(),
+				CreatedAt:      m.CreatedAt,
+			},
+			LastMessageAt: m.CreatedAt,
+		}
+		if m.Session != nil {
+			item.Session = *m.Session
+		}
+		out.Items = append(out.Items, item)
+	}
+
+	return out, nil
+}
+
+// textPreview returns the first non-empty text part, cut to maxRunes with an ellipsis
+func textPreview(parts []model.Part, maxRunes int) string {
+	for _, p := range parts {
+		if p.Type != "text" || strings.TrimSpace(p.Text) == "" {
+			continue
+		}
+		text := []rune(strings.TrimSpace(p.Text))
+		if len(text) <= maxRunes {
+			return string(text)
+		}
+		return string(text[:maxRunes]) + "…"
+	}
+	return ""
+}
+
+type SearchMessagesInput struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	Query     string    `json:"query"`
+	Limit     int       `json:"limit"`
+	Cursor    string    `json:"cursor"`
+}
+
+// MessageSearchHit is a message whose text matches the query
+type MessageSearchHit struct {
+	SessionID uuid.UUID `json:"session_id"`
+	MessageID uuid.UUID `json:"message_id"`
+	Role      string    `json:"role"`
+	Snippet   string    `json:"snippet"` // text around the first match
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SearchMessagesOutput struct {
+	Items      []MessageSearchHit `json:"items"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+	HasMore    bool               `json:"has_more"`
+}
+
+const (
+	// searchPageSize is the number of messages loaded at once while searching
+	searchPageSize = 100
+	// searchMaxScanned bounds the messages a search request reads. A page may then hold fewer hits
+	// than its limit, its cursor resumes the search where the scan stopped.
+	searchMaxScanned = 1000
+	// searchSnippetRunes is the context kept on each side of the match in a snippet
+	searchSnippetRunes = 80
+)
+
+// SearchMessages searches the text of the messages of all sessions of the project, newest first.
+// Messages are matched in SQL on the search text stored with them, then matched case-insensitively again
+// to cut the snippet. Messages stored before search text was indexed are matched once BackfillSearchText
+// gave them one.
+func (s *sessionService) SearchMessages(ctx context.Context, in SearchMessagesInput) (*SearchMessagesOutput, error) {
+	var afterT time.Time
+	var afterID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := &SearchMessagesOutput{Items: []MessageSearchHit{}}
+	var last *model.Message
+	scanned := 0
+	for {
+		msgs, err := s.sessionRepo.SearchMessagesByProject(ctx, in.ProjectID, in.Query, afterT, afterID, searchPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range msgs {
+			m := &msgs[i]
+			last = m
+			scanned++
+			if snippet, ok := searchSnippet(*m.SearchText, in.Query, searchSnippetRunes); ok {
+				out.Items = append(out.Items, MessageSearchHit{
+					SessionID: m.SessionID,
+					MessageID: m.ID,
+					Role:      m.Role,
+					Snippet:   snippet,
+					CreatedAt: m.CreatedAt,
+				})
+			}
+			if len(out.Items) == in.Limit || scanned == searchMaxScanned {
+				// more messages are left unless this one was the last of the project
+				out.HasMore = i < len(msgs)-1 || len(msgs) == searchPageSize
+				break
 			}
+		}
+		if out.HasMore || len(msgs) < searchPageSize || len(out.Items) == in.Limit || scanned == searchMaxScanned {
+			break
+		}
+		afterT, afterID = last.CreatedAt, last.ID
+	}
+
+	if out.HasMore {
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+	return out, nil
+}
+
+// searchBackfillPageSize is the number of messages BackfillSearchText loads at once
+const searchBackfillPageSize = 100
+
+// BackfillSearchText computes the search text of the messages stored before it was indexed from their
+// parts, loaded concurrently, and returns the number of messages updated. Messages whose parts could not
+// be loaded are skipped, they are retried on the next run.
+func (s *sessionService) BackfillSearchText(ctx context.Context) (int64, error) {
+	var afterT time.Time
+	var afterID uuid.UUID
+	var updated atomic.Int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return updated.Load(), err
+		}
+		msgs, err := s.sessionRepo.ListMessagesWithoutSearchText(ctx, afterT, afterID, searchBackfillPageSize)
+		if err != nil {
+			return updated.Load(), fmt.Errorf("list messages without search text: %w", err)
+		}
+
+		var g errgroup.Group
+		g.SetLimit(partsLoadConcurrency)
+		for i := range msgs {
+			g.Go(func() error {
+				m := &msgs[i]
+				if err := s.loadMessageParts(ctx, m); err != nil {
+					s.log.Sugar().Warnw("skipping search text of message", "message_id", m.ID, "err", err)
+					return nil
+				}
+				if err := s.sessionRepo.SetMessageSearchText(ctx, m.ID, partsSearchText(m.Parts)); err != nil {
+					return fmt.Errorf("set search text of message %s: %w", m.ID, err)
+				}
+				updated.Add(1)
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return updated.Load(), err
+		}
+
+		if len(msgs) < searchBackfillPageSize {
+			return updated.Load(), nil
+		}
+		last := msgs[len(msgs)-1]
+		afterT, afterID = last.CreatedAt, last.ID
+	}
+}
+
+// partsSearchText returns the text of the text and tool-result parts, one part per line
+func partsSearchText(parts []model.Part) string {
+	var texts []string
+	for _, p := range parts {
+		if p.Text != "" && (p.Type == "text" || p.Type == "tool-result") {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// searchSnippet looks for query in text, ignoring case, and returns the text around the first match with up
+// to around runes on each side
+func searchSnippet(text string, query string, around int) (string, bool) {
+	q := lowerRunes(query)
+	if len(q) == 0 {
+		return "", false
+	}
+	runes := []rune(text)
+	idx := indexRunes(lowerRunes(text), q)
+	if idx < 0 {
+		return "", false
+	}
+
+	start, end := max(idx-around, 0), min(idx+len(q)+around, len(runes))
+	snippet := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet, true
+}
+
+// lowerRunes lower-cases s rune by rune, so that indexes match the runes of s
+func lowerRunes(s string) []rune {
+	r := []rune(s)
+	for i := range r {
+		r[i] = unicode.ToLower(r[i])
+	}
+	return r
+}
+
+func indexRunes(s, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		if slices.Equal(s[i:i+len(sub)], sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput) (*model.Message, error) {
+	if in.Rules.Enabled() {
+		if err := s.checkMessageRules(ctx, in); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkQuota(ctx, in.ProjectID, in.Quota); err != nil {
+		return nil, err
+	}
+
+	// A message holds one reference per distinct asset, however many of its parts point at it,
+	// so files reused across parts, by file field or by content, are uploaded and counted once
+	byField := map[string]*uploadedFile{}
+	bySHA256 := map[string]*uploadedFile{}
+	contentTypes := map[string]string{} // sniffed content type of each file field
+	var uploads []*uploadedFile         // in the order of the parts first using them
+
+	for idx, p := range in.Parts {
+		if p.FileField == "" {
+			continue
+		}
+		fh, ok := in.Files[p.FileField]
+		if !ok || fh == nil {
+			return nil, fmt.Errorf("parts[%d]: missing uploaded file %s", idx, p.FileField)
+		}
 
-			// upload asset to S3
-			asset, err := s.s3.UploadFormFile(ctx, "assets/"+in.ProjectID.String(), fh)
+		if _, ok := byField[p.FileField]; !ok {
+			content, err := blob.FormFileContent(fh)
 			if err != nil {
-				return nil, fmt.Errorf("upload %s failed: %w", p.FileField, err)
+				return nil, fmt.Errorf("read %s failed: %w", p.FileField, err)
 			}
+			contentTypes[p.FileField] = content.ContentType
 
-			if err := s.assetReferenceRepo.IncrementAssetRef(ctx, in.ProjectID, *asset); err != nil {
-				return nil, fmt.Errorf("increment asset reference: %w", err)
+			file, ok := bySHA256[content.SHA256]
+			if !ok {
+				file = &uploadedFile{field: p.FileField, content: content}
+				bySHA256[content.SHA256] = file
+				uploads = append(uploads, file)
 			}
+			byField[p.FileField] = file
+		}
+		if err := checkAssetType(p.Type, contentTypes[p.FileField]); err != nil {
+			return nil, fmt.Errorf("parts[%d] %s: %w", idx, p.FileField, err)
+		}
+	}
+
+	// upload assets to S3
+	uploaded, err := s.uploadFiles(ctx, in.ProjectID, uploads)
+	if err != nil {
+		return nil, err
+	}
+
+	// From here on the message is stored as a whole or not at all: until it is created,
+	// a failure releases the references taken on its files and parts
+	held := slices.Clone(uploaded)
+	created := false
+	defer func() {
+		if !created {
+			s.releaseAssetRefs(ctx, in.ProjectID, held)
+		}
+	}()
+
+	parts := make([]model.Part, 0, len(in.Parts))
+	for _, p := range in.Parts {
+		part := model.Part{
+			Type: p.Type,
+			Meta: p.Meta,
+		}
 
-			part.Asset = asset
+		if p.FileField != "" {
+			fh := in.Files[p.FileField]
+			asset := *byField[p.FileField].asset
+			part.Asset = &asset
 			part.Filename = fh.Filename
+			if s.cfg.Asset.SanitizeFilenames {
+				part.Filename = path.SanitizeFilename(fh.Filename, s.cfg.Asset.MaxFilenameBytes)
+				if part.Filename != fh.Filename {
+					// keep the uploaded name, the sanitized one is what clients should write to disk
+					part.Meta = maps.Clone(part.Meta)
+					if part.Meta == nil {
+						part.Meta = map[string]interface{}{}
+					}
+					part.Meta[model.PartMetaOriginalFilename] = fh.Filename
+				}
+			}
 		}
 
 		if p.Text != "" {
@@ -244,20 +732,21 @@ func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput)
 	}
 
 	// upload parts to S3 as JSON file
-	asset, err := s.s3.UploadJSON(ctx, "parts/"+in.ProjectID.String(), parts)
+	content, err := blob.JSONContent(parts)
 	if err != nil {
-		return nil, fmt.Errorf("upload parts to S3 failed: %w", err)
+		return nil, fmt.Errorf("encode parts failed: %w", err)
 	}
-
-	if err := s.assetReferenceRepo.IncrementAssetRef(ctx, in.ProjectID, *asset); err != nil {
-		return nil, fmt.Errorf("increment asset reference: %w", err)
+	asset, err := s.storeAsset(ctx, in.ProjectID, "parts/"+in.ProjectID.String(), content)
+	if err != nil {
+		return nil, fmt.Errorf("upload parts to S3 failed: %w", err)
 	}
+	held = append(held, *asset)
 
 	// Cache parts data in Redis after successful S3 upload
 	if s.redis != nil {
 		if err := s.cachePartsInRedis(ctx, asset.SHA256, parts); err != nil {
 			// Log error but don't fail the request if Redis caching fails
-			s.log.Warn("failed to cache parts in Redis", zap.String("sha256", asset.SHA256), zap.Error(err))
+			s.warnRedis(ctx, err, "failed to cache parts in Redis", zap.String("sha256", asset.SHA256))
 		}
 	}
 
@@ -267,32 +756,55 @@ func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput)
 		messageMeta = make(map[string]interface{})
 	}
 
+	searchText := partsSearchText(parts)
 	msg := model.Message{
+		ID:             uuid.New(), // known before the insert for the outbox event
 		SessionID:      in.SessionID,
 		Role:           in.Role,
 		Meta:           datatypes.NewJSONType(messageMeta), // Store message-level metadata
 		PartsAssetMeta: datatypes.NewJSONType(*asset),
 		Parts:          parts,
-	}
-
-	if err := s.sessionRepo.CreateMessageWithAssets(ctx, &msg); err != nil {
-		return nil, err
+		PartTypeCounts: datatypes.NewJSONType(countPartTypes(parts)),
+		ClientSeq:      in.ClientSeq,
+		SearchText:     &searchText,
 	}
 
 	// Check if task tracking is disabled for this session
+	var payload *StoreMQPublishJSON
+	var event *model.PendingMQEvent
 	disableTaskTracking, err := s.sessionRepo.GetDisableTaskTracking(ctx, in.SessionID)
 	if err != nil {
-		s.log.Error("failed to get disable_task_tracking for session", zap.Error(err))
+		requestid.Logger(ctx, s.log).Error("failed to get disable_task_tracking for session", zap.Error(err))
 		// Continue without publishing, but don't fail the request
-	} else if s.publisher != nil && !disableTaskTracking {
-		// Only publish to MQ if task tracking is enabled
-		if err := s.publisher.PublishJSON(ctx, s.cfg.RabbitMQ.ExchangeName.SessionMessage, s.cfg.RabbitMQ.RoutingKey.SessionMessageInsert, StoreMQPublishJSON{
+	} else if !disableTaskTracking {
+		// Only publish to MQ and webhook if task tracking is enabled
+		payload = &StoreMQPublishJSON{
 			ProjectID: in.ProjectID,
 			SessionID: in.SessionID,
 			MessageID: msg.ID,
-		}); err != nil {
-			s.log.Error("publish session message", zap.Error(err))
 		}
+		if s.outbox != nil {
+			event, err = s.outbox.NewEvent(s.cfg.RabbitMQ.ExchangeName.SessionMessage, s.cfg.RabbitMQ.RoutingKey.SessionMessageInsert, payload)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The message and its event are created together, the event is then published at least once
+	if err := s.sessionRepo.CreateMessageWithAssets(ctx, &msg, event); err != nil {
+		return nil, err
+	}
+	created = true
+	if event != nil {
+		s.outbox.Relay(ctx, event)
+	}
+	if payload != nil && s.webhook != nil {
+		s.webhook.SendAsync(*payload)
+	}
+
+	if s.scanner != nil && len(uploaded) > 0 {
+		go s.scanAssets(context.WithoutCancel(ctx), in.ProjectID, uploaded)
 	}
 
 	return &msg, nil
@@ -305,12 +817,18 @@ type GetMessagesInput struct {
 	WithAssetPublicURL bool                    `json:"with_public_url"`
 	AssetExpire        time.Duration           `json:"asset_expire"`
 	TimeDesc           bool                    `json:"time_desc"`
+	OutputDesc         bool                    `json:"output_desc"`
+	SummaryOnly        bool                    `json:"summary_only"` // skip loading parts, rely on PartTypeCounts
 	EditStrategies     []editor.StrategyConfig `json:"edit_strategies,omitempty"`
+	WithPartsSource    bool                    `json:"with_parts_source"` // report where the parts of each message were loaded from
 }
 
 type PublicURL struct {
 	URL      string    `json:"url"`
 	ExpireAt time.Time `json:"expire_at"`
+	// GeneratedAt is when the url was presigned. URLs are presigned on every request today,
+	// if presigning ever gets cached it tells a reused url from a fresh one.
+	GeneratedAt time.Time `json:"generated_at"`
 }
 
 type GetMessagesOutput struct {
@@ -318,6 +836,8 @@ type GetMessagesOutput struct {
 	NextCursor string               `json:"next_cursor,omitempty"`
 	HasMore    bool                 `json:"has_more"`
 	PublicURLs map[string]PublicURL `json:"public_urls,omitempty"` // file_name -> url
+	// PartsSources maps message IDs to where their parts were loaded from: redis, s3 or none, with WithPartsSource
+	PartsSources map[string]string `json:"parts_sources,omitempty"`
 }
 
 func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (*GetMessagesOutput, error) {
@@ -332,43 +852,26 @@ func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (
 			return nil, err
 		}
 	} else {
-		// Parse cursor (createdAt, id); an empty cursor indicates starting from the latest
+		// Parse cursor (clientSeq, createdAt, id); an empty cursor indicates starting from the latest
+		var afterSeq *int64
 		var afterT time.Time
 		var afterID uuid.UUID
 		if in.Cursor != "" {
-			afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+			afterSeq, afterT, afterID, err = paging.DecodeMessageCursor(in.Cursor)
 			if err != nil {
 				return nil, err
 			}
 		}
 
 		// Query limit+1 is used to determine has_more
-		msgs, err = s.sessionRepo.ListBySessionWithCursor(ctx, in.SessionID, afterT, afterID, in.Limit+1, in.TimeDesc)
+		msgs, err = s.sessionRepo.ListBySessionWithCursor(ctx, in.SessionID, afterSeq, afterT, afterID, in.Limit+1, in.TimeDesc)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	// Load parts for each message
-	for i, m := range msgs {
-		meta := m.PartsAssetMeta.Data()
-		parts := s.loadPartsForMessage(ctx, meta)
-		if len(parts) == 0 {
-			continue // Skip messages with failed parts loading
-		}
-		msgs[i].Parts = parts
-	}
-
-	// Always sort messages from old to new (ascending by created_at)
-	// regardless of the in.TimeDesc parameter used for cursor pagination
-	sort.Slice(msgs, func(i, j int) bool {
-		if msgs[i].CreatedAt.Equal(msgs[j].CreatedAt) {
-			return msgs[i].ID.String() < msgs[j].ID.String()
-		}
-		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
-	})
-
-	// Build output with pagination info
+	// Build output with pagination info, truncating in query order so that
+	// the cursor points at the last message of the page in the time_desc direction
 	out := &GetMessagesOutput{
 		Items:   msgs,
 		HasMore: false,
@@ -377,9 +880,57 @@ func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (
 		out.HasMore = true
 		out.Items = msgs[:in.Limit]
 		last := out.Items[len(out.Items)-1]
-		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+		out.NextCursor = paging.EncodeMessageCursor(last.ClientSeq, last.CreatedAt, last.ID)
+	}
+
+	// Flag the head of the conversation even when it is on another page. A full listing and the last
+	// page in ascending order end with it, the first page in descending order starts with it, other
+	// pages look it up.
+	var latestID uuid.UUID
+	switch {
+	case len(out.Items) == 0:
+	case in.Limit <= 0 || (!out.HasMore && !in.TimeDesc):
+		latestID = out.Items[len(out.Items)-1].ID
+	case in.TimeDesc && in.Cursor == "":
+		latestID = out.Items[0].ID
+	default:
+		latestID, err = s.sessionRepo.GetLatestMessageID(ctx, in.SessionID)
+		if err != nil {
+			return nil, fmt.Errorf("get latest message: %w", err)
+		}
+	}
+	for i := range out.Items {
+		out.Items[i].IsLatest = out.Items[i].ID == latestID
+	}
+
+	if in.SummaryOnly {
+		sortMessagesAsc(out.Items)
+		if in.OutputDesc {
+			slices.Reverse(out.Items)
+		}
+		return out, nil
+	}
+
+	// Load parts for each message
+	if in.WithPartsSource {
+		out.PartsSources = make(map[string]string, len(out.Items))
+	}
+	for i, m := range out.Items {
+		meta := m.PartsAssetMeta.Data()
+		parts, source := s.loadPartsForMessage(ctx, meta)
+		if in.WithPartsSource {
+			out.PartsSources[m.ID.String()] = source
+		}
+		if len(parts) == 0 {
+			continue // Skip messages with failed parts loading
+		}
+		out.Items[i].Parts = parts
 	}
 
+	// Always sort messages from old to new (ascending by created_at)
+	// regardless of the in.TimeDesc parameter used for cursor pagination
+	sortMessagesAsc(out.Items)
+
 	// Apply edit strategies if provided (before format conversion)
 	if len(in.EditStrategies) > 0 {
 		out.Items, err = editor.ApplyStrategies(out.Items, in.EditStrategies)
@@ -388,22 +939,28 @@ func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (
 		}
 	}
 
-	// Generate presigned URLs for assets if requested
+	// Return newest-first if requested; edit strategies above expect chronological order
+	if in.OutputDesc {
+		slices.Reverse(out.Items)
+	}
+
+	// Generate presigned URLs for assets if requested, except for quarantined ones
 	if in.WithAssetPublicURL && s.s3 != nil {
+		infected, err := s.infectedAssets(ctx, out.Items)
+		if err != nil {
+			return nil, err
+		}
 		out.PublicURLs = make(map[string]PublicURL)
 		for _, m := range out.Items {
 			for _, p := range m.Parts {
-				if p.Asset == nil {
+				if p.Asset == nil || infected[p.Asset.S3Key] {
 					continue
 				}
-				url, err := s.s3.PresignGet(ctx, p.Asset.S3Key, in.AssetExpire)
+				publicURL, err := s.presignAsset(ctx, *p.Asset, in.AssetExpire)
 				if err != nil {
-					return nil, fmt.Errorf("get presigned url for asset %s: %w", p.Asset.S3Key, err)
-				}
-				out.PublicURLs[p.Asset.SHA256] = PublicURL{
-					URL:      url,
-					ExpireAt: time.Now().Add(in.AssetExpire),
+					return nil, err
 				}
+				out.PublicURLs[p.Asset.SHA256] = publicURL
 			}
 		}
 	}
@@ -411,24 +968,363 @@ func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (
 	return out, nil
 }
 
-// cachePartsInRedis stores message parts in Redis with a fixed TTL
-func (s *sessionService) cachePartsInRedis(ctx context.Context, sha256 string, parts []model.Part) error {
-	if s.redis == nil {
-		return errors.New("redis client is not available")
-	}
+// GetMessagesVersion returns the current version of the session's messages, see model.MessagesVersion
+func (s *sessionService) GetMessagesVersion(ctx context.Context, sessionID uuid.UUID) (*model.MessagesVersion, error) {
+	return s.sessionRepo.GetMessagesVersion(ctx, sessionID)
+}
 
-	// Serialize parts to JSON
-	jsonData, err := sonic.Marshal(parts)
+// SessionFingerprint identifies the content of a session's messages
+type SessionFingerprint struct {
+	Fingerprint  string `json:"fingerprint" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	MessageCount int    `json:"message_count"`
+}
+
+// GetFingerprint hashes the SHA256 of the parts of every message, in message order. Parts blobs are
+// content addressed, so the fingerprint only changes when messages are added, removed, reordered or
+// their parts change, and no blob has to be loaded.
+func (s *sessionService) GetFingerprint(ctx context.Context, sessionID uuid.UUID) (*SessionFingerprint, error) {
+	shas, err := s.sessionRepo.ListPartsSHA256(ctx, sessionID)
 	if err != nil {
-		return fmt.Errorf("marshal parts to JSON: %w", err)
+		return nil, fmt.Errorf("list parts hashes: %w", err)
 	}
 
-	// Use SHA256 as part of Redis key for content-based caching
-	redisKey := redisKeyPrefixParts + sha256
-
-	// Store in Redis with fixed TTL
-	if err := s.redis.Set(ctx, redisKey, jsonData, defaultPartsCacheTTL).Err(); err != nil {
-		return fmt.Errorf("set Redis key %s: %w", redisKey, err)
+	h := sha256.New()
+	for _, sha := range shas {
+		h.Write([]byte(sha))
+		h.Write([]byte{'\n'})
+	}
+	return &SessionFingerprint{Fingerprint: hex.EncodeToString(h.Sum(nil)), MessageCount: len(shas)}, nil
+}
+
+// storeAsset references the content in the project, uploading it under keyPrefix only when the project
+// doesn't have an asset with the same SHA256 yet, e.g. for repeated system prompts or re-sent files
+func (s *sessionService) storeAsset(ctx context.Context, projectID uuid.UUID, keyPrefix string, content *blob.Content) (*model.Asset, error) {
+	ref, err := s.assetReferenceRepo.IncrementExistingAssetRef(ctx, projectID, content.SHA256)
+	switch {
+	case err == nil:
+		existing := ref.AssetMeta.Data()
+		existing.S3Key = ref.S3Key
+		return &existing, nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, fmt.Errorf("increment asset reference: %w", err)
+	}
+
+	asset, err := s.s3.Upload(ctx, keyPrefix, content)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.assetReferenceRepo.IncrementAssetRef(ctx, projectID, *asset); err != nil {
+		return nil, fmt.Errorf("increment asset reference: %w", err)
+	}
+	return asset, nil
+}
+
+// uploadFiles stores the files as assets, up to Asset.UploadConcurrency at once. When any of them
+// fails, the uploads not started yet are skipped and the references taken by the others are released,
+// so that a failed message leaves no referenced assets behind. It returns the assets in the files order.
+func (s *sessionService) uploadFiles(ctx context.Context, projectID uuid.UUID, files []*uploadedFile) ([]model.Asset, error) {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(1, s.cfg.Asset.UploadConcurrency))
+
+	stored := make([]bool, len(files))
+	for i, file := range files {
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			asset, err := s.storeAsset(ctx, projectID, "assets/"+projectID.String(), file.content)
+			if err != nil {
+				return fmt.Errorf("upload %s failed: %w", file.field, err)
+			}
+			file.asset = asset
+			stored[i] = true
+			return nil
+		})
+	}
+	err := g.Wait()
+
+	assets := make([]model.Asset, 0, len(files))
+	for i, file := range files {
+		if stored[i] {
+			assets = append(assets, *file.asset)
+		}
+	}
+	if err != nil {
+		s.releaseAssetRefs(ctx, projectID, assets)
+		return nil, err
+	}
+	return assets, nil
+}
+
+// releaseAssetRefs drops the references a message that failed to store took on its assets, so that
+// GC reclaims the ones nothing else references. Failures are only logged, the caller reports the
+// error of the message.
+func (s *sessionService) releaseAssetRefs(ctx context.Context, projectID uuid.UUID, assets []model.Asset) {
+	if len(assets) == 0 {
+		return
+	}
+	delta, err := s.assetReferenceRepo.BatchDecrementAssetRefsDelta(context.WithoutCancel(ctx), projectID, assets)
+	if err != nil {
+		released := 0
+		if delta != nil {
+			released = len(delta.Decremented) + len(delta.Deleted)
+		}
+		requestid.Logger(ctx, s.log).Error("release asset references of a failed message",
+			zap.String("project_id", projectID.String()), zap.Int("assets", len(assets)), zap.Int("released", released), zap.Error(err))
+	}
+}
+
+// scanAssets submits the uploaded assets never scanned before to the malware scanner, and records the
+// verdict of a scanner answering synchronously. Other scanners post it back through AssetService.
+// Submissions are retried by the scanner, and an asset still failing is reset, so that a later upload of the
+// same content resubmits it.
+func (s *sessionService) scanAssets(ctx context.Context, projectID uuid.UUID, assets []model.Asset) {
+	for _, asset := range assets {
+		submit, err := s.assetReferenceRepo.MarkScanPending(ctx, projectID, asset.SHA256)
+		if err != nil {
+			requestid.Logger(ctx, s.log).Error("mark asset scan pending", zap.String("sha256", asset.SHA256), zap.Error(err))
+			continue
+		}
+		if !submit {
+			continue // already scanned, or being scanned for another message
+		}
+
+		res, err := s.scanner.Scan(ctx, scanner.Request{
+			ProjectID: projectID,
+			SHA256:    asset.SHA256,
+			Bucket:    asset.Bucket,
+			S3Key:     asset.S3Key,
+		})
+		status := res.Status
+		if err != nil {
+			requestid.Logger(ctx, s.log).Error("submit asset for scanning", zap.String("sha256", asset.SHA256), zap.Error(err))
+			status = ""
+		} else if status == "" {
+			continue // the scanner posts the verdict back
+		} else if !validScanResult(status) {
+			requestid.Logger(ctx, s.log).Error("unknown scan status", zap.String("sha256", asset.SHA256), zap.String("status", status))
+			continue
+		}
+		if err := s.assetReferenceRepo.SetScanStatus(ctx, projectID, asset.SHA256, status); err != nil {
+			requestid.Logger(ctx, s.log).Error("set asset scan status", zap.String("sha256", asset.SHA256), zap.Error(err))
+		}
+	}
+}
+
+// infectedAssets returns the S3 keys of the message assets reported infected by the malware scanner
+func (s *sessionService) infectedAssets(ctx context.Context, msgs []model.Message) (map[string]bool, error) {
+	var keys []string
+	for _, m := range msgs {
+		for _, p := range m.Parts {
+			if p.Asset != nil && p.Asset.S3Key != "" {
+				keys = append(keys, p.Asset.S3Key)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	infected, err := s.assetReferenceRepo.InfectedS3Keys(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("check asset scan status: %w", err)
+	}
+	out := make(map[string]bool, len(infected))
+	for _, k := range infected {
+		out[k] = true
+	}
+	return out, nil
+}
+
+// presignAsset returns a presigned GET url for the asset
+func (s *sessionService) presignAsset(ctx context.Context, asset model.Asset, expire time.Duration) (PublicURL, error) {
+	return presignPublicURL(ctx, s.s3, asset, expire)
+}
+
+// presigner is the part of blob.Store generating download urls
+type presigner interface {
+	PresignGetAs(ctx context.Context, key, contentType string, expire time.Duration) (string, error)
+}
+
+// presignPublicURL returns a presigned GET url for the asset served with its content type
+func presignPublicURL(ctx context.Context, s3 presigner, asset model.Asset, expire time.Duration) (PublicURL, error) {
+	url, err := s3.PresignGetAs(ctx, asset.S3Key, asset.MIME, expire)
+	if err != nil {
+		return PublicURL{}, fmt.Errorf("get presigned url for asset %s: %w", asset.S3Key, err)
+	}
+	now := time.Now()
+	return PublicURL{
+		URL:         url,
+		ExpireAt:    now.Add(expire),
+		GeneratedAt: now,
+	}, nil
+}
+
+type GetAssetsInput struct {
+	SessionID   uuid.UUID     `json:"session_id"`
+	GroupByType bool          `json:"group_by_type"`
+	AssetExpire time.Duration `json:"asset_expire"`
+}
+
+// SessionAsset is an asset referenced by a message part of a session
+type SessionAsset struct {
+	MessageID uuid.UUID   `json:"message_id"`
+	Type      string      `json:"type"` // part type, e.g. image, audio, file
+	Filename  string      `json:"filename,omitempty"`
+	Asset     model.Asset `json:"asset"`
+	PublicURL *PublicURL  `json:"public_url,omitempty"`
+	// Quarantined assets were reported infected by the malware scanner and get no public url
+	Quarantined bool `json:"quarantined,omitempty"`
+}
+
+type GetAssetsOutput struct {
+	Items  []SessionAsset            `json:"items,omitempty"`
+	Groups map[string][]SessionAsset `json:"groups,omitempty"` // part type -> assets, set when grouping by type
+}
+
+// GetAssets returns the assets of all message parts in a session, oldest first.
+// Assets are deduplicated by SHA256, keeping the first part referencing them.
+func (s *sessionService) GetAssets(ctx context.Context, in GetAssetsInput) (*GetAssetsOutput, error) {
+	msgs, err := s.GetAllMessages(ctx, in.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var infected map[string]bool
+	if s.s3 != nil {
+		if infected, err = s.infectedAssets(ctx, msgs); err != nil {
+			return nil, err
+		}
+	}
+
+	items := []SessionAsset{}
+	seen := make(map[string]struct{})
+	for _, m := range msgs {
+		for _, p := range m.Parts {
+			if p.Asset == nil {
+				continue
+			}
+			if _, ok := seen[p.Asset.SHA256]; ok {
+				continue
+			}
+			seen[p.Asset.SHA256] = struct{}{}
+
+			item := SessionAsset{
+				MessageID: m.ID,
+				Type:      p.Type,
+				Filename:  p.Filename,
+				Asset:     *p.Asset,
+			}
+			if infected[p.Asset.S3Key] {
+				item.Quarantined = true
+			} else if s.s3 != nil {
+				publicURL, err := s.presignAsset(ctx, *p.Asset, in.AssetExpire)
+				if err != nil {
+					return nil, err
+				}
+				item.PublicURL = &publicURL
+			}
+			items = append(items, item)
+		}
+	}
+
+	if !in.GroupByType {
+		return &GetAssetsOutput{Items: items}, nil
+	}
+
+	groups := make(map[string][]SessionAsset)
+	for _, item := range items {
+		groups[item.Type] = append(groups[item.Type], item)
+	}
+	return &GetAssetsOutput{Groups: groups}, nil
+}
+
+type GetAssetReferencesOutput struct {
+	MessageIDs []uuid.UUID `json:"message_ids"`
+}
+
+// GetAssetReferences returns the IDs of the messages in a session with a part referencing
+// the asset with the given SHA256, oldest first
+func (s *sessionService) GetAssetReferences(ctx context.Context, sessionID uuid.UUID, sha256 string) (*GetAssetReferencesOutput, error) {
+	msgs, err := s.GetAllMessages(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &GetAssetReferencesOutput{MessageIDs: []uuid.UUID{}}
+	for _, m := range msgs {
+		for _, p := range m.Parts {
+			if p.Asset != nil && p.Asset.SHA256 == sha256 {
+				out.MessageIDs = append(out.MessageIDs, m.ID)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// sortMessagesAsc sorts messages by client_seq, messages without it last, then from old to new, breaking ties by ID
+func sortMessagesAsc(msgs []model.Message) {
+	sort.Slice(msgs, func(i, j int) bool {
+		si, sj := msgs[i].ClientSeq, msgs[j].ClientSeq
+		if (si == nil) != (sj == nil) {
+			return sj == nil
+		}
+		if si != nil && *si != *sj {
+			return *si < *sj
+		}
+		if msgs[i].CreatedAt.Equal(msgs[j].CreatedAt) {
+			return msgs[i].ID.String() < msgs[j].ID.String()
+		}
+		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+	})
+}
+
+// countPartTypes returns the number of parts per part type
+func countPartTypes(parts []model.Part) map[string]int {
+	counts := make(map[string]int)
+	for _, p := range parts {
+		counts[p.Type]++
+	}
+	return counts
+}
+
+// partsCacheTTL returns the configured TTL of the message parts cache
+func (s *sessionService) partsCacheTTL() time.Duration {
+	if s.cfg == nil || s.cfg.Redis.PartsCacheTTLSec <= 0 {
+		return defaultPartsCacheTTL
+	}
+	return time.Duration(s.cfg.Redis.PartsCacheTTLSec) * time.Second
+}
+
+// warnRedis logs a failed Redis call. While the circuit breaker skips Redis calls it already logged
+// Redis as down, so the skipped calls are only logged at debug level.
+func (s *sessionService) warnRedis(ctx context.Context, err error, msg string, fields ...zap.Field) {
+	fields = append(fields, zap.Error(err))
+	if errors.Is(err, cache.ErrCircuitOpen) {
+		requestid.Logger(ctx, s.log).Debug(msg, fields...)
+		return
+	}
+	requestid.Logger(ctx, s.log).Warn(msg, fields...)
+}
+
+// cachePartsInRedis stores message parts in Redis with the configured TTL
+func (s *sessionService) cachePartsInRedis(ctx context.Context, sha256 string, parts []model.Part) error {
+	if s.redis == nil {
+		return errors.New("redis client is not available")
+	}
+
+	// Serialize parts to JSON
+	jsonData, err := sonic.Marshal(parts)
+	if err != nil {
+		return fmt.Errorf("marshal parts to JSON: %w", err)
+	}
+
+	// Use SHA256 as part of Redis key for content-based caching
+	redisKey := redisKeyPrefixParts + sha256
+
+	if err := s.redis.Set(ctx, redisKey, jsonData, s.partsCacheTTL()).Err(); err != nil {
+		return fmt.Errorf("set Redis key %s: %w", redisKey, err)
 	}
 
 	return nil
@@ -463,9 +1359,16 @@ func (s *sessionService) getPartsFromRedis(ctx context.Context, sha256 string) (
 	return parts, nil
 }
 
-// loadPartsForMessage loads parts for a message from cache or S3
+// Where loadPartsForMessage found the parts of a message
+const (
+	PartsFromRedis = "redis"
+	PartsFromS3    = "s3"
+	PartsNotLoaded = "none" // neither had them, the message has no parts
+)
+
+// loadPartsForMessage loads parts for a message from cache or S3, returning where they came from
 // Returns the loaded parts, or empty slice if loading fails
-func (s *sessionService) loadPartsForMessage(ctx context.Context, meta model.Asset) []model.Part {
+func (s *sessionService) loadPartsForMessage(ctx context.Context, meta model.Asset) ([]model.Part, string) {
 	parts := []model.Part{}
 	cacheHit := false
 
@@ -476,26 +1379,204 @@ func (s *sessionService) loadPartsForMessage(ctx context.Context, meta model.Ass
 			cacheHit = true
 		} else if err != redis.Nil {
 			// Log actual Redis errors (not cache misses)
-			s.log.Warn("failed to get parts from Redis", zap.String("sha256", meta.SHA256), zap.Error(err))
+			s.warnRedis(ctx, err, "failed to get parts from Redis", zap.String("sha256", meta.SHA256))
+		}
+		if cacheHit {
+			s.partsCacheHits.Add(1)
+			metrics.PartsCacheLookups.WithLabelValues(metrics.CacheHit).Inc()
+		} else {
+			s.partsCacheMisses.Add(1)
+			metrics.PartsCacheLookups.WithLabelValues(metrics.CacheMiss).Inc()
 		}
 	}
 
 	// If cache miss, download from S3
 	if !cacheHit && s.s3 != nil {
+		s.partsS3Fallbacks.Add(1)
+		metrics.PartsS3Fallbacks.Inc()
 		if err := s.s3.DownloadJSON(ctx, meta.S3Key, &parts); err != nil {
-			s.log.Warn("failed to download parts from S3", zap.String("sha256", meta.SHA256), zap.Error(err))
-			return parts // Return empty parts on S3 download failure
+			requestid.Logger(ctx, s.log).Warn("failed to download parts from S3", zap.String("sha256", meta.SHA256), zap.Error(err))
+			return parts, PartsNotLoaded // Return empty parts on S3 download failure
 		}
 		// Cache the parts in Redis after successful S3 download
 		if s.redis != nil {
 			if err := s.cachePartsInRedis(ctx, meta.SHA256, parts); err != nil {
 				// Log error but don't fail the request if Redis caching fails
-				s.log.Warn("failed to cache parts in Redis", zap.String("sha256", meta.SHA256), zap.Error(err))
+				s.warnRedis(ctx, err, "failed to cache parts in Redis", zap.String("sha256", meta.SHA256))
 			}
 		}
+		return parts, PartsFromS3
+	}
+
+	if cacheHit {
+		return parts, PartsFromRedis
+	}
+	return parts, PartsNotLoaded
+}
+
+// PartsCacheStats are the parts cache counters of the service since startup
+type PartsCacheStats struct {
+	Hits        uint64  `json:"hits"`
+	Misses      uint64  `json:"misses"`
+	S3Fallbacks uint64  `json:"s3_fallbacks"`
+	HitRatio    float64 `json:"hit_ratio"` // hits / (hits + misses), 0 before the first lookup
+	TTLSeconds  int     `json:"ttl_seconds"`
+}
+
+// GetPartsCacheStats returns the Redis parts cache hit/miss and S3 fallback counters
+func (s *sessionService) GetPartsCacheStats() PartsCacheStats {
+	stats := PartsCacheStats{
+		Hits:        s.partsCacheHits.Load(),
+		Misses:      s.partsCacheMisses.Load(),
+		S3Fallbacks: s.partsS3Fallbacks.Load(),
+		TTLSeconds:  int(s.partsCacheTTL().Seconds()),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+type WarmPartsCacheOutput struct {
+	Cached        int `json:"cached"`         // parts blobs loaded from S3 into Redis
+	AlreadyCached int `json:"already_cached"` // parts blobs that were in Redis already
+	Failed        int `json:"failed"`         // parts blobs that could not be loaded or cached
+}
+
+// WarmPartsCache loads the parts of every message of the session into Redis, so that
+// later reads don't fall back to S3. Blobs already in Redis are left untouched.
+func (s *sessionService) WarmPartsCache(ctx context.Context, sessionID uuid.UUID) (*WarmPartsCacheOutput, error) {
+	if s.redis == nil {
+		return nil, ErrPartsCacheUnavailable
+	}
+
+	msgs, err := s.sessionRepo.ListAllMessagesBySession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+
+	out := &WarmPartsCacheOutput{}
+	seen := make(map[string]struct{}, len(msgs))
+	for _, m := range msgs {
+		meta := m.PartsAssetMeta.Data()
+		if meta.SHA256 == "" {
+			continue
+		}
+		if _, ok := seen[meta.SHA256]; ok {
+			continue
+		}
+		seen[meta.SHA256] = struct{}{}
+
+		n, err := s.redis.Exists(ctx, redisKeyPrefixParts+meta.SHA256).Result()
+		if errors.Is(err, cache.ErrCircuitOpen) {
+			return nil, fmt.Errorf("%w: %w", ErrPartsCacheUnavailable, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("check parts cache: %w", err)
+		}
+		if n > 0 {
+			out.AlreadyCached++
+			continue
+		}
+
+		if s.s3 == nil {
+			out.Failed++
+			continue
+		}
+		parts := []model.Part{}
+		if err := s.s3.DownloadJSON(ctx, meta.S3Key, &parts); err != nil {
+			requestid.Logger(ctx, s.log).Warn("failed to download parts from S3", zap.String("sha256", meta.SHA256), zap.Error(err))
+			out.Failed++
+			continue
+		}
+		if err := s.cachePartsInRedis(ctx, meta.SHA256, parts); err != nil {
+			s.warnRedis(ctx, err, "failed to cache parts in Redis", zap.String("sha256", meta.SHA256))
+			out.Failed++
+			continue
+		}
+		out.Cached++
+	}
+
+	return out, nil
+}
+
+// Activity bucket granularities with their size and the longest time range a request may cover
+var (
+	activityBucketSize = map[string]time.Duration{
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+	}
+	activityBucketMaxRange = map[string]time.Duration{
+		"minute": 24 * time.Hour,
+		"hour":   31 * 24 * time.Hour,
+		"day":    366 * 24 * time.Hour,
+	}
+)
+
+// ErrInvalidActivityRange is returned by GetActivity for an unknown bucket or an invalid time range
+var ErrInvalidActivityRange = errors.New("invalid activity range")
+
+type GetActivityInput struct {
+	SessionID uuid.UUID  `json:"session_id"`
+	Bucket    string     `json:"bucket"`
+	Start     *time.Time `json:"start,omitempty"` // defaults to End minus the bucket's max range
+	End       *time.Time `json:"end,omitempty"`   // defaults to now
+}
+
+type GetActivityOutput struct {
+	Bucket string                        `json:"bucket"`
+	Start  time.Time                     `json:"start"`
+	End    time.Time                     `json:"end"`
+	Items  []model.MessageActivityBucket `json:"items"`
+}
+
+// GetActivity returns the session's message counts per time bucket in [Start, End), oldest first.
+// Counts come from a grouped query without loading parts, and empty buckets are filled with 0.
+func (s *sessionService) GetActivity(ctx context.Context, in GetActivityInput) (*GetActivityOutput, error) {
+	size, ok := activityBucketSize[in.Bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported bucket %q", ErrInvalidActivityRange, in.Bucket)
+	}
+	maxRange := activityBucketMaxRange[in.Bucket]
+
+	end := time.Now().UTC()
+	if in.End != nil {
+		end = in.End.UTC()
+	}
+	start := end.Add(-maxRange)
+	if in.Start != nil {
+		start = in.Start.UTC()
+	}
+	// Align to bucket boundaries, buckets are computed in UTC
+	start = start.Truncate(size)
+	if !start.Before(end) {
+		return nil, fmt.Errorf("%w: start must be earlier than end", ErrInvalidActivityRange)
+	}
+	if end.Sub(start) > maxRange {
+		return nil, fmt.Errorf("%w: range exceeds %s for bucket %s", ErrInvalidActivityRange, maxRange, in.Bucket)
+	}
+
+	counts, err := s.sessionRepo.CountMessagesByBucket(ctx, in.SessionID, in.Bucket, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("count messages by bucket: %w", err)
+	}
+	byStart := make(map[int64]int64, len(counts))
+	for _, c := range counts {
+		byStart[c.Start.Unix()] = c.Count
+	}
+
+	items := make([]model.MessageActivityBucket, 0, int(end.Sub(start)/size)+1)
+	for t := start; t.Before(end); t = t.Add(size) {
+		items = append(items, model.MessageActivityBucket{Start: t, Count: byStart[t.Unix()]})
 	}
 
-	return parts
+	return &GetActivityOutput{
+		Bucket: in.Bucket,
+		Start:  start,
+		End:    end,
+		Items:  items,
+	}, nil
 }
 
 // GetAllMessages retrieves all messages for a session and loads their parts
@@ -509,7 +1590,7 @@ func (s *sessionService) GetAllMessages(ctx context.Context, sessionID uuid.UUID
 	// Load parts for each message
 	for i, m := range msgs {
 		meta := m.PartsAssetMeta.Data()
-		msgs[i].Parts = s.loadPartsForMessage(ctx, meta)
+		msgs[i].Parts, _ = s.loadPartsForMessage(ctx, meta)
 	}
 
 	// Sort messages from old to new (ascending by created_at)
@@ -548,3 +1629,409 @@ func (s *sessionService) GetSessionObservingStatus(
 
 	return status, nil
 }
+
+// checkMessageRules enforces the project message rules before anything is uploaded.
+// System messages are not stored as messages, so a required system prompt must be set in the session configs.
+func (s *sessionService) checkMessageRules(ctx context.Context, in StoreMessageInput) error {
+	if in.Rules.RequireSystemPrompt {
+		session, err := s.sessionRepo.Get(ctx, &model.Session{ID: in.SessionID})
+		if err != nil {
+			return fmt.Errorf("get session: %w", err)
+		}
+		if session.SystemPrompt() == "" {
+			return fmt.Errorf("%w: session must have a system prompt before storing messages", ErrMessageRuleViolation)
+		}
+	}
+
+	if in.Rules.FirstMessageRole != "" && in.Role != in.Rules.FirstMessageRole {
+		msgs, err := s.sessionRepo.ListBySessionWithCursor(ctx, in.SessionID, nil, time.Time{}, uuid.Nil, 1, false)
+		if err != nil {
+			return fmt.Errorf("list messages: %w", err)
+		}
+		if len(msgs) == 0 {
+			return fmt.Errorf("%w: first message must have role %s, got %s", ErrMessageRuleViolation, in.Rules.FirstMessageRole, in.Role)
+		}
+	}
+
+	if in.Rules.ToolResultsFollowCalls {
+		if err := s.checkStoredToolOrder(ctx, in); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ToolOrderViolation is a break of the tool call order providers replay: the tool results of a
+// message of tool calls must come in the messages right after it, before any other message
+type ToolOrderViolation struct {
+	Index      int       `json:"index"` // position of the message breaking the order, from 0 in message order
+	MessageID  uuid.UUID `json:"message_id"`
+	ToolCallID string    `json:"tool_call_id"`
+	Reason     string    `json:"reason"`
+}
+
+// ToolOrderCheck tells whether the messages of a session can be replayed to a provider requiring
+// tool results to follow their tool calls
+type ToolOrderCheck struct {
+	ReplayReady bool                 `json:"replay_ready"`
+	Violations  []ToolOrderViolation `json:"violations"`
+}
+
+// CheckToolOrder checks the order of the tool calls and results of all messages of the session.
+// Tool calls left without results at the end of the session are violations too, as they can't be replayed.
+func (s *sessionService) CheckToolOrder(ctx context.Context, sessionID uuid.UUID) (*ToolOrderCheck, error) {
+	msgs, err := s.sessionRepo.ListAllMessagesBySession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list messages: %w", err)
+	}
+	if err := s.loadMessagesParts(ctx, msgs); err != nil {
+		return nil, err
+	}
+
+	violations := toolOrderViolations(msgs, true)
+	return &ToolOrderCheck{ReplayReady: len(violations) == 0, Violations: violations}, nil
+}
+
+// ErrPartsNotLoaded is returned by the checks that need the parts of every message, as a message whose parts
+// could not be loaded would be checked as a message without parts
+var ErrPartsNotLoaded = errors.New("message parts could not be loaded")
+
+// partsLoadConcurrency caps the parts loaded at once by loadMessagesParts
+const partsLoadConcurrency = 8
+
+// loadMessagesParts loads the parts of msgs concurrently, failing with ErrPartsNotLoaded if any of them
+// could not be loaded
+func (s *sessionService) loadMessagesParts(ctx context.Context, msgs []model.Message) error {
+	var g errgroup.Group
+	g.SetLimit(partsLoadConcurrency)
+	for i := range msgs {
+		g.Go(func() error { return s.loadMessageParts(ctx, &msgs[i]) })
+	}
+	return g.Wait()
+}
+
+// loadMessageParts loads the parts of m, failing with ErrPartsNotLoaded if they could not be loaded
+func (s *sessionService) loadMessageParts(ctx context.Context, m *model.Message) error {
+	parts, source := s.loadPartsForMessage(ctx, m.PartsAssetMeta.Data())
+	if source == PartsNotLoaded {
+		return fmt.Errorf("%w: message %s", ErrPartsNotLoaded, m.ID)
+	}
+	m.Parts = parts
+	return nil
+}
+
+// toolOrderPageSize is the page size of the messages loaded back to the last turn by checkStoredToolOrder
+const toolOrderPageSize = 20
+
+// checkStoredToolOrder checks that the message to store keeps tool results right after their tool calls.
+// Only the latest messages back to the last one that is not only tool results are loaded, as the
+// calls the message may answer are there.
+func (s *sessionService) checkStoredToolOrder(ctx context.Context, in StoreMessageInput) error {
+	var tail []model.Message
+	var afterSeq *int64
+	var afterT time.Time
+	var afterID uuid.UUID
+	for {
+		msgs, err := s.sessionRepo.ListBySessionWithCursor(ctx, in.SessionID, afterSeq, afterT, afterID, toolOrderPageSize, true)
+		if err != nil {
+			return fmt.Errorf("list messages: %w", err)
+		}
+		done := len(msgs) < toolOrderPageSize
+		for _, m := range msgs {
+			// loaded one at a time, the first message that is not only tool results is usually the latest
+			if err := s.loadMessageParts(ctx, &m); err != nil {
+				return err
+			}
+			tail = append(tail, m)
+			if !isToolResultOnly(m.Parts) {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+		last := msgs[len(msgs)-1]
+		afterSeq, afterT, afterID = last.ClientSeq, last.CreatedAt, last.ID
+	}
+	slices.Reverse(tail)
+
+	incoming := model.Message{Role: in.Role, Parts: make([]model.Part, 0, len(in.Parts))}
+	for _, p := range in.Parts {
+		incoming.Parts = append(incoming.Parts, model.Part{Type: p.Type, Meta: p.Meta})
+	}
+	tail = append(tail, incoming)
+
+	// the loaded messages were checked when they were stored, only the new one is
+	for _, v := range toolOrderViolations(tail, false) {
+		if v.Index == len(tail)-1 {
+			return fmt.Errorf("%w: %s", ErrMessageRuleViolation, v.Reason)
+		}
+	}
+	return nil
+}
+
+// toolOrderViolations walks messages in order, keeping the tool calls of the last message of tool calls
+// that no result answered yet. A tool result must answer one of them, and any message that is not only
+// tool results ends the wait. With atEnd, calls still unanswered after the last message are reported.
+func toolOrderViolations(msgs []model.Message, atEnd bool) []ToolOrderViolation {
+	violations := []ToolOrderViolation{}
+	pending := map[string]int{} // tool call id -> index of the message of the call
+	var pendingIDs []string     // in call order, for stable reports
+
+	unanswered := func(index int, id uuid.UUID, reason string) {
+		for _, callID := range pendingIDs {
+			if callIndex, ok := pending[callID]; ok {
+				violations = append(violations, ToolOrderViolation{
+					Index:      index,
+					MessageID:  id,
+					ToolCallID: callID,
+					Reason:     fmt.Sprintf("tool-call %s of message %d %s", callID, callIndex, reason),
+				})
+			}
+		}
+		pending = map[string]int{}
+		pendingIDs = nil
+	}
+
+	for i, m := range msgs {
+		for _, p := range m.Parts {
+			if p.Type != "tool-result" {
+				continue
+			}
+			callID, _ := p.Meta["tool_call_id"].(string)
+			if callID == "" {
+				continue
+			}
+			if _, ok := pending[callID]; !ok {
+				violations = append(violations, ToolOrderViolation{
+					Index:      i,
+					MessageID:  m.ID,
+					ToolCallID: callID,
+					Reason:     fmt.Sprintf("tool-result for %s in message %d does not follow its tool-call", callID, i),
+				})
+				continue
+			}
+			delete(pending, callID)
+		}
+
+		if !isToolResultOnly(m.Parts) {
+			unanswered(i, m.ID, fmt.Sprintf("is not followed by its tool-result before message %d", i))
+		}
+		if m.Role != "assistant" {
+			continue
+		}
+		for _, p := range m.Parts {
+			if p.Type != "tool-call" {
+				continue
+			}
+			if callID, _ := p.Meta["id"].(string); callID != "" {
+				pending[callID] = i
+				pendingIDs = append(pendingIDs, callID)
+			}
+		}
+	}
+
+	if atEnd && len(pending) > 0 {
+		for _, callID := range pendingIDs {
+			if callIndex, ok := pending[callID]; ok {
+				violations = append(violations, ToolOrderViolation{
+					Index:      callIndex,
+					MessageID:  msgs[callIndex].ID,
+					ToolCallID: callID,
+					Reason:     fmt.Sprintf("tool-call %s of message %d has no tool-result", callID, callIndex),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// isToolResultOnly reports whether parts are all tool results, as in the tool messages of OpenAI
+func isToolResultOnly(parts []model.Part) bool {
+	if len(parts) == 0 {
+		return false
+	}
+	for _, p := range parts {
+		if p.Type != "tool-result" {
+			return false
+		}
+	}
+	return true
+}
+
+// SyncLearningStatus refreshes the locally cached learning status of all sessions
+func (s *sessionService) SyncLearningStatus(ctx context.Context) (int64, error) {
+	return s.sessionRepo.SyncLearningStatus(ctx)
+}
+
+// UpdateSystemPrompt replaces the session's system prompt, an empty prompt clears it
+func (s *sessionService) UpdateSystemPrompt(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, prompt string) error {
+	if sessionID == uuid.Nil {
+		return errors.New("session id is empty")
+	}
+
+	if err := s.sessionRepo.SetSystemPrompt(ctx, projectID, sessionID, prompt); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("update system prompt: %w", err)
+	}
+
+	return nil
+}
+
+var (
+	// ErrSessionNotFound is returned by UpdateSystemPrompt, MoveToSpace and DisconnectFromSpace when the session doesn't exist in the project
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSpaceNotInProject is returned by MoveToSpace when the target space doesn't belong to the session's project
+	ErrSpaceNotInProject = errors.New("space does not belong to project")
+)
+
+// MoveToSpace connects the session to another space of its project, whether or not it is connected yet
+func (s *sessionService) MoveToSpace(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, spaceID uuid.UUID) error {
+	err := s.sessionRepo.MoveToSpace(ctx, projectID, sessionID, spaceID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("move session to space: %w", err)
+	}
+
+	// nothing was updated, tell a missing session from a space of another project
+	session, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && session.ProjectID != projectID) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("get session: %w", err)
+	}
+	return ErrSpaceNotInProject
+}
+
+// DisconnectFromSpace detaches the session from its space, if any. Tasks already learned in the space stay there.
+func (s *sessionService) DisconnectFromSpace(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error {
+	if err := s.sessionRepo.DisconnectFromSpace(ctx, projectID, sessionID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("disconnect session from space: %w", err)
+	}
+	return nil
+}
+
+// ErrQuotaExceeded is returned by StoreMessage when the project stores as much as its quota allows
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// GetUsageOutput is what a project stores against its quota, a max of 0 is unlimited
+type GetUsageOutput struct {
+	Messages      int64 `json:"messages"`
+	MaxMessages   int64 `json:"max_messages"`
+	AssetBytes    int64 `json:"asset_bytes"`
+	MaxAssetBytes int64 `json:"max_asset_bytes"`
+}
+
+// projectUsage is the cached part of GetUsageOutput
+type projectUsage struct {
+	Messages   int64 `json:"messages"`
+	AssetBytes int64 `json:"asset_bytes"`
+}
+
+const (
+	redisKeyPrefixUsage = "usage:project:"
+	// Default TTL of the cached usage of a project, used when quota.usageCacheTTLSec is not set
+	defaultUsageCacheTTL = 30 * time.Second
+)
+
+// quota fills the values the project does not override with the global quota
+func (s *sessionService) quota(overrides model.Quota) model.Quota {
+	if s.cfg == nil {
+		return overrides
+	}
+	if overrides.MaxMessages <= 0 {
+		overrides.MaxMessages = s.cfg.Quota.MaxMessages
+	}
+	if overrides.MaxAssetBytes <= 0 {
+		overrides.MaxAssetBytes = s.cfg.Quota.MaxAssetBytes
+	}
+	return overrides
+}
+
+func (s *sessionService) usageCacheTTL() time.Duration {
+	if s.cfg == nil || s.cfg.Quota.UsageCacheTTLSec <= 0 {
+		return defaultUsageCacheTTL
+	}
+	return time.Duration(s.cfg.Quota.UsageCacheTTLSec) * time.Second
+}
+
+// usage counts what the project stores, cached briefly in Redis as counting scans all its messages.
+// Redis errors only skip the cache.
+func (s *sessionService) usage(ctx context.Context, projectID uuid.UUID) (*projectUsage, error) {
+	redisKey := redisKeyPrefixUsage + projectID.String()
+	if s.redis != nil {
+		if val, err := s.redis.Get(ctx, redisKey).Result(); err == nil {
+			var u projectUsage
+			if err := sonic.Unmarshal([]byte(val), &u); err == nil {
+				return &u, nil
+			}
+		} else if !errors.Is(err, redis.Nil) {
+			s.warnRedis(ctx, err, "get cached project usage", zap.String("project_id", projectID.String()))
+		}
+	}
+
+	messages, err := s.sessionRepo.CountMessagesByProject(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("count messages: %w", err)
+	}
+	assetBytes, err := s.assetReferenceRepo.TotalSizeByProject(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("sum asset sizes: %w", err)
+	}
+	u := &projectUsage{Messages: messages, AssetBytes: assetBytes}
+
+	if s.redis != nil {
+		if data, err := sonic.Marshal(u); err == nil {
+			if err := s.redis.Set(ctx, redisKey, data, s.usageCacheTTL()).Err(); err != nil {
+				s.warnRedis(ctx, err, "cache project usage", zap.String("project_id", projectID.String()))
+			}
+		}
+	}
+	return u, nil
+}
+
+// GetUsage returns what the project stores against its quota, the global quota with the project's overrides
+func (s *sessionService) GetUsage(ctx context.Context, projectID uuid.UUID, quota model.Quota) (*GetUsageOutput, error) {
+	u, err := s.usage(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	q := s.quota(quota)
+	return &GetUsageOutput{
+		Messages:      u.Messages,
+		MaxMessages:   q.MaxMessages,
+		AssetBytes:    u.AssetBytes,
+		MaxAssetBytes: q.MaxAssetBytes,
+	}, nil
+}
+
+// checkQuota rejects a new message of a project that stores as many messages or asset bytes as its quota allows.
+// Usage is counted before the message, so the last message stored under the quota can take it over.
+func (s *sessionService) checkQuota(ctx context.Context, projectID uuid.UUID, overrides model.Quota) error {
+	q := s.quota(overrides)
+	if q.MaxMessages <= 0 && q.MaxAssetBytes <= 0 {
+		return nil
+	}
+
+	u, err := s.usage(ctx, projectID)
+	if err != nil {
+		return fmt.Errorf("check quota: %w", err)
+	}
+	if q.MaxMessages > 0 && u.Messages >= q.MaxMessages {
+		return fmt.Errorf("%w: the project stores %d messages, its quota is %d", ErrQuotaExceeded, u.Messages, q.MaxMessages)
+	}
+	if q.MaxAssetBytes > 0 && u.AssetBytes >= q.MaxAssetBytes {
+		return fmt.Errorf("%w: the project stores %d bytes of assets, its quota is %d", ErrQuotaExceeded, u.AssetBytes, q.MaxAssetBytes)
+	}
+	return nil
+}
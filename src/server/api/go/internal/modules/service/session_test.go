@@ -1,17 +1,39 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bytedance/sonic"
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/config"
+	"github.com/memodb-io/Acontext/internal/infra/blob"
+	"github.com/memodb-io/Acontext/internal/infra/scanner"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/repo"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // MockSessionRepo is a mock implementation of SessionRepo
@@ -24,13 +46,21 @@ func (m *MockSessionRepo) Create(ctx context.Context, s *model.Session) error {
 	return args.Error(0)
 }
 
-func (m *MockSessionRepo) Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error {
+func (m *MockSessionRepo) GetOrCreateByClientID(ctx context.Context, s *model.Session) (bool, error) {
+	args := m.Called(ctx, s)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSessionRepo) Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) (*model.AssetRefDelta, error) {
 	args := m.Called(ctx, projectID, sessionID)
-	return args.Error(0)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.AssetRefDelta), args.Error(1)
 }
 
-func (m *MockSessionRepo) Update(ctx context.Context, s *model.Session) error {
-	args := m.Called(ctx, s)
+func (m *MockSessionRepo) Update(ctx context.Context, s *model.Session, columns ...string) error {
+	args := m.Called(ctx, s, columns)
 	return args.Error(0)
 }
 
@@ -47,21 +77,21 @@ func (m *MockSessionRepo) GetDisableTaskTracking(ctx context.Context, sessionID
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockSessionRepo) CreateMessageWithAssets(ctx context.Context, msg *model.Message) error {
-	args := m.Called(ctx, msg)
+func (m *MockSessionRepo) CreateMessageWithAssets(ctx context.Context, msg *model.Message, event *model.PendingMQEvent) error {
+	args := m.Called(ctx, msg, event)
 	return args.Error(0)
 }
 
-func (m *MockSessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterT time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
-	args := m.Called(ctx, sessionID, afterT, afterID, limit, timeDesc)
+func (m *MockSessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterSeq *int64, afterT time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
+	args := m.Called(ctx, sessionID, afterSeq, afterT, afterID, limit, timeDesc)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]model.Message), args.Error(1)
 }
 
-func (m *MockSessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, spaceID *uuid.UUID, notConnected bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error) {
-	args := m.Called(ctx, projectID, spaceID, notConnected, afterCreatedAt, afterID, limit, timeDesc)
+func (m *MockSessionRepo) ListWithCursor(ctx context.Context, in repo.ListSessionsQuery) ([]model.Session, error) {
+	args := m.Called(ctx, in)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -76,6 +106,35 @@ func (m *MockSessionRepo) ListAllMessagesBySession(ctx context.Context, sessionI
 	return args.Get(0).([]model.Message), args.Error(1)
 }
 
+func (m *MockSessionRepo) ListLatestMessagesWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error) {
+	args := m.Called(ctx, projectID, afterCreatedAt, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Message), args.Error(1)
+}
+
+func (m *MockSessionRepo) SearchMessagesByProject(ctx context.Context, projectID uuid.UUID, query string, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error) {
+	args := m.Called(ctx, projectID, query, afterCreatedAt, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Message), args.Error(1)
+}
+
+func (m *MockSessionRepo) ListMessagesWithoutSearchText(ctx context.Context, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Message, error) {
+	args := m.Called(ctx, afterCreatedAt, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Message), args.Error(1)
+}
+
+func (m *MockSessionRepo) SetMessageSearchText(ctx context.Context, messageID uuid.UUID, text string) error {
+	args := m.Called(ctx, messageID, text)
+	return args.Error(0)
+}
+
 func (m *MockSessionRepo) GetObservingStatus(ctx context.Context, sessionID string) (*model.MessageObservingStatus, error) {
 	args := m.Called(ctx, sessionID)
 	if args.Get(0) == nil {
@@ -84,6 +143,60 @@ func (m *MockSessionRepo) GetObservingStatus(ctx context.Context, sessionID stri
 	return args.Get(0).(*model.MessageObservingStatus), args.Error(1)
 }
 
+func (m *MockSessionRepo) SyncLearningStatus(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionRepo) CountMessagesByBucket(ctx context.Context, sessionID uuid.UUID, bucket string, start, end time.Time) ([]model.MessageActivityBucket, error) {
+	args := m.Called(ctx, sessionID, bucket, start, end)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.MessageActivityBucket), args.Error(1)
+}
+
+func (m *MockSessionRepo) GetMessagesVersion(ctx context.Context, sessionID uuid.UUID) (*model.MessagesVersion, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.MessagesVersion), args.Error(1)
+}
+
+func (m *MockSessionRepo) ListPartsSHA256(ctx context.Context, sessionID uuid.UUID) ([]string, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockSessionRepo) GetLatestMessageID(ctx context.Context, sessionID uuid.UUID) (uuid.UUID, error) {
+	args := m.Called(ctx, sessionID)
+	return args.Get(0).(uuid.UUID), args.Error(1)
+}
+
+func (m *MockSessionRepo) SetSystemPrompt(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, prompt string) error {
+	args := m.Called(ctx, projectID, sessionID, prompt)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) MoveToSpace(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, spaceID uuid.UUID) error {
+	args := m.Called(ctx, projectID, sessionID, spaceID)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) DisconnectFromSpace(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error {
+	args := m.Called(ctx, projectID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) CountMessagesByProject(ctx context.Context, projectID uuid.UUID) (int64, error) {
+	args := m.Called(ctx, projectID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 // MockAssetReferenceRepo is a mock implementation of AssetReferenceRepo
 type MockAssetReferenceRepo struct {
 	mock.Mock
@@ -109,6 +222,79 @@ func (m *MockAssetReferenceRepo) BatchDecrementAssetRefs(ctx context.Context, pr
 	return args.Error(0)
 }
 
+func (m *MockAssetReferenceRepo) BatchDecrementAssetRefsDelta(ctx context.Context, projectID uuid.UUID, assets []model.Asset) (*model.AssetRefDelta, error) {
+	args := m.Called(ctx, projectID, assets)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.AssetRefDelta), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) IncrementExistingAssetRef(ctx context.Context, projectID uuid.UUID, sha256 string) (*model.AssetReference, error) {
+	args := m.Called(ctx, projectID, sha256)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.AssetReference), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) Get(ctx context.Context, projectID uuid.UUID, sha256 string) (*model.AssetReference, error) {
+	args := m.Called(ctx, projectID, sha256)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.AssetReference), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.AssetReference, error) {
+	args := m.Called(ctx, projectID, afterCreatedAt, afterID, limit, timeDesc)
+	return args.Get(0).([]model.AssetReference), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) ListUnreferenced(ctx context.Context, updatedBefore time.Time, limit int) ([]model.AssetReference, error) {
+	args := m.Called(ctx, updatedBefore, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.AssetReference), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) DeleteUnreferenced(ctx context.Context, id uuid.UUID, updatedBefore time.Time) (string, error) {
+	args := m.Called(ctx, id, updatedBefore)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) UntrackedS3Keys(ctx context.Context, keys []string) ([]string, error) {
+	args := m.Called(ctx, keys)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) MarkScanPending(ctx context.Context, projectID uuid.UUID, sha256 string) (bool, error) {
+	args := m.Called(ctx, projectID, sha256)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) SetScanStatus(ctx context.Context, projectID uuid.UUID, sha256 string, status string) error {
+	args := m.Called(ctx, projectID, sha256, status)
+	return args.Error(0)
+}
+
+func (m *MockAssetReferenceRepo) InfectedS3Keys(ctx context.Context, keys []string) ([]string, error) {
+	args := m.Called(ctx, keys)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockAssetReferenceRepo) TotalSizeByProject(ctx context.Context, projectID uuid.UUID) (int64, error) {
+	args := m.Called(ctx, projectID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 // MockBlobService is a mock implementation of blob service
 type MockBlobService struct {
 	mock.Mock
@@ -137,8 +323,8 @@ type MockPublisher struct {
 	mock.Mock
 }
 
-func (m *MockPublisher) PublishJSON(ctx context.Context, exchange, routingKey string, data interface{}) error {
-	args := m.Called(ctx, exchange, routingKey, data)
+func (m *MockPublisher) PublishJSONWithID(ctx context.Context, exchange, routingKey, messageID string, data interface{}) error {
+	args := m.Called(ctx, exchange, routingKey, messageID, data)
 	return args.Error(0)
 }
 
@@ -193,7 +379,7 @@ func TestSessionService_Create(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			err := service.Create(ctx, tt.session)
 
@@ -229,7 +415,7 @@ func TestSessionService_Delete(t *testing.T) {
 			projectID: projectID,
 			sessionID: sessionID,
 			setup: func(repo *MockSessionRepo) {
-				repo.On("Delete", ctx, projectID, sessionID).Return(nil)
+				repo.On("Delete", ctx, projectID, sessionID).Return(&model.AssetRefDelta{}, nil)
 			},
 			wantErr: false,
 		},
@@ -239,7 +425,7 @@ func TestSessionService_Delete(t *testing.T) {
 			sessionID: uuid.UUID{},
 			setup: func(repo *MockSessionRepo) {
 				// Empty UUID will call Delete, because len(uuid.UUID{}) != 0
-				repo.On("Delete", ctx, projectID, mock.AnythingOfType("uuid.UUID")).Return(nil)
+				repo.On("Delete", ctx, projectID, mock.AnythingOfType("uuid.UUID")).Return(&model.AssetRefDelta{}, nil)
 			},
 			wantErr: false, // Actually won't error
 		},
@@ -248,7 +434,7 @@ func TestSessionService_Delete(t *testing.T) {
 			projectID: projectID,
 			sessionID: sessionID,
 			setup: func(repo *MockSessionRepo) {
-				repo.On("Delete", ctx, projectID, sessionID).Return(errors.New("deletion failed"))
+				repo.On("Delete", ctx, projectID, sessionID).Return(nil, errors.New("deletion failed"))
 			},
 			wantErr: true,
 		},
@@ -271,9 +457,9 @@ func TestSessionService_Delete(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
-			err := service.Delete(ctx, tt.projectID, tt.sessionID)
+			_, err := service.Delete(ctx, tt.projectID, tt.sessionID)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -356,7 +542,7 @@ func TestSessionService_GetByID(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			result, err := service.GetByID(ctx, tt.session)
 
@@ -395,7 +581,7 @@ func TestSessionService_UpdateByID(t *testing.T) {
 			setup: func(repo *MockSessionRepo) {
 				repo.On("Update", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
-				})).Return(nil)
+				}), []string(nil)).Return(nil)
 			},
 			wantErr: false,
 		},
@@ -405,7 +591,7 @@ func TestSessionService_UpdateByID(t *testing.T) {
 				ID: sessionID,
 			},
 			setup: func(repo *MockSessionRepo) {
-				repo.On("Update", ctx, mock.AnythingOfType("*model.Session")).Return(errors.New("update failed"))
+				repo.On("Update", ctx, mock.AnythingOfType("*model.Session"), []string(nil)).Return(errors.New("update failed"))
 			},
 			wantErr: true,
 		},
@@ -428,7 +614,7 @@ func TestSessionService_UpdateByID(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			err := service.UpdateByID(ctx, tt.session)
 
@@ -450,6 +636,8 @@ func TestSessionService_List(t *testing.T) {
 	ctx := context.Background()
 	projectID := uuid.New()
 	spaceID := uuid.New()
+	createdBefore := time.Now().UTC()
+	createdAfter := createdBefore.Add(-7 * 24 * time.Hour)
 
 	tests := []struct {
 		name    string
@@ -466,7 +654,7 @@ func TestSessionService_List(t *testing.T) {
 				NotConnected: false,
 				Limit:        10,
 			},
-			setup: func(repo *MockSessionRepo) {
+			setup: func(sessionRepo *MockSessionRepo) {
 				expectedSessions := []model.Session{
 					{
 						ID:        uuid.New(),
@@ -477,7 +665,7 @@ func TestSessionService_List(t *testing.T) {
 						ProjectID: projectID,
 					},
 				}
-				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
+				sessionRepo.On("ListWithCursor", ctx, repo.ListSessionsQuery{ProjectID: projectID, SortBy: model.SessionSortCreatedAt, Limit: 11}).Return(expectedSessions, nil)
 			},
 			wantErr: false,
 		},
@@ -489,7 +677,7 @@ func TestSessionService_List(t *testing.T) {
 				NotConnected: false,
 				Limit:        10,
 			},
-			setup: func(repo *MockSessionRepo) {
+			setup: func(sessionRepo *MockSessionRepo) {
 				expectedSessions := []model.Session{
 					{
 						ID:        uuid.New(),
@@ -497,7 +685,7 @@ func TestSessionService_List(t *testing.T) {
 						SpaceID:   &spaceID,
 					},
 				}
-				repo.On("ListWithCursor", ctx, projectID, &spaceID, false, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
+				sessionRepo.On("ListWithCursor", ctx, repo.ListSessionsQuery{ProjectID: projectID, SpaceID: &spaceID, SortBy: model.SessionSortCreatedAt, Limit: 11}).Return(expectedSessions, nil)
 			},
 			wantErr: false,
 		},
@@ -509,7 +697,7 @@ func TestSessionService_List(t *testing.T) {
 				NotConnected: true,
 				Limit:        10,
 			},
-			setup: func(repo *MockSessionRepo) {
+			setup: func(sessionRepo *MockSessionRepo) {
 				expectedSessions := []model.Session{
 					{
 						ID:        uuid.New(),
@@ -517,7 +705,46 @@ func TestSessionService_List(t *testing.T) {
 						SpaceID:   nil,
 					},
 				}
-				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), true, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
+				sessionRepo.On("ListWithCursor", ctx, repo.ListSessionsQuery{ProjectID: projectID, NotConnected: true, SortBy: model.SessionSortCreatedAt, Limit: 11}).Return(expectedSessions, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "successful sessions retrieval - filter by learning status",
+			input: ListSessionsInput{
+				ProjectID:      projectID,
+				LearningStatus: model.LearningStatusPending,
+				Limit:          10,
+			},
+			setup: func(sessionRepo *MockSessionRepo) {
+				expectedSessions := []model.Session{
+					{
+						ID:        uuid.New(),
+						ProjectID: projectID,
+						SpaceID:   &spaceID,
+					},
+				}
+				sessionRepo.On("ListWithCursor", ctx, repo.ListSessionsQuery{ProjectID: projectID, LearningStatus: model.LearningStatusPending, SortBy: model.SessionSortCreatedAt, Limit: 11}).Return(expectedSessions, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "successful sessions retrieval - filter by created_at range",
+			input: ListSessionsInput{
+				ProjectID:     projectID,
+				CreatedAfter:  &createdAfter,
+				CreatedBefore: &createdBefore,
+				Limit:         10,
+			},
+			setup: func(sessionRepo *MockSessionRepo) {
+				expectedSessions := []model.Session{
+					{
+						ID:        uuid.New(),
+						ProjectID: projectID,
+						CreatedAt: createdAfter.Add(time.Hour),
+					},
+				}
+				sessionRepo.On("ListWithCursor", ctx, repo.ListSessionsQuery{ProjectID: projectID, CreatedAfter: &createdAfter, CreatedBefore: &createdBefore, SortBy: model.SessionSortCreatedAt, Limit: 11}).Return(expectedSessions, nil)
 			},
 			wantErr: false,
 		},
@@ -529,8 +756,8 @@ func TestSessionService_List(t *testing.T) {
 				NotConnected: false,
 				Limit:        10,
 			},
-			setup: func(repo *MockSessionRepo) {
-				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return([]model.Session{}, nil)
+			setup: func(sessionRepo *MockSessionRepo) {
+				sessionRepo.On("ListWithCursor", ctx, repo.ListSessionsQuery{ProjectID: projectID, SortBy: model.SessionSortCreatedAt, Limit: 11}).Return([]model.Session{}, nil)
 			},
 			wantErr: false,
 		},
@@ -542,8 +769,8 @@ func TestSessionService_List(t *testing.T) {
 				NotConnected: false,
 				Limit:        10,
 			},
-			setup: func(repo *MockSessionRepo) {
-				repo.On("ListWithCursor", ctx, projectID, (*uuid.UUID)(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("database error"))
+			setup: func(sessionRepo *MockSessionRepo) {
+				sessionRepo.On("ListWithCursor", ctx, repo.ListSessionsQuery{ProjectID: projectID, SortBy: model.SessionSortCreatedAt, Limit: 11}).Return(nil, errors.New("database error"))
 			},
 			wantErr: true,
 		},
@@ -551,8 +778,8 @@ func TestSessionService_List(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			repo := &MockSessionRepo{}
-			tt.setup(repo)
+			sessionRepo := &MockSessionRepo{}
+			tt.setup(sessionRepo)
 
 			logger := zap.NewNop()
 			mockAssetRefRepo := &MockAssetReferenceRepo{}
@@ -566,7 +793,7 @@ func TestSessionService_List(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(sessionRepo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			result, err := service.List(ctx, tt.input)
 
@@ -581,11 +808,37 @@ func TestSessionService_List(t *testing.T) {
 				assert.NotNil(t, result)
 			}
 
-			repo.AssertExpectations(t)
+			sessionRepo.AssertExpectations(t)
 		})
 	}
 }
 
+func TestSessionService_List_SortBy(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	count := int64(5)
+	first := model.Session{ID: uuid.New(), ProjectID: projectID, MessageCount: &count}
+	second := model.Session{ID: uuid.New(), ProjectID: projectID}
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("ListWithCursor", ctx, repo.ListSessionsQuery{ProjectID: projectID, SortBy: model.SessionSortMessageCount, Limit: 2, TimeDesc: true}).Return([]model.Session{first, second}, nil)
+	service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+	out, err := service.List(ctx, ListSessionsInput{ProjectID: projectID, SortBy: model.SessionSortMessageCount, Limit: 1, TimeDesc: true})
+	require.NoError(t, err)
+	assert.True(t, out.HasMore)
+	sortBy, key, id, err := paging.DecodeSortCursor(out.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, model.SessionSortMessageCount, sortBy)
+	assert.Equal(t, count, key)
+	assert.Equal(t, first.ID, id)
+
+	// the cursor only continues the ordering it was returned for
+	_, err = service.List(ctx, ListSessionsInput{ProjectID: projectID, Cursor: out.NextCursor, Limit: 1})
+	assert.ErrorIs(t, err, paging.ErrInvalidCursor)
+	sessionRepo.AssertExpectations(t)
+}
+
 func TestPartIn_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -735,7 +988,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 				TimeDesc:  false,
 			},
 			setup: func(repo *MockSessionRepo) {
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("query failure"))
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("query failure"))
 			},
 			wantErr: true,
 		},
@@ -750,7 +1003,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 				msgs := []model.Message{
 					{ID: uuid.New(), SessionID: sessionID, Role: "user"},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -765,7 +1018,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 				msgs := []model.Message{
 					{ID: uuid.New(), SessionID: sessionID, Role: "user"},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -846,7 +1099,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 				},
 			}
 			// Note: blob is nil in test, so GetMessages will skip DownloadJSON and PresignGet
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			result, err := service.GetMessages(ctx, tt.input)
 
@@ -909,7 +1162,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg2ID, SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-2 * time.Hour)},
 					{ID: msg3ID, SessionID: sessionID, Role: "user", CreatedAt: now.Add(-1 * time.Hour)},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -933,7 +1186,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg2ID, SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-2 * time.Hour)},
 					{ID: msg1ID, SessionID: sessionID, Role: "user", CreatedAt: now.Add(-3 * time.Hour)},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -957,7 +1210,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg2ID, SessionID: sessionID, Role: "assistant", CreatedAt: now},
 					{ID: msg1ID, SessionID: sessionID, Role: "user", CreatedAt: now},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -983,7 +1236,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg1ID, SessionID: sessionID, Role: "user", CreatedAt: now.Add(-3 * time.Hour)},
 					{ID: msg3ID, SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-1 * time.Hour)},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -1006,7 +1259,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			result, err := service.GetMessages(ctx, tt.input)
 
@@ -1040,3 +1293,1767 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestSessionService_GetMessages_OutputDesc(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	now := time.Now()
+
+	msg1 := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: now.Add(-3 * time.Hour)}
+	msg2 := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-2 * time.Hour)}
+	msg3 := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: now.Add(-1 * time.Hour)}
+
+	tests := []struct {
+		name           string
+		input          GetMessagesInput
+		setup          func(*MockSessionRepo)
+		expectedOrder  []uuid.UUID
+		expectedCursor string
+	}{
+		{
+			name: "output_desc returns newest first",
+			input: GetMessagesInput{
+				SessionID:  sessionID,
+				Limit:      10,
+				OutputDesc: true,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 11, false).Return([]model.Message{msg1, msg2, msg3}, nil)
+			},
+			expectedOrder: []uuid.UUID{msg3.ID, msg2.ID, msg1.ID},
+		},
+		{
+			name: "time_desc page keeps newest messages and cursor with output_desc",
+			input: GetMessagesInput{
+				SessionID:  sessionID,
+				Limit:      2,
+				TimeDesc:   true,
+				OutputDesc: true,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 3, true).Return([]model.Message{msg3, msg2, msg1}, nil)
+			},
+			expectedOrder:  []uuid.UUID{msg3.ID, msg2.ID},
+			expectedCursor: paging.EncodeCursor(msg2.CreatedAt, msg2.ID),
+		},
+		{
+			name: "time_desc page keeps newest messages and cursor without output_desc",
+			input: GetMessagesInput{
+				SessionID: sessionID,
+				Limit:     2,
+				TimeDesc:  true,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 3, true).Return([]model.Message{msg3, msg2, msg1}, nil)
+			},
+			expectedOrder:  []uuid.UUID{msg2.ID, msg3.ID},
+			expectedCursor: paging.EncodeCursor(msg2.CreatedAt, msg2.ID),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			tt.setup(repo)
+
+			service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			result, err := service.GetMessages(ctx, tt.input)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedCursor, result.NextCursor)
+			assert.Equal(t, tt.expectedCursor != "", result.HasMore)
+			ids := make([]uuid.UUID, 0, len(result.Items))
+			for _, m := range result.Items {
+				ids = append(ids, m.ID)
+			}
+			assert.Equal(t, tt.expectedOrder, ids)
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionService_GetMessages_IsLatest(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	now := time.Now()
+
+	msg1 := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: now.Add(-3 * time.Hour)}
+	msg2 := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-2 * time.Hour)}
+	msg3 := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: now.Add(-1 * time.Hour)}
+
+	tests := []struct {
+		name       string
+		input      GetMessagesInput
+		setup      func(*MockSessionRepo)
+		wantLatest uuid.UUID
+	}{
+		{
+			name:  "full listing ends with the head",
+			input: GetMessagesInput{SessionID: sessionID},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{msg1, msg2, msg3}, nil)
+			},
+			wantLatest: msg3.ID,
+		},
+		{
+			name:  "first time_desc page starts with the head",
+			input: GetMessagesInput{SessionID: sessionID, Limit: 2, TimeDesc: true},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 3, true).Return([]model.Message{msg3, msg2, msg1}, nil)
+			},
+			wantLatest: msg3.ID,
+		},
+		{
+			name:  "head on a later page is looked up",
+			input: GetMessagesInput{SessionID: sessionID, Limit: 1},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 2, false).Return([]model.Message{msg1, msg2}, nil)
+				repo.On("GetLatestMessageID", ctx, sessionID).Return(msg3.ID, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			tt.setup(repo)
+			service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			out, err := service.GetMessages(ctx, tt.input)
+			require.NoError(t, err)
+			for _, m := range out.Items {
+				assert.Equal(t, m.ID == tt.wantLatest, m.IsLatest, m.ID)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCountPartTypes(t *testing.T) {
+	parts := []model.Part{
+		{Type: "text", Text: "hello"},
+		{Type: "image"},
+		{Type: "text", Text: "world"},
+		{Type: "tool-call"},
+	}
+
+	assert.Equal(t, map[string]int{"text": 2, "image": 1, "tool-call": 1}, countPartTypes(parts))
+	assert.Equal(t, map[string]int{}, countPartTypes(nil))
+}
+
+func TestSessionService_GetMessages_SummaryOnly(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	now := time.Now()
+
+	msg1 := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: now.Add(-2 * time.Hour), PartTypeCounts: datatypes.NewJSONType(map[string]int{"text": 1})}
+	msg2 := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-1 * time.Hour), PartTypeCounts: datatypes.NewJSONType(map[string]int{"tool-call": 2})}
+
+	repo := &MockSessionRepo{}
+	repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 11, true).Return([]model.Message{msg2, msg1}, nil)
+
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+	result, err := service.GetMessages(ctx, GetMessagesInput{
+		SessionID:   sessionID,
+		Limit:       10,
+		TimeDesc:    true,
+		SummaryOnly: true,
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, result.Items, 2)
+	assert.Equal(t, msg1.ID, result.Items[0].ID)
+	assert.Equal(t, map[string]int{"tool-call": 2}, result.Items[1].PartTypeCounts.Data())
+	assert.Nil(t, result.Items[0].Parts)
+	assert.Nil(t, result.PublicURLs)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_GetMessages_ClientSeq(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	now := time.Now()
+	seq := func(v int64) *int64 { return &v }
+
+	// imported messages carry their logical order, the live one sent after has none
+	imported1 := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", ClientSeq: seq(1), CreatedAt: now.Add(-1 * time.Minute)}
+	imported2 := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", ClientSeq: seq(2), CreatedAt: now.Add(-2 * time.Minute)}
+	live := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", CreatedAt: now.Add(-3 * time.Minute)}
+
+	repo := &MockSessionRepo{}
+	repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.UUID{}, 3, true).Return([]model.Message{live, imported2, imported1}, nil)
+	repo.On("ListBySessionWithCursor", ctx, sessionID, seq(2), imported2.CreatedAt.UTC(), imported2.ID, 3, true).Return([]model.Message{imported1}, nil)
+	repo.On("GetLatestMessageID", ctx, sessionID).Return(live.ID, nil)
+
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+	result, err := service.GetMessages(ctx, GetMessagesInput{SessionID: sessionID, Limit: 2, TimeDesc: true, SummaryOnly: true})
+	require.NoError(t, err)
+	require.True(t, result.HasMore)
+	assert.Equal(t, []uuid.UUID{imported2.ID, live.ID}, []uuid.UUID{result.Items[0].ID, result.Items[1].ID})
+	assert.True(t, result.Items[1].IsLatest)
+
+	result, err = service.GetMessages(ctx, GetMessagesInput{SessionID: sessionID, Limit: 2, TimeDesc: true, SummaryOnly: true, Cursor: result.NextCursor})
+	require.NoError(t, err)
+	assert.False(t, result.HasMore)
+	require.Len(t, result.Items, 1)
+	assert.Equal(t, imported1.ID, result.Items[0].ID)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_SyncLearningStatus(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		setup   func(*MockSessionRepo)
+		want    int64
+		wantErr bool
+	}{
+		{
+			name: "successful sync",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("SyncLearningStatus", ctx).Return(int64(3), nil)
+			},
+			want:    3,
+			wantErr: false,
+		},
+		{
+			name: "sync failure",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("SyncLearningStatus", ctx).Return(int64(0), errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			tt.setup(repo)
+
+			service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			n, err := service.SyncLearningStatus(ctx)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, n)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionService_UpdateSystemPrompt(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name      string
+		sessionID uuid.UUID
+		prompt    string
+		setup     func(*MockSessionRepo)
+		wantErr   bool
+		wantIs    error
+	}{
+		{
+			name:      "set system prompt",
+			sessionID: sessionID,
+			prompt:    "You are a helpful assistant.",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("SetSystemPrompt", ctx, projectID, sessionID, "You are a helpful assistant.").Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:      "clear system prompt",
+			sessionID: sessionID,
+			prompt:    "",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("SetSystemPrompt", ctx, projectID, sessionID, "").Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:      "empty session id",
+			sessionID: uuid.Nil,
+			prompt:    "You are a helpful assistant.",
+			setup:     func(repo *MockSessionRepo) {},
+			wantErr:   true,
+		},
+		{
+			name:      "repo failure",
+			sessionID: sessionID,
+			prompt:    "You are a helpful assistant.",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("SetSystemPrompt", ctx, projectID, sessionID, "You are a helpful assistant.").Return(errors.New("connection failed"))
+			},
+			wantErr: true,
+		},
+		{
+			name:      "session not in the project",
+			sessionID: sessionID,
+			prompt:    "You are a helpful assistant.",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("SetSystemPrompt", ctx, projectID, sessionID, "You are a helpful assistant.").Return(gorm.ErrRecordNotFound)
+			},
+			wantErr: true,
+			wantIs:  ErrSessionNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			tt.setup(repo)
+
+			service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			err := service.UpdateSystemPrompt(ctx, projectID, tt.sessionID, tt.prompt)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				if tt.wantIs != nil {
+					assert.ErrorIs(t, err, tt.wantIs)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionService_StoreMessage_Rules(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	store := &blob.LocalStore{Dir: t.TempDir()}
+	asset, err := store.UploadJSON(ctx, "parts", []model.Part{{Type: "text", Text: "hi"}})
+	require.NoError(t, err)
+	existing := []model.Message{{ID: uuid.New(), SessionID: sessionID, Role: "user", PartsAssetMeta: datatypes.NewJSONType(*asset)}}
+	unloaded := []model.Message{{ID: uuid.New(), SessionID: sessionID, Role: "user", PartsAssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "parts/missing.json"})}}
+
+	tests := []struct {
+		name    string
+		role    string
+		parts   []PartIn
+		rules   model.MessageRules
+		setup   func(*MockSessionRepo)
+		wantErr bool
+		// wantErrIs is the error expected instead of a rule violation
+		wantErrIs error
+	}{
+		{
+			name:    "no rules",
+			role:    "assistant",
+			setup:   func(repo *MockSessionRepo) {},
+			wantErr: false,
+		},
+		{
+			name:  "system prompt required and set",
+			role:  "user",
+			rules: model.MessageRules{RequireSystemPrompt: true},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("Get", ctx, mock.Anything).Return(&model.Session{
+					ID:      sessionID,
+					Configs: datatypes.JSONMap{"system_prompt": "You are a helpful assistant."},
+				}, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:  "system prompt required but missing",
+			role:  "user",
+			rules: model.MessageRules{RequireSystemPrompt: true},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID}, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name:  "first message with wrong role",
+			role:  "assistant",
+			rules: model.MessageRules{FirstMessageRole: "user"},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.Nil, 1, false).Return([]model.Message{}, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name:  "later message with other role",
+			role:  "assistant",
+			rules: model.MessageRules{FirstMessageRole: "user"},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.Nil, 1, false).Return(existing, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:    "first message with required role",
+			role:    "user",
+			rules:   model.MessageRules{FirstMessageRole: "user"},
+			setup:   func(repo *MockSessionRepo) {},
+			wantErr: false,
+		},
+		{
+			name:  "tool result without its tool call",
+			role:  "user",
+			parts: []PartIn{{Type: "tool-result", Text: "42", Meta: map[string]interface{}{"tool_call_id": "call_1"}}},
+			rules: model.MessageRules{ToolResultsFollowCalls: true},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.Nil, toolOrderPageSize, true).Return(existing, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name:  "tool result after a message whose parts failed to load",
+			role:  "user",
+			parts: []PartIn{{Type: "tool-result", Text: "42", Meta: map[string]interface{}{"tool_call_id": "call_1"}}},
+			rules: model.MessageRules{ToolResultsFollowCalls: true},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.Nil, toolOrderPageSize, true).Return(unloaded, nil)
+			},
+			wantErr:   true,
+			wantErrIs: ErrPartsNotLoaded,
+		},
+		{
+			name:  "text message with tool order required",
+			role:  "user",
+			parts: []PartIn{{Type: "text", Text: "hello"}},
+			rules: model.MessageRules{ToolResultsFollowCalls: true},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListBySessionWithCursor", ctx, sessionID, (*int64)(nil), time.Time{}, uuid.Nil, toolOrderPageSize, true).Return([]model.Message{}, nil)
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			tt.setup(repo)
+
+			service := &sessionService{sessionRepo: repo, s3: store, log: zap.NewNop()}
+
+			err := service.checkMessageRules(ctx, StoreMessageInput{
+				SessionID: sessionID,
+				Role:      tt.role,
+				Parts:     tt.parts,
+				Rules:     tt.rules,
+			})
+
+			if tt.wantErrIs != nil {
+				assert.ErrorIs(t, err, tt.wantErrIs)
+				assert.NotErrorIs(t, err, ErrMessageRuleViolation)
+			} else if tt.wantErr {
+				assert.ErrorIs(t, err, ErrMessageRuleViolation)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestToolOrderViolations(t *testing.T) {
+	call := func(ids ...string) model.Message {
+		m := model.Message{ID: uuid.New(), Role: "assistant"}
+		for _, id := range ids {
+			m.Parts = append(m.Parts, model.Part{Type: "tool-call", Meta: map[string]interface{}{"id": id, "name": "search"}})
+		}
+		return m
+	}
+	result := func(ids ...string) model.Message {
+		m := model.Message{ID: uuid.New(), Role: "user"}
+		for _, id := range ids {
+			m.Parts = append(m.Parts, model.Part{Type: "tool-result", Meta: map[string]interface{}{"tool_call_id": id}})
+		}
+		return m
+	}
+	text := func(role string) model.Message {
+		return model.Message{ID: uuid.New(), Role: role, Parts: []model.Part{{Type: "text", Text: "hi"}}}
+	}
+
+	type violation struct {
+		index      int
+		toolCallID string
+	}
+	tests := []struct {
+		name  string
+		msgs  []model.Message
+		atEnd bool
+		want  []violation
+	}{
+		{
+			name: "results follow their calls",
+			msgs: []model.Message{text("user"), call("a", "b"), result("a"), result("b"), text("assistant")},
+			want: []violation{},
+		},
+		{
+			name: "results in one message",
+			msgs: []model.Message{call("a", "b"), result("b", "a"), text("user")},
+			want: []violation{},
+		},
+		{
+			name: "result before its call",
+			msgs: []model.Message{text("user"), result("a"), call("a")},
+			want: []violation{{1, "a"}},
+		},
+		{
+			name: "message between call and result",
+			msgs: []model.Message{call("a"), text("user"), result("a")},
+			want: []violation{{1, "a"}, {2, "a"}},
+		},
+		{
+			name: "result answered twice",
+			msgs: []model.Message{call("a"), result("a"), result("a")},
+			want: []violation{{2, "a"}},
+		},
+		{
+			name: "unanswered call at end is allowed while sending",
+			msgs: []model.Message{text("user"), call("a")},
+			want: []violation{},
+		},
+		{
+			name:  "unanswered call at end",
+			msgs:  []model.Message{text("user"), call("a", "b"), result("b")},
+			atEnd: true,
+			want:  []violation{{1, "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []violation{}
+			for _, v := range toolOrderViolations(tt.msgs, tt.atEnd) {
+				assert.Equal(t, tt.msgs[v.Index].ID, v.MessageID)
+				assert.NotEmpty(t, v.Reason)
+				got = append(got, violation{v.Index, v.ToolCallID})
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSessionService_CheckToolOrder(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	store := &blob.LocalStore{Dir: t.TempDir()}
+	stored := func(role string, parts ...model.Part) model.Message {
+		asset, err := store.UploadJSON(ctx, "parts", parts)
+		require.NoError(t, err)
+		return model.Message{ID: uuid.New(), SessionID: sessionID, Role: role, PartsAssetMeta: datatypes.NewJSONType(*asset)}
+	}
+	call := stored("assistant", model.Part{Type: "tool-call", Meta: map[string]interface{}{"id": "call_1", "name": "search"}})
+	result := stored("user", model.Part{Type: "tool-result", Meta: map[string]interface{}{"tool_call_id": "call_1"}})
+	lost := model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", PartsAssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "parts/missing.json"})}
+
+	repo := &MockSessionRepo{}
+	service := &sessionService{sessionRepo: repo, s3: store, log: zap.NewNop()}
+
+	repo.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{call, result}, nil).Once()
+	check, err := service.CheckToolOrder(ctx, sessionID)
+	require.NoError(t, err)
+	assert.True(t, check.ReplayReady)
+
+	// the result would follow a message without parts if the lost parts were taken as empty
+	repo.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{call, lost, result}, nil).Once()
+	_, err = service.CheckToolOrder(ctx, sessionID)
+	assert.ErrorIs(t, err, ErrPartsNotLoaded)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_StoreMessage_Quota(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+
+	tests := []struct {
+		name      string
+		global    config.QuotaCfg
+		overrides model.Quota
+		counted   bool
+		wantErr   bool
+	}{
+		{name: "unlimited", counted: false, wantErr: false},
+		{name: "under message quota", global: config.QuotaCfg{MaxMessages: 11}, counted: true, wantErr: false},
+		{name: "message quota reached", global: config.QuotaCfg{MaxMessages: 10}, counted: true, wantErr: true},
+		{name: "project raises message quota", global: config.QuotaCfg{MaxMessages: 10}, overrides: model.Quota{MaxMessages: 100}, counted: true, wantErr: false},
+		{name: "asset bytes quota reached", global: config.QuotaCfg{MaxAssetBytes: 2048}, counted: true, wantErr: true},
+		{name: "project raises asset bytes quota", overrides: model.Quota{MaxAssetBytes: 4096}, counted: true, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			refs := &MockAssetReferenceRepo{}
+			if tt.counted {
+				repo.On("CountMessagesByProject", ctx, projectID).Return(int64(10), nil).Once()
+				refs.On("TotalSizeByProject", ctx, projectID).Return(int64(2048), nil).Once()
+			}
+
+			service := &sessionService{sessionRepo: repo, assetReferenceRepo: refs, log: zap.NewNop(), cfg: &config.Config{Quota: tt.global}}
+
+			err := service.checkQuota(ctx, projectID, tt.overrides)
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrQuotaExceeded)
+			} else {
+				assert.NoError(t, err)
+			}
+			repo.AssertExpectations(t)
+			refs.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionService_GetUsage(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+
+	repo := &MockSessionRepo{}
+	repo.On("CountMessagesByProject", ctx, projectID).Return(int64(42), nil)
+	refs := &MockAssetReferenceRepo{}
+	refs.On("TotalSizeByProject", ctx, projectID).Return(int64(1024), nil)
+
+	service := &sessionService{sessionRepo: repo, assetReferenceRepo: refs, log: zap.NewNop(), cfg: &config.Config{Quota: config.QuotaCfg{MaxMessages: 100, MaxAssetBytes: 1 << 20}}}
+
+	out, err := service.GetUsage(ctx, projectID, model.Quota{MaxMessages: 50})
+	require.NoError(t, err)
+	assert.Equal(t, &GetUsageOutput{Messages: 42, MaxMessages: 50, AssetBytes: 1024, MaxAssetBytes: 1 << 20}, out)
+}
+
+func TestSessionService_GetFingerprint(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+
+	fingerprint := func(shas []string) *SessionFingerprint {
+		repo := &MockSessionRepo{}
+		repo.On("ListPartsSHA256", ctx, sessionID).Return(shas, nil).Once()
+		service := &sessionService{sessionRepo: repo, log: zap.NewNop()}
+
+		out, err := service.GetFingerprint(ctx, sessionID)
+		require.NoError(t, err)
+		return out
+	}
+
+	base := fingerprint([]string{"aaa", "bbb"})
+	assert.Len(t, base.Fingerprint, 64)
+	assert.Equal(t, 2, base.MessageCount)
+
+	// same parts, same fingerprint
+	assert.Equal(t, base, fingerprint([]string{"aaa", "bbb"}))
+	// reordered, changed or added messages change it
+	assert.NotEqual(t, base.Fingerprint, fingerprint([]string{"bbb", "aaa"}).Fingerprint)
+	assert.NotEqual(t, base.Fingerprint, fingerprint([]string{"aaa", "ccc"}).Fingerprint)
+	assert.NotEqual(t, base.Fingerprint, fingerprint([]string{"aaa", "bbb", "bbb"}).Fingerprint)
+	// hashes are delimited, concatenation does not collide
+	assert.NotEqual(t, base.Fingerprint, fingerprint([]string{"aaab", "bb"}).Fingerprint)
+
+	empty := fingerprint(nil)
+	assert.Equal(t, 0, empty.MessageCount)
+	assert.NotEqual(t, base.Fingerprint, empty.Fingerprint)
+
+	repo := &MockSessionRepo{}
+	repo.On("ListPartsSHA256", ctx, sessionID).Return(nil, errors.New("database error"))
+	service := &sessionService{sessionRepo: repo, log: zap.NewNop()}
+	_, err := service.GetFingerprint(ctx, sessionID)
+	assert.Error(t, err)
+}
+
+func TestSessionService_GetPartsCacheStats(t *testing.T) {
+	service := &sessionService{log: zap.NewNop()}
+
+	stats := service.GetPartsCacheStats()
+	assert.Equal(t, PartsCacheStats{TTLSeconds: 3600}, stats)
+
+	service.partsCacheHits.Add(3)
+	service.partsCacheMisses.Add(1)
+	service.partsS3Fallbacks.Add(1)
+
+	stats = service.GetPartsCacheStats()
+	assert.Equal(t, uint64(3), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(1), stats.S3Fallbacks)
+	assert.Equal(t, 0.75, stats.HitRatio)
+}
+
+func TestSessionService_GetMessages_WithPartsSource(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	now := time.Now()
+
+	store := &blob.LocalStore{Dir: t.TempDir()}
+	asset, err := store.UploadJSON(ctx, "parts", []model.Part{{Type: "text", Text: "hi"}})
+	require.NoError(t, err)
+
+	stored := model.Message{ID: uuid.New(), SessionID: sessionID, CreatedAt: now.Add(-2 * time.Minute), PartsAssetMeta: datatypes.NewJSONType(*asset)}
+	lost := model.Message{ID: uuid.New(), SessionID: sessionID, CreatedAt: now.Add(-1 * time.Minute), PartsAssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "parts/missing.json"})}
+
+	repo := &MockSessionRepo{}
+	repo.On("ListAllMessagesBySession", ctx, sessionID).Return([]model.Message{stored, lost}, nil)
+
+	service := &sessionService{sessionRepo: repo, s3: store, log: zap.NewNop(), cfg: &config.Config{}}
+
+	out, err := service.GetMessages(ctx, GetMessagesInput{SessionID: sessionID, WithPartsSource: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{stored.ID.String(): PartsFromS3, lost.ID.String(): PartsNotLoaded}, out.PartsSources)
+
+	out, err = service.GetMessages(ctx, GetMessagesInput{SessionID: sessionID})
+	require.NoError(t, err)
+	assert.Nil(t, out.PartsSources)
+}
+
+func TestSessionService_GetActivity(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(3 * time.Hour)
+
+	tests := []struct {
+		name      string
+		in        GetActivityInput
+		setup     func(*MockSessionRepo)
+		wantCount []int64
+		wantStart time.Time
+		wantErr   error
+	}{
+		{
+			name: "fills empty buckets",
+			in:   GetActivityInput{SessionID: sessionID, Bucket: "hour", Start: &start, End: &end},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("CountMessagesByBucket", ctx, sessionID, "hour", start, end).Return([]model.MessageActivityBucket{
+					{Start: start, Count: 2},
+					{Start: start.Add(2 * time.Hour), Count: 5},
+				}, nil)
+			},
+			wantCount: []int64{2, 0, 5},
+			wantStart: start,
+		},
+		{
+			name: "start is aligned to the bucket",
+			in: GetActivityInput{SessionID: sessionID, Bucket: "hour", Start: func() *time.Time {
+				t := start.Add(30 * time.Minute)
+				return &t
+			}(), End: &end},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("CountMessagesByBucket", ctx, sessionID, "hour", start, end).Return([]model.MessageActivityBucket{}, nil)
+			},
+			wantCount: []int64{0, 0, 0},
+			wantStart: start,
+		},
+		{
+			name:    "unsupported bucket",
+			in:      GetActivityInput{SessionID: sessionID, Bucket: "week", Start: &start, End: &end},
+			setup:   func(repo *MockSessionRepo) {},
+			wantErr: ErrInvalidActivityRange,
+		},
+		{
+			name:    "start after end",
+			in:      GetActivityInput{SessionID: sessionID, Bucket: "hour", Start: &end, End: &start},
+			setup:   func(repo *MockSessionRepo) {},
+			wantErr: ErrInvalidActivityRange,
+		},
+		{
+			name: "range too large for bucket",
+			in: GetActivityInput{SessionID: sessionID, Bucket: "minute", Start: &start, End: func() *time.Time {
+				t := start.Add(25 * time.Hour)
+				return &t
+			}()},
+			setup:   func(repo *MockSessionRepo) {},
+			wantErr: ErrInvalidActivityRange,
+		},
+		{
+			name: "repo failure",
+			in:   GetActivityInput{SessionID: sessionID, Bucket: "hour", Start: &start, End: &end},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("CountMessagesByBucket", ctx, sessionID, "hour", start, end).Return(nil, errors.New("database error"))
+			},
+			wantErr: errors.New("database error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			tt.setup(repo)
+
+			service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			out, err := service.GetActivity(ctx, tt.in)
+
+			if tt.wantErr != nil {
+				assert.Error(t, err)
+				if errors.Is(tt.wantErr, ErrInvalidActivityRange) {
+					assert.ErrorIs(t, err, ErrInvalidActivityRange)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantStart, out.Start)
+				counts := make([]int64, len(out.Items))
+				for i, item := range out.Items {
+					counts[i] = item.Count
+				}
+				assert.Equal(t, tt.wantCount, counts)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionService_PartsCacheTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		want int
+	}{
+		{name: "configured", cfg: &config.Config{Redis: config.RedisCfg{PartsCacheTTLSec: 600}}, want: 600},
+		{name: "unset falls back to default", cfg: &config.Config{}, want: 3600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewSessionService(&MockSessionRepo{}, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, tt.cfg, nil, nil, nil)
+			assert.Equal(t, tt.want, service.GetPartsCacheStats().TTLSeconds)
+		})
+	}
+}
+
+func TestSessionService_WarmPartsCache_NoRedis(t *testing.T) {
+	repo := &MockSessionRepo{}
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+	_, err := service.WarmPartsCache(context.Background(), uuid.New())
+
+	assert.ErrorIs(t, err, ErrPartsCacheUnavailable)
+	repo.AssertNotCalled(t, "ListAllMessagesBySession", mock.Anything, mock.Anything)
+}
+
+func TestSessionService_InvalidCursor(t *testing.T) {
+	ctx := context.Background()
+	valid := paging.EncodeCursor(time.Now(), uuid.New())
+
+	cursors := map[string]string{
+		"garbage":   "not a cursor!",
+		"truncated": valid[:len(valid)/2],
+	}
+
+	for name, cursor := range cursors {
+		t.Run(name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			_, err := service.List(ctx, ListSessionsInput{ProjectID: uuid.New(), Limit: 10, Cursor: cursor})
+			assert.ErrorIs(t, err, paging.ErrInvalidCursor)
+
+			_, err = service.GetMessages(ctx, GetMessagesInput{SessionID: uuid.New(), Limit: 10, Cursor: cursor})
+			assert.ErrorIs(t, err, paging.ErrInvalidCursor)
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionService_MoveToSpace(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	spaceID := uuid.New()
+
+	tests := []struct {
+		name    string
+		setup   func(*MockSessionRepo)
+		wantErr error
+	}{
+		{
+			name: "moved",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("MoveToSpace", ctx, projectID, sessionID, spaceID).Return(nil)
+			},
+		},
+		{
+			name: "space of another project",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("MoveToSpace", ctx, projectID, sessionID, spaceID).Return(gorm.ErrRecordNotFound)
+				repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+			},
+			wantErr: ErrSpaceNotInProject,
+		},
+		{
+			name: "session of another project",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("MoveToSpace", ctx, projectID, sessionID, spaceID).Return(gorm.ErrRecordNotFound)
+				repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: sessionID, ProjectID: uuid.New()}, nil)
+			},
+			wantErr: ErrSessionNotFound,
+		},
+		{
+			name: "missing session",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("MoveToSpace", ctx, projectID, sessionID, spaceID).Return(gorm.ErrRecordNotFound)
+				repo.On("Get", ctx, mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantErr: ErrSessionNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			tt.setup(repo)
+
+			service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			err := service.MoveToSpace(ctx, projectID, sessionID, spaceID)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+
+	t.Run("repo failure", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("MoveToSpace", ctx, projectID, sessionID, spaceID).Return(errors.New("connection refused"))
+
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+		err := service.MoveToSpace(ctx, projectID, sessionID, spaceID)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrSessionNotFound)
+		assert.NotErrorIs(t, err, ErrSpaceNotInProject)
+	})
+}
+
+func TestSessionService_DisconnectFromSpace(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name    string
+		repoErr error
+		wantErr error
+	}{
+		{name: "disconnected"},
+		{name: "missing session", repoErr: gorm.ErrRecordNotFound, wantErr: ErrSessionNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			repo.On("DisconnectFromSpace", ctx, projectID, sessionID).Return(tt.repoErr)
+
+			service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			err := service.DisconnectFromSpace(ctx, projectID, sessionID)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+
+	t.Run("repo failure", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("DisconnectFromSpace", ctx, projectID, sessionID).Return(errors.New("connection refused"))
+
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+		err := service.DisconnectFromSpace(ctx, projectID, sessionID)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrSessionNotFound)
+	})
+}
+
+func TestSessionService_PresignAsset(t *testing.T) {
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		BaseEndpoint: aws.String("http://localhost:9000"),
+		UsePathStyle: true,
+	})
+	svc := &sessionService{s3: &blob.S3Deps{Presigner: s3.NewPresignClient(client), Bucket: "assets"}}
+
+	before := time.Now()
+	publicURL, err := svc.presignAsset(context.Background(), model.Asset{S3Key: "assets/abc.png"}, time.Hour)
+	require.NoError(t, err)
+
+	assert.Contains(t, publicURL.URL, "/assets/assets/abc.png")
+	assert.False(t, publicURL.GeneratedAt.Before(before))
+	assert.Equal(t, time.Hour, publicURL.ExpireAt.Sub(publicURL.GeneratedAt))
+}
+
+func TestSessionService_ScanAssets(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	clean := model.Asset{Bucket: "assets", S3Key: "assets/p/clean.png", SHA256: "clean"}
+	infected := model.Asset{Bucket: "assets", S3Key: "assets/p/infected.png", SHA256: "infected"}
+	async := model.Asset{Bucket: "assets", S3Key: "assets/p/async.png", SHA256: "async"}
+	failed := model.Asset{Bucket: "assets", S3Key: "assets/p/failed.png", SHA256: "failed"}
+	scanned := model.Asset{Bucket: "assets", S3Key: "assets/p/scanned.png", SHA256: "scanned"}
+
+	var submitted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req scanner.Request
+		body, _ := io.ReadAll(r.Body)
+		_ = sonic.Unmarshal(body, &req)
+		submitted = append(submitted, req.SHA256)
+		assert.Equal(t, projectID, req.ProjectID)
+		switch req.SHA256 {
+		case "clean", "infected":
+			_, _ = w.Write([]byte(`{"status":"` + req.SHA256 + `"}`))
+		case "async":
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	r := &MockAssetReferenceRepo{}
+	for _, a := range []model.Asset{clean, infected, async, failed} {
+		r.On("MarkScanPending", ctx, projectID, a.SHA256).Return(true, nil)
+	}
+	r.On("MarkScanPending", ctx, projectID, scanned.SHA256).Return(false, nil)
+	r.On("SetScanStatus", ctx, projectID, "clean", model.ScanStatusClean).Return(nil)
+	r.On("SetScanStatus", ctx, projectID, "infected", model.ScanStatusInfected).Return(nil)
+	r.On("SetScanStatus", ctx, projectID, "failed", "").Return(nil)
+
+	svc := &sessionService{
+		assetReferenceRepo: r,
+		scanner:            &scanner.Scanner{URL: srv.URL, HTTPClient: srv.Client(), Logger: zap.NewNop()},
+		log:                zap.NewNop(),
+	}
+	svc.scanAssets(ctx, projectID, []model.Asset{clean, infected, async, failed, scanned})
+
+	assert.Equal(t, []string{"clean", "infected", "async", "failed"}, submitted)
+	r.AssertExpectations(t)
+}
+
+func TestSessionService_InfectedAssets(t *testing.T) {
+	ctx := context.Background()
+	clean := model.Asset{S3Key: "assets/p/clean.png", SHA256: "clean"}
+	infected := model.Asset{S3Key: "assets/p/infected.png", SHA256: "infected"}
+
+	assetRepo := &MockAssetReferenceRepo{}
+	assetRepo.On("InfectedS3Keys", ctx, []string{clean.S3Key, infected.S3Key}).Return([]string{infected.S3Key}, nil)
+	svc := &sessionService{assetReferenceRepo: assetRepo, log: zap.NewNop()}
+
+	msgs := []model.Message{
+		{ID: uuid.New(), Parts: []model.Part{{Type: "text", Text: "look"}, {Type: "image", Asset: &clean}}},
+		{ID: uuid.New(), Parts: []model.Part{{Type: "image", Asset: &infected}}},
+	}
+	infectedKeys, err := svc.infectedAssets(ctx, msgs)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{infected.S3Key: true}, infectedKeys)
+
+	none, err := svc.infectedAssets(ctx, []model.Message{{ID: uuid.New(), Parts: []model.Part{{Type: "text", Text: "hi"}}}})
+	require.NoError(t, err)
+	assert.Empty(t, none)
+	assetRepo.AssertExpectations(t)
+}
+
+func TestSessionService_GetOrCreate(t *testing.T) {
+	ctx := context.Background()
+	clientID := "chat-42"
+
+	t.Run("without client session id", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		session := &model.Session{ProjectID: uuid.New()}
+		repo.On("Create", ctx, session).Return(nil)
+
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+		created, err := service.GetOrCreate(ctx, session)
+		require.NoError(t, err)
+		assert.True(t, created)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("with client session id", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		session := &model.Session{ProjectID: uuid.New(), ClientSessionID: &clientID}
+		repo.On("GetOrCreateByClientID", ctx, session).Return(false, nil)
+
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+		created, err := service.GetOrCreate(ctx, session)
+		require.NoError(t, err)
+		assert.False(t, created)
+		repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestSessionService_Feed(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	now := time.Now().UTC()
+
+	msgs := make([]model.Message, 3)
+	for i := range msgs {
+		msgs[i] = model.Message{
+			ID:             uuid.New(),
+			SessionID:      uuid.New(),
+			Role:           "user",
+			PartTypeCounts: datatypes.NewJSONType(map[string]int{"text": 1}),
+			CreatedAt:      now.Add(-time.Duration(i) * time.Minute),
+		}
+		msgs[i].Session = &model.Session{ID: msgs[i].SessionID, ProjectID: projectID}
+	}
+
+	repo := &MockSessionRepo{}
+	repo.On("ListLatestMessagesWithCursor", ctx, projectID, time.Time{}, uuid.Nil, 3).Return(msgs, nil)
+
+	svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+	out, err := svc.Feed(ctx, FeedInput{ProjectID: projectID, Limit: 2})
+	require.NoError(t, err)
+
+	assert.True(t, out.HasMore)
+	require.Len(t, out.Items, 2)
+	assert.Equal(t, msgs[0].SessionID, out.Items[0].Session.ID)
+	assert.Equal(t, msgs[0].ID, out.Items[0].LastMessage.ID)
+	assert.Equal(t, msgs[0].CreatedAt, out.Items[0].LastMessageAt)
+	assert.Equal(t, map[string]int{"text": 1}, out.Items[0].LastMessage.PartTypeCounts)
+
+	afterT, afterID, err := paging.DecodeCursor(out.NextCursor)
+	require.NoError(t, err)
+	assert.True(t, msgs[1].CreatedAt.Equal(afterT))
+	assert.Equal(t, msgs[1].ID, afterID)
+	repo.AssertExpectations(t)
+
+	_, err = svc.Feed(ctx, FeedInput{ProjectID: projectID, Limit: 2, Cursor: "not-a-cursor"})
+	assert.Error(t, err)
+}
+
+func TestSessionService_SearchMessages(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	now := time.Now().UTC()
+
+	noMatch := "nothing to see"
+	page := func(n int, from time.Time) []model.Message {
+		msgs := make([]model.Message, n)
+		for i := range msgs {
+			msgs[i] = model.Message{ID: uuid.New(), SessionID: uuid.New(), Role: "user", SearchText: &noMatch, CreatedAt: from.Add(-time.Duration(i) * time.Second)}
+		}
+		return msgs
+	}
+
+	t.Run("scan stops at the bound", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		afterT, afterID := time.Time{}, uuid.Nil
+		for i := 0; i < searchMaxScanned/searchPageSize; i++ {
+			msgs := page(searchPageSize, now.Add(-time.Duration(i)*time.Hour))
+			repo.On("SearchMessagesByProject", ctx, projectID, "deploy", afterT, afterID, searchPageSize).Return(msgs, nil).Once()
+			last := msgs[len(msgs)-1]
+			afterT, afterID = last.CreatedAt, last.ID
+		}
+
+		svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+		out, err := svc.SearchMessages(ctx, SearchMessagesInput{ProjectID: projectID, Query: "deploy", Limit: 20})
+		require.NoError(t, err)
+
+		assert.Empty(t, out.Items)
+		assert.True(t, out.HasMore)
+		cursorT, cursorID, err := paging.DecodeCursor(out.NextCursor)
+		require.NoError(t, err)
+		assert.True(t, afterT.Equal(cursorT))
+		assert.Equal(t, afterID, cursorID)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("end of messages", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("SearchMessagesByProject", ctx, projectID, "deploy", time.Time{}, uuid.Nil, searchPageSize).Return(page(3, now), nil).Once()
+
+		svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+		out, err := svc.SearchMessages(ctx, SearchMessagesInput{ProjectID: projectID, Query: "deploy", Limit: 20})
+		require.NoError(t, err)
+
+		assert.Empty(t, out.Items)
+		assert.False(t, out.HasMore)
+		assert.Empty(t, out.NextCursor)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("hits", func(t *testing.T) {
+		text, other := "tests passed\nready to deploy", "Deploy on Friday"
+		msgs := page(3, now)
+		msgs[0].SearchText = &text
+		msgs[2].SearchText = &other
+
+		repo := &MockSessionRepo{}
+		repo.On("SearchMessagesByProject", ctx, projectID, "deploy", time.Time{}, uuid.Nil, searchPageSize).Return(msgs, nil).Once()
+		svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+		out, err := svc.SearchMessages(ctx, SearchMessagesInput{ProjectID: projectID, Query: "deploy", Limit: 20})
+		require.NoError(t, err)
+
+		require.Len(t, out.Items, 2)
+		assert.Equal(t, msgs[0].ID, out.Items[0].MessageID)
+		assert.Equal(t, "tests passed\nready to deploy", out.Items[0].Snippet)
+		assert.Equal(t, msgs[2].ID, out.Items[1].MessageID)
+		assert.Equal(t, "Deploy on Friday", out.Items[1].Snippet)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		svc := NewSessionService(&MockSessionRepo{}, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+		_, err := svc.SearchMessages(ctx, SearchMessagesInput{ProjectID: projectID, Query: "deploy", Limit: 20, Cursor: "not-a-cursor"})
+		assert.Error(t, err)
+	})
+}
+
+func TestSessionService_BackfillSearchText(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	store := &blob.LocalStore{Dir: t.TempDir()}
+	asset, err := store.UploadJSON(ctx, "parts", []model.Part{
+		{Type: "text", Text: "Deploy on Friday"},
+		{Type: "tool-result", Text: "tests passed"},
+	})
+	require.NoError(t, err)
+	page := func(n int, from time.Time) []model.Message {
+		msgs := make([]model.Message, n)
+		for i := range msgs {
+			msgs[i] = model.Message{ID: uuid.New(), PartsAssetMeta: datatypes.NewJSONType(*asset), CreatedAt: from.Add(time.Duration(i) * time.Second)}
+		}
+		return msgs
+	}
+
+	t.Run("pages until the last message", func(t *testing.T) {
+		first, second := page(searchBackfillPageSize, now), page(2, now.Add(time.Hour))
+		last := first[len(first)-1]
+
+		repo := &MockSessionRepo{}
+		repo.On("ListMessagesWithoutSearchText", ctx, time.Time{}, uuid.Nil, searchBackfillPageSize).Return(first, nil).Once()
+		repo.On("ListMessagesWithoutSearchText", ctx, last.CreatedAt, last.ID, searchBackfillPageSize).Return(second, nil).Once()
+		repo.On("SetMessageSearchText", ctx, mock.Anything, "Deploy on Friday\ntests passed").Return(nil).Times(searchBackfillPageSize + 2)
+
+		svc := &sessionService{sessionRepo: repo, s3: store, log: zap.NewNop()}
+		n, err := svc.BackfillSearchText(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(searchBackfillPageSize+2), n)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("parts not loaded are skipped", func(t *testing.T) {
+		msgs := page(2, now)
+		msgs[0].PartsAssetMeta = datatypes.NewJSONType(model.Asset{S3Key: "parts/missing.json"})
+
+		repo := &MockSessionRepo{}
+		repo.On("ListMessagesWithoutSearchText", ctx, time.Time{}, uuid.Nil, searchBackfillPageSize).Return(msgs, nil).Once()
+		repo.On("SetMessageSearchText", ctx, msgs[1].ID, "Deploy on Friday\ntests passed").Return(nil).Once()
+
+		svc := &sessionService{sessionRepo: repo, s3: store, log: zap.NewNop()}
+		n, err := svc.BackfillSearchText(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("update error", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("ListMessagesWithoutSearchText", ctx, time.Time{}, uuid.Nil, searchBackfillPageSize).Return(page(1, now), nil).Once()
+		repo.On("SetMessageSearchText", ctx, mock.Anything, mock.Anything).Return(errors.New("db down")).Once()
+
+		svc := &sessionService{sessionRepo: repo, s3: store, log: zap.NewNop()}
+		n, err := svc.BackfillSearchText(ctx)
+		assert.ErrorContains(t, err, "db down")
+		assert.Zero(t, n)
+	})
+}
+
+func TestSearchSnippet(t *testing.T) {
+	text := partsSearchText([]model.Part{
+		{Type: "image"},
+		{Type: "tool-call", Text: "deploy"},
+		{Type: "text", Text: "We talked about the Deployment plan for Friday."},
+	})
+	assert.Equal(t, "We talked about the Deployment plan for Friday.", text)
+
+	snippet, ok := searchSnippet(text, "deployment", 10)
+	require.True(t, ok)
+	assert.Equal(t, "…about the Deployment plan for…", snippet)
+
+	snippet, ok = searchSnippet(text, "WE TALKED", 100)
+	require.True(t, ok)
+	assert.Equal(t, "We talked about the Deployment plan for Friday.", snippet)
+
+	snippet, ok = searchSnippet(partsSearchText([]model.Part{{Type: "tool-result", Text: "Ünïcode ÉTÉ result"}}), "été", 3)
+	require.True(t, ok)
+	assert.Equal(t, "…de ÉTÉ re…", snippet)
+
+	_, ok = searchSnippet(text, "missing", 10)
+	assert.False(t, ok)
+}
+
+func TestTextPreview(t *testing.T) {
+	parts := []model.Part{
+		{Type: "image"},
+		{Type: "text", Text: "   "},
+		{Type: "text", Text: " héllo world "},
+	}
+	assert.Equal(t, "héllo world", textPreview(parts, 20))
+	assert.Equal(t, "héllo…", textPreview(parts, 5))
+	assert.Empty(t, textPreview([]model.Part{{Type: "tool-call"}}, 20))
+}
+
+func TestCheckAssetType(t *testing.T) {
+	tests := []struct {
+		partType string
+		mime     string
+		wantErr  bool
+	}{
+		{partType: "image", mime: "image/png"},
+		{partType: "image", mime: "application/pdf", wantErr: true},
+		{partType: "image", mime: "text/plain; charset=utf-8", wantErr: true},
+		{partType: "image", mime: "application/octet-stream"},
+		{partType: "audio", mime: "audio/mpeg"},
+		{partType: "audio", mime: "video/mp4"},
+		{partType: "audio", mime: "image/jpeg", wantErr: true},
+		{partType: "video", mime: "video/webm"},
+		{partType: "video", mime: "audio/wave", wantErr: true},
+		{partType: "file", mime: "application/pdf"},
+		{partType: "file", mime: "image/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.partType+" "+tt.mime, func(t *testing.T) {
+			err := checkAssetType(tt.partType, tt.mime)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrAssetTypeMismatch)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSessionService_StoreMessage_RejectsMismatchedFile(t *testing.T) {
+	ctx := context.Background()
+
+	// a pdf declared as a png
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", `form-data; name="doc"; filename="cat.png"`)
+	h.Set("Content-Type", "image/png")
+	part, err := writer.CreatePart(h)
+	require.NoError(t, err)
+	_, _ = part.Write([]byte("%PDF-1.7\n"))
+	require.NoError(t, writer.Close())
+	form, err := multipart.NewReader(&buf, writer.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	fh := form.File["doc"][0]
+
+	content, err := blob.FormFileContent(fh)
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", content.ContentType, "the sniffed type wins over the declared one")
+
+	repo := &MockSessionRepo{}
+	svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+	_, err = svc.StoreMessage(ctx, StoreMessageInput{
+		ProjectID: uuid.New(),
+		SessionID: uuid.New(),
+		Role:      "user",
+		Parts:     []PartIn{{Type: "image", FileField: "doc"}},
+		Files:     map[string]*multipart.FileHeader{"doc": fh},
+	})
+	assert.ErrorIs(t, err, ErrAssetTypeMismatch)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_StoreMessage_StoresReusedFileOnce(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	// the same image under two form fields
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, name := range []string{"img", "copy"} {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+name+`"; filename="cat.png"`)
+		h.Set("Content-Type", "image/png")
+		part, err := writer.CreatePart(h)
+		require.NoError(t, err)
+		_, _ = part.Write(png)
+	}
+	require.NoError(t, writer.Close())
+	form, err := multipart.NewReader(&buf, writer.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+
+	content, err := blob.FormFileContent(form.File["img"][0])
+	require.NoError(t, err)
+	existing := model.Asset{Bucket: "assets", S3Key: "assets/cat.png", SHA256: content.SHA256, MIME: "image/png"}
+
+	refs := &MockAssetReferenceRepo{}
+	refs.On("IncrementExistingAssetRef", ctx, projectID, content.SHA256).Return(&model.AssetReference{
+		ProjectID: projectID,
+		SHA256:    content.SHA256,
+		S3Key:     existing.S3Key,
+		RefCount:  1,
+		AssetMeta: datatypes.NewJSONType(existing),
+	}, nil).Once()
+	// the parts JSON itself
+	refs.On("IncrementExistingAssetRef", ctx, projectID, mock.Anything).Return(&model.AssetReference{S3Key: "parts/p.json"}, nil).Once()
+
+	repo := &MockSessionRepo{}
+	repo.On("CreateMessageWithAssets", ctx, mock.Anything, mock.Anything).Return(nil)
+	repo.On("GetDisableTaskTracking", ctx, sessionID).Return(true, nil)
+
+	svc := NewSessionService(repo, refs, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+	msg, err := svc.StoreMessage(ctx, StoreMessageInput{
+		ProjectID: projectID,
+		SessionID: sessionID,
+		Role:      "user",
+		Parts: []PartIn{
+			{Type: "image", FileField: "img"},
+			{Type: "image", FileField: "img"},
+			{Type: "image", FileField: "copy"},
+		},
+		Files: map[string]*multipart.FileHeader{"img": form.File["img"][0], "copy": form.File["copy"][0]},
+	})
+	require.NoError(t, err)
+	require.Len(t, msg.Parts, 3)
+	for _, p := range msg.Parts {
+		require.NotNil(t, p.Asset)
+		assert.Equal(t, existing.S3Key, p.Asset.S3Key)
+	}
+	refs.AssertExpectations(t)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_StoreMessage_OutboxEvent(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	cfg := &config.Config{RabbitMQ: config.MQCfg{
+		ExchangeName: config.MQExchangeName{SessionMessage: "session.message"},
+		RoutingKey:   config.MQRoutingKey{SessionMessageInsert: "session.message.insert"},
+	}}
+
+	// the parts JSON is stored already
+	refs := &MockAssetReferenceRepo{}
+	refs.On("IncrementExistingAssetRef", ctx, projectID, mock.Anything).Return(&model.AssetReference{S3Key: "parts/p.json"}, nil)
+
+	var created *model.Message
+	var event *model.PendingMQEvent
+	repo := &MockSessionRepo{}
+	repo.On("GetDisableTaskTracking", ctx, sessionID).Return(false, nil)
+	repo.On("CreateMessageWithAssets", ctx, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		created, event = args.Get(1).(*model.Message), args.Get(2).(*model.PendingMQEvent)
+	}).Return(nil)
+
+	pub, events := &MockPublisher{}, &MockPendingMQEventRepo{}
+	pub.On("PublishJSONWithID", mock.Anything, "session.message", "session.message.insert", mock.Anything, mock.Anything).Return(nil)
+	events.On("Delete", mock.Anything, mock.Anything).Return(nil)
+	outbox := NewMQOutboxService(pub, events, cfg, zap.NewNop())
+
+	svc := NewSessionService(repo, refs, zap.NewNop(), nil, outbox, cfg, nil, nil, nil)
+	msg, err := svc.StoreMessage(ctx, StoreMessageInput{
+		ProjectID: projectID,
+		SessionID: sessionID,
+		Role:      "user",
+		Parts:     []PartIn{{Type: "text", Text: "hello"}},
+	})
+	require.NoError(t, err)
+
+	// the event is created with the message, then relayed
+	require.NotNil(t, event)
+	assert.Equal(t, msg.ID, created.ID)
+	assert.JSONEq(t, fmt.Sprintf(`{"project_id":%q,"session_id":%q,"message_id":%q}`, projectID, sessionID, msg.ID), string(event.Body))
+	events.AssertCalled(t, "Delete", mock.Anything, event.ID)
+	pub.AssertExpectations(t)
+
+	t.Run("no event with task tracking disabled", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("GetDisableTaskTracking", ctx, sessionID).Return(true, nil)
+		repo.On("CreateMessageWithAssets", ctx, mock.Anything, (*model.PendingMQEvent)(nil)).Return(nil)
+
+		svc := NewSessionService(repo, refs, zap.NewNop(), nil, outbox, cfg, nil, nil, nil)
+		_, err := svc.StoreMessage(ctx, StoreMessageInput{ProjectID: projectID, SessionID: sessionID, Role: "user", Parts: []PartIn{{Type: "text", Text: "hello"}}})
+		require.NoError(t, err)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestSessionService_StoreMessage_UploadsFilesConcurrently(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	// three distinct files
+	names := []string{"a", "b", "c"}
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, name := range names {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+name+`"; filename="`+name+`.txt"`)
+		h.Set("Content-Type", "text/plain")
+		part, err := writer.CreatePart(h)
+		require.NoError(t, err)
+		_, _ = part.Write([]byte("file " + name))
+	}
+	require.NoError(t, writer.Close())
+	form, err := multipart.NewReader(&buf, writer.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+
+	files := map[string]*multipart.FileHeader{}
+	shas := map[string]string{}
+	for _, name := range names {
+		files[name] = form.File[name][0]
+		content, err := blob.FormFileContent(files[name])
+		require.NoError(t, err)
+		shas[name] = content.SHA256
+	}
+	known := func(name string) *model.AssetReference {
+		return &model.AssetReference{
+			ProjectID: projectID,
+			SHA256:    shas[name],
+			S3Key:     "assets/" + name,
+			AssetMeta: datatypes.NewJSONType(model.Asset{SHA256: shas[name], S3Key: "assets/" + name}),
+		}
+	}
+	in := StoreMessageInput{
+		ProjectID: projectID,
+		SessionID: sessionID,
+		Role:      "user",
+		Parts:     []PartIn{{Type: "file", FileField: "c"}, {Type: "file", FileField: "a"}, {Type: "file", FileField: "b"}},
+		Files:     files,
+	}
+	cfg := &config.Config{Asset: config.AssetCfg{UploadConcurrency: 3}}
+
+	t.Run("parts keep their order", func(t *testing.T) {
+		refs := &MockAssetReferenceRepo{}
+		for _, name := range names {
+			refs.On("IncrementExistingAssetRef", ctx, projectID, shas[name]).Return(known(name), nil).Once()
+		}
+		// the parts JSON itself
+		refs.On("IncrementExistingAssetRef", ctx, projectID, mock.Anything).Return(&model.AssetReference{S3Key: "parts/p.json"}, nil).Once()
+
+		repo := &MockSessionRepo{}
+		repo.On("CreateMessageWithAssets", ctx, mock.Anything, mock.Anything).Return(nil)
+		repo.On("GetDisableTaskTracking", ctx, sessionID).Return(true, nil)
+
+		msg, err := NewSessionService(repo, refs, zap.NewNop(), nil, nil, cfg, nil, nil, nil).StoreMessage(ctx, in)
+		require.NoError(t, err)
+		require.Len(t, msg.Parts, 3)
+		for i, name := range []string{"c", "a", "b"} {
+			require.NotNil(t, msg.Parts[i].Asset)
+			assert.Equal(t, "assets/"+name, msg.Parts[i].Asset.S3Key)
+		}
+		refs.AssertExpectations(t)
+	})
+
+	t.Run("a failed upload releases the others", func(t *testing.T) {
+		refs := &MockAssetReferenceRepo{}
+		refs.On("IncrementExistingAssetRef", ctx, projectID, shas["a"]).Return(known("a"), nil).Once()
+		refs.On("IncrementExistingAssetRef", ctx, projectID, shas["b"]).Return(known("b"), nil).Once()
+		// failing once a and b are stored, else they might be skipped
+		refs.On("IncrementExistingAssetRef", ctx, projectID, shas["c"]).Return(nil, errors.New("db down")).After(100 * time.Millisecond).Once()
+		refs.On("BatchDecrementAssetRefsDelta", mock.Anything, projectID, mock.MatchedBy(func(assets []model.Asset) bool {
+			return len(assets) == 2 && assets[0].S3Key == "assets/a" && assets[1].S3Key == "assets/b"
+		})).Return(&model.AssetRefDelta{}, nil).Once()
+
+		repo := &MockSessionRepo{}
+		_, err := NewSessionService(repo, refs, zap.NewNop(), nil, nil, cfg, nil, nil, nil).StoreMessage(ctx, in)
+		assert.ErrorContains(t, err, "upload c failed")
+		refs.AssertExpectations(t)
+		repo.AssertNotCalled(t, "CreateMessageWithAssets", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+// countingAssetRefs keeps the asset reference counts in memory, for tests checking the counts a store leaves behind
+type countingAssetRefs struct {
+	MockAssetReferenceRepo
+	mu     sync.Mutex
+	counts map[string]int
+	assets map[string]model.Asset
+}
+
+func newCountingAssetRefs(known ...model.Asset) *countingAssetRefs {
+	r := &countingAssetRefs{counts: map[string]int{}, assets: map[string]model.Asset{}}
+	for _, a := range known {
+		r.counts[a.SHA256]++
+		r.assets[a.SHA256] = a
+	}
+	return r
+}
+
+func (r *countingAssetRefs) IncrementExistingAssetRef(ctx context.Context, projectID uuid.UUID, sha256 string) (*model.AssetReference, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts[sha256] == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	r.counts[sha256]++
+	a := r.assets[sha256]
+	return &model.AssetReference{ProjectID: projectID, SHA256: sha256, S3Key: a.S3Key, RefCount: r.counts[sha256], AssetMeta: datatypes.NewJSONType(a)}, nil
+}
+
+func (r *countingAssetRefs) IncrementAssetRef(ctx context.Context, projectID uuid.UUID, asset model.Asset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[asset.SHA256]++
+	r.assets[asset.SHA256] = asset
+	return nil
+}
+
+func (r *countingAssetRefs) BatchDecrementAssetRefsDelta(ctx context.Context, projectID uuid.UUID, assets []model.Asset) (*model.AssetRefDelta, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delta := &model.AssetRefDelta{}
+	for _, a := range assets {
+		if r.counts[a.SHA256]--; r.counts[a.SHA256] <= 0 {
+			delete(r.counts, a.SHA256)
+			delta.Deleted = append(delta.Deleted, model.AssetRefChange{SHA256: a.SHA256, S3Key: a.S3Key})
+		} else {
+			delta.Decremented = append(delta.Decremented, model.AssetRefChange{SHA256: a.SHA256, S3Key: a.S3Key, RefCount: r.counts[a.SHA256]})
+		}
+	}
+	return delta, nil
+}
+
+func (r *countingAssetRefs) snapshot() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return maps.Clone(r.counts)
+}
+
+func TestSessionService_StoreMessage_ReleasesRefsOnFailure(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, name := range []string{"known", "new"} {
+		part, err := writer.CreateFormFile(name, name+".txt")
+		require.NoError(t, err)
+		_, _ = part.Write([]byte("file " + name))
+	}
+	require.NoError(t, writer.Close())
+	form, err := multipart.NewReader(&buf, writer.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	known, err := blob.FormFileContent(form.File["known"][0])
+	require.NoError(t, err)
+
+	in := StoreMessageInput{
+		ProjectID: projectID,
+		SessionID: sessionID,
+		Role:      "user",
+		Parts:     []PartIn{{Type: "text", Text: "see attached"}, {Type: "file", FileField: "known"}, {Type: "file", FileField: "new"}},
+		Files:     map[string]*multipart.FileHeader{"known": form.File["known"][0], "new": form.File["new"][0]},
+	}
+	cfg := &config.Config{Asset: config.AssetCfg{UploadConcurrency: 2}}
+
+	t.Run("failed insert", func(t *testing.T) {
+		refs := newCountingAssetRefs(model.Asset{SHA256: known.SHA256, S3Key: "assets/known"})
+		before := refs.snapshot()
+
+		repo := &MockSessionRepo{}
+		repo.On("GetDisableTaskTracking", ctx, sessionID).Return(true, nil)
+		repo.On("CreateMessageWithAssets", ctx, mock.Anything, mock.Anything).Return(errors.New("insert failed"))
+
+		svc := NewSessionService(repo, refs, zap.NewNop(), &blob.LocalStore{Dir: t.TempDir()}, nil, cfg, nil, nil, nil)
+		_, err := svc.StoreMessage(ctx, in)
+		assert.ErrorContains(t, err, "insert failed")
+		assert.Equal(t, before, refs.snapshot(), "the file and parts references are released")
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("stored message keeps its refs", func(t *testing.T) {
+		refs := newCountingAssetRefs(model.Asset{SHA256: known.SHA256, S3Key: "assets/known"})
+
+		repo := &MockSessionRepo{}
+		repo.On("GetDisableTaskTracking", ctx, sessionID).Return(true, nil)
+		repo.On("CreateMessageWithAssets", ctx, mock.Anything, mock.Anything).Return(nil)
+
+		svc := NewSessionService(repo, refs, zap.NewNop(), &blob.LocalStore{Dir: t.TempDir()}, nil, cfg, nil, nil, nil)
+		msg, err := svc.StoreMessage(ctx, in)
+		require.NoError(t, err)
+		counts := refs.snapshot()
+		assert.Len(t, counts, 3, "the known file, the new file and the parts")
+		assert.Equal(t, 2, counts[known.SHA256])
+		assert.Equal(t, 1, counts[msg.PartsAssetMeta.Data().SHA256])
+	})
+}
+
+func TestSessionService_StoreAsset_SkipsUploadOfKnownContent(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+
+	// fake S3 answering object listings with no objects and counting PUTs
+	var puts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			puts.Add(1)
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.Header().Set("ETag", `"etag"`)
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = io.WriteString(w, `<ListBucketResult><IsTruncated>false</IsTruncated></ListBucketResult>`)
+		}
+	}))
+	defer server.Close()
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+	})
+	s3Deps := &blob.S3Deps{Client: client, Uploader: manager.NewUploader(client), Bucket: "assets"}
+
+	parts := []model.Part{{Type: "text", Text: "You are a helpful assistant."}}
+	content, err := blob.JSONContent(parts)
+	require.NoError(t, err)
+
+	refs := &MockAssetReferenceRepo{}
+	svc := &sessionService{assetReferenceRepo: refs, s3: s3Deps, log: zap.NewNop()}
+
+	// first upload: unknown content is put to S3
+	refs.On("IncrementExistingAssetRef", ctx, projectID, content.SHA256).Return(nil, gorm.ErrRecordNotFound).Once()
+	refs.On("IncrementAssetRef", ctx, projectID, mock.Anything).Return(nil).Once()
+
+	first, err := svc.storeAsset(ctx, projectID, "parts/"+projectID.String(), content)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), puts.Load())
+
+	// second upload of the same content: only the reference is incremented
+	refs.On("IncrementExistingAssetRef", ctx, projectID, content.SHA256).Return(&model.AssetReference{
+		ProjectID: projectID,
+		SHA256:    content.SHA256,
+		S3Key:     first.S3Key,
+		RefCount:  1,
+		AssetMeta: datatypes.NewJSONType(*first),
+	}, nil).Once()
+
+	second, err := svc.storeAsset(ctx, projectID, "parts/"+projectID.String(), content)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), puts.Load(), "identical content must not be uploaded again")
+	assert.Equal(t, first, second)
+	refs.AssertExpectations(t)
+}
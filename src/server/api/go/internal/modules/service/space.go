@@ -12,17 +12,19 @@ import (
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/repo"
 	"github.com/memodb-io/Acontext/internal/pkg/paging"
+	"github.com/memodb-io/Acontext/internal/pkg/requestid"
 	"go.uber.org/zap"
 )
 
 type SpaceService interface {
 	Create(ctx context.Context, m *model.Space) error
 	Delete(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) error
-	UpdateByID(ctx context.Context, m *model.Space) error
+	UpdateByID(ctx context.Context, m *model.Space, columns ...string) error
 	GetByID(ctx context.Context, m *model.Space) (*model.Space, error)
 	List(ctx context.Context, in ListSpacesInput) (*ListSpacesOutput, error)
 	ListExperienceConfirmations(ctx context.Context, in ListExperienceConfirmationsInput) (*ListExperienceConfirmationsOutput, error)
 	ConfirmExperience(ctx context.Context, spaceID uuid.UUID, experienceID uuid.UUID, save bool) (*model.ExperienceConfirmation, error)
+	ListSessionIDs(ctx context.Context, in ListSessionIDsInput) (*ListSessionIDsOutput, error)
 }
 
 type spaceService struct {
@@ -41,8 +43,23 @@ func NewSpaceService(r repo.SpaceRepo, publisher *mq.Publisher, cfg *config.Conf
 	}
 }
 
+// ErrSpaceLimitReached is returned by Create when the project already has the configured max spaces
+var ErrSpaceLimitReached = errors.New("project has reached the maximum number of spaces")
+
 func (s *spaceService) Create(ctx context.Context, m *model.Space) error {
-	return s.r.Create(ctx, m)
+	maxSpaces := s.cfg.Space.MaxPerProject
+	if maxSpaces <= 0 {
+		return s.r.Create(ctx, m)
+	}
+
+	created, err := s.r.CreateWithLimit(ctx, m, maxSpaces)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return fmt.Errorf("%w (%d)", ErrSpaceLimitReached, maxSpaces)
+	}
+	return nil
 }
 
 func (s *spaceService) Delete(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID) error {
@@ -52,11 +69,12 @@ func (s *spaceService) Delete(ctx context.Context, projectID uuid.UUID, spaceID
 	return s.r.Delete(ctx, &model.Space{ID: spaceID, ProjectID: projectID})
 }
 
-func (s *spaceService) UpdateByID(ctx context.Context, m *model.Space) error {
+// UpdateByID updates the space, see repo.SpaceRepo.Update for how columns are picked
+func (s *spaceService) UpdateByID(ctx context.Context, m *model.Space, columns ...string) error {
 	if len(m.ID) == 0 {
 		return errors.New("space id is empty")
 	}
-	return s.r.Update(ctx, m)
+	return s.r.Update(ctx, m, columns...)
 }
 
 func (s *spaceService) GetByID(ctx context.Context, m *model.Space) (*model.Space, error) {
@@ -197,7 +215,7 @@ func (s *spaceService) ConfirmExperience(ctx context.Context, spaceID uuid.UUID,
 				routingKey := "space.task.sop.complete"
 
 				if err := s.publisher.PublishJSON(ctx, exchangeName, routingKey, sopComplete); err != nil {
-					s.log.Error("failed to publish SOPComplete message", zap.Error(err))
+					requestid.Logger(ctx, s.log).Error("failed to publish SOPComplete message", zap.Error(err))
 					return nil, fmt.Errorf("failed to publish message: %w", err)
 				}
 			}
@@ -217,3 +235,47 @@ func (s *spaceService) ConfirmExperience(ctx context.Context, spaceID uuid.UUID,
 		return nil, nil
 	}
 }
+
+type ListSessionIDsInput struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	SpaceID   uuid.UUID `json:"space_id"`
+	Limit     int       `json:"limit"`
+	Cursor    string    `json:"cursor"`
+}
+
+type ListSessionIDsOutput struct {
+	Items      []uuid.UUID `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	HasMore    bool        `json:"has_more"`
+}
+
+// ListSessionIDs lists the IDs of the project's sessions connected to the space, oldest first
+func (s *spaceService) ListSessionIDs(ctx context.Context, in ListSessionIDsInput) (*ListSessionIDsOutput, error) {
+	var afterT time.Time
+	var afterID uuid.UUID
+	var err error
+	if in.Cursor != "" {
+		afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Query limit+1 is used to determine has_more
+	sessions, err := s.r.ListSessionsWithCursor(ctx, in.ProjectID, in.SpaceID, afterT, afterID, in.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListSessionIDsOutput{Items: make([]uuid.UUID, 0, min(len(sessions), in.Limit))}
+	if len(sessions) > in.Limit {
+		out.HasMore = true
+		sessions = sessions[:in.Limit]
+		last := sessions[len(sessions)-1]
+		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, sess := range sessions {
+		out.Items = append(out.Items, sess.ID)
+	}
+	return out, nil
+}
@@ -9,8 +9,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/config"
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/pkg/paging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -24,13 +26,18 @@ func (m *MockSpaceRepo) Create(ctx context.Context, s *model.Space) error {
 	return args.Error(0)
 }
 
+func (m *MockSpaceRepo) CreateWithLimit(ctx context.Context, s *model.Space, maxSpaces int) (bool, error) {
+	args := m.Called(ctx, s, maxSpaces)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockSpaceRepo) Delete(ctx context.Context, s *model.Space) error {
 	args := m.Called(ctx, s)
 	return args.Error(0)
 }
 
-func (m *MockSpaceRepo) Update(ctx context.Context, s *model.Space) error {
-	args := m.Called(ctx, s)
+func (m *MockSpaceRepo) Update(ctx context.Context, s *model.Space, columns ...string) error {
+	args := m.Called(ctx, s, columns)
 	return args.Error(0)
 }
 
@@ -71,16 +78,25 @@ func (m *MockSpaceRepo) DeleteExperienceConfirmation(ctx context.Context, spaceI
 	return args.Error(0)
 }
 
+func (m *MockSpaceRepo) ListSessionsWithCursor(ctx context.Context, projectID uuid.UUID, spaceID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int) ([]model.Session, error) {
+	args := m.Called(ctx, projectID, spaceID, afterCreatedAt, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Session), args.Error(1)
+}
+
 func TestSpaceService_Create(t *testing.T) {
 	ctx := context.Background()
 	projectID := uuid.New()
 
 	tests := []struct {
-		name    string
-		space   *model.Space
-		setup   func(*MockSpaceRepo)
-		wantErr bool
-		errMsg  string
+		name      string
+		space     *model.Space
+		maxSpaces int
+		setup     func(*MockSpaceRepo)
+		wantErr   bool
+		errMsg    string
 	}{
 		{
 			name: "successful space creation",
@@ -104,6 +120,31 @@ func TestSpaceService_Create(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "below space limit",
+			space: &model.Space{
+				ID:        uuid.New(),
+				ProjectID: projectID,
+			},
+			maxSpaces: 3,
+			setup: func(repo *MockSpaceRepo) {
+				repo.On("CreateWithLimit", ctx, mock.AnythingOfType("*model.Space"), 3).Return(true, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "space limit reached",
+			space: &model.Space{
+				ID:        uuid.New(),
+				ProjectID: projectID,
+			},
+			maxSpaces: 3,
+			setup: func(repo *MockSpaceRepo) {
+				repo.On("CreateWithLimit", ctx, mock.AnythingOfType("*model.Space"), 3).Return(false, nil)
+			},
+			wantErr: true,
+			errMsg:  "maximum number of spaces",
+		},
 	}
 
 	for _, tt := range tests {
@@ -111,7 +152,8 @@ func TestSpaceService_Create(t *testing.T) {
 			repo := &MockSpaceRepo{}
 			tt.setup(repo)
 
-			service := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop())
+			cfg := &config.Config{Space: config.SpaceCfg{MaxPerProject: tt.maxSpaces}}
+			service := NewSpaceService(repo, nil, cfg, zap.NewNop())
 			err := service.Create(ctx, tt.space)
 
 			if tt.wantErr {
@@ -214,7 +256,7 @@ func TestSpaceService_UpdateByID(t *testing.T) {
 			setup: func(repo *MockSpaceRepo) {
 				repo.On("Update", ctx, mock.MatchedBy(func(s *model.Space) bool {
 					return s.ID == spaceID
-				})).Return(nil)
+				}), []string(nil)).Return(nil)
 			},
 			wantErr: false,
 		},
@@ -225,7 +267,7 @@ func TestSpaceService_UpdateByID(t *testing.T) {
 			},
 			setup: func(repo *MockSpaceRepo) {
 				// Empty UUID will call Update, because len(uuid.UUID{}) != 0
-				repo.On("Update", ctx, mock.AnythingOfType("*model.Space")).Return(nil)
+				repo.On("Update", ctx, mock.AnythingOfType("*model.Space"), []string(nil)).Return(nil)
 			},
 			wantErr: false, // Actually won't error
 		},
@@ -235,7 +277,7 @@ func TestSpaceService_UpdateByID(t *testing.T) {
 				ID: spaceID,
 			},
 			setup: func(repo *MockSpaceRepo) {
-				repo.On("Update", ctx, mock.AnythingOfType("*model.Space")).Return(errors.New("update failed"))
+				repo.On("Update", ctx, mock.AnythingOfType("*model.Space"), []string(nil)).Return(errors.New("update failed"))
 			},
 			wantErr: true,
 		},
@@ -337,6 +379,35 @@ func TestSpaceService_GetByID(t *testing.T) {
 	}
 }
 
+func TestSpaceService_ListSessionIDs(t *testing.T) {
+	ctx := context.Background()
+	projectID, spaceID := uuid.New(), uuid.New()
+	now := time.Now().UTC()
+	sessions := []model.Session{
+		{ID: uuid.New(), CreatedAt: now},
+		{ID: uuid.New(), CreatedAt: now.Add(time.Second)},
+		{ID: uuid.New(), CreatedAt: now.Add(2 * time.Second)},
+	}
+
+	repo := &MockSpaceRepo{}
+	repo.On("ListSessionsWithCursor", ctx, projectID, spaceID, time.Time{}, uuid.Nil, 3).Return(sessions, nil).Once()
+	svc := NewSpaceService(repo, nil, &config.Config{}, zap.NewNop())
+
+	out, err := svc.ListSessionIDs(ctx, ListSessionIDsInput{ProjectID: projectID, SpaceID: spaceID, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{sessions[0].ID, sessions[1].ID}, out.Items)
+	assert.True(t, out.HasMore)
+	assert.Equal(t, paging.EncodeCursor(sessions[1].CreatedAt, sessions[1].ID), out.NextCursor)
+
+	repo.On("ListSessionsWithCursor", ctx, projectID, spaceID, sessions[1].CreatedAt, sessions[1].ID, 3).Return(sessions[2:], nil).Once()
+	out, err = svc.ListSessionIDs(ctx, ListSessionIDsInput{ProjectID: projectID, SpaceID: spaceID, Limit: 2, Cursor: out.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{sessions[2].ID}, out.Items)
+	assert.False(t, out.HasMore)
+	assert.Empty(t, out.NextCursor)
+	repo.AssertExpectations(t)
+}
+
 func TestSpaceService_List(t *testing.T) {
 	ctx := context.Background()
 	projectID := uuid.New()
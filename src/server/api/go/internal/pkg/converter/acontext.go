@@ -1,12 +1,16 @@
 package converter
 
 import (
+	"maps"
+
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/service"
 )
 
 // AcontextConverter converts internal messages to Acontext format
-type AcontextConverter struct{}
+type AcontextConverter struct {
+	Options
+}
 
 // AcontextMessage represents the API response format for Acontext.
 // This is a Data Transfer Object (DTO) that converts UUID fields to strings
@@ -22,6 +26,7 @@ type AcontextMessage struct {
 	TaskID                   *string        `json:"task_id"`
 	CreatedAt                string         `json:"created_at"` // ISO 8601 timestamp for UI compatibility
 	UpdatedAt                string         `json:"updated_at"` // ISO 8601 timestamp
+	IsLatest                 bool           `json:"is_latest,omitempty"`
 }
 
 // Convert converts internal model.Message to Acontext format
@@ -33,10 +38,11 @@ func (c *AcontextConverter) Convert(messages []model.Message, publicURLs map[str
 			ID:                       msg.ID.String(),
 			SessionID:                msg.SessionID.String(),
 			Role:                     msg.Role,
-			Parts:                    msg.Parts,
+			Parts:                    c.convertParts(msg.Parts),
 			SessionTaskProcessStatus: msg.SessionTaskProcessStatus,
 			CreatedAt:                msg.CreatedAt.Format("2006-01-02T15:04:05.999999Z07:00"), // ISO 8601 / RFC3339
 			UpdatedAt:                msg.UpdatedAt.Format("2006-01-02T15:04:05.999999Z07:00"),
+			IsLatest:                 msg.IsLatest,
 		}
 
 		// Convert ParentID if present
@@ -60,3 +66,27 @@ func (c *AcontextConverter) Convert(messages []model.Message, publicURLs map[str
 
 	return result, nil
 }
+
+// convertParts returns the parts as stored, with the large integers of tool-call arguments as strings if asked.
+// Rewritten parts are copies, the message is left untouched.
+func (c *AcontextConverter) convertParts(parts []model.Part) []model.Part {
+	if !c.LargeNumbersAsStrings {
+		return parts
+	}
+	out := make([]model.Part, len(parts))
+	for i, part := range parts {
+		out[i] = part
+		args, ok := part.Meta["arguments"]
+		if part.Type != "tool-call" || !ok {
+			continue
+		}
+		meta := maps.Clone(part.Meta)
+		if argsStr, ok := args.(string); ok {
+			meta["arguments"] = c.convertArguments(argsStr)
+		} else {
+			meta["arguments"] = c.convertArgumentsValue(args)
+		}
+		out[i].Meta = meta
+	}
+	return out
+}
@@ -15,7 +15,9 @@ import (
 )
 
 // AnthropicConverter converts messages to Anthropic Claude-compatible format using official SDK types
-type AnthropicConverter struct{}
+type AnthropicConverter struct {
+	Options
+}
 
 func (c *AnthropicConverter) Convert(messages []model.Message, publicURLs map[string]service.PublicURL) (interface{}, error) {
 	result := make([]anthropic.MessageParam, 0, len(messages))
@@ -34,11 +36,16 @@ func (c *AnthropicConverter) convertMessage(msg model.Message, publicURLs map[st
 	// Convert parts to content blocks
 	contentBlocks := c.convertParts(msg.Parts, publicURLs)
 
+	var message anthropic.MessageParam
 	if role == "user" {
-		return anthropic.NewUserMessage(contentBlocks...)
+		message = anthropic.NewUserMessage(contentBlocks...)
 	} else {
-		return anthropic.NewAssistantMessage(contentBlocks...)
+		message = anthropic.NewAssistantMessage(contentBlocks...)
+	}
+	if meta := c.stashedMeta(msg); meta != nil {
+		message.SetExtraFields(map[string]any{normalizer.StashMetaKey: meta})
 	}
+	return message
 }
 
 func (c *AnthropicConverter) convertRole(role string) string {
@@ -168,13 +175,19 @@ func (c *AnthropicConverter) convertToolCallPart(part model.Part) *anthropic.Con
 	// Parse arguments (unified field name)
 	var input interface{}
 	if argsStr, ok := part.Meta["arguments"].(string); ok {
-		// Arguments is JSON string, unmarshal it
-		if err := json.Unmarshal([]byte(argsStr), &input); err != nil {
+		// Arguments is JSON string, passed through raw: decoding would round large integers, and the SDK
+		// writes a json.Number as a string
+		if json.Valid([]byte(argsStr)) {
+			input = json.RawMessage(c.convertArguments(argsStr))
+		} else {
 			input = map[string]interface{}{}
 		}
 	} else {
-		// Arguments is already an object
-		input = part.Meta["arguments"]
+		// Arguments is already an object, encoded beforehand as the SDK writes a json.Number as a string
+		input = c.convertArgumentsValue(part.Meta["arguments"])
+		if b, err := json.Marshal(input); err == nil {
+			input = json.RawMessage(b)
+		}
 	}
 
 	block := anthropic.NewToolUseBlock(id, input, name)
@@ -199,8 +212,63 @@ func (c *AnthropicConverter) convertToolResultPart(part model.Part) *anthropic.C
 		return nil
 	}
 
-	block := anthropic.NewToolResultBlock(toolUseID, part.Text, isError)
-	return &block
+	images := c.toolResultImages(part.Meta["images"])
+	if len(images) == 0 {
+		block := anthropic.NewToolResultBlock(toolUseID, part.Text, isError)
+		return &block
+	}
+
+	// Tool results with images get a list of content blocks, the text first
+	toolResult := anthropic.ToolResultBlockParam{ToolUseID: toolUseID, IsError: anthropic.Bool(isError)}
+	if part.Text != "" {
+		toolResult.Content = append(toolResult.Content, anthropic.ToolResultBlockParamContentUnion{
+			OfText: &anthropic.TextBlockParam{Text: part.Text},
+		})
+	}
+	for _, image := range images {
+		toolResult.Content = append(toolResult.Content, anthropic.ToolResultBlockParamContentUnion{OfImage: image})
+	}
+	return &anthropic.ContentBlockParamUnion{OfToolResult: &toolResult}
+}
+
+// toolResultImages rebuilds the image blocks of a tool result from the images meta of its tool-result part,
+// as written by the normalizer. Images without data or url are left out.
+func (c *AnthropicConverter) toolResultImages(v any) []*anthropic.ImageBlockParam {
+	var metas []map[string]any
+	switch images := v.(type) {
+	case []map[string]any:
+		metas = images
+	case []any: // meta loaded back from storage
+		for _, image := range images {
+			if meta, ok := image.(map[string]any); ok {
+				metas = append(metas, meta)
+			}
+		}
+	}
+
+	blocks := make([]*anthropic.ImageBlockParam, 0, len(metas))
+	for _, meta := range metas {
+		switch meta["type"] {
+		case "base64":
+			mediaType, _ := meta["media_type"].(string)
+			data, _ := meta["data"].(string)
+			if data == "" {
+				continue
+			}
+			blocks = append(blocks, &anthropic.ImageBlockParam{Source: anthropic.ImageBlockParamSourceUnion{
+				OfBase64: &anthropic.Base64ImageSourceParam{Data: data, MediaType: anthropic.Base64ImageSourceMediaType(mediaType)},
+			}})
+		case "url":
+			url, _ := meta["url"].(string)
+			if url == "" {
+				continue
+			}
+			blocks = append(blocks, &anthropic.ImageBlockParam{Source: anthropic.ImageBlockParamSourceUnion{
+				OfURL: &anthropic.URLImageSourceParam{URL: url},
+			}})
+		}
+	}
+	return blocks
 }
 
 func (c *AnthropicConverter) convertDocumentPart(part model.Part, publicURLs map[string]service.PublicURL) *anthropic.ContentBlockParamUnion {
@@ -1,10 +1,12 @@
 package converter
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/memodb-io/Acontext/internal/pkg/normalizer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -92,6 +94,46 @@ func TestAnthropicConverter_Convert_ToolResult(t *testing.T) {
 	assert.NotNil(t, result)
 }
 
+func TestAnthropicConverter_ToolResultWithImage_RoundTrip(t *testing.T) {
+	input := `{
+		"role": "user",
+		"content": [{
+			"type": "tool_result",
+			"tool_use_id": "toolu_123",
+			"is_error": false,
+			"content": [
+				{"type": "text", "text": "Screenshot taken"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}}
+			]
+		}]
+	}`
+
+	role, partsIn, _, err := (&normalizer.AnthropicNormalizer{}).NormalizeFromAnthropicMessage(json.RawMessage(input))
+	require.NoError(t, err)
+	require.Len(t, partsIn, 1)
+	assert.Equal(t, "tool-result", partsIn[0].Type)
+
+	// the parts as normalized, before they are stored
+	inMemory := []model.Part{{Type: partsIn[0].Type, Text: partsIn[0].Text, Meta: partsIn[0].Meta}}
+
+	// parts are stored as JSON, their meta is read back as generic maps
+	stored, err := json.Marshal(inMemory)
+	require.NoError(t, err)
+	var loaded []model.Part
+	require.NoError(t, json.Unmarshal(stored, &loaded))
+
+	for name, parts := range map[string][]model.Part{"in memory": inMemory, "loaded": loaded} {
+		t.Run(name, func(t *testing.T) {
+			result, err := (&AnthropicConverter{}).Convert([]model.Message{createTestMessage(role, parts, nil)}, nil)
+			require.NoError(t, err)
+
+			output, err := json.Marshal(result)
+			require.NoError(t, err)
+			assert.JSONEq(t, "["+input+"]", string(output))
+		})
+	}
+}
+
 func TestAnthropicConverter_Convert_Image(t *testing.T) {
 	converter := &AnthropicConverter{}
 
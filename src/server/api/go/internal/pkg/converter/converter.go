@@ -2,7 +2,9 @@ package converter
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/service"
 )
@@ -12,14 +14,34 @@ type ConvertMessagesInput struct {
 	Messages   []model.Message
 	Format     model.MessageFormat
 	PublicURLs map[string]service.PublicURL
+	Options    Options
 }
 
-// MessageConverter interface for extensible message conversion
+// MessageConverter interface for extensible message conversion.
+// Convert returns a non-nil slice, empty when there are no messages, so that items is serialized as [] and not null.
 type MessageConverter interface {
 	Convert(messages []model.Message, publicURLs map[string]service.PublicURL) (interface{}, error)
 }
 
-// ConvertMessages converts messages to the specified format
+// ConversionError is a failure to convert messages, pointing at the message that fails on its own if any
+type ConversionError struct {
+	Format    model.MessageFormat
+	MessageID uuid.UUID // uuid.Nil when no message fails on its own
+	PartTypes []string  // types of the parts of the message, in order
+	Err       error
+}
+
+func (e *ConversionError) Error() string {
+	if e.MessageID == uuid.Nil {
+		return fmt.Sprintf("convert messages to %s: %v", e.Format, e.Err)
+	}
+	return fmt.Sprintf("convert message %s with parts [%s] to %s: %v", e.MessageID, strings.Join(e.PartTypes, ", "), e.Format, e.Err)
+}
+
+func (e *ConversionError) Unwrap() error { return e.Err }
+
+// ConvertMessages converts messages to the specified format.
+// A converter failing, or panicking, returns a *ConversionError.
 func ConvertMessages(input ConvertMessagesInput) (interface{}, error) {
 	var converter MessageConverter
 
@@ -31,52 +53,105 @@ func ConvertMessages(input ConvertMessagesInput) (interface{}, error) {
 
 	switch format {
 	case model.FormatAcontext:
-		converter = &AcontextConverter{}
+		converter = &AcontextConverter{Options: input.Options}
 	case model.FormatOpenAI:
-		converter = &OpenAIConverter{}
+		converter = &OpenAIConverter{Options: input.Options}
 	case model.FormatAnthropic:
-		converter = &AnthropicConverter{}
+		converter = &AnthropicConverter{Options: input.Options}
 	case model.FormatGemini:
-		converter = &GeminiConverter{}
+		converter = &GeminiConverter{Options: input.Options}
+	case model.FormatLangChain:
+		converter = &LangChainConverter{Options: input.Options}
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
 
-	return converter.Convert(input.Messages, input.PublicURLs)
+	return convert(converter, format, input.Messages, input.PublicURLs)
+}
+
+// convert runs the converter, and on failure converts the messages one by one to find the culprit,
+// as some converters look across messages
+func convert(converter MessageConverter, format model.MessageFormat, messages []model.Message, publicURLs map[string]service.PublicURL) (interface{}, error) {
+	out, err := convertSafely(converter, messages, publicURLs)
+	if err == nil {
+		return out, nil
+	}
+
+	convErr := &ConversionError{Format: format, Err: err}
+	for _, msg := range messages {
+		if _, err := convertSafely(converter, []model.Message{msg}, publicURLs); err != nil {
+			convErr.MessageID = msg.ID
+			convErr.Err = err
+			convErr.PartTypes = make([]string, 0, len(msg.Parts))
+			for _, p := range msg.Parts {
+				convErr.PartTypes = append(convErr.PartTypes, p.Type)
+			}
+			break
+		}
+	}
+	return nil, convErr
+}
+
+// convertSafely runs the converter, turning a panic on unexpected message content into an error
+func convertSafely(converter MessageConverter, messages []model.Message, publicURLs map[string]service.PublicURL) (out interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return converter.Convert(messages, publicURLs)
+}
+
+// stashedMeta returns the meta to write in the normalizer.StashMetaKey field of a message, or nil
+func (o Options) stashedMeta(msg model.Message) map[string]any {
+	if !o.PreserveNames {
+		return nil
+	}
+	if name, ok := msg.Meta.Data()["name"].(string); ok && name != "" {
+		return map[string]any{"name": name}
+	}
+	return nil
 }
 
 // ValidateFormat checks if the format is valid
 func ValidateFormat(format string) (model.MessageFormat, error) {
 	mf := model.MessageFormat(format)
 	switch mf {
-	case model.FormatAcontext, model.FormatOpenAI, model.FormatAnthropic, model.FormatGemini:
+	case model.FormatAcontext, model.FormatOpenAI, model.FormatAnthropic, model.FormatGemini, model.FormatLangChain:
 		return mf, nil
 	default:
-		return "", fmt.Errorf("invalid format: %s, supported formats: acontext, openai, anthropic, gemini", format)
+		return "", fmt.Errorf("invalid format: %s, supported formats: acontext, openai, anthropic, gemini, langchain", format)
 	}
 }
 
-// GetConvertedMessagesOutput wraps the converted messages with metadata
+// GetConvertedMessagesOutput wraps the converted messages with metadata.
+// Without messages, items and ids are empty arrays and next_cursor is left out, whatever the format.
 func GetConvertedMessagesOutput(
 	messages []model.Message,
 	format model.MessageFormat,
 	publicURLs map[string]service.PublicURL,
 	nextCursor string,
 	hasMore bool,
+	opts Options,
 ) (map[string]interface{}, error) {
 	convertedData, err := ConvertMessages(ConvertMessagesInput{
 		Messages:   messages,
 		Format:     format,
 		PublicURLs: publicURLs,
+		Options:    opts,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Extracting message IDs
+	// Extracting message IDs, and the head of the conversation for formats without is_latest
 	messageIDs := make([]string, len(messages))
+	latestID := ""
 	for i := range len(messages) {
 		messageIDs[i] = messages[i].ID.String()
+		if messages[i].IsLatest {
+			latestID = messageIDs[i]
+		}
 	}
 
 	result := map[string]interface{}{
@@ -88,6 +163,12 @@ func GetConvertedMessagesOutput(
 	if nextCursor != "" {
 		result["next_cursor"] = nextCursor
 	}
+	if latestID != "" {
+		result["latest_id"] = latestID
+	}
+	if format == model.FormatAnthropic && opts.SystemPrompt != "" {
+		result["system"] = opts.SystemPrompt
+	}
 
 	// Include public_urls only if format is None (original format)
 	if format == model.FormatAcontext && len(publicURLs) > 0 {
@@ -1,6 +1,9 @@
 package converter
 
 import (
+	"bytes"
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -170,6 +173,7 @@ func TestGetConvertedMessagesOutput(t *testing.T) {
 		publicURLs,
 		"next_cursor_123",
 		true,
+		Options{},
 	)
 
 	require.NoError(t, err)
@@ -199,6 +203,7 @@ func TestGetConvertedMessagesOutput_NonAcontextFormat(t *testing.T) {
 		publicURLs,
 		"",
 		false,
+		Options{},
 	)
 
 	require.NoError(t, err)
@@ -210,6 +215,29 @@ func TestGetConvertedMessagesOutput_NonAcontextFormat(t *testing.T) {
 	assert.Nil(t, result["public_urls"])
 }
 
+func TestGetConvertedMessagesOutput_SystemPrompt(t *testing.T) {
+	messages := []model.Message{
+		createTestMessage("user", []model.Part{
+			{Type: "text", Text: "Test"},
+		}, nil),
+	}
+	opts := Options{SystemPrompt: "You are a helpful assistant."}
+
+	result, err := GetConvertedMessagesOutput(messages, model.FormatAnthropic, nil, "", false, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "You are a helpful assistant.", result["system"])
+	assert.Len(t, result["items"], 1)
+
+	// Other formats have no system field
+	result, err = GetConvertedMessagesOutput(messages, model.FormatOpenAI, nil, "", false, opts)
+	require.NoError(t, err)
+	assert.NotContains(t, result, "system")
+
+	result, err = GetConvertedMessagesOutput(messages, model.FormatAnthropic, nil, "", false, Options{})
+	require.NoError(t, err)
+	assert.NotContains(t, result, "system")
+}
+
 func TestGetConvertedMessagesOutput_EmptyMessages(t *testing.T) {
 	// Test with empty message list
 	messages := []model.Message{}
@@ -220,6 +248,7 @@ func TestGetConvertedMessagesOutput_EmptyMessages(t *testing.T) {
 		nil,
 		"",
 		false,
+		Options{},
 	)
 
 	require.NoError(t, err)
@@ -237,6 +266,24 @@ func TestGetConvertedMessagesOutput_EmptyMessages(t *testing.T) {
 	assert.True(t, hasItems, "items field should exist")
 }
 
+func TestGetConvertedMessagesOutput_EmptyMessagesAllFormats(t *testing.T) {
+	formats := []model.MessageFormat{model.FormatAcontext, model.FormatOpenAI, model.FormatAnthropic, model.FormatGemini}
+
+	for _, format := range formats {
+		for name, messages := range map[string][]model.Message{"nil": nil, "empty": {}} {
+			t.Run(string(format)+"/"+name, func(t *testing.T) {
+				result, err := GetConvertedMessagesOutput(messages, format, nil, "", false, Options{})
+				require.NoError(t, err)
+
+				// strict SDK deserializers expect arrays, never null
+				body, err := json.Marshal(result)
+				require.NoError(t, err)
+				assert.JSONEq(t, `{"items":[],"ids":[],"has_more":false}`, string(body))
+			})
+		}
+	}
+}
+
 func TestGetConvertedMessagesOutput_SingleMessage(t *testing.T) {
 	// Test with single message
 	msg := createTestMessage("user", []model.Part{
@@ -251,6 +298,7 @@ func TestGetConvertedMessagesOutput_SingleMessage(t *testing.T) {
 		nil,
 		"cursor-123",
 		true,
+		Options{},
 	)
 
 	require.NoError(t, err)
@@ -287,6 +335,7 @@ func TestGetConvertedMessagesOutput_IDOrderMatchesItemOrder(t *testing.T) {
 		nil,
 		"",
 		false,
+		Options{},
 	)
 
 	require.NoError(t, err)
@@ -316,6 +365,7 @@ func TestGetConvertedMessagesOutput_DifferentFormats(t *testing.T) {
 			nil,
 			"",
 			false,
+			Options{},
 		)
 
 		require.NoError(t, err, "format %s should not error", format)
@@ -346,6 +396,7 @@ func TestGetConvertedMessagesOutput_WithPublicURLs(t *testing.T) {
 		publicURLs,
 		"",
 		false,
+		Options{},
 	)
 
 	require.NoError(t, err)
@@ -357,3 +408,134 @@ func TestGetConvertedMessagesOutput_WithPublicURLs(t *testing.T) {
 	_, hasURLs := result["public_urls"]
 	assert.True(t, hasURLs, "public_urls should exist for Acontext format")
 }
+
+// failingConverter panics on the messages with a part of type "boom"
+type failingConverter struct{}
+
+func (failingConverter) Convert(messages []model.Message, _ map[string]service.PublicURL) (interface{}, error) {
+	for _, m := range messages {
+		for _, p := range m.Parts {
+			if p.Type == "boom" {
+				var meta map[string]any
+				_ = meta["x"].(string)
+			}
+		}
+	}
+	return []string{}, nil
+}
+
+func TestConvert_ErrorNamesTheMessage(t *testing.T) {
+	ok := createTestMessage("user", []model.Part{{Type: "text", Text: "hi"}}, nil)
+	bad := createTestMessage("assistant", []model.Part{{Type: "text", Text: "calling"}, {Type: "boom"}}, nil)
+
+	_, err := convert(failingConverter{}, model.FormatOpenAI, []model.Message{ok, bad, ok}, nil)
+	var convErr *ConversionError
+	require.ErrorAs(t, err, &convErr)
+	assert.Equal(t, bad.ID, convErr.MessageID)
+	assert.Equal(t, []string{"text", "boom"}, convErr.PartTypes)
+	assert.Equal(t, model.FormatOpenAI, convErr.Format)
+	assert.Contains(t, err.Error(), "convert message "+bad.ID.String()+" with parts [text, boom] to openai: panic:")
+
+	out, err := convert(failingConverter{}, model.FormatOpenAI, []model.Message{ok}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, out)
+}
+
+func TestConvertMessages_LargeNumbers(t *testing.T) {
+	// 2^53+1 is rounded to 2^53 by a float64
+	const args = `{"user_id":9007199254740993,"limit":10,"ratio":0.5,"ids":[-9007199254740993,1]}`
+	// arguments are stored as a string, or as an object decoded with json.Number from Anthropic
+	// tool_use.input and Gemini functionCall.args
+	var argsObject map[string]any
+	dec := json.NewDecoder(strings.NewReader(args))
+	dec.UseNumber()
+	require.NoError(t, dec.Decode(&argsObject))
+	toolCall := func(arguments any) []model.Message {
+		return []model.Message{
+			createTestMessage("assistant", []model.Part{
+				{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "lookup", "arguments": arguments, "type": "function"}},
+			}, nil),
+		}
+	}
+
+	// the tool-call arguments of each format, as a client would decode them
+	arguments := func(t *testing.T, format model.MessageFormat, out interface{}) map[string]any {
+		body, err := json.Marshal(out)
+		require.NoError(t, err)
+		var items []map[string]any
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		require.NoError(t, dec.Decode(&items))
+		require.Len(t, items, 1)
+
+		var v any
+		switch format {
+		case model.FormatAcontext:
+			v = items[0]["parts"].([]any)[0].(map[string]any)["meta"].(map[string]any)["arguments"]
+		case model.FormatOpenAI:
+			v = items[0]["tool_calls"].([]any)[0].(map[string]any)["function"].(map[string]any)["arguments"]
+		case model.FormatAnthropic:
+			v = items[0]["content"].([]any)[0].(map[string]any)["input"]
+		case model.FormatGemini:
+			v = items[0]["parts"].([]any)[0].(map[string]any)["functionCall"].(map[string]any)["args"]
+		}
+		if s, ok := v.(string); ok {
+			dec := json.NewDecoder(strings.NewReader(s))
+			dec.UseNumber()
+			require.NoError(t, dec.Decode(&v))
+		}
+		return v.(map[string]any)
+	}
+
+	stringArgs, objectArgs := toolCall(args), toolCall(argsObject)
+	for name, messages := range map[string][]model.Message{"string arguments": stringArgs, "object arguments": objectArgs} {
+		for _, format := range []model.MessageFormat{model.FormatAcontext, model.FormatOpenAI, model.FormatAnthropic, model.FormatGemini} {
+			t.Run(name+"/"+string(format), func(t *testing.T) {
+				out, err := ConvertMessages(ConvertMessagesInput{Messages: messages, Format: format})
+				require.NoError(t, err)
+				got := arguments(t, format, out)
+				assert.Equal(t, json.Number("9007199254740993"), got["user_id"], "large integers keep their precision")
+
+				out, err = ConvertMessages(ConvertMessagesInput{
+					Messages: messages,
+					Format:   format,
+					Options:  Options{LargeNumbersAsStrings: true},
+				})
+				require.NoError(t, err)
+				got = arguments(t, format, out)
+				assert.Equal(t, "9007199254740993", got["user_id"])
+				assert.Equal(t, []any{"-9007199254740993", json.Number("1")}, got["ids"])
+				assert.Equal(t, json.Number("10"), got["limit"], "safe integers stay numbers")
+				assert.Equal(t, json.Number("0.5"), got["ratio"])
+			})
+		}
+	}
+
+	// the stored messages are not rewritten
+	assert.Equal(t, args, stringArgs[0].Parts[0].Meta["arguments"])
+	assert.Equal(t, json.Number("9007199254740993"), objectArgs[0].Parts[0].Meta["arguments"].(map[string]any)["user_id"])
+}
+
+func TestStringifyLargeNumbers(t *testing.T) {
+	in := map[string]any{
+		"float":  float64(1 << 60),
+		"safe":   float64(maxSafeInteger),
+		"int64":  int64(-1 << 62),
+		"uint64": uint64(1 << 63),
+		"number": json.Number("123456789012345678901234567890"),
+		"exp":    json.Number("1e300"),
+		"nested": []any{map[string]any{"id": json.Number("9007199254740992")}},
+	}
+
+	out := stringifyLargeNumbers(in)
+	assert.Equal(t, map[string]any{
+		"float":  "1152921504606846976",
+		"safe":   float64(maxSafeInteger),
+		"int64":  "-4611686018427387904",
+		"uint64": "9223372036854775808",
+		"number": "123456789012345678901234567890",
+		"exp":    json.Number("1e300"),
+		"nested": []any{map[string]any{"id": "9007199254740992"}},
+	}, out)
+	assert.Equal(t, json.Number("9007199254740992"), in["nested"].([]any)[0].(map[string]any)["id"], "input is left untouched")
+}
@@ -14,7 +14,9 @@ import (
 )
 
 // GeminiConverter converts messages to Google Gemini-compatible format using official SDK types
-type GeminiConverter struct{}
+type GeminiConverter struct {
+	Options
+}
 
 func (c *GeminiConverter) Convert(messages []model.Message, publicURLs map[string]service.PublicURL) (interface{}, error) {
 	// First pass: collect tool-call IDs and their function names
@@ -37,14 +39,31 @@ func (c *GeminiConverter) Convert(messages []model.Message, publicURLs map[strin
 
 	// Second pass: convert messages using the mapping
 	result := make([]*genai.Content, 0, len(messages))
+	var stashed []map[string]any // meta of each content, when PreserveNames is set
 	for _, msg := range messages {
 		geminiContent := c.convertMessage(msg, publicURLs, toolCallIDToName)
 		if geminiContent != nil {
 			result = append(result, geminiContent)
+			if c.PreserveNames {
+				stashed = append(stashed, c.stashedMeta(msg))
+			}
 		}
 	}
 
-	return result, nil
+	if !c.PreserveNames {
+		return result, nil
+	}
+	withMeta := make([]GeminiContentWithMeta, len(result))
+	for i, content := range result {
+		withMeta[i] = GeminiContentWithMeta{Content: content, Meta: stashed[i]}
+	}
+	return withMeta, nil
+}
+
+// GeminiContentWithMeta is a Gemini content with the message meta Gemini has no field for, see Options.PreserveNames
+type GeminiContentWithMeta struct {
+	*genai.Content
+	Meta map[string]any `json:"meta,omitempty"`
 }
 
 func (c *GeminiConverter) convertMessage(msg model.Message, publicURLs map[string]service.PublicURL, toolCallIDToName map[string]string) *genai.Content {
@@ -195,12 +214,12 @@ func (c *GeminiConverter) convertToolCallPart(part model.Part) *genai.FunctionCa
 	// Parse arguments (unified field name)
 	var args map[string]interface{}
 	if argsStr, ok := part.Meta["arguments"].(string); ok {
-		// Arguments is JSON string, unmarshal it
-		if err := json.Unmarshal([]byte(argsStr), &args); err != nil {
+		// Arguments is JSON string, unmarshal it keeping large integers exact
+		if err := decodeArguments(c.convertArguments(argsStr), &args); err != nil {
 			args = make(map[string]interface{})
 		}
 	} else if argsObj, ok := part.Meta["arguments"].(map[string]interface{}); ok {
-		args = argsObj
+		args, _ = c.convertArgumentsValue(argsObj).(map[string]interface{})
 	} else {
 		args = make(map[string]interface{})
 	}
@@ -0,0 +1,177 @@
+package converter
+
+import (
+	"encoding/json"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+// LangChainConverter converts messages to raw LangChain message dicts
+type LangChainConverter struct {
+	Options
+}
+
+// LangChainMessage is a LangChain message dict: human, ai or tool
+type LangChainMessage struct {
+	Type string `json:"type"`
+	// Content is a string, or a list of text and image_url blocks for messages with images
+	Content          interface{}    `json:"content"`
+	Name             string         `json:"name,omitempty"`
+	ToolCallID       string         `json:"tool_call_id,omitempty"`
+	AdditionalKwargs map[string]any `json:"additional_kwargs"`
+}
+
+// LangChainToolCall is a tool call of additional_kwargs, in the OpenAI shape LangChain keeps it in
+type LangChainToolCall struct {
+	ID       string                    `json:"id"`
+	Type     string                    `json:"type"`
+	Function LangChainToolCallFunction `json:"function"`
+}
+
+type LangChainToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Convert converts messages to LangChain dicts. A user message of tool results becomes one tool
+// message per result, as LangChain answers each tool call with its own message.
+func (c *LangChainConverter) Convert(messages []model.Message, publicURLs map[string]service.PublicURL) (interface{}, error) {
+	result := make([]LangChainMessage, 0, len(messages))
+
+	for _, msg := range messages {
+		name, _ := msg.Meta.Data()["name"].(string)
+
+		if msg.Role == "user" && c.isToolResultOnly(msg.Parts) {
+			for _, part := range msg.Parts {
+				toolCallID, _ := part.Meta["tool_call_id"].(string)
+				result = append(result, LangChainMessage{
+					Type:             "tool",
+					Content:          part.Text,
+					Name:             name,
+					ToolCallID:       toolCallID,
+					AdditionalKwargs: map[string]any{},
+				})
+			}
+			continue
+		}
+
+		switch msg.Role {
+		case "assistant":
+			result = append(result, c.convertToAIMessage(msg, name))
+		default:
+			result = append(result, LangChainMessage{
+				Type:             "human",
+				Content:          c.convertContent(msg.Parts, publicURLs),
+				Name:             name,
+				AdditionalKwargs: map[string]any{},
+			})
+		}
+	}
+
+	return result, nil
+}
+
+func (c *LangChainConverter) convertToAIMessage(msg model.Message, name string) LangChainMessage {
+	var text string
+	var toolCalls []LangChainToolCall
+	for _, part := range msg.Parts {
+		switch part.Type {
+		case "text":
+			text += part.Text
+		case "tool-call":
+			if toolCall := c.convertToToolCall(part); toolCall != nil {
+				toolCalls = append(toolCalls, *toolCall)
+			}
+		}
+	}
+
+	kwargs := map[string]any{}
+	if len(toolCalls) > 0 {
+		kwargs["tool_calls"] = toolCalls
+	}
+	return LangChainMessage{
+		Type:             "ai",
+		Content:          text,
+		Name:             name,
+		AdditionalKwargs: kwargs,
+	}
+}
+
+func (c *LangChainConverter) convertToToolCall(part model.Part) *LangChainToolCall {
+	if part.Meta == nil {
+		return nil
+	}
+
+	id, _ := part.Meta["id"].(string)
+	name, _ := part.Meta["name"].(string)
+	arguments, _ := part.Meta["arguments"].(string)
+	arguments = c.convertArguments(arguments)
+
+	// Arguments stored as an object by another format are marshaled
+	if arguments == "" {
+		if argsObj, ok := part.Meta["arguments"]; ok {
+			if argsBytes, err := json.Marshal(c.convertArgumentsValue(argsObj)); err == nil {
+				arguments = string(argsBytes)
+			}
+		}
+	}
+
+	if id == "" || name == "" {
+		return nil
+	}
+	return &LangChainToolCall{
+		ID:       id,
+		Type:     "function",
+		Function: LangChainToolCallFunction{Name: name, Arguments: arguments},
+	}
+}
+
+// convertContent returns a single text part as a string, other content as a list of blocks.
+// Parts LangChain has no block for, and images without a url, are left out.
+func (c *LangChainConverter) convertContent(parts []model.Part, publicURLs map[string]service.PublicURL) interface{} {
+	if len(parts) == 1 && parts[0].Type == "text" {
+		return parts[0].Text
+	}
+
+	blocks := make([]map[string]any, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			blocks = append(blocks, map[string]any{"type": "text", "text": part.Text})
+		case "image":
+			url := c.getAssetURL(part.Asset, publicURLs)
+			if url == "" {
+				continue
+			}
+			imageURL := map[string]any{"url": url}
+			if detail, ok := part.Meta["detail"].(string); ok && detail != "" {
+				imageURL["detail"] = detail
+			}
+			blocks = append(blocks, map[string]any{"type": "image_url", "image_url": imageURL})
+		}
+	}
+	return blocks
+}
+
+func (c *LangChainConverter) isToolResultOnly(parts []model.Part) bool {
+	if len(parts) == 0 {
+		return false
+	}
+	for _, part := range parts {
+		if part.Type != "tool-result" {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *LangChainConverter) getAssetURL(asset *model.Asset, publicURLs map[string]service.PublicURL) string {
+	if asset == nil {
+		return ""
+	}
+	if publicURL, ok := publicURLs[asset.S3Key]; ok {
+		return publicURL.URL
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package converter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLangChainConverter_Convert(t *testing.T) {
+	converter := &LangChainConverter{}
+
+	messages := []model.Message{
+		createTestMessage("user", []model.Part{
+			{Type: "text", Text: "Weather in SF?"},
+		}, nil),
+		createTestMessage("assistant", []model.Part{
+			{Type: "text", Text: "Checking."},
+			{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "get_weather", "arguments": `{"city":"SF"}`, "type": "function"}},
+		}, nil),
+		createTestMessage("user", []model.Part{
+			{Type: "tool-result", Text: "72F", Meta: map[string]any{"tool_call_id": "call_1"}},
+			{Type: "tool-result", Text: "sunny", Meta: map[string]any{"tool_call_id": "call_2"}},
+		}, nil),
+	}
+
+	result, err := converter.Convert(messages, nil)
+	require.NoError(t, err)
+
+	b, err := json.Marshal(result)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"type": "human", "content": "Weather in SF?", "additional_kwargs": {}},
+		{"type": "ai", "content": "Checking.", "additional_kwargs": {"tool_calls": [
+			{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"SF\"}"}}
+		]}},
+		{"type": "tool", "content": "72F", "tool_call_id": "call_1", "additional_kwargs": {}},
+		{"type": "tool", "content": "sunny", "tool_call_id": "call_2", "additional_kwargs": {}}
+	]`, string(b))
+}
+
+func TestLangChainConverter_Convert_ObjectArguments(t *testing.T) {
+	converter := &LangChainConverter{}
+
+	// Anthropic tool calls keep their input as an object
+	messages := []model.Message{
+		createTestMessage("assistant", []model.Part{
+			{Type: "tool-call", Meta: map[string]any{"id": "toolu_1", "name": "lookup", "arguments": map[string]any{"q": "x"}}},
+		}, nil),
+	}
+
+	result, err := converter.Convert(messages, nil)
+	require.NoError(t, err)
+	msgs := result.([]LangChainMessage)
+	require.Len(t, msgs, 1)
+	toolCalls := msgs[0].AdditionalKwargs["tool_calls"].([]LangChainToolCall)
+	require.Len(t, toolCalls, 1)
+	assert.Equal(t, `{"q":"x"}`, toolCalls[0].Function.Arguments)
+}
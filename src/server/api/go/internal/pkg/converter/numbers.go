@@ -0,0 +1,110 @@
+package converter
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxSafeInteger is the largest integer a float64 holds exactly, 2^53-1, beyond it JSON clients
+// parsing numbers as float64 silently round 64-bit IDs
+const maxSafeInteger = 1<<53 - 1
+
+// Options tune the converted output
+type Options struct {
+	// LargeNumbersAsStrings writes the integers of tool-call arguments beyond ±(2^53-1) as strings
+	LargeNumbersAsStrings bool
+	// PreserveNames writes the name of messages converted to Anthropic and Gemini, which have no name field,
+	// in a meta field so that it survives a round trip. Providers reject the field, it must be removed
+	// before sending the messages to them.
+	PreserveNames bool
+	// SystemPrompt is returned in the system field of the anthropic output, as Anthropic takes the system
+	// prompt as a top-level parameter and rejects messages with a system role. Other formats ignore it.
+	SystemPrompt string
+}
+
+// decodeArguments decodes JSON tool-call arguments, keeping numbers as json.Number so that
+// integers beyond float64 precision survive a round trip
+func decodeArguments(s string, v interface{}) error {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// convertArguments returns JSON tool-call arguments as they should be output, with their large
+// integers as strings if asked. Arguments that are not valid JSON are returned unchanged.
+func (o Options) convertArguments(s string) string {
+	if !o.LargeNumbersAsStrings {
+		return s
+	}
+	var args interface{}
+	if err := decodeArguments(s, &args); err != nil {
+		return s
+	}
+	b, err := json.Marshal(stringifyLargeNumbers(args))
+	if err != nil {
+		return s
+	}
+	return string(b)
+}
+
+// convertArgumentsValue is convertArguments for arguments already decoded, stored as an object
+func (o Options) convertArgumentsValue(v interface{}) interface{} {
+	if !o.LargeNumbersAsStrings {
+		return v
+	}
+	return stringifyLargeNumbers(v)
+}
+
+// stringifyLargeNumbers returns a copy of v with the integers beyond ±maxSafeInteger replaced by
+// their decimal string, v itself is left untouched
+func stringifyLargeNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			out[k] = stringifyLargeNumbers(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			out[i] = stringifyLargeNumbers(e)
+		}
+		return out
+	case json.Number:
+		if isLargeInteger(string(t)) {
+			return string(t)
+		}
+	case float64:
+		// already decoded as float64, so possibly rounded, but clients won't round it again
+		if t == math.Trunc(t) && math.Abs(t) > maxSafeInteger {
+			return strconv.FormatFloat(t, 'f', 0, 64)
+		}
+	case int64:
+		if t > maxSafeInteger || t < -maxSafeInteger {
+			return strconv.FormatInt(t, 10)
+		}
+	case uint64:
+		if t > maxSafeInteger {
+			return strconv.FormatUint(t, 10)
+		}
+	}
+	return v
+}
+
+// isLargeInteger reports whether the JSON number n is an integer beyond ±maxSafeInteger.
+// Numbers with a fraction or an exponent are floats, approximate anyway.
+func isLargeInteger(n string) bool {
+	if strings.ContainsAny(n, ".eE") {
+		return false
+	}
+	i, err := strconv.ParseInt(n, 10, 64)
+	if err != nil {
+		// out of int64 range, or not a number at all
+		_, err := strconv.ParseFloat(n, 64)
+		return err == nil
+	}
+	return i > maxSafeInteger || i < -maxSafeInteger
+}
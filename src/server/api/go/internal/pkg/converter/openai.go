@@ -11,7 +11,9 @@ import (
 )
 
 // OpenAIConverter converts messages to OpenAI-compatible format using official SDK types
-type OpenAIConverter struct{}
+type OpenAIConverter struct {
+	Options
+}
 
 func (c *OpenAIConverter) Convert(messages []model.Message, publicURLs map[string]service.PublicURL) (interface{}, error) {
 	result := make([]openai.ChatCompletionMessageParamUnion, 0, len(messages))
@@ -150,14 +152,31 @@ func (c *OpenAIConverter) convertToUserMessage(msg model.Message, publicURLs map
 }
 
 func (c *OpenAIConverter) convertToAssistantMessage(msg model.Message) openai.ChatCompletionMessageParamUnion {
+	// Messages stored from an OpenAI content array keep one content part per text part
+	metaData := msg.Meta.Data()
+	contentArray, _ := metaData["content_array"].(bool)
+
 	// Separate text content and tool calls
 	var textContent string
+	var contentParts []openai.ChatCompletionAssistantMessageParamContentArrayOfContentPartUnion
 	var toolCalls []openai.ChatCompletionMessageToolCallUnionParam
 
 	for _, part := range msg.Parts {
 		switch part.Type {
 		case "text":
-			textContent += part.Text
+			if !contentArray {
+				textContent += part.Text
+				continue
+			}
+			if isRefusal, _ := part.Meta["is_refusal"].(bool); isRefusal {
+				contentParts = append(contentParts, openai.ChatCompletionAssistantMessageParamContentArrayOfContentPartUnion{
+					OfRefusal: &openai.ChatCompletionContentPartRefusalParam{Refusal: part.Text},
+				})
+			} else {
+				contentParts = append(contentParts, openai.ChatCompletionAssistantMessageParamContentArrayOfContentPartUnion{
+					OfText: &openai.ChatCompletionContentPartTextParam{Text: part.Text},
+				})
+			}
 		case "tool-call":
 			if part.Meta != nil {
 				toolCall := c.convertToToolCall(part)
@@ -175,6 +194,10 @@ func (c *OpenAIConverter) convertToAssistantMessage(msg model.Message) openai.Ch
 		assistantParam.Content = openai.ChatCompletionAssistantMessageParamContentUnion{
 			OfString: param.NewOpt(textContent),
 		}
+	} else if len(contentParts) > 0 {
+		assistantParam.Content = openai.ChatCompletionAssistantMessageParamContentUnion{
+			OfArrayOfContentParts: contentParts,
+		}
 	}
 
 	if len(toolCalls) > 0 {
@@ -182,10 +205,8 @@ func (c *OpenAIConverter) convertToAssistantMessage(msg model.Message) openai.Ch
 	}
 
 	// Add name field from message meta if present
-	if metaData := msg.Meta.Data(); len(metaData) > 0 {
-		if name, ok := metaData["name"].(string); ok && name != "" {
-			assistantParam.Name = param.NewOpt(name)
-		}
+	if name, ok := metaData["name"].(string); ok && name != "" {
+		assistantParam.Name = param.NewOpt(name)
 	}
 
 	return openai.ChatCompletionMessageParamUnion{
@@ -205,6 +226,11 @@ func (c *OpenAIConverter) convertToToolMessage(msg model.Message) openai.ChatCom
 		},
 	}
 
+	// The SDK has no name on tool messages, it is written as an extra field
+	if name, ok := msg.Meta.Data()["name"].(string); ok && name != "" {
+		toolParam.SetExtraFields(map[string]any{"name": name})
+	}
+
 	return openai.ChatCompletionMessageParamUnion{
 		OfTool: &toolParam,
 	}
@@ -219,11 +245,12 @@ func (c *OpenAIConverter) convertToToolCall(part model.Part) *openai.ChatComplet
 	id, _ := part.Meta["id"].(string)
 	name, _ := part.Meta["name"].(string) // Unified: was "tool_name", now "name"
 	arguments, _ := part.Meta["arguments"].(string)
+	arguments = c.convertArguments(arguments)
 
 	// If arguments is not a string, marshal it
 	if arguments == "" {
 		if argsObj, ok := part.Meta["arguments"]; ok {
-			if argsBytes, err := json.Marshal(argsObj); err == nil {
+			if argsBytes, err := json.Marshal(c.convertArgumentsValue(argsObj)); err == nil {
 				arguments = string(argsBytes)
 			}
 		}
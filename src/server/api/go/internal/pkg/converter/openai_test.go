@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	openai "github.com/openai/openai-go/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -48,6 +49,36 @@ func TestOpenAIConverter_Convert_AssistantWithToolCalls(t *testing.T) {
 	assert.NotNil(t, result)
 }
 
+func TestOpenAIConverter_Convert_AssistantContentArray(t *testing.T) {
+	converter := &OpenAIConverter{}
+	parts := []model.Part{
+		{Type: "text", Text: "Let me check. "},
+		{Type: "text", Text: "I can't share that.", Meta: map[string]any{"is_refusal": true}},
+		{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "lookup", "arguments": "{}", "type": "function"}},
+	}
+
+	t.Run("joined by default", func(t *testing.T) {
+		result, err := converter.Convert([]model.Message{createTestMessage("assistant", parts, nil)}, nil)
+		require.NoError(t, err)
+		msgs := result.([]openai.ChatCompletionMessageParamUnion)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, "Let me check. I can't share that.", msgs[0].OfAssistant.Content.OfString.Value)
+		assert.Len(t, msgs[0].OfAssistant.ToolCalls, 1)
+	})
+
+	t.Run("array preserved", func(t *testing.T) {
+		result, err := converter.Convert([]model.Message{createTestMessage("assistant", parts, map[string]any{"content_array": true})}, nil)
+		require.NoError(t, err)
+		msgs := result.([]openai.ChatCompletionMessageParamUnion)
+		require.Len(t, msgs, 1)
+		content := msgs[0].OfAssistant.Content.OfArrayOfContentParts
+		require.Len(t, content, 2)
+		assert.Equal(t, "Let me check. ", content[0].OfText.Text)
+		assert.Equal(t, "I can't share that.", content[1].OfRefusal.Refusal)
+		assert.Len(t, msgs[0].OfAssistant.ToolCalls, 1)
+	})
+}
+
 func TestOpenAIConverter_Convert_ToolResult(t *testing.T) {
 	converter := &OpenAIConverter{}
 
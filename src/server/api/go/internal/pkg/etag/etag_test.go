@@ -0,0 +1,40 @@
+package etag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeak(t *testing.T) {
+	tag := Weak("a", "b")
+
+	assert.Regexp(t, `^W/"[0-9a-f]{32}"$`, tag)
+	assert.Equal(t, tag, Weak("a", "b"))
+	assert.NotEqual(t, tag, Weak("ab"))
+	assert.NotEqual(t, tag, Weak("a", "c"))
+}
+
+func TestMatch(t *testing.T) {
+	tag := Weak("v1")
+	strong := tag[2:]
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{name: "empty header", ifNoneMatch: "", want: false},
+		{name: "same tag", ifNoneMatch: tag, want: true},
+		{name: "strong form of the tag", ifNoneMatch: strong, want: true},
+		{name: "wildcard", ifNoneMatch: "*", want: true},
+		{name: "tag in list", ifNoneMatch: `W/"other", ` + tag, want: true},
+		{name: "different tag", ifNoneMatch: Weak("v2"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Match(tt.ifNoneMatch, tag))
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "acontext_api"
+
+var (
+	// HTTPRequests counts handled requests by method, route template and status code
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of handled HTTP requests.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes request latency by method and route template
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency in seconds.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// MessagesStored counts stored messages by input format
+	MessagesStored = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_stored_total",
+		Help:      "Number of messages stored, by input format.",
+	}, []string{"format"})
+
+	// S3OperationDuration observes S3 upload/download durations
+	S3OperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "s3_operation_duration_seconds",
+		Help:      "S3 operation duration in seconds.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// PartsCacheLookups counts Redis lookups of message parts by result (hit or miss)
+	PartsCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parts_cache_lookups_total",
+		Help:      "Redis message parts cache lookups, by result.",
+	}, []string{"result"})
+
+	// PartsS3Fallbacks counts message parts downloaded from S3 because they were not cached
+	PartsS3Fallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parts_s3_fallbacks_total",
+		Help:      "Message parts loaded from S3 after a Redis cache miss or with the cache disabled.",
+	})
+
+	// TokenizerDuration observes tokenizer call durations
+	TokenizerDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tokenizer_duration_seconds",
+		Help:      "Tokenizer call duration in seconds.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	})
+
+	// MQPendingEvents counts the outbox RabbitMQ messages not published, by status (pending or dead)
+	MQPendingEvents = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mq_pending_events",
+		Help:      "Outbox RabbitMQ messages not published, waiting for an attempt (pending) or given up (dead).",
+	}, []string{"status"})
+
+	// RedisCircuitOpen is 1 while Redis calls are skipped because Redis looks down, 0 otherwise
+	RedisCircuitOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "redis_circuit_open",
+		Help:      "Whether Redis calls are skipped by the circuit breaker after connection failures.",
+	})
+)
+
+// S3 operation label values
+const (
+	S3Upload   = "upload"
+	S3Download = "download"
+)
+
+// Parts cache result label values
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// ObserveS3 records the duration of an S3 operation started at start
+func ObserveS3(operation string, start time.Time) {
+	S3OperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// Handler serves the registered metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -20,22 +20,25 @@ func (n *AcontextNormalizer) NormalizeFromAcontextMessage(messageJSON json.RawMe
 		Meta  map[string]interface{} `json:"meta,omitempty"` // Optional message-level metadata
 	}
 
-	if err := json.Unmarshal(messageJSON, &msg); err != nil {
-		return "", nil, nil, fmt.Errorf("failed to unmarshal Acontext message: %w", err)
+	if err := decodeNumbers(messageJSON, &msg); err != nil {
+		return "", nil, nil, unmarshalErr("Acontext", err)
 	}
 
 	// Validate role
 	validRoles := map[string]bool{"user": true, "assistant": true}
 	if !validRoles[msg.Role] {
-		return "", nil, nil, fmt.Errorf("invalid role: %s (must be one of: user, assistant)", msg.Role)
+		return "", nil, nil, fieldErrf("role", "invalid role: %s (must be one of: user, assistant)", msg.Role)
 	}
 
 	// Validate each part
 	for i, part := range msg.Parts {
 		if err := part.Validate(); err != nil {
-			return "", nil, nil, fmt.Errorf("invalid part at index %d: %w", i, err)
+			return "", nil, nil, fieldErr(fmt.Sprintf("parts[%d]", i), fmt.Errorf("invalid part at index %d: %w", i, err))
 		}
 	}
+	if err := validatePartRoles("Acontext", "parts", msg.Role, msg.Parts); err != nil {
+		return "", nil, nil, err
+	}
 
 	// Extract or create message-level metadata
 	messageMeta := msg.Meta
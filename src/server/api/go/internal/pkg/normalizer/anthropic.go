@@ -19,34 +19,46 @@ func (n *AnthropicNormalizer) NormalizeFromAnthropicMessage(messageJSON json.Raw
 	// Parse using official Anthropic SDK types
 	var message anthropic.MessageParam
 	if err := message.UnmarshalJSON(messageJSON); err != nil {
-		return "", nil, nil, fmt.Errorf("failed to unmarshal Anthropic message: %w", err)
+		return "", nil, nil, unmarshalErr("Anthropic", err)
 	}
 
 	// Validate role (Anthropic only supports "user" and "assistant")
 	role := string(message.Role)
 	if role != "user" && role != "assistant" {
-		return "", nil, nil, fmt.Errorf("invalid Anthropic role: %s (only 'user' and 'assistant' are supported)", role)
+		return "", nil, nil, fieldErrf("role", "invalid Anthropic role: %s (only 'user' and 'assistant' are supported)", role)
 	}
 
 	// Convert content blocks
 	parts := []service.PartIn{}
-	for _, blockUnion := range message.Content {
-		part, err := normalizeAnthropicContentBlock(blockUnion)
+	rawInputs := rawItemFields(messageJSON, "content", "input")
+	for i, blockUnion := range message.Content {
+		var rawInput json.RawMessage
+		if i < len(rawInputs) {
+			rawInput = rawInputs[i]
+		}
+		part, err := normalizeAnthropicContentBlock(blockUnion, rawInput)
 		if err != nil {
-			return "", nil, nil, err
+			return "", nil, nil, at(fmt.Sprintf("content[%d]", i), err)
 		}
 		parts = append(parts, part)
 	}
+	if err := validatePartRoles("Anthropic", "content", role, parts); err != nil {
+		return "", nil, nil, err
+	}
 
 	// Extract message-level metadata
 	messageMeta := map[string]interface{}{
 		"source_format": "anthropic",
 	}
+	if name := stashedName(messageJSON); name != "" {
+		messageMeta["name"] = name
+	}
 
 	return role, parts, messageMeta, nil
 }
 
-func normalizeAnthropicContentBlock(blockUnion anthropic.ContentBlockParamUnion) (service.PartIn, error) {
+// normalizeAnthropicContentBlock converts a content block, rawInput is the raw JSON input of a tool_use block
+func normalizeAnthropicContentBlock(blockUnion anthropic.ContentBlockParamUnion, rawInput json.RawMessage) (service.PartIn, error) {
 	if blockUnion.OfText != nil {
 		part := service.PartIn{
 			Type: "text",
@@ -62,16 +74,7 @@ func normalizeAnthropicContentBlock(blockUnion anthropic.ContentBlockParamUnion)
 
 		return part, nil
 	} else if blockUnion.OfImage != nil {
-		// Handle image source
-		meta := map[string]interface{}{}
-		if blockUnion.OfImage.Source.OfBase64 != nil {
-			meta["type"] = "base64"
-			meta["media_type"] = blockUnion.OfImage.Source.OfBase64.MediaType
-			meta["data"] = blockUnion.OfImage.Source.OfBase64.Data
-		} else if blockUnion.OfImage.Source.OfURL != nil {
-			meta["type"] = "url"
-			meta["url"] = blockUnion.OfImage.Source.OfURL.URL
-		}
+		meta := anthropicImageMeta(*blockUnion.OfImage)
 
 		// Extract cache_control if present
 		if blockUnion.OfImage.CacheControl.Type != "" {
@@ -84,9 +87,9 @@ func normalizeAnthropicContentBlock(blockUnion anthropic.ContentBlockParamUnion)
 		}, nil
 	} else if blockUnion.OfToolUse != nil {
 		// Convert input to JSON string
-		argsBytes, err := json.Marshal(blockUnion.OfToolUse.Input)
+		argsBytes, err := toolArguments(blockUnion.OfToolUse.Input, rawInput)
 		if err != nil {
-			return service.PartIn{}, fmt.Errorf("failed to marshal tool input: %w", err)
+			return service.PartIn{}, fieldErrf("input", "failed to marshal tool input: %w", err)
 		}
 
 		// UNIFIED FORMAT: tool-call with unified field names
@@ -107,11 +110,14 @@ func normalizeAnthropicContentBlock(blockUnion anthropic.ContentBlockParamUnion)
 			Meta: meta,
 		}, nil
 	} else if blockUnion.OfToolResult != nil {
-		// Handle tool result content
+		// Handle tool result content, its images are kept in the meta of the tool-result part
 		var resultText string
+		var images []map[string]interface{}
 		for _, contentItem := range blockUnion.OfToolResult.Content {
 			if contentItem.OfText != nil {
 				resultText += contentItem.OfText.Text
+			} else if contentItem.OfImage != nil {
+				images = append(images, anthropicImageMeta(*contentItem.OfImage))
 			}
 		}
 
@@ -125,6 +131,9 @@ func normalizeAnthropicContentBlock(blockUnion anthropic.ContentBlockParamUnion)
 			"tool_call_id": blockUnion.OfToolResult.ToolUseID, // Unified: was "tool_use_id", now "tool_call_id"
 			"is_error":     isError,
 		}
+		if len(images) > 0 {
+			meta["images"] = images
+		}
 
 		// Extract cache_control if present
 		if blockUnion.OfToolResult.CacheControl.Type != "" {
@@ -141,7 +150,7 @@ func normalizeAnthropicContentBlock(blockUnion anthropic.ContentBlockParamUnion)
 		meta := map[string]interface{}{}
 		if blockUnion.OfDocument.Source.OfBase64 != nil {
 			meta["type"] = "base64"
-			meta["media_type"] = blockUnion.OfDocument.Source.OfBase64.MediaType
+			meta["media_type"] = string(blockUnion.OfDocument.Source.OfBase64.MediaType)
 			meta["data"] = blockUnion.OfDocument.Source.OfBase64.Data
 		} else if blockUnion.OfDocument.Source.OfURL != nil {
 			meta["type"] = "url"
@@ -159,7 +168,21 @@ func normalizeAnthropicContentBlock(blockUnion anthropic.ContentBlockParamUnion)
 		}, nil
 	}
 
-	return service.PartIn{}, fmt.Errorf("unsupported Anthropic content block type")
+	return service.PartIn{}, fieldErrf("type", "unsupported Anthropic content block type")
+}
+
+// anthropicImageMeta returns the meta of an image part from the source of an Anthropic image block
+func anthropicImageMeta(image anthropic.ImageBlockParam) map[string]interface{} {
+	meta := map[string]interface{}{}
+	if image.Source.OfBase64 != nil {
+		meta["type"] = "base64"
+		meta["media_type"] = string(image.Source.OfBase64.MediaType)
+		meta["data"] = image.Source.OfBase64.Data
+	} else if image.Source.OfURL != nil {
+		meta["type"] = "url"
+		meta["url"] = image.Source.OfURL.URL
+	}
+	return meta
 }
 
 // CacheControl represents cache control configuration
@@ -7,6 +7,7 @@ import (
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAnthropicNormalizer_NormalizeFromAnthropicMessage(t *testing.T) {
@@ -349,6 +350,16 @@ func TestAnthropicNormalizer_ContentBlockTypes(t *testing.T) {
 	}
 }
 
+func TestAnthropicNormalizer_ToolUseLargeNumbers(t *testing.T) {
+	// 2^53+1 is rounded to 2^53 by a float64
+	input := `{"role": "assistant", "content": [{"type": "text", "text": "Looking up"}, {"type": "tool_use", "id": "toolu_1", "name": "lookup", "input": {"user_id": 9007199254740993, "ids": [1, -9007199254740993]}}]}`
+
+	_, parts, _, err := (&AnthropicNormalizer{}).NormalizeFromAnthropicMessage(json.RawMessage(input))
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	assert.Equal(t, `{"user_id":9007199254740993,"ids":[1,-9007199254740993]}`, parts[1].Meta["arguments"])
+}
+
 func TestAnthropicNormalizer_CacheControl(t *testing.T) {
 	normalizer := &AnthropicNormalizer{}
 
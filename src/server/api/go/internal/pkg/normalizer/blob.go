@@ -0,0 +1,145 @@
+package normalizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+// ErrUnrecognizedBlob is returned when a message blob is empty or lacks the fields of its format
+var ErrUnrecognizedBlob = errors.New("empty or unrecognized message blob")
+
+// blobContentKeys lists per format the fields carrying message content; a blob must have at least one of them
+var blobContentKeys = map[model.MessageFormat][]string{
+	model.FormatOpenAI:    {"content", "tool_calls", "function_call"},
+	model.FormatAnthropic: {"content"},
+	model.FormatGemini:    {"parts"},
+	model.FormatAcontext:  {"parts"},
+	model.FormatLangChain: {"content"},
+}
+
+// blobRoleKeys lists the formats whose role is not in a role field, LangChain names it type
+var blobRoleKeys = map[model.MessageFormat]string{
+	model.FormatLangChain: "type",
+}
+
+// ValidateBlob checks that a message blob is a non-empty JSON object with a role and the content field
+// of its format, so that common client mistakes get a uniform error before any format-specific normalizer runs
+func ValidateBlob(format model.MessageFormat, blob json.RawMessage) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &fields); err != nil || len(fields) == 0 {
+		return fmt.Errorf("%w: %s blob must be a non-empty JSON object", ErrUnrecognizedBlob, format)
+	}
+
+	roleKey := "role"
+	if key, ok := blobRoleKeys[format]; ok {
+		roleKey = key
+	}
+	if !hasValue(fields, roleKey) {
+		return fmt.Errorf("%w: %s blob has no %s", ErrUnrecognizedBlob, format, roleKey)
+	}
+
+	keys := blobContentKeys[format]
+	for _, key := range keys {
+		if hasValue(fields, key) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s blob must have one of: %s", ErrUnrecognizedBlob, format, strings.Join(keys, ", "))
+}
+
+// Options tune the normalization of message blobs
+type Options struct {
+	// PreserveOpenAIContentArray marks OpenAI assistant messages whose content is an array, so they are
+	// converted back to OpenAI with the same content parts instead of their text joined into a string
+	PreserveOpenAIContentArray bool
+}
+
+// Normalize converts a message blob of the given format to the internal role, parts and message meta
+// using the format's normalizer. The blob is expected to have passed ValidateBlob.
+func Normalize(format model.MessageFormat, blob json.RawMessage, opts Options) (string, []service.PartIn, map[string]interface{}, error) {
+	switch format {
+	case model.FormatAcontext:
+		return (&AcontextNormalizer{}).NormalizeFromAcontextMessage(blob)
+	case model.FormatOpenAI:
+		return (&OpenAINormalizer{PreserveContentArray: opts.PreserveOpenAIContentArray}).NormalizeFromOpenAIMessage(blob)
+	case model.FormatAnthropic:
+		return (&AnthropicNormalizer{}).NormalizeFromAnthropicMessage(blob)
+	case model.FormatGemini:
+		return (&GeminiNormalizer{}).NormalizeFromGeminiMessage(blob)
+	case model.FormatLangChain:
+		return (&LangChainNormalizer{}).NormalizeFromLangChainMessage(blob)
+	default:
+		return "", nil, nil, fmt.Errorf("format %s is not supported", format)
+	}
+}
+
+// StashMetaKey is the field of Anthropic and Gemini messages holding the message meta these formats have no
+// field for, as written by the converter with Options.PreserveNames. Only the name is read back.
+const StashMetaKey = "meta"
+
+// stashedName returns the name stashed in the StashMetaKey field of a message blob, or ""
+func stashedName(blob json.RawMessage) string {
+	var fields struct {
+		Meta struct {
+			Name string `json:"name"`
+		} `json:"meta"`
+	}
+	_ = json.Unmarshal(blob, &fields)
+	return fields.Meta.Name
+}
+
+// decodeNumbers decodes JSON like json.Unmarshal, but the numbers of interface{} values as json.Number,
+// as a float64 rounds the integers beyond 2^53 of tool arguments
+func decodeNumbers(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// rawItemFields returns the raw JSON at path in each item of the list field of a message, by item index,
+// nil where an item has none. SDK types decode tool arguments with float64 numbers, the raw JSON keeps
+// the integers beyond 2^53 that these round.
+func rawItemFields(blob json.RawMessage, list string, path ...string) []json.RawMessage {
+	var fields map[string]json.RawMessage
+	var items []json.RawMessage
+	if json.Unmarshal(blob, &fields) != nil || json.Unmarshal(fields[list], &items) != nil {
+		return nil
+	}
+
+	out := make([]json.RawMessage, len(items))
+	for i, item := range items {
+		for _, key := range path {
+			var obj map[string]json.RawMessage
+			if json.Unmarshal(item, &obj) != nil {
+				item = nil
+				break
+			}
+			item = obj[key]
+		}
+		out[i] = item
+	}
+	return out
+}
+
+// toolArguments returns the JSON of tool arguments decoded as v, from their raw JSON when there is one
+func toolArguments(v interface{}, raw json.RawMessage) ([]byte, error) {
+	if len(raw) > 0 && string(raw) != "null" {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, raw); err == nil {
+			return buf.Bytes(), nil
+		}
+	}
+	return json.Marshal(v)
+}
+
+// hasValue reports whether the field is present and not null
+func hasValue(fields map[string]json.RawMessage, key string) bool {
+	v, ok := fields[key]
+	return ok && string(v) != "null"
+}
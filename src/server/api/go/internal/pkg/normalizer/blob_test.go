@@ -0,0 +1,44 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBlob(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  model.MessageFormat
+		blob    string
+		wantErr bool
+	}{
+		{name: "empty object", format: model.FormatOpenAI, blob: `{}`, wantErr: true},
+		{name: "null", format: model.FormatOpenAI, blob: `null`, wantErr: true},
+		{name: "string", format: model.FormatAnthropic, blob: `"hello"`, wantErr: true},
+		{name: "array", format: model.FormatGemini, blob: `[{"role":"user"}]`, wantErr: true},
+		{name: "missing role", format: model.FormatOpenAI, blob: `{"content":"hello"}`, wantErr: true},
+		{name: "null role", format: model.FormatAnthropic, blob: `{"role":null,"content":"hello"}`, wantErr: true},
+		{name: "openai without content", format: model.FormatOpenAI, blob: `{"role":"user"}`, wantErr: true},
+		{name: "openai text", format: model.FormatOpenAI, blob: `{"role":"user","content":"hello"}`},
+		{name: "openai tool calls only", format: model.FormatOpenAI, blob: `{"role":"assistant","content":null,"tool_calls":[]}`},
+		{name: "anthropic", format: model.FormatAnthropic, blob: `{"role":"user","content":"hello"}`},
+		{name: "anthropic with parts", format: model.FormatAnthropic, blob: `{"role":"user","parts":[]}`, wantErr: true},
+		{name: "gemini", format: model.FormatGemini, blob: `{"role":"user","parts":[{"text":"hello"}]}`},
+		{name: "acontext", format: model.FormatAcontext, blob: `{"role":"user","parts":[{"type":"text","text":"hello"}]}`},
+		{name: "acontext with content", format: model.FormatAcontext, blob: `{"role":"user","content":"hello"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBlob(tt.format, json.RawMessage(tt.blob))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrUnrecognizedBlob)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
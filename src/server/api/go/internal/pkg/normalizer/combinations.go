@@ -0,0 +1,86 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+// Valid role/content combinations.
+//
+// After normalization every message is either "user" or "assistant", and the
+// tool part types are bound to a single role in every format:
+//
+//	| part type                      | user | assistant |
+//	|--------------------------------|------|-----------|
+//	| text, image, audio, video,     | yes  | yes       |
+//	| file, data                     |      |           |
+//	| tool-call                      | no   | yes       |
+//	| tool-result                    | yes  | no        |
+//
+// In OpenAI format, role-specific fields are only accepted on their own role:
+//
+//	| field         | allowed roles |
+//	|---------------|---------------|
+//	| tool_calls    | assistant     |
+//	| function_call | assistant     |
+//	| tool_call_id  | tool          |
+//
+// The OpenAI SDK silently drops such fields on other roles, so they are checked
+// against the raw JSON before parsing.
+
+// partTypeRoles lists the only role allowed to carry each role-bound part type
+var partTypeRoles = map[string]string{
+	"tool-call":   "assistant",
+	"tool-result": "user",
+}
+
+// openAIFieldRoles lists the OpenAI roles allowed to carry each role-specific field
+var openAIFieldRoles = map[string][]string{
+	"tool_calls":    {"assistant"},
+	"function_call": {"assistant"},
+	"tool_call_id":  {"tool"},
+}
+
+// validatePartRoles checks that every role-bound part is carried by its allowed role.
+// field is the blob field holding one part per element, used in the error path.
+func validatePartRoles(format, field, role string, parts []service.PartIn) error {
+	for i, p := range parts {
+		if allowed, ok := partTypeRoles[p.Type]; ok && allowed != role {
+			return fieldErrf(fmt.Sprintf("%s[%d].type", field, i), "invalid %s message: parts[%d] of type %s is not allowed in %s messages (only in %s messages)", format, i, p.Type, role, allowed)
+		}
+	}
+	return nil
+}
+
+// validateOpenAIFieldRoles checks that role-specific fields of an OpenAI message match its role
+func validateOpenAIFieldRoles(messageJSON json.RawMessage) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(messageJSON, &raw); err != nil {
+		return unmarshalErr("OpenAI", err)
+	}
+
+	var role string
+	if r, ok := raw["role"]; ok {
+		_ = json.Unmarshal(r, &role)
+	}
+
+	for field, roles := range openAIFieldRoles {
+		v, ok := raw[field]
+		if !ok || string(v) == "null" {
+			continue
+		}
+		allowed := false
+		for _, r := range roles {
+			if r == role {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fieldErrf(field, "invalid OpenAI %s message: field %q is only allowed in %v messages", role, field, roles)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleCombinations(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		input       string
+		wantErr     bool
+		errContains string
+	}{
+		// OpenAI
+		{
+			name:   "openai assistant with content and tool_calls",
+			format: "openai",
+			input: `{
+				"role": "assistant",
+				"content": "Let me check.",
+				"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{}"}}]
+			}`,
+		},
+		{
+			name:   "openai assistant with null tool_call_id",
+			format: "openai",
+			input:  `{"role": "assistant", "content": "Hi", "tool_call_id": null}`,
+		},
+		{
+			name:        "openai tool with tool_calls",
+			format:      "openai",
+			input:       `{"role": "tool", "tool_call_id": "call_1", "content": "72F", "tool_calls": [{"id": "call_2", "type": "function", "function": {"name": "x", "arguments": "{}"}}]}`,
+			wantErr:     true,
+			errContains: `field "tool_calls" is only allowed in [assistant] messages`,
+		},
+		{
+			name:        "openai user with tool_calls",
+			format:      "openai",
+			input:       `{"role": "user", "content": "Hi", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "x", "arguments": "{}"}}]}`,
+			wantErr:     true,
+			errContains: `field "tool_calls"`,
+		},
+		{
+			name:        "openai user with function_call",
+			format:      "openai",
+			input:       `{"role": "user", "content": "Hi", "function_call": {"name": "x", "arguments": "{}"}}`,
+			wantErr:     true,
+			errContains: `field "function_call"`,
+		},
+		{
+			name:        "openai assistant with tool_call_id",
+			format:      "openai",
+			input:       `{"role": "assistant", "content": "Hi", "tool_call_id": "call_1"}`,
+			wantErr:     true,
+			errContains: `field "tool_call_id" is only allowed in [tool] messages`,
+		},
+		{
+			name:        "openai system with tool_calls",
+			format:      "openai",
+			input:       `{"role": "system", "content": "Be nice", "tool_calls": []}`,
+			wantErr:     true,
+			errContains: "system messages are not supported",
+		},
+		// Anthropic
+		{
+			name:   "anthropic assistant with text and tool_use",
+			format: "anthropic",
+			input:  `{"role": "assistant", "content": [{"type": "text", "text": "Checking"}, {"type": "tool_use", "id": "toolu_1", "name": "x", "input": {}}]}`,
+		},
+		{
+			name:        "anthropic user with tool_use",
+			format:      "anthropic",
+			input:       `{"role": "user", "content": [{"type": "tool_use", "id": "toolu_1", "name": "x", "input": {}}]}`,
+			wantErr:     true,
+			errContains: "parts[0] of type tool-call is not allowed in user messages",
+		},
+		{
+			name:        "anthropic assistant with tool_result",
+			format:      "anthropic",
+			input:       `{"role": "assistant", "content": [{"type": "text", "text": "Done"}, {"type": "tool_result", "tool_use_id": "toolu_1", "content": [{"type": "text", "text": "ok"}]}]}`,
+			wantErr:     true,
+			errContains: "parts[1] of type tool-result is not allowed in assistant messages",
+		},
+		// Gemini
+		{
+			name:        "gemini user with functionCall",
+			format:      "gemini",
+			input:       `{"role": "user", "parts": [{"functionCall": {"id": "call_1", "name": "x", "args": {}}}]}`,
+			wantErr:     true,
+			errContains: "tool-call is not allowed in user messages",
+		},
+		{
+			name:        "gemini model with functionResponse",
+			format:      "gemini",
+			input:       `{"role": "model", "parts": [{"functionResponse": {"id": "call_1", "name": "x", "response": {"output": "ok"}}}]}`,
+			wantErr:     true,
+			errContains: "tool-result is not allowed in assistant messages",
+		},
+		// Acontext
+		{
+			name:        "acontext user with tool-call",
+			format:      "acontext",
+			input:       `{"role": "user", "parts": [{"type": "tool-call", "meta": {"name": "x", "arguments": "{}"}}]}`,
+			wantErr:     true,
+			errContains: "tool-call is not allowed in user messages",
+		},
+		{
+			name:        "acontext assistant with tool-result",
+			format:      "acontext",
+			input:       `{"role": "assistant", "parts": [{"type": "tool-result", "text": "ok", "meta": {"tool_call_id": "call_1"}}]}`,
+			wantErr:     true,
+			errContains: "tool-result is not allowed in assistant messages",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			input := json.RawMessage(tt.input)
+			switch tt.format {
+			case "openai":
+				_, _, _, err = (&OpenAINormalizer{}).NormalizeFromOpenAIMessage(input)
+			case "anthropic":
+				_, _, _, err = (&AnthropicNormalizer{}).NormalizeFromAnthropicMessage(input)
+			case "gemini":
+				_, _, _, err = (&GeminiNormalizer{}).NormalizeFromGeminiMessage(input)
+			case "acontext":
+				_, _, _, err = (&AcontextNormalizer{}).NormalizeFromAcontextMessage(input)
+			}
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
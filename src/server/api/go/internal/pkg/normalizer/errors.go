@@ -0,0 +1,56 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// FieldError is a normalization error pointing at the offending field of the message blob,
+// with a JSON path such as content[1].image_url.url
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	err     error
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.err
+}
+
+// fieldErr reports err at path
+func fieldErr(path string, err error) *FieldError {
+	return &FieldError{Path: path, Message: err.Error(), err: err}
+}
+
+func fieldErrf(path, format string, args ...any) *FieldError {
+	return fieldErr(path, fmt.Errorf(format, args...))
+}
+
+// at prefixes the path of a FieldError returned for a nested value, e.g. at("content[1]", err)
+// turns image_url.url into content[1].image_url.url. Other errors are reported at prefix.
+func at(prefix string, err error) error {
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		return fieldErr(prefix, err)
+	}
+	path := prefix
+	if fe.Path != "" {
+		path += "." + fe.Path
+	}
+	return &FieldError{Path: path, Message: fe.Message, err: fe.err}
+}
+
+// unmarshalErr wraps a blob unmarshal error, keeping the field of type mismatches reported by encoding/json
+func unmarshalErr(format string, err error) error {
+	err = fmt.Errorf("failed to unmarshal %s message: %w", format, err)
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) && te.Field != "" {
+		return fieldErr(te.Field, err)
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+)
+
+func TestNormalize_FieldErrorPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   model.MessageFormat
+		blob     string
+		wantPath string
+	}{
+		{
+			name:     "openai empty image url",
+			format:   model.FormatOpenAI,
+			blob:     `{"role":"user","content":[{"type":"text","text":"a"},{"type":"image_url","image_url":{"url":""}}]}`,
+			wantPath: "content[1].image_url.url",
+		},
+		{
+			name:     "openai system message",
+			format:   model.FormatOpenAI,
+			blob:     `{"role":"system","content":"You are a bot"}`,
+			wantPath: "role",
+		},
+		{
+			name:     "openai field on the wrong role",
+			format:   model.FormatOpenAI,
+			blob:     `{"role":"user","content":"hi","tool_call_id":"call_1"}`,
+			wantPath: "tool_call_id",
+		},
+		{
+			name:     "anthropic tool result in assistant message",
+			format:   model.FormatAnthropic,
+			blob:     `{"role":"assistant","content":[{"type":"text","text":"a"},{"type":"tool_result","tool_use_id":"t1","content":"ok"}]}`,
+			wantPath: "content[1].type",
+		},
+		{
+			name:     "gemini function call without id",
+			format:   model.FormatGemini,
+			blob:     `{"role":"model","parts":[{"functionCall":{"name":"search","args":{}}}]}`,
+			wantPath: "parts[0].functionCall.id",
+		},
+		{
+			name:     "gemini type mismatch",
+			format:   model.FormatGemini,
+			blob:     `{"role":"user","parts":[{"text":5}]}`,
+			wantPath: "parts.text",
+		},
+		{
+			name:     "acontext invalid part",
+			format:   model.FormatAcontext,
+			blob:     `{"role":"user","parts":[{"type":"text","text":"a"},{"type":"text"}]}`,
+			wantPath: "parts[1]",
+		},
+		{
+			name:     "acontext invalid role",
+			format:   model.FormatAcontext,
+			blob:     `{"role":"system","parts":[{"type":"text","text":"a"}]}`,
+			wantPath: "role",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := Normalize(tt.format, json.RawMessage(tt.blob), Options{})
+			require.Error(t, err)
+
+			var fe *FieldError
+			require.True(t, errors.As(err, &fe), "expected a FieldError, got %v", err)
+			assert.Equal(t, tt.wantPath, fe.Path)
+			assert.Contains(t, err.Error(), tt.wantPath+": ")
+		})
+	}
+}
+
+func TestAt(t *testing.T) {
+	inner := errors.New("boom")
+
+	err := at("content[2]", fieldErr("image_url.url", inner))
+	assert.Equal(t, "content[2].image_url.url: boom", err.Error())
+	assert.ErrorIs(t, err, inner)
+
+	err = at("parts[0]", inner)
+	assert.Equal(t, "parts[0]: boom", err.Error())
+	assert.ErrorIs(t, err, inner)
+}
@@ -19,13 +19,13 @@ func (n *GeminiNormalizer) NormalizeFromGeminiMessage(messageJSON json.RawMessag
 	// Parse using official Google Gemini SDK types
 	var content genai.Content
 	if err := json.Unmarshal(messageJSON, &content); err != nil {
-		return "", nil, nil, fmt.Errorf("failed to unmarshal Gemini message: %w", err)
+		return "", nil, nil, unmarshalErr("Gemini", err)
 	}
 
 	// Convert role: "user" or "model" -> "user" or "assistant"
 	role := normalizeGeminiRole(content.Role)
 	if role == "" {
-		return "", nil, nil, fmt.Errorf("invalid Gemini role: %s (only 'user' and 'model' are supported)", content.Role)
+		return "", nil, nil, fieldErrf("role", "invalid Gemini role: %s (only 'user' and 'model' are supported)", content.Role)
 	}
 
 	// Convert parts
@@ -33,18 +33,29 @@ func (n *GeminiNormalizer) NormalizeFromGeminiMessage(messageJSON json.RawMessag
 	// Since FunctionCall and FunctionResponse are in different messages (different roles),
 	// we cannot match them without IDs. The user must provide matching IDs in Gemini format.
 	parts := []service.PartIn{}
-	for _, part := range content.Parts {
-		partIn, err := normalizeGeminiPart(part)
+	rawArgs := rawItemFields(messageJSON, "parts", "functionCall", "args")
+	for i, part := range content.Parts {
+		var args json.RawMessage
+		if i < len(rawArgs) {
+			args = rawArgs[i]
+		}
+		partIn, err := normalizeGeminiPart(part, args)
 		if err != nil {
-			return "", nil, nil, err
+			return "", nil, nil, at(fmt.Sprintf("parts[%d]", i), err)
 		}
 		parts = append(parts, partIn)
 	}
+	if err := validatePartRoles("Gemini", "parts", role, parts); err != nil {
+		return "", nil, nil, err
+	}
 
 	// Extract message-level metadata
 	messageMeta := map[string]interface{}{
 		"source_format": "gemini",
 	}
+	if name := stashedName(messageJSON); name != "" {
+		messageMeta["name"] = name
+	}
 
 	return role, parts, messageMeta, nil
 }
@@ -61,7 +72,8 @@ func normalizeGeminiRole(role string) string {
 	}
 }
 
-func normalizeGeminiPart(part *genai.Part) (service.PartIn, error) {
+// normalizeGeminiPart converts a part, rawArgs is the raw JSON args of a function call part
+func normalizeGeminiPart(part *genai.Part, rawArgs json.RawMessage) (service.PartIn, error) {
 	if part == nil {
 		return service.PartIn{}, fmt.Errorf("nil part")
 	}
@@ -92,15 +104,15 @@ func normalizeGeminiPart(part *genai.Part) (service.PartIn, error) {
 	// Handle function call part
 	if part.FunctionCall != nil {
 		// Convert args to JSON string
-		argsBytes, err := json.Marshal(part.FunctionCall.Args)
+		argsBytes, err := toolArguments(part.FunctionCall.Args, rawArgs)
 		if err != nil {
-			return service.PartIn{}, fmt.Errorf("failed to marshal function call args: %w", err)
+			return service.PartIn{}, fieldErrf("functionCall.args", "failed to marshal function call args: %w", err)
 		}
 
 		// UNIFIED FORMAT: tool-call with unified field names
 		// Require ID for proper matching with FunctionResponse
 		if part.FunctionCall.ID == "" {
-			return service.PartIn{}, fmt.Errorf("FunctionCall.ID is required but missing (function: %s)", part.FunctionCall.Name)
+			return service.PartIn{}, fieldErrf("functionCall.id", "FunctionCall.ID is required but missing (function: %s)", part.FunctionCall.Name)
 		}
 
 		meta := map[string]interface{}{
@@ -134,7 +146,7 @@ func normalizeGeminiPart(part *genai.Part) (service.PartIn, error) {
 		// 2. Multiple FunctionCalls with the same name would cause ambiguity
 		// 3. The user must provide matching IDs in Gemini format for proper matching
 		if part.FunctionResponse.ID == "" {
-			return service.PartIn{}, fmt.Errorf("FunctionResponse.ID is required but missing (function: %s)", part.FunctionResponse.Name)
+			return service.PartIn{}, fieldErrf("functionResponse.id", "FunctionResponse.ID is required but missing (function: %s)", part.FunctionResponse.Name)
 		}
 
 		meta := map[string]interface{}{
@@ -8,6 +8,7 @@ import (
 	"google.golang.org/genai"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGeminiNormalizer_NormalizeFromGeminiMessage(t *testing.T) {
@@ -181,6 +182,16 @@ func TestGeminiNormalizer_FunctionCall(t *testing.T) {
 	assert.Equal(t, "gemini", messageMeta["source_format"])
 }
 
+func TestGeminiNormalizer_FunctionCallLargeNumbers(t *testing.T) {
+	// 2^53+1 is rounded to 2^53 by a float64
+	input := `{"role": "model", "parts": [{"text": "Looking up"}, {"functionCall": {"id": "call_1", "name": "lookup", "args": {"user_id": 9007199254740993}}}]}`
+
+	_, parts, _, err := (&GeminiNormalizer{}).NormalizeFromGeminiMessage(json.RawMessage(input))
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	assert.Equal(t, `{"user_id":9007199254740993}`, parts[1].Meta["arguments"])
+}
+
 func TestGeminiNormalizer_FunctionResponse(t *testing.T) {
 	normalizer := &GeminiNormalizer{}
 
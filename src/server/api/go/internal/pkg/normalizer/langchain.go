@@ -0,0 +1,186 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+// LangChainNormalizer normalizes raw LangChain message dicts, as LangChain agents serialize them:
+// {type: human|ai|tool, content, additional_kwargs: {tool_calls}}
+type LangChainNormalizer struct{}
+
+type langChainMessage struct {
+	Type             string          `json:"type"`
+	Content          json.RawMessage `json:"content"`
+	Name             string          `json:"name,omitempty"`
+	ToolCallID       string          `json:"tool_call_id,omitempty"`
+	AdditionalKwargs struct {
+		ToolCalls []langChainToolCall `json:"tool_calls,omitempty"`
+	} `json:"additional_kwargs"`
+}
+
+// langChainToolCall is a tool call of additional_kwargs, in the OpenAI shape LangChain keeps it in
+type langChainToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// langChainContentBlock is an element of a content list
+type langChainContentBlock struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text"`
+	ImageURL json.RawMessage `json:"image_url"` // a url string, or {url, detail}
+}
+
+// NormalizeFromLangChainMessage converts a LangChain message dict to internal format.
+// human messages become user messages, ai messages assistant messages with their
+// additional_kwargs.tool_calls as tool-call parts, and tool messages user messages with a tool-result part.
+// Returns: role, parts, messageMeta, error
+func (n *LangChainNormalizer) NormalizeFromLangChainMessage(messageJSON json.RawMessage) (string, []service.PartIn, map[string]interface{}, error) {
+	var msg langChainMessage
+	if err := json.Unmarshal(messageJSON, &msg); err != nil {
+		return "", nil, nil, unmarshalErr("LangChain", err)
+	}
+
+	if len(msg.AdditionalKwargs.ToolCalls) > 0 && msg.Type != "ai" {
+		return "", nil, nil, fieldErrf("additional_kwargs.tool_calls", "invalid LangChain %s message: tool_calls are only allowed in ai messages", msg.Type)
+	}
+
+	var role string
+	var parts []service.PartIn
+	var err error
+	switch msg.Type {
+	case "human":
+		role = "user"
+		parts, err = normalizeLangChainContent(msg.Content)
+		if err == nil && len(parts) == 0 {
+			err = fieldErrf("content", "LangChain human message must have content")
+		}
+	case "ai":
+		role = "assistant"
+		parts, err = normalizeLangChainContent(msg.Content)
+		for i, toolCall := range msg.AdditionalKwargs.ToolCalls {
+			if toolCall.ID == "" || toolCall.Function.Name == "" {
+				return "", nil, nil, fieldErrf(fmt.Sprintf("additional_kwargs.tool_calls[%d]", i), "tool call must have an id and a function name")
+			}
+			parts = append(parts, service.PartIn{
+				Type: "tool-call",
+				Meta: map[string]interface{}{
+					"id":        toolCall.ID,
+					"name":      toolCall.Function.Name,
+					"arguments": toolCall.Function.Arguments,
+					"type":      "function",
+				},
+			})
+		}
+	case "tool":
+		role = "user"
+		if msg.ToolCallID == "" {
+			return "", nil, nil, fieldErrf("tool_call_id", "LangChain tool message must have a tool_call_id")
+		}
+		parts, err = normalizeLangChainToolResult(msg.Content, msg.ToolCallID)
+	case "system":
+		return "", nil, nil, fieldErrf("type", "system messages are not supported. Use session-level or skill-level configuration for system prompts")
+	default:
+		return "", nil, nil, fieldErrf("type", "invalid LangChain message type: %s (must be one of: human, ai, tool)", msg.Type)
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	messageMeta := map[string]interface{}{
+		"source_format": "langchain",
+	}
+	if msg.Name != "" {
+		messageMeta["name"] = msg.Name
+	}
+
+	return role, parts, messageMeta, nil
+}
+
+// normalizeLangChainContent converts a content string, or list of text and image_url blocks, to parts
+func normalizeLangChainContent(content json.RawMessage) ([]service.PartIn, error) {
+	if len(content) == 0 || string(content) == "null" {
+		return nil, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		if text == "" {
+			return nil, nil
+		}
+		return []service.PartIn{{Type: "text", Text: text}}, nil
+	}
+
+	var blocks []langChainContentBlock
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return nil, fieldErrf("content", "content must be a string or a list of content blocks")
+	}
+
+	parts := make([]service.PartIn, 0, len(blocks))
+	for i, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, service.PartIn{Type: "text", Text: block.Text})
+		case "image_url":
+			url, detail := parseLangChainImageURL(block.ImageURL)
+			if url == "" {
+				return nil, fieldErrf(fmt.Sprintf("content[%d].image_url", i), "image url must not be empty")
+			}
+			parts = append(parts, service.PartIn{
+				Type: "image",
+				Meta: map[string]interface{}{
+					"url":    url,
+					"detail": detail,
+				},
+			})
+		default:
+			return nil, fieldErrf(fmt.Sprintf("content[%d].type", i), "unsupported LangChain content block type: %s", block.Type)
+		}
+	}
+	return parts, nil
+}
+
+// parseLangChainImageURL reads an image_url given either as a url string or as {url, detail}
+func parseLangChainImageURL(raw json.RawMessage) (string, string) {
+	var url string
+	if err := json.Unmarshal(raw, &url); err == nil {
+		return url, ""
+	}
+	var obj struct {
+		URL    string `json:"url"`
+		Detail string `json:"detail"`
+	}
+	_ = json.Unmarshal(raw, &obj)
+	return obj.URL, obj.Detail
+}
+
+// normalizeLangChainToolResult converts the content of a tool message to a single tool-result part
+func normalizeLangChainToolResult(content json.RawMessage, toolCallID string) ([]service.PartIn, error) {
+	parts, err := normalizeLangChainContent(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var text string
+	for i, p := range parts {
+		if p.Type != "text" {
+			return nil, fieldErrf(fmt.Sprintf("content[%d].type", i), "LangChain tool message content must be text")
+		}
+		text += p.Text
+	}
+
+	return []service.PartIn{{
+		Type: "tool-result",
+		Text: text,
+		Meta: map[string]interface{}{
+			"tool_call_id": toolCallID,
+		},
+	}}, nil
+}
@@ -0,0 +1,129 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+)
+
+func TestLangChainNormalizer_NormalizeFromLangChainMessage(t *testing.T) {
+	normalizer := &LangChainNormalizer{}
+
+	tests := []struct {
+		name          string
+		input         string
+		wantRole      string
+		wantPartTypes []string
+		wantErr       bool
+		errContains   string
+	}{
+		{
+			name:          "human message with text",
+			input:         `{"type": "human", "content": "Hello", "additional_kwargs": {}}`,
+			wantRole:      "user",
+			wantPartTypes: []string{"text"},
+		},
+		{
+			name:          "human message with image block",
+			input:         `{"type": "human", "content": [{"type": "text", "text": "What is this?"}, {"type": "image_url", "image_url": {"url": "https://example.com/a.png"}}]}`,
+			wantRole:      "user",
+			wantPartTypes: []string{"text", "image"},
+		},
+		{
+			name: "ai message with tool calls",
+			input: `{"type": "ai", "content": "Checking.", "additional_kwargs": {"tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"SF\"}"}}
+			]}}`,
+			wantRole:      "assistant",
+			wantPartTypes: []string{"text", "tool-call"},
+		},
+		{
+			name:          "ai message with only tool calls",
+			input:         `{"type": "ai", "content": "", "additional_kwargs": {"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "f", "arguments": "{}"}}]}}`,
+			wantRole:      "assistant",
+			wantPartTypes: []string{"tool-call"},
+		},
+		{
+			name:          "tool message",
+			input:         `{"type": "tool", "content": "72F", "tool_call_id": "call_1"}`,
+			wantRole:      "user",
+			wantPartTypes: []string{"tool-result"},
+		},
+		{
+			name:        "tool message without tool_call_id",
+			input:       `{"type": "tool", "content": "72F"}`,
+			wantErr:     true,
+			errContains: "tool_call_id",
+		},
+		{
+			name:        "tool calls on a human message",
+			input:       `{"type": "human", "content": "hi", "additional_kwargs": {"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "f", "arguments": "{}"}}]}}`,
+			wantErr:     true,
+			errContains: "only allowed in ai messages",
+		},
+		{
+			name:        "system message",
+			input:       `{"type": "system", "content": "You are helpful"}`,
+			wantErr:     true,
+			errContains: "system messages are not supported",
+		},
+		{
+			name:        "unknown type",
+			input:       `{"type": "chat", "content": "hi"}`,
+			wantErr:     true,
+			errContains: "invalid LangChain message type",
+		},
+		{
+			name:        "unsupported content block",
+			input:       `{"type": "human", "content": [{"type": "audio"}]}`,
+			wantErr:     true,
+			errContains: "content[0].type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, parts, meta, err := normalizer.NormalizeFromLangChainMessage(json.RawMessage(tt.input))
+
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRole, role)
+			types := make([]string, 0, len(parts))
+			for _, p := range parts {
+				types = append(types, p.Type)
+			}
+			assert.Equal(t, tt.wantPartTypes, types)
+			assert.Equal(t, "langchain", meta["source_format"])
+		})
+	}
+}
+
+func TestLangChainNormalizer_ToolCallMeta(t *testing.T) {
+	input := `{"type": "ai", "content": "", "name": "agent", "additional_kwargs": {"tool_calls": [
+		{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"SF\"}"}}
+	]}}`
+
+	_, parts, meta, err := (&LangChainNormalizer{}).NormalizeFromLangChainMessage(json.RawMessage(input))
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	assert.Equal(t, map[string]interface{}{
+		"id":        "call_1",
+		"name":      "get_weather",
+		"arguments": `{"city":"SF"}`,
+		"type":      "function",
+	}, parts[0].Meta)
+	assert.Equal(t, "agent", meta["name"])
+}
+
+func TestValidateBlob_LangChain(t *testing.T) {
+	assert.NoError(t, ValidateBlob(model.FormatLangChain, json.RawMessage(`{"type": "human", "content": "hi"}`)))
+	assert.ErrorIs(t, ValidateBlob(model.FormatLangChain, json.RawMessage(`{"role": "user", "content": "hi"}`)), ErrUnrecognizedBlob)
+}
@@ -0,0 +1,79 @@
+package normalizer
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ErrLimitExceeded is wrapped by the errors of CheckLimits
+var ErrLimitExceeded = errors.New("message limit exceeded")
+
+// Limits bounds a message blob before it is normalized, 0 disables a limit
+type Limits struct {
+	MaxParts           int // Max items in the content, parts and tool_calls arrays of the message together, LangChain's additional_kwargs.tool_calls included
+	MaxInlineDataBytes int // Max length of a single base64 payload, e.g. a data url or an inline data field
+}
+
+// inlineDataKeys are the fields carrying base64 payloads in the supported formats:
+// OpenAI input_audio.data and file.file_data, Anthropic source.data, Gemini inlineData.data
+var inlineDataKeys = map[string]bool{"data": true, "file_data": true}
+
+// CheckLimits checks a decoded message blob of any format against limits without normalizing it,
+// so oversized messages are rejected before they are copied around
+func CheckLimits(blob any, limits Limits) error {
+	m, ok := blob.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	if limits.MaxParts > 0 {
+		n := 0
+		for _, key := range []string{"content", "parts", "tool_calls"} {
+			if items, ok := m[key].([]any); ok {
+				n += len(items)
+			}
+		}
+		if kwargs, ok := m["additional_kwargs"].(map[string]any); ok {
+			if items, ok := kwargs["tool_calls"].([]any); ok {
+				n += len(items)
+			}
+		}
+		if n > limits.MaxParts {
+			return fmt.Errorf("%w: message has %d parts, at most %d are allowed", ErrLimitExceeded, n, limits.MaxParts)
+		}
+	}
+
+	if limits.MaxInlineDataBytes > 0 {
+		return checkInlineData("", "", m, limits.MaxInlineDataBytes)
+	}
+	return nil
+}
+
+func checkInlineData(path, key string, v any, maxBytes int) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			if err := checkInlineData(p, k, v[k], maxBytes); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if err := checkInlineData(fmt.Sprintf("%s[%d]", path, i), "", item, maxBytes); err != nil {
+				return err
+			}
+		}
+	case string:
+		if len(v) > maxBytes && (inlineDataKeys[key] || strings.HasPrefix(v, "data:")) {
+			return fieldErr(path, fmt.Errorf("%w: inline data is %d bytes, at most %d are allowed", ErrLimitExceeded, len(v), maxBytes))
+		}
+	}
+	return nil
+}
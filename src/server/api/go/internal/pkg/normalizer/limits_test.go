@@ -0,0 +1,82 @@
+package normalizer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckLimits(t *testing.T) {
+	big := strings.Repeat("A", 64)
+	limits := Limits{MaxParts: 2, MaxInlineDataBytes: 32}
+
+	tests := []struct {
+		name     string
+		blob     any
+		wantPath string
+		wantErr  bool
+	}{
+		{
+			name: "within limits",
+			blob: map[string]any{"role": "user", "content": []any{
+				map[string]any{"type": "text", "text": big},
+				map[string]any{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/cat.png"}},
+			}},
+		},
+		{
+			name:    "too many parts",
+			blob:    map[string]any{"role": "user", "parts": []any{"a", "b", "c"}},
+			wantErr: true,
+		},
+		{
+			name:    "tool calls count as parts",
+			blob:    map[string]any{"role": "assistant", "content": []any{"a"}, "tool_calls": []any{"b", "c"}},
+			wantErr: true,
+		},
+		{
+			name: "openai data url",
+			blob: map[string]any{"role": "user", "content": []any{
+				map[string]any{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64," + big}},
+			}},
+			wantPath: "content[0].image_url.url",
+			wantErr:  true,
+		},
+		{
+			name: "anthropic source data",
+			blob: map[string]any{"role": "user", "content": []any{
+				map[string]any{"type": "text", "text": "look"},
+				map[string]any{"type": "image", "source": map[string]any{"type": "base64", "data": big}},
+			}},
+			wantPath: "content[1].source.data",
+			wantErr:  true,
+		},
+		{
+			name:     "gemini inline data",
+			blob:     map[string]any{"role": "user", "parts": []any{map[string]any{"inlineData": map[string]any{"mimeType": "image/png", "data": big}}}},
+			wantPath: "parts[0].inlineData.data",
+			wantErr:  true,
+		},
+		{name: "not an object", blob: "hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckLimits(tt.blob, limits)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrLimitExceeded)
+			if tt.wantPath != "" {
+				var fe *FieldError
+				if assert.True(t, errors.As(err, &fe)) {
+					assert.Equal(t, tt.wantPath, fe.Path)
+				}
+			}
+		})
+	}
+
+	assert.NoError(t, CheckLimits(map[string]any{"parts": []any{"a", "b", "c"}}, Limits{}), "zero limits are disabled")
+}
@@ -11,7 +11,11 @@ import (
 )
 
 // OpenAINormalizer normalizes OpenAI format to internal format using official SDK types
-type OpenAINormalizer struct{}
+type OpenAINormalizer struct {
+	// PreserveContentArray records in the message meta that an assistant message had its content
+	// as an array, see Options.PreserveOpenAIContentArray
+	PreserveContentArray bool
+}
 
 // NormalizeFromOpenAIMessage converts OpenAI ChatCompletionMessageParamUnion to internal format
 // Returns: role, parts, messageMeta, error
@@ -19,25 +23,32 @@ func (n *OpenAINormalizer) NormalizeFromOpenAIMessage(messageJSON json.RawMessag
 	// Parse using official OpenAI SDK types
 	var message openai.ChatCompletionMessageParamUnion
 	if err := message.UnmarshalJSON(messageJSON); err != nil {
-		return "", nil, nil, fmt.Errorf("failed to unmarshal OpenAI message: %w", err)
+		return "", nil, nil, unmarshalErr("OpenAI", err)
+	}
+
+	// Reject role-specific fields on other roles, the SDK would drop them silently
+	if message.OfSystem == nil && message.OfDeveloper == nil {
+		if err := validateOpenAIFieldRoles(messageJSON); err != nil {
+			return "", nil, nil, err
+		}
 	}
 
 	// Extract role and content based on message type
 	if message.OfUser != nil {
 		return normalizeOpenAIUserMessage(*message.OfUser)
 	} else if message.OfAssistant != nil {
-		return normalizeOpenAIAssistantMessage(*message.OfAssistant)
+		return normalizeOpenAIAssistantMessage(*message.OfAssistant, n.PreserveContentArray)
 	} else if message.OfSystem != nil {
-		return "", nil, nil, fmt.Errorf("system messages are not supported. Use session-level or skill-level configuration for system prompts")
+		return "", nil, nil, fieldErrf("role", "system messages are not supported. Use session-level or skill-level configuration for system prompts")
 	} else if message.OfTool != nil {
-		return normalizeOpenAIToolMessage(*message.OfTool)
+		return normalizeOpenAIToolMessage(*message.OfTool, messageJSON)
 	} else if message.OfFunction != nil {
 		return normalizeOpenAIFunctionMessage(*message.OfFunction)
 	} else if message.OfDeveloper != nil {
-		return "", nil, nil, fmt.Errorf("developer messages are not supported. Use session-level or skill-level configuration for system prompts")
+		return "", nil, nil, fieldErrf("role", "developer messages are not supported. Use session-level or skill-level configuration for system prompts")
 	}
 
-	return "", nil, nil, fmt.Errorf("unknown OpenAI message type")
+	return "", nil, nil, fieldErrf("role", "unknown OpenAI message type")
 }
 
 func normalizeOpenAIUserMessage(msg openai.ChatCompletionUserMessageParam) (string, []service.PartIn, map[string]interface{}, error) {
@@ -50,15 +61,15 @@ func normalizeOpenAIUserMessage(msg openai.ChatCompletionUserMessageParam) (stri
 			Text: msg.Content.OfString.Value,
 		})
 	} else if len(msg.Content.OfArrayOfContentParts) > 0 {
-		for _, partUnion := range msg.Content.OfArrayOfContentParts {
+		for i, partUnion := range msg.Content.OfArrayOfContentParts {
 			part, err := normalizeOpenAIContentPart(partUnion)
 			if err != nil {
-				return "", nil, nil, err
+				return "", nil, nil, at(fmt.Sprintf("content[%d]", i), err)
 			}
 			parts = append(parts, part)
 		}
 	} else {
-		return "", nil, nil, fmt.Errorf("OpenAI user message must have content")
+		return "", nil, nil, fieldErrf("content", "OpenAI user message must have content")
 	}
 
 	// Extract message-level metadata
@@ -74,7 +85,10 @@ func normalizeOpenAIUserMessage(msg openai.ChatCompletionUserMessageParam) (stri
 	return "user", parts, messageMeta, nil
 }
 
-func normalizeOpenAIAssistantMessage(msg openai.ChatCompletionAssistantMessageParam) (string, []service.PartIn, map[string]interface{}, error) {
+// normalizeOpenAIAssistantMessage always orders the parts the same way: the content first, in array order,
+// then tool_calls in array order, then the deprecated function_call. OpenAI keeps content and tool calls
+// in separate fields, so this is the only order a message can be converted back to.
+func normalizeOpenAIAssistantMessage(msg openai.ChatCompletionAssistantMessageParam, preserveContentArray bool) (string, []service.PartIn, map[string]interface{}, error) {
 	parts := []service.PartIn{}
 
 	// Handle content - can be string or array
@@ -86,10 +100,10 @@ func normalizeOpenAIAssistantMessage(msg openai.ChatCompletionAssistantMessagePa
 			})
 		}
 	} else if len(msg.Content.OfArrayOfContentParts) > 0 {
-		for _, partUnion := range msg.Content.OfArrayOfContentParts {
+		for i, partUnion := range msg.Content.OfArrayOfContentParts {
 			part, err := normalizeOpenAIAssistantContentPart(partUnion)
 			if err != nil {
-				return "", nil, nil, err
+				return "", nil, nil, at(fmt.Sprintf("content[%d]", i), err)
 			}
 			parts = append(parts, part)
 		}
@@ -132,10 +146,14 @@ func normalizeOpenAIAssistantMessage(msg openai.ChatCompletionAssistantMessagePa
 		messageMeta["name"] = msg.Name.Value
 	}
 
+	if preserveContentArray && len(msg.Content.OfArrayOfContentParts) > 0 {
+		messageMeta["content_array"] = true
+	}
+
 	return "assistant", parts, messageMeta, nil
 }
 
-func normalizeOpenAIToolMessage(msg openai.ChatCompletionToolMessageParam) (string, []service.PartIn, map[string]interface{}, error) {
+func normalizeOpenAIToolMessage(msg openai.ChatCompletionToolMessageParam, messageJSON json.RawMessage) (string, []service.PartIn, map[string]interface{}, error) {
 	parts := []service.PartIn{}
 
 	// Tool messages are converted to user messages with tool-result parts
@@ -161,6 +179,14 @@ func normalizeOpenAIToolMessage(msg openai.ChatCompletionToolMessageParam) (stri
 		"source_format": "openai",
 	}
 
+	// The SDK has no name on tool messages, but clients send one to name the participant
+	var raw struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(messageJSON, &raw); err == nil && raw.Name != "" {
+		messageMeta["name"] = raw.Name
+	}
+
 	return "user", parts, messageMeta, nil
 }
 
@@ -196,6 +222,9 @@ func normalizeOpenAIContentPart(partUnion openai.ChatCompletionContentPartUnionP
 			Text: partUnion.OfText.Text,
 		}, nil
 	} else if partUnion.OfImageURL != nil {
+		if partUnion.OfImageURL.ImageURL.URL == "" {
+			return service.PartIn{}, fieldErrf("image_url.url", "image url must not be empty")
+		}
 		return service.PartIn{
 			Type: "image",
 			Meta: map[string]interface{}{
@@ -235,7 +264,7 @@ func normalizeOpenAIContentPart(partUnion openai.ChatCompletionContentPartUnionP
 		}, nil
 	}
 
-	return service.PartIn{}, fmt.Errorf("unsupported OpenAI content part type")
+	return service.PartIn{}, fieldErrf("type", "unsupported OpenAI content part type")
 }
 
 func normalizeOpenAIAssistantContentPart(partUnion openai.ChatCompletionAssistantMessageParamContentArrayOfContentPartUnion) (service.PartIn, error) {
@@ -254,5 +283,5 @@ func normalizeOpenAIAssistantContentPart(partUnion openai.ChatCompletionAssistan
 		}, nil
 	}
 
-	return service.PartIn{}, fmt.Errorf("unsupported OpenAI assistant content part type")
+	return service.PartIn{}, fieldErrf("type", "unsupported OpenAI assistant content part type")
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestOpenAINormalizer_NormalizeFromOpenAIMessage(t *testing.T) {
@@ -358,6 +359,39 @@ func TestOpenAINormalizer_ToolCallsAndResults(t *testing.T) {
 	})
 }
 
+func TestOpenAINormalizer_AssistantPartOrder(t *testing.T) {
+	input := `{
+		"role": "assistant",
+		"tool_calls": [
+			{"id": "call_1", "type": "function", "function": {"name": "first", "arguments": "{}"}},
+			{"id": "call_2", "type": "function", "function": {"name": "second", "arguments": "{}"}}
+		],
+		"content": [
+			{"type": "text", "text": "Let me check."},
+			{"type": "refusal", "refusal": "I can't share that."}
+		]
+	}`
+
+	// content first in array order, then tool calls in array order, whatever the field order
+	_, parts, messageMeta, err := (&OpenAINormalizer{}).NormalizeFromOpenAIMessage(json.RawMessage(input))
+	require.NoError(t, err)
+	require.Len(t, parts, 4)
+	assert.Equal(t, "Let me check.", parts[0].Text)
+	assert.Equal(t, "I can't share that.", parts[1].Text)
+	assert.Equal(t, "first", parts[2].Meta["name"])
+	assert.Equal(t, "second", parts[3].Meta["name"])
+	assert.NotContains(t, messageMeta, "content_array")
+
+	_, _, messageMeta, err = (&OpenAINormalizer{PreserveContentArray: true}).NormalizeFromOpenAIMessage(json.RawMessage(input))
+	require.NoError(t, err)
+	assert.Equal(t, true, messageMeta["content_array"])
+
+	// string content is not an array to preserve
+	_, _, messageMeta, err = (&OpenAINormalizer{PreserveContentArray: true}).NormalizeFromOpenAIMessage(json.RawMessage(`{"role": "assistant", "content": "Hi"}`))
+	require.NoError(t, err)
+	assert.NotContains(t, messageMeta, "content_array")
+}
+
 func TestOpenAINormalizer_MultipleContentParts(t *testing.T) {
 	normalizer := &OpenAINormalizer{}
 
@@ -406,3 +440,22 @@ func TestOpenAINormalizer_MessageWithName(t *testing.T) {
 	assert.Equal(t, "openai", messageMeta["source_format"])
 	assert.Equal(t, "Alice", messageMeta["name"])
 }
+
+func TestOpenAINormalizer_ToolMessageWithName(t *testing.T) {
+	normalizer := &OpenAINormalizer{}
+
+	input := `{
+		"role": "tool",
+		"name": "get_weather",
+		"tool_call_id": "call_1",
+		"content": "Sunny"
+	}`
+
+	role, parts, messageMeta, err := normalizer.NormalizeFromOpenAIMessage(json.RawMessage(input))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "user", role)
+	assert.Len(t, parts, 1)
+	assert.Equal(t, "tool-result", parts[0].Type)
+	assert.Equal(t, "get_weather", messageMeta["name"])
+}
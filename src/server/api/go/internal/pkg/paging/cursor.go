@@ -11,6 +11,10 @@ import (
 	"github.com/google/uuid"
 )
 
+// ErrInvalidCursor is wrapped by every DecodeCursor error. A cursor that doesn't decode comes from
+// the client, so callers should report it as a bad request.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 func EncodeCursor(t time.Time, id uuid.UUID) string {
 	raw := fmt.Sprintf("%d|%s", t.UTC().UnixNano(), id.String())
 	return base64.RawURLEncoding.EncodeToString([]byte(raw))
@@ -18,23 +22,118 @@ func EncodeCursor(t time.Time, id uuid.UUID) string {
 
 func DecodeCursor(s string) (time.Time, uuid.UUID, error) {
 	if s == "" {
-		return time.Time{}, uuid.Nil, errors.New("empty cursor")
+		return time.Time{}, uuid.Nil, fmt.Errorf("%w: empty cursor", ErrInvalidCursor)
 	}
-	b, err := base64.RawURLEncoding.DecodeString(s)
+	b, err := decodeBase64(s)
 	if err != nil {
-		return time.Time{}, uuid.Nil, err
+		return time.Time{}, uuid.Nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
 	}
 	parts := strings.Split(string(b), "|")
 	if len(parts) != 2 {
-		return time.Time{}, uuid.Nil, errors.New("bad cursor")
+		return time.Time{}, uuid.Nil, fmt.Errorf("%w: bad cursor", ErrInvalidCursor)
 	}
 	ns, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
-		return time.Time{}, uuid.Nil, err
+		return time.Time{}, uuid.Nil, fmt.Errorf("%w: bad timestamp: %v", ErrInvalidCursor, err)
 	}
 	id, err := uuid.Parse(parts[1])
 	if err != nil {
-		return time.Time{}, uuid.Nil, err
+		return time.Time{}, uuid.Nil, fmt.Errorf("%w: bad id: %v", ErrInvalidCursor, err)
 	}
 	return time.Unix(0, ns).UTC(), id, nil
 }
+
+// EncodeMessageCursor encodes the ordering key of a message: its client_seq, nil when unset, then its created_at
+// and id. Without client_seq it is the cursor of EncodeCursor.
+func EncodeMessageCursor(seq *int64, t time.Time, id uuid.UUID) string {
+	if seq == nil {
+		return EncodeCursor(t, id)
+	}
+	raw := fmt.Sprintf("%d|%d|%s", *seq, t.UTC().UnixNano(), id.String())
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeMessageCursor decodes a cursor of EncodeMessageCursor, the client_seq is nil for a cursor of EncodeCursor
+func DecodeMessageCursor(s string) (*int64, time.Time, uuid.UUID, error) {
+	if s == "" {
+		return nil, time.Time{}, uuid.Nil, fmt.Errorf("%w: empty cursor", ErrInvalidCursor)
+	}
+	b, err := decodeBase64(s)
+	if err != nil {
+		return nil, time.Time{}, uuid.Nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	parts := strings.Split(string(b), "|")
+	if len(parts) == 2 {
+		t, id, err := DecodeCursor(s)
+		return nil, t, id, err
+	}
+	if len(parts) != 3 {
+		return nil, time.Time{}, uuid.Nil, fmt.Errorf("%w: bad cursor", ErrInvalidCursor)
+	}
+
+	seq, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, time.Time{}, uuid.Nil, fmt.Errorf("%w: bad client_seq: %v", ErrInvalidCursor, err)
+	}
+	ns, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, time.Time{}, uuid.Nil, fmt.Errorf("%w: bad timestamp: %v", ErrInvalidCursor, err)
+	}
+	id, err := uuid.Parse(parts[2])
+	if err != nil {
+		return nil, time.Time{}, uuid.Nil, fmt.Errorf("%w: bad id: %v", ErrInvalidCursor, err)
+	}
+	return &seq, time.Unix(0, ns).UTC(), id, nil
+}
+
+// EncodeSortCursor encodes the ordering key of a row listed by another column than created_at: the name
+// of the column, its value as an integer, unix nanoseconds for a time, then the id
+func EncodeSortCursor(sortBy string, key int64, id uuid.UUID) string {
+	raw := fmt.Sprintf("%s|%d|%s", sortBy, key, id.String())
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeSortCursor decodes a cursor of EncodeSortCursor. A cursor of EncodeCursor decodes with an empty
+// sortBy and its created_at in unix nanoseconds as key.
+func DecodeSortCursor(s string) (string, int64, uuid.UUID, error) {
+	if s == "" {
+		return "", 0, uuid.Nil, fmt.Errorf("%w: empty cursor", ErrInvalidCursor)
+	}
+	b, err := decodeBase64(s)
+	if err != nil {
+		return "", 0, uuid.Nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	parts := strings.Split(string(b), "|")
+	if len(parts) == 2 {
+		t, id, err := DecodeCursor(s)
+		return "", t.UnixNano(), id, err
+	}
+	if len(parts) != 3 || parts[0] == "" {
+		return "", 0, uuid.Nil, fmt.Errorf("%w: bad cursor", ErrInvalidCursor)
+	}
+
+	key, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, uuid.Nil, fmt.Errorf("%w: bad sort key: %v", ErrInvalidCursor, err)
+	}
+	id, err := uuid.Parse(parts[2])
+	if err != nil {
+		return "", 0, uuid.Nil, fmt.Errorf("%w: bad id: %v", ErrInvalidCursor, err)
+	}
+	return parts[0], key, id, nil
+}
+
+// decodeBase64 decodes a base64url cursor as produced by EncodeCursor. Cursors in the older standard
+// base64 alphabet are still accepted, padded or not, including ones whose '+' was unescaped to ' '
+// when embedded in a URL query.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		return b, nil
+	}
+	if b, stdErr := base64.RawStdEncoding.DecodeString(strings.ReplaceAll(s, " ", "+")); stdErr == nil {
+		return b, nil
+	}
+	return nil, err
+}
@@ -1,6 +1,8 @@
 package paging
 
 import (
+	"encoding/base64"
+	"fmt"
 	"testing"
 	"time"
 
@@ -103,7 +105,7 @@ func TestDecodeCursor(t *testing.T) {
 			decodedTime, decodedID, err := DecodeCursor(tt.cursor)
 
 			if tt.wantErr {
-				assert.Error(t, err)
+				assert.ErrorIs(t, err, ErrInvalidCursor)
 				if tt.errMsg != "" {
 					assert.Contains(t, err.Error(), tt.errMsg)
 				}
@@ -236,3 +238,128 @@ func TestCursor_URLSafe(t *testing.T) {
 		assert.NotContains(t, cursor, "=") // RawURLEncoding does not include padding characters
 	})
 }
+
+func TestDecodeCursor_LegacyStdEncoding(t *testing.T) {
+	testTime := time.Date(2024, 1, 1, 12, 0, 0, 123456789, time.UTC)
+	testID := uuid.MustParse("123e4567-e89b-12d3-a456-426614174000")
+	raw := []byte(fmt.Sprintf("%d|%s", testTime.UnixNano(), testID))
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "padded standard base64", cursor: base64.StdEncoding.EncodeToString(raw)},
+		{name: "unpadded standard base64", cursor: base64.RawStdEncoding.EncodeToString(raw)},
+		{name: "padded base64url", cursor: base64.URLEncoding.EncodeToString(raw)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decodedTime, decodedID, err := DecodeCursor(tt.cursor)
+			assert.NoError(t, err)
+			assert.Equal(t, testTime.UnixNano(), decodedTime.UnixNano())
+			assert.Equal(t, testID, decodedID)
+		})
+	}
+}
+
+func TestDecodeBase64_PlusAndSlash(t *testing.T) {
+	// 0xfb 0xef 0xff encodes to "++//" in standard base64 and "--__" in base64url
+	raw := []byte{0xfb, 0xef, 0xff}
+	std := base64.StdEncoding.EncodeToString(raw)
+	urlSafe := base64.RawURLEncoding.EncodeToString(raw)
+	assert.Equal(t, "++//", std)
+	assert.Equal(t, "--__", urlSafe)
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "base64url", encoded: urlSafe},
+		{name: "standard base64", encoded: std},
+		{name: "standard base64 with '+' unescaped to ' ' in a query", encoded: "  //"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := decodeBase64(tt.encoded)
+			assert.NoError(t, err)
+			assert.Equal(t, raw, b)
+		})
+	}
+
+	_, err := decodeBase64("-+_/")
+	assert.Error(t, err)
+}
+
+func TestMessageCursor(t *testing.T) {
+	testTime := time.Date(2024, 1, 1, 12, 0, 0, 123456789, time.UTC)
+	testID := uuid.MustParse("123e4567-e89b-12d3-a456-426614174000")
+
+	for _, seq := range []*int64{nil, ptr(int64(0)), ptr(int64(-3)), ptr(int64(1717171717000))} {
+		decodedSeq, decodedTime, decodedID, err := DecodeMessageCursor(EncodeMessageCursor(seq, testTime, testID))
+		assert.NoError(t, err)
+		assert.Equal(t, seq, decodedSeq)
+		assert.True(t, testTime.Equal(decodedTime))
+		assert.Equal(t, testID, decodedID)
+	}
+
+	t.Run("cursor without client_seq is a plain cursor", func(t *testing.T) {
+		assert.Equal(t, EncodeCursor(testTime, testID), EncodeMessageCursor(nil, testTime, testID))
+
+		seq, decodedTime, decodedID, err := DecodeMessageCursor(EncodeCursor(testTime, testID))
+		assert.NoError(t, err)
+		assert.Nil(t, seq)
+		assert.True(t, testTime.Equal(decodedTime))
+		assert.Equal(t, testID, decodedID)
+	})
+
+	for name, raw := range map[string]string{
+		"bad client_seq": "x|1|" + testID.String(),
+		"bad timestamp":  "1|x|" + testID.String(),
+		"bad id":         "1|1|x",
+		"empty seq":      "|1|" + testID.String(),
+		"too many parts": "1|1|1|" + testID.String(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, _, err := DecodeMessageCursor(base64.RawURLEncoding.EncodeToString([]byte(raw)))
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
+
+func TestSortCursor(t *testing.T) {
+	testID := uuid.MustParse("123e4567-e89b-12d3-a456-426614174000")
+
+	for _, key := range []int64{0, 42, -1, time.Date(2024, 1, 1, 12, 0, 0, 123456789, time.UTC).UnixNano()} {
+		sortBy, decodedKey, decodedID, err := DecodeSortCursor(EncodeSortCursor("message_count", key, testID))
+		assert.NoError(t, err)
+		assert.Equal(t, "message_count", sortBy)
+		assert.Equal(t, key, decodedKey)
+		assert.Equal(t, testID, decodedID)
+	}
+
+	t.Run("plain cursor has no sort column", func(t *testing.T) {
+		testTime := time.Date(2024, 1, 1, 12, 0, 0, 123456789, time.UTC)
+		sortBy, key, id, err := DecodeSortCursor(EncodeCursor(testTime, testID))
+		assert.NoError(t, err)
+		assert.Empty(t, sortBy)
+		assert.Equal(t, testTime.UnixNano(), key)
+		assert.Equal(t, testID, id)
+	})
+
+	for name, raw := range map[string]string{
+		"bad key":        "message_count|x|" + testID.String(),
+		"bad id":         "message_count|1|x",
+		"empty sort":     "|1|" + testID.String(),
+		"too many parts": "message_count|1|1|" + testID.String(),
+		"bad plain":      "x|" + testID.String(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, _, err := DecodeSortCursor(base64.RawURLEncoding.EncodeToString([]byte(raw)))
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,58 @@
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Header carries the request ID, on incoming requests, responses and calls to other services
+const Header = "X-Request-ID"
+
+// maxLen bounds the request IDs accepted from clients, longer ones are replaced
+const maxLen = 128
+
+type ctxKey struct{}
+
+// New returns a new random request ID
+func New() string {
+	return uuid.NewString()
+}
+
+// Valid reports whether a request ID sent by a client can be kept: non-empty, at most 128 characters
+// of letters, digits and -_.:, so that it is safe to log and to send on to other services
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WithID returns a copy of ctx carrying the request ID
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or "" if none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Logger returns log with the request ID carried by ctx as the request_id field, or log itself if ctx
+// carries none, so that what a service logs while serving a request can be matched with the request
+func Logger(ctx context.Context, log *zap.Logger) *zap.Logger {
+	if id := FromContext(ctx); id != "" {
+		return log.With(zap.String("request_id", id))
+	}
+	return log
+}
@@ -0,0 +1,47 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{id: New(), want: true},
+		{id: "req_01HZX.abc:1", want: true},
+		{id: "", want: false},
+		{id: strings.Repeat("a", 129), want: false},
+		{id: "abc def", want: false},
+		{id: "abc\r\nX-Injected: 1", want: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Valid(tt.id), tt.id)
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, FromContext(ctx))
+	assert.Equal(t, "req-1", FromContext(WithID(ctx, "req-1")))
+}
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	log := zap.New(core)
+
+	Logger(context.Background(), log).Info("without id")
+	Logger(WithID(context.Background(), "req-1"), log).Info("with id")
+
+	entries := logs.AllUntimed()
+	assert.Empty(t, entries[0].ContextMap())
+	assert.Equal(t, map[string]any{"request_id": "req-1"}, entries[1].ContextMap())
+}
@@ -0,0 +1,93 @@
+package strictquery
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// UnknownParamsError is returned by the strict bindings for query parameters the request struct doesn't declare
+type UnknownParamsError struct {
+	Params []string
+}
+
+func (e *UnknownParamsError) Error() string {
+	return "unknown query parameters: " + strings.Join(e.Params, ", ")
+}
+
+// Enable swaps gin's form and query bindings for strict ones, so ShouldBind and ShouldBindQuery
+// reject query parameters that the bound struct has no form field for.
+// It replaces package level bindings and should be called once at startup.
+func Enable() {
+	binding.Form = strictBinding{binding.Form}
+	binding.Query = strictBinding{binding.Query}
+}
+
+type strictBinding struct {
+	binding.Binding
+}
+
+func (b strictBinding) Bind(req *http.Request, obj any) error {
+	if unknown := UnknownParams(req.URL.Query(), obj); len(unknown) > 0 {
+		return &UnknownParamsError{Params: unknown}
+	}
+	return b.Binding.Bind(req, obj)
+}
+
+// UnknownParams returns the sorted keys of values that don't map to a form field of obj
+func UnknownParams(values url.Values, obj any) []string {
+	t := reflect.TypeOf(obj)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	known := map[string]bool{}
+	collectKeys(t, known)
+
+	var unknown []string
+	for key := range values {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// collectKeys gathers the form keys gin maps for t: the name in the form tag, or the field name
+// without one, descending into embedded and untagged struct fields the way gin does
+func collectKeys(t reflect.Type, known map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("form")
+		if tag == "-" {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if tag == "" && ft.Kind() == reflect.Struct && ft != timeType {
+			collectKeys(ft, known)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		known[name] = true
+	}
+}
@@ -0,0 +1,63 @@
+package strictquery
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type paging struct {
+	Limit  int    `form:"limit,default=20"`
+	Cursor string `form:"cursor"`
+}
+
+type listReq struct {
+	paging
+	Format  string `form:"format,default=openai"`
+	Ignored string `form:"-"`
+	NoTag   string
+}
+
+func TestUnknownParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "no params", query: ""},
+		{name: "known params", query: "format=anthropic&limit=10&cursor=abc"},
+		{name: "untagged field uses its name", query: "NoTag=1"},
+		{name: "typo", query: "fromat=openai", want: []string{"fromat"}},
+		{name: "ignored field", query: "Ignored=1&format=openai", want: []string{"Ignored"}},
+		{name: "several sorted", query: "z=1&a=2&limit=3", want: []string{"a", "z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, UnknownParams(values, &listReq{}))
+		})
+	}
+}
+
+func TestStrictBinding(t *testing.T) {
+	b := strictBinding{binding.Query}
+
+	req := httptest.NewRequest("GET", "/?format=gemini&limit=5", nil)
+	out := listReq{}
+	require.NoError(t, b.Bind(req, &out))
+	assert.Equal(t, "gemini", out.Format)
+	assert.Equal(t, 5, out.Limit)
+
+	req = httptest.NewRequest("GET", "/?fromat=gemini&limt=5", nil)
+	err := b.Bind(req, &listReq{})
+	var unknown *UnknownParamsError
+	require.True(t, errors.As(err, &unknown))
+	assert.Equal(t, []string{"fromat", "limt"}, unknown.Params)
+	assert.Equal(t, "unknown query parameters: fromat, limt", err.Error())
+}
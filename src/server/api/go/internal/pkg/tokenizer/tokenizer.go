@@ -6,12 +6,17 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/pkg/metrics"
 	"github.com/tiktoken-go/tokenizer"
 	"go.uber.org/zap"
 )
 
+// Encoding is the tiktoken encoding used to count tokens, shared by GPT-4o, GPT-4.1, O1, O3, etc.
+const Encoding = string(tokenizer.O200kBase)
+
 var (
 	// Global codec instance
 	codec   tokenizer.Codec
@@ -32,7 +37,7 @@ func Init(log *zap.Logger) error {
 		}
 
 		codec = enc
-		log.Info("Tokenizer initialized successfully", zap.String("encoding", "o200k_base"))
+		log.Info("Tokenizer initialized successfully", zap.String("encoding", Encoding))
 	})
 
 	return initErr
@@ -44,7 +49,9 @@ func CountTokens(text string) (int, error) {
 		return 0, fmt.Errorf("tokenizer not initialized, call Init() first")
 	}
 
+	start := time.Now()
 	count, err := codec.Count(text)
+	metrics.TokenizerDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
 		return 0, fmt.Errorf("failed to count tokens: %w", err)
 	}
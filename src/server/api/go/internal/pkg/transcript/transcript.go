@@ -0,0 +1,151 @@
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+)
+
+// Format is the output format of a transcript
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatText     Format = "text"
+)
+
+// Extension returns the file extension used for transcripts in the format
+func (f Format) Extension() string {
+	if f == FormatMarkdown {
+		return "md"
+	}
+	return "txt"
+}
+
+// ContentType returns the MIME type of transcripts in the format
+func (f Format) ContentType() string {
+	if f == FormatMarkdown {
+		return "text/markdown; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// WriteMessage renders one message followed by a blank line. Text parts are written as is,
+// tool calls and results as fenced code blocks, and media parts as links to their public url
+// looked up by asset SHA256 in publicURLs.
+func WriteMessage(w io.Writer, format Format, msg model.Message, publicURLs map[string]service.PublicURL) error {
+	role := msg.Role + ":"
+	if format == FormatMarkdown {
+		role = "**" + role + "**"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(role)
+	first := true
+	for _, p := range msg.Parts {
+		b := renderPart(format, p, publicURLs)
+		if b == "" {
+			continue
+		}
+		// inline a leading text part after the role, everything else starts its own paragraph
+		if first && p.Type == "text" {
+			sb.WriteString(" ")
+		} else {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(b)
+		first = false
+	}
+	sb.WriteString("\n\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func renderPart(format Format, p model.Part, publicURLs map[string]service.PublicURL) string {
+	switch p.Type {
+	case "text":
+		return p.Text
+	case "tool-call":
+		name, _ := p.Meta["name"].(string)
+		id, _ := p.Meta["id"].(string)
+		return labeled(format, "Tool call", name, id) + "\n" + fenced("json", toolArguments(p.Meta["arguments"]))
+	case "tool-result":
+		id, _ := p.Meta["tool_call_id"].(string)
+		return labeled(format, "Tool result", "", id) + "\n" + fenced("", p.Text)
+	case "data":
+		b, _ := json.MarshalIndent(p.Meta, "", "  ")
+		return fenced("json", string(b))
+	}
+
+	if p.Asset == nil {
+		return p.Text
+	}
+	label := strings.TrimSpace(p.Type + " " + p.Filename)
+	url := ""
+	if u, ok := publicURLs[p.Asset.SHA256]; ok {
+		url = u.URL
+	}
+	switch {
+	case format == FormatText:
+		return strings.TrimSpace(fmt.Sprintf("[%s] %s", label, url))
+	case url == "":
+		return "_" + label + "_"
+	case p.Type == "image":
+		return fmt.Sprintf("![%s](%s)", label, url)
+	default:
+		return fmt.Sprintf("[%s](%s)", label, url)
+	}
+}
+
+// labeled renders the line introducing a tool call or result, e.g. "Tool call `search` (call_1):"
+func labeled(format Format, label, name, id string) string {
+	var sb strings.Builder
+	sb.WriteString(label)
+	if name != "" {
+		if format == FormatMarkdown {
+			name = "`" + name + "`"
+		}
+		sb.WriteString(" " + name)
+	}
+	if id != "" {
+		sb.WriteString(" (" + id + ")")
+	}
+	sb.WriteString(":")
+	return sb.String()
+}
+
+// toolArguments returns the arguments of a tool call as JSON, they may be stored as a string or an object
+func toolArguments(args any) string {
+	switch v := args.(type) {
+	case nil:
+		return "{}"
+	case string:
+		return v
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
+
+// fenced wraps content in a code fence longer than any backtick run inside it
+func fenced(lang, content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fence + lang + "\n" + strings.TrimRight(content, "\n") + "\n" + fence
+}
@@ -0,0 +1,94 @@
+package transcript
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/memodb-io/Acontext/internal/modules/model"
+	"github.com/memodb-io/Acontext/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteMessage(t *testing.T) {
+	image := &model.Asset{SHA256: "abc", S3Key: "assets/abc.png"}
+	urls := map[string]service.PublicURL{"abc": {URL: "https://s3.example.com/abc.png"}}
+
+	tests := []struct {
+		name   string
+		format Format
+		msg    model.Message
+		want   string
+	}{
+		{
+			name:   "markdown text",
+			format: FormatMarkdown,
+			msg:    model.Message{Role: "user", Parts: []model.Part{{Type: "text", Text: "Hello"}}},
+			want:   "**user:** Hello\n\n",
+		},
+		{
+			name:   "plain text",
+			format: FormatText,
+			msg:    model.Message{Role: "user", Parts: []model.Part{{Type: "text", Text: "Hello"}, {Type: "text", Text: "again"}}},
+			want:   "user: Hello\n\nagain\n\n",
+		},
+		{
+			name:   "tool call",
+			format: FormatMarkdown,
+			msg: model.Message{Role: "assistant", Parts: []model.Part{
+				{Type: "text", Text: "Checking."},
+				{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "search", "arguments": `{"q":"go"}`}},
+			}},
+			want: "**assistant:** Checking.\n\nTool call `search` (call_1):\n```json\n{\"q\":\"go\"}\n```\n\n",
+		},
+		{
+			name:   "tool call with object arguments",
+			format: FormatText,
+			msg: model.Message{Role: "assistant", Parts: []model.Part{
+				{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "search", "arguments": map[string]any{"q": "go"}}},
+			}},
+			want: "assistant:\n\nTool call search (call_1):\n```json\n{\"q\":\"go\"}\n```\n\n",
+		},
+		{
+			name:   "tool result containing a fence",
+			format: FormatMarkdown,
+			msg: model.Message{Role: "user", Parts: []model.Part{
+				{Type: "tool-result", Text: "```go\nx\n```", Meta: map[string]any{"tool_call_id": "call_1"}},
+			}},
+			want: "**user:**\n\nTool result (call_1):\n````\n```go\nx\n```\n````\n\n",
+		},
+		{
+			name:   "markdown image",
+			format: FormatMarkdown,
+			msg:    model.Message{Role: "user", Parts: []model.Part{{Type: "image", Asset: image, Filename: "cat.png"}}},
+			want:   "**user:**\n\n![image cat.png](https://s3.example.com/abc.png)\n\n",
+		},
+		{
+			name:   "text image",
+			format: FormatText,
+			msg:    model.Message{Role: "user", Parts: []model.Part{{Type: "image", Asset: image}}},
+			want:   "user:\n\n[image] https://s3.example.com/abc.png\n\n",
+		},
+		{
+			name:   "file without url",
+			format: FormatMarkdown,
+			msg:    model.Message{Role: "user", Parts: []model.Part{{Type: "file", Asset: &model.Asset{SHA256: "missing"}, Filename: "a.pdf"}}},
+			want:   "**user:**\n\n_file a.pdf_\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			require.NoError(t, WriteMessage(&sb, tt.format, tt.msg, urls))
+			assert.Equal(t, tt.want, sb.String())
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "md", FormatMarkdown.Extension())
+	assert.Equal(t, "txt", FormatText.Extension())
+	assert.Equal(t, "text/markdown; charset=utf-8", FormatMarkdown.ContentType())
+	assert.Equal(t, "text/plain; charset=utf-8", FormatText.ContentType())
+}
@@ -3,6 +3,8 @@ package path
 import (
 	"errors"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var (
@@ -73,6 +75,46 @@ func SanitizePath(path string) string {
 	return cleanPath
 }
 
+// SanitizeFilename makes an uploaded filename safe to use as a local file name: it keeps the last
+// element of the name (dropping any directories, with / or \ as separator), removes control characters
+// and truncates it to maxBytes bytes, keeping the extension. A name left empty or made only of dots becomes "file".
+// maxBytes <= 0 disables truncation.
+func SanitizeFilename(name string, maxBytes int) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if strings.Trim(name, ".") == "" {
+		name = "file"
+	}
+
+	if maxBytes <= 0 || len(name) <= maxBytes {
+		return name
+	}
+	ext := ""
+	if i := strings.LastIndex(name, "."); i > 0 && len(name)-i <= maxBytes/2 {
+		ext = name[i:]
+	}
+	return truncateUTF8(strings.TrimSuffix(name, ext), maxBytes-len(ext)) + ext
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a multi-byte character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
 // GetDirectoriesFromPaths extracts unique directory names from a list of file paths
 // that are direct children of the given parent path
 func GetDirectoriesFromPaths(parentPath string, filePaths []string) []string {
@@ -297,6 +297,86 @@ func TestSanitizePath(t *testing.T) {
 	}
 }
 
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		maxBytes int
+		expected string
+	}{
+		{
+			name:     "clean filename",
+			input:    "report.pdf",
+			maxBytes: 255,
+			expected: "report.pdf",
+		},
+		{
+			name:     "unix directories are dropped",
+			input:    "../../etc/passwd",
+			maxBytes: 255,
+			expected: "passwd",
+		},
+		{
+			name:     "windows directories are dropped",
+			input:    `C:\fakepath\photo.png`,
+			maxBytes: 255,
+			expected: "photo.png",
+		},
+		{
+			name:     "control characters are removed",
+			input:    "re\x00port\r\n\x1b[31m.txt",
+			maxBytes: 255,
+			expected: "report[31m.txt",
+		},
+		{
+			name:     "dots only",
+			input:    "..",
+			maxBytes: 255,
+			expected: "file",
+		},
+		{
+			name:     "empty after trailing separator",
+			input:    "docs/",
+			maxBytes: 255,
+			expected: "file",
+		},
+		{
+			name:     "truncated keeping the extension",
+			input:    "abcdefghijklmnop.txt",
+			maxBytes: 10,
+			expected: "abcdef.txt",
+		},
+		{
+			name:     "truncated without splitting characters",
+			input:    "日本語のファイル.md",
+			maxBytes: 13,
+			expected: "日本語.md",
+		},
+		{
+			name:     "long extension is truncated with the name",
+			input:    "a.verylongextension",
+			maxBytes: 8,
+			expected: "a.verylo",
+		},
+		{
+			name:     "no limit",
+			input:    "abcdefghijklmnop.txt",
+			maxBytes: 0,
+			expected: "abcdefghijklmnop.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := SanitizeFilename(tt.input, tt.maxBytes)
+			assert.Equal(t, tt.expected, result)
+			if tt.maxBytes > 0 {
+				assert.LessOrEqual(t, len(result), tt.maxBytes)
+			}
+		})
+	}
+}
+
 func TestGetDirectoriesFromPaths(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 
@@ -11,7 +12,10 @@ import (
 	"github.com/memodb-io/Acontext/internal/config"
 	"github.com/memodb-io/Acontext/internal/middleware"
 	"github.com/memodb-io/Acontext/internal/modules/handler"
+	"github.com/memodb-io/Acontext/internal/modules/model"
 	"github.com/memodb-io/Acontext/internal/modules/serializer"
+	"github.com/memodb-io/Acontext/internal/pkg/metrics"
+	"github.com/memodb-io/Acontext/internal/pkg/strictquery"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -19,6 +23,7 @@ import (
 type RouterDeps struct {
 	Config          *config.Config
 	DB              *gorm.DB
+	Redis           *redis.Client
 	Log             *zap.Logger
 	SpaceHandler    *handler.SpaceHandler
 	BlockHandler    *handler.BlockHandler
@@ -27,13 +32,24 @@ type RouterDeps struct {
 	ArtifactHandler *handler.ArtifactHandler
 	TaskHandler     *handler.TaskHandler
 	ToolHandler     *handler.ToolHandler
+	ConvertHandler  *handler.ConvertHandler
+	AssetHandler    *handler.AssetHandler
+	APIKeyHandler   *handler.APIKeyHandler
+	APIKeyUsage     middleware.KeyUsageRecorder
+
+	LocalAssetHandler *handler.LocalAssetHandler
 }
 
 func NewRouter(d RouterDeps) *gin.Engine {
 	// Initialize logger for serializer package
 	serializer.SetLogger(d.Log)
 
+	if d.Config.App.StrictQueryParams {
+		strictquery.Enable()
+	}
+
 	r := gin.New()
+	r.MaxMultipartMemory = d.Config.Multipart.MaxMemoryBytes
 	r.Use(gin.Recovery())
 
 	// Add OpenTelemetry middleware if enabled (using configuration system)
@@ -42,12 +58,47 @@ func NewRouter(d RouterDeps) *gin.Engine {
 		// Add trace ID to response header
 		r.Use(middleware.TraceID())
 	}
+	r.Use(middleware.RequestID())
+
+	if d.Config.Metrics.Enabled {
+		r.Use(middleware.Metrics())
+	}
 
 	r.Use(middleware.ZapLogger(d.Log))
+	r.Use(middleware.CORS(d.Config.CORS, d.Config.App.Env))
+	r.Use(middleware.ConcurrencyLimit(d.Config.Concurrency))
+	r.Use(middleware.MultipartLimit(d.Config.Multipart, map[string]int64{
+		"/api/v1/session/:session_id/messages": d.Config.Message.MaxBodyBytes,
+	}))
+
+	if d.Config.Compression.Enabled {
+		r.Use(middleware.Compression(d.Config.Compression))
+	}
 
 	// health
 	r.GET("/health", func(c *gin.Context) { c.JSON(http.StatusOK, serializer.Response{Msg: "ok"}) })
 
+	// metrics, scraped with the metrics token
+	if d.Config.Metrics.Enabled {
+		r.GET("/metrics", middleware.StaticTokenAuth(d.Config.Metrics.Token), gin.WrapH(metrics.Handler()))
+	}
+
+	// internal routes, not behind project auth but the internal token
+	internal := r.Group("/internal")
+	{
+		// scan results are signed by the scanner instead of carrying the internal token
+		internal.POST("/assets/scan_result", d.AssetHandler.ScanResult)
+
+		authed := internal.Group("", middleware.StaticTokenAuth(d.Config.Internal.Token))
+		authed.GET("/stats/parts-cache", d.SessionHandler.GetPartsCacheStats)
+		authed.POST("/assets/gc", d.AssetHandler.GC)
+	}
+
+	// presigned URLs of the local storage backend, authorized by their signed token
+	if d.LocalAssetHandler.Enabled() {
+		r.GET("/local-assets/:sha256", d.LocalAssetHandler.GetLocalAsset)
+	}
+
 	// swagger
 	r.GET("/swagger", func(c *gin.Context) {
 		c.Redirect(http.StatusMovedPermanently, "/swagger/index.html")
@@ -56,7 +107,10 @@ func NewRouter(d RouterDeps) *gin.Engine {
 
 	v1 := r.Group("/api/v1")
 	{
-		v1.Use(middleware.ProjectAuth(d.Config, d.DB))
+		v1.Use(middleware.ProjectAuth(d.Config, d.DB, d.APIKeyUsage))
+		v1.Use(middleware.RateLimit(d.Config.RateLimit, d.Redis, d.Log))
+		// API keys with the read scope can only make GET requests
+		v1.Use(middleware.RequireScopeByMethod())
 
 		// ping endpoint
 		v1.GET("/ping", func(c *gin.Context) { c.JSON(http.StatusOK, serializer.Response{Msg: "pong"}) })
@@ -73,6 +127,7 @@ func NewRouter(d RouterDeps) *gin.Engine {
 			space.GET("/:space_id/configs", d.SpaceHandler.GetConfigs)
 
 			space.GET("/:space_id/experience_search", d.SpaceHandler.GetExperienceSearch)
+			space.GET("/:space_id/learning_status", d.SpaceHandler.GetLearningStatus)
 
 			space.GET("/:space_id/experience_confirmations", d.SpaceHandler.ListExperienceConfirmations)
 			space.PUT("/:space_id/experience_confirmations/:experience_id", d.SpaceHandler.ConfirmExperience)
@@ -91,24 +146,49 @@ func NewRouter(d RouterDeps) *gin.Engine {
 			}
 		}
 
+		v1.GET("/usage", d.SessionHandler.GetUsage)
+
+		assets := v1.Group("/assets")
+		{
+			assets.GET("", d.AssetHandler.ListAssets)
+			assets.GET("/:sha256", d.AssetHandler.GetAsset)
+			assets.DELETE("/:sha256", d.AssetHandler.DeleteAsset)
+		}
+
 		session := v1.Group("/session")
 		{
 			session.GET("", d.SessionHandler.GetSessions)
 			session.POST("", d.SessionHandler.CreateSession)
+			session.POST("/flush_batch", d.SessionHandler.SessionFlushBatch)
 			session.DELETE("/:session_id", d.SessionHandler.DeleteSession)
 
 			session.PUT("/:session_id/configs", d.SessionHandler.UpdateConfigs)
 			session.GET("/:session_id/configs", d.SessionHandler.GetConfigs)
 
+			session.GET("/:session_id/system_prompt", d.SessionHandler.GetSystemPrompt)
+			session.PUT("/:session_id/system_prompt", d.SessionHandler.UpdateSystemPrompt)
+			session.GET("/:session_id/assets", d.SessionHandler.GetAssets)
+			session.GET("/:session_id/assets/:sha256/references", d.SessionHandler.GetAssetReferences)
+			session.GET("/:session_id/export", d.SessionHandler.ExportMessages)
+
 			session.POST("/:session_id/connect_to_space", d.SessionHandler.ConnectToSpace)
+			session.POST("/:session_id/move_to_space", d.SessionHandler.MoveToSpace)
+			session.POST("/:session_id/disconnect_from_space", d.SessionHandler.DisconnectFromSpace)
 
 			session.POST("/:session_id/messages", d.SessionHandler.StoreMessage)
 			session.GET("/:session_id/messages", d.SessionHandler.GetMessages)
+			session.POST("/:session_id/cache/warm", d.SessionHandler.WarmPartsCache)
 
 			session.POST("/:session_id/flush", d.SessionHandler.SessionFlush)
 			session.GET("/:session_id/get_learning_status", d.SessionHandler.GetLearningStatus)
+			session.GET("/:session_id/learning_status/wait", d.SessionHandler.WaitLearningStatus)
 
 			session.GET("/:session_id/token_counts", d.SessionHandler.GetTokenCounts)
+			session.GET("/:session_id/estimated_cost", d.SessionHandler.GetEstimatedCost)
+			session.GET("/:session_id/fingerprint", d.SessionHandler.GetFingerprint)
+			session.GET("/:session_id/pending_tool_calls", d.SessionHandler.GetPendingToolCalls)
+			session.GET("/:session_id/replay_check", d.SessionHandler.GetReplayCheck)
+			session.GET("/:session_id/activity", d.SessionHandler.GetActivity)
 
 			session.GET("/:session_id/observing_status", d.SessionHandler.GetSessionObservingStatus)
 
@@ -118,6 +198,12 @@ func NewRouter(d RouterDeps) *gin.Engine {
 			}
 		}
 
+		project := v1.Group("/project")
+		{
+			project.GET("/feed", d.SessionHandler.GetFeed)
+			project.GET("/messages/search", d.SessionHandler.SearchMessages)
+		}
+
 		disk := v1.Group("/disk")
 		{
 			disk.GET("", d.DiskHandler.ListDisks)
@@ -139,6 +225,17 @@ func NewRouter(d RouterDeps) *gin.Engine {
 			tool.PUT("/name", d.ToolHandler.RenameToolName)
 			tool.GET("/name", d.ToolHandler.GetToolName)
 		}
+
+		v1.POST("/convert", d.ConvertHandler.Convert)
+		v1.POST("/validate/batch", d.ConvertHandler.ValidateBatch)
+
+		apiKeys := v1.Group("/api_keys", middleware.RequireScope(model.ScopeAdmin))
+		{
+			apiKeys.GET("", d.APIKeyHandler.ListAPIKeys)
+			apiKeys.POST("", d.APIKeyHandler.CreateAPIKey)
+			apiKeys.DELETE("/:key_id", d.APIKeyHandler.RevokeAPIKey)
+			apiKeys.POST("/:key_id/rotate", d.APIKeyHandler.RotateAPIKey)
+		}
 	}
 	return r
 }